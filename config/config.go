@@ -5,6 +5,7 @@ import (
 	"log"
 	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -62,6 +63,277 @@ func LoadConfig(path string) IConfig {
 				return f
 			}(),
 			gcpbucket: envMap["APP_GCP_BUCKET"],
+			//-------------------------------------------------------------  storage driver =-------------------------
+			storageDriver: func() string {
+				d := strings.ToLower(strings.TrimSpace(envMap["APP_STORAGE_DRIVER"]))
+				switch d {
+				case "": // ไม่ได้ตั้งค่าไว้ = ใช้ gcs เหมือนเดิม
+					return "gcs"
+				case "gcs", "local", "s3":
+					return d
+				default:
+					log.Fatalf("load StorageDriver failed: driver %q is not supported", d)
+				}
+				return ""
+			}(),
+			storageRoot: func() string {
+				if envMap["APP_STORAGE_ROOT"] == "" {
+					return "./asset/storage"
+				}
+				return envMap["APP_STORAGE_ROOT"]
+			}(),
+			storageUrl: strings.TrimSuffix(envMap["APP_STORAGE_URL"], "/"),
+			storagePrivatePrefix: func() string {
+				if envMap["APP_STORAGE_PRIVATE_PREFIX"] == "" {
+					return "private"
+				}
+				return strings.Trim(envMap["APP_STORAGE_PRIVATE_PREFIX"], "/")
+			}(),
+			//-------------------------------------------------------------  bucket (gcs | s3) =-------------------------
+			storageBucket: func() string {
+				if envMap["APP_STORAGE_BUCKET"] == "" {
+					return envMap["APP_GCP_BUCKET"] // config เดิม
+				}
+				return envMap["APP_STORAGE_BUCKET"]
+			}(),
+			storageEndpoint: func() string {
+				if envMap["APP_STORAGE_ENDPOINT"] == "" {
+					return "s3.amazonaws.com"
+				}
+				return envMap["APP_STORAGE_ENDPOINT"]
+			}(),
+			storageRegion:    envMap["APP_STORAGE_REGION"],
+			storageAccessKey: envMap["APP_STORAGE_ACCESS_KEY"],
+			storageSecretKey: envMap["APP_STORAGE_SECRET_KEY"],
+			//-------------------------------------------------------------  type bool =-------------------------
+			storagePathStyle: func() bool {
+				if envMap["APP_STORAGE_PATH_STYLE"] == "" {
+					return false
+				}
+				b, err := strconv.ParseBool(envMap["APP_STORAGE_PATH_STYLE"])
+				if err != nil {
+					log.Fatalf("load StoragePathStyle failed: %v", err)
+				}
+				return b
+			}(),
+			//-------------------------------------------------------------  image variants =-------------------------
+			// APP_IMAGE_VARIANTS=thumbnail:150,medium:600,large:1200   (ชื่อ:ขนาดด้านที่ยาวที่สุด px)
+			imageVariants: func() map[string]int {
+				raw := envMap["APP_IMAGE_VARIANTS"]
+				if raw == "" {
+					raw = "thumbnail:150,medium:600,large:1200"
+				}
+				variants := make(map[string]int)
+				for _, v := range strings.Split(raw, ",") {
+					name, size, ok := strings.Cut(strings.TrimSpace(v), ":")
+					if !ok || name == "" {
+						log.Fatalf("load ImageVariants failed: %q must be name:size", v)
+					}
+					px, err := strconv.Atoi(size)
+					if err != nil || px <= 0 {
+						log.Fatalf("load ImageVariants failed: size of %q is invalid", name)
+					}
+					variants[name] = px
+				}
+				return variants
+			}(),
+			imageMaxDimension: func() int {
+				if envMap["APP_IMAGE_MAX_DIMENSION"] == "" {
+					return 8000
+				}
+				d, err := strconv.Atoi(envMap["APP_IMAGE_MAX_DIMENSION"])
+				if err != nil {
+					log.Fatalf("load ImageMaxDimension failed: %v", err)
+				}
+				return d
+			}(),
+			imageMaxPixels: func() int {
+				if envMap["APP_IMAGE_MAX_PIXELS"] == "" {
+					return 40000000
+				}
+				p, err := strconv.Atoi(envMap["APP_IMAGE_MAX_PIXELS"])
+				if err != nil {
+					log.Fatalf("load ImageMaxPixels failed: %v", err)
+				}
+				return p
+			}(),
+			imageWebp: func() bool {
+				if envMap["APP_IMAGE_WEBP"] == "" {
+					return false
+				}
+				b, err := strconv.ParseBool(envMap["APP_IMAGE_WEBP"])
+				if err != nil {
+					log.Fatalf("load ImageWebp failed: %v", err)
+				}
+				return b
+			}(),
+			//-------------------------------------------------------------  resumable upload (tus) =-------------------------
+			uploadTmpDir: func() string {
+				if envMap["APP_UPLOAD_TMP_DIR"] == "" {
+					return "./asset/uploads"
+				}
+				return envMap["APP_UPLOAD_TMP_DIR"]
+			}(),
+			uploadMaxSize: func() int {
+				if envMap["APP_UPLOAD_MAX_SIZE"] == "" {
+					return 1073741824 // 1GB
+				}
+				s, err := strconv.Atoi(envMap["APP_UPLOAD_MAX_SIZE"])
+				if err != nil || s <= 0 {
+					log.Fatalf("load UploadMaxSize failed: %v", err)
+				}
+				return s
+			}(),
+			uploadExpires: func() time.Duration {
+				if envMap["APP_UPLOAD_EXPIRES"] == "" {
+					return 24 * time.Hour
+				}
+				t, err := strconv.Atoi(envMap["APP_UPLOAD_EXPIRES"])
+				if err != nil || t <= 0 {
+					log.Fatalf("load UploadExpires failed: %v", err)
+				}
+				return time.Duration(int64(t) * int64(math.Pow10(9)))
+			}(),
+			signedUrlExpires: func() time.Duration {
+				if envMap["APP_SIGNED_URL_EXPIRES"] == "" {
+					return 15 * time.Minute
+				}
+				t, err := strconv.Atoi(envMap["APP_SIGNED_URL_EXPIRES"])
+				if err != nil || t <= 0 {
+					log.Fatalf("load SignedUrlExpires failed: %v", err)
+				}
+				return time.Duration(int64(t) * int64(math.Pow10(9)))
+			}(),
+			//-------------------------------------------------------------  orphan files gc =-------------------------
+			// APP_GC_PREFIXES=images/products,private/transfer-slips   (prefix ใน bucket ที่ให้ gc ตรวจ)
+			gcPrefixes: func() []string {
+				raw := envMap["APP_GC_PREFIXES"]
+				if raw == "" {
+					private := strings.Trim(envMap["APP_STORAGE_PRIVATE_PREFIX"], "/")
+					if private == "" {
+						private = "private"
+					}
+					raw = "images/products," + private + "/transfer-slips"
+				}
+				prefixes := make([]string, 0)
+				for _, p := range strings.Split(raw, ",") {
+					p = strings.Trim(strings.TrimSpace(p), "/")
+					if p == "" {
+						log.Fatalf("load GcPrefixes failed: prefix must not be empty (gc ทั้ง bucket)")
+					}
+					prefixes = append(prefixes, p+"/")
+				}
+				return prefixes
+			}(),
+			gcGracePeriod: func() time.Duration {
+				if envMap["APP_GC_GRACE_PERIOD"] == "" {
+					return 24 * time.Hour
+				}
+				t, err := strconv.Atoi(envMap["APP_GC_GRACE_PERIOD"])
+				if err != nil || t <= 0 {
+					log.Fatalf("load GcGracePeriod failed: %v", err)
+				}
+				return time.Duration(int64(t) * int64(math.Pow10(9)))
+			}(),
+			gcInterval: func() time.Duration {
+				if envMap["APP_GC_INTERVAL"] == "" {
+					return time.Hour
+				}
+				t, err := strconv.Atoi(envMap["APP_GC_INTERVAL"])
+				if err != nil || t < 0 {
+					log.Fatalf("load GcInterval failed: %v", err)
+				}
+				return time.Duration(int64(t) * int64(math.Pow10(9)))
+			}(),
+			//-------------------------------------------------------------  outbox =-------------------------
+			outboxInterval: func() time.Duration {
+				if envMap["APP_OUTBOX_INTERVAL"] == "" {
+					return 10 * time.Second
+				}
+				t, err := strconv.Atoi(envMap["APP_OUTBOX_INTERVAL"])
+				if err != nil || t < 0 {
+					log.Fatalf("load OutboxInterval failed: %v", err)
+				}
+				return time.Duration(int64(t) * int64(math.Pow10(9)))
+			}(),
+			//-------------------------------------------------------------  trash (soft delete) =-------------------------
+			trashRetention: func() time.Duration {
+				if envMap["APP_TRASH_RETENTION"] == "" {
+					return 30 * 24 * time.Hour
+				}
+				t, err := strconv.Atoi(envMap["APP_TRASH_RETENTION"])
+				if err != nil || t <= 0 {
+					log.Fatalf("load TrashRetention failed: %v", err)
+				}
+				return time.Duration(int64(t) * int64(math.Pow10(9)))
+			}(),
+			trashInterval: func() time.Duration {
+				if envMap["APP_TRASH_INTERVAL"] == "" {
+					return time.Hour
+				}
+				t, err := strconv.Atoi(envMap["APP_TRASH_INTERVAL"])
+				if err != nil || t < 0 {
+					log.Fatalf("load TrashInterval failed: %v", err)
+				}
+				return time.Duration(int64(t) * int64(math.Pow10(9)))
+			}(),
+			//-------------------------------------------------------------  scheduled price =-------------------------
+			priceInterval: func() time.Duration {
+				if envMap["APP_PRICE_INTERVAL"] == "" {
+					return time.Minute
+				}
+				t, err := strconv.Atoi(envMap["APP_PRICE_INTERVAL"])
+				if err != nil || t < 0 {
+					log.Fatalf("load PriceInterval failed: %v", err)
+				}
+				return time.Duration(int64(t) * int64(math.Pow10(9)))
+			}(),
+			//-------------------------------------------------------------  malware scanner =-------------------------
+			scannerDriver: func() string {
+				d := strings.ToLower(strings.TrimSpace(envMap["APP_SCANNER_DRIVER"]))
+				switch d {
+				case "": // ไม่ได้ตั้งค่าไว้ = ไม่สแกน
+					return "none"
+				case "none", "clamav":
+					return d
+				default:
+					log.Fatalf("load ScannerDriver failed: driver %q is not supported", d)
+				}
+				return ""
+			}(),
+			// APP_SCANNER_ADDRESS=127.0.0.1:3310 (tcp) | unix:/var/run/clamav/clamd.ctl
+			scannerAddress: func() string {
+				if envMap["APP_SCANNER_ADDRESS"] == "" {
+					return "127.0.0.1:3310"
+				}
+				return envMap["APP_SCANNER_ADDRESS"]
+			}(),
+			scannerTimeout: func() time.Duration {
+				if envMap["APP_SCANNER_TIMEOUT"] == "" {
+					return 30 * time.Second
+				}
+				t, err := strconv.Atoi(envMap["APP_SCANNER_TIMEOUT"])
+				if err != nil || t <= 0 {
+					log.Fatalf("load ScannerTimeout failed: %v", err)
+				}
+				return time.Duration(int64(t) * int64(math.Pow10(9)))
+			}(),
+			quarantinePrefix: func() string {
+				if envMap["APP_SCANNER_QUARANTINE_PREFIX"] == "" {
+					return "quarantine"
+				}
+				return strings.Trim(envMap["APP_SCANNER_QUARANTINE_PREFIX"], "/")
+			}(),
+			storageUseSSL: func() bool {
+				if envMap["APP_STORAGE_USE_SSL"] == "" {
+					return true
+				}
+				b, err := strconv.ParseBool(envMap["APP_STORAGE_USE_SSL"])
+				if err != nil {
+					log.Fatalf("load StorageUseSSL failed: %v", err)
+				}
+				return b
+			}(),
 		},
 
 		db: &db{
@@ -134,17 +406,86 @@ type IAppConfig interface {
 	BodyLimit() int
 	FileLimit() int
 	Gcpbucket() string
+	StorageDriver() string           // gcs | local | s3
+	StorageRoot() string             // path ที่เก็บไฟล์ของ local driver
+	StorageUrl() string              // base url ที่ใช้สร้าง url ของไฟล์ (ว่าง = ให้ driver สร้างเอง)
+	StoragePrivatePrefix() string    // ไฟล์ใต้ prefix นี้ไม่ make public เด็ดขาด (เช่น สลิปโอนเงิน)
+	StorageBucket() string           // gcs | s3
+	StorageEndpoint() string         // s3 host:port เช่น s3.amazonaws.com, 127.0.0.1:9000 (minio)
+	StorageRegion() string           // s3
+	StoragePathStyle() bool          // s3 = true ใช้ endpoint/bucket/key (minio), false = bucket.endpoint/key
+	StorageUseSSL() bool             // s3 https
+	StorageAccessKey() string        // s3
+	StorageSecretKey() string        // s3
+	ImageVariants() map[string]int   // ชื่อ variant : ขนาด px
+	ImageWebp() bool                 // สร้าง variant .webp เพิ่ม
+	ImageMaxDimension() int          // px ด้านใดด้านหนึ่ง
+	ImageMaxPixels() int             // กว้าง x สูง  กัน decompression bomb
+	UploadTmpDir() string            // ที่พักไฟล์ที่ยัง upload (tus) ไม่เสร็จ
+	UploadMaxSize() int              // byte ขนาดไฟล์สูงสุดของ tus upload
+	UploadExpires() time.Duration    // tus upload ที่ค้างเกินเวลานี้จะถูกลบ
+	SignedUrlExpires() time.Duration // อายุของ signed url (PUT/GET ตรงไปที่ bucket)
+	GcPrefixes() []string            // prefix ที่ gc ตรวจหาไฟล์ที่ไม่มี product / order ใช้ (ลงท้ายด้วย /)
+	GcGracePeriod() time.Duration    // ไฟล์ใหม่กว่านี้ไม่นับเป็น orphan (อาจยัง upload ค้างอยู่)
+	GcInterval() time.Duration       // รอบของ gc เบื้องหลัง  0 = ปิด (สั่งผ่าน api อย่างเดียว)
+	OutboxInterval() time.Duration   // รอบของ worker ที่ทำ event ใน outbox (ลบไฟล์)  0 = ปิด
+	TrashRetention() time.Duration   // product / category ที่ถูกลบ (soft delete) อยู่ในถังขยะนานเท่านี้ก่อนลบจริง
+	TrashInterval() time.Duration    // รอบของ job ที่ลบของในถังขยะที่เกิน retention  0 = ปิด
+	PriceInterval() time.Duration    // รอบของ job ที่เปลี่ยนราคาตามตารางที่ตั้งไว้ (product_price_schedules)  0 = ปิด
+	ScannerDriver() string           // none | clamav
+	ScannerAddress() string          // clamd  host:port | unix:/path
+	ScannerTimeout() time.Duration   // เวลาสแกนสูงสุดต่อไฟล์
+	QuarantinePrefix() string        // ไฟล์ติดไวรัสถูกย้ายมาเก็บที่นี่ (private)
 }
 type app struct {
-	host         string
-	port         int
-	name         string
-	version      string
-	readTimeout  time.Duration
-	writeTimeout time.Duration //
-	bodyLimit    int           //byte
-	fileLimit    int           //byte
-	gcpbucket    string
+	host          string
+	port          int
+	name          string
+	version       string
+	readTimeout   time.Duration
+	writeTimeout  time.Duration //
+	bodyLimit     int           //byte
+	fileLimit     int           //byte
+	gcpbucket     string
+	storageDriver string
+	storageRoot   string
+	storageUrl    string
+
+	storagePrivatePrefix string
+
+	storageBucket    string
+	storageEndpoint  string
+	storageRegion    string
+	storagePathStyle bool
+	storageUseSSL    bool
+	storageAccessKey string
+	storageSecretKey string
+
+	imageVariants     map[string]int
+	imageWebp         bool
+	imageMaxDimension int
+	imageMaxPixels    int
+
+	uploadTmpDir  string
+	uploadMaxSize int //byte
+	uploadExpires time.Duration
+
+	signedUrlExpires time.Duration
+
+	gcPrefixes    []string
+	gcGracePeriod time.Duration
+	gcInterval    time.Duration
+
+	outboxInterval time.Duration
+
+	trashRetention time.Duration
+	trashInterval  time.Duration
+	priceInterval  time.Duration
+
+	scannerDriver    string
+	scannerAddress   string
+	scannerTimeout   time.Duration
+	quarantinePrefix string
 }
 
 func (c *config) App() IAppConfig { //ใช้ Pointer เพราะไม่ต้อง copy เร็วกว่า ดีกว่า copy struct
@@ -152,14 +493,44 @@ func (c *config) App() IAppConfig { //ใช้ Pointer เพราะไม่
 }
 
 // implement Functions
-func (a *app) Url() string                 { return fmt.Sprintf("%v:%v", a.host, a.port) } //host:port
-func (a *app) Name() string                { return a.name }
-func (a *app) Version() string             { return a.version }
-func (a *app) ReadTimeout() time.Duration  { return a.readTimeout }
-func (a *app) WriteTimeout() time.Duration { return a.writeTimeout }
-func (a *app) BodyLimit() int              { return a.bodyLimit }
-func (a *app) FileLimit() int              { return a.fileLimit }
-func (a *app) Gcpbucket() string           { return a.gcpbucket }
+func (a *app) Url() string                     { return fmt.Sprintf("%v:%v", a.host, a.port) } //host:port
+func (a *app) Name() string                    { return a.name }
+func (a *app) Version() string                 { return a.version }
+func (a *app) ReadTimeout() time.Duration      { return a.readTimeout }
+func (a *app) WriteTimeout() time.Duration     { return a.writeTimeout }
+func (a *app) BodyLimit() int                  { return a.bodyLimit }
+func (a *app) FileLimit() int                  { return a.fileLimit }
+func (a *app) Gcpbucket() string               { return a.gcpbucket }
+func (a *app) StorageDriver() string           { return a.storageDriver }
+func (a *app) StorageRoot() string             { return a.storageRoot }
+func (a *app) StorageUrl() string              { return a.storageUrl }
+func (a *app) StoragePrivatePrefix() string    { return a.storagePrivatePrefix }
+func (a *app) StorageBucket() string           { return a.storageBucket }
+func (a *app) StorageEndpoint() string         { return a.storageEndpoint }
+func (a *app) StorageRegion() string           { return a.storageRegion }
+func (a *app) StoragePathStyle() bool          { return a.storagePathStyle }
+func (a *app) StorageUseSSL() bool             { return a.storageUseSSL }
+func (a *app) StorageAccessKey() string        { return a.storageAccessKey }
+func (a *app) StorageSecretKey() string        { return a.storageSecretKey }
+func (a *app) ImageVariants() map[string]int   { return a.imageVariants }
+func (a *app) ImageWebp() bool                 { return a.imageWebp }
+func (a *app) ImageMaxDimension() int          { return a.imageMaxDimension }
+func (a *app) ImageMaxPixels() int             { return a.imageMaxPixels }
+func (a *app) UploadTmpDir() string            { return a.uploadTmpDir }
+func (a *app) UploadMaxSize() int              { return a.uploadMaxSize }
+func (a *app) UploadExpires() time.Duration    { return a.uploadExpires }
+func (a *app) SignedUrlExpires() time.Duration { return a.signedUrlExpires }
+func (a *app) GcPrefixes() []string            { return a.gcPrefixes }
+func (a *app) GcGracePeriod() time.Duration    { return a.gcGracePeriod }
+func (a *app) GcInterval() time.Duration       { return a.gcInterval }
+func (a *app) OutboxInterval() time.Duration   { return a.outboxInterval }
+func (a *app) TrashRetention() time.Duration   { return a.trashRetention }
+func (a *app) TrashInterval() time.Duration    { return a.trashInterval }
+func (a *app) PriceInterval() time.Duration    { return a.priceInterval }
+func (a *app) ScannerDriver() string           { return a.scannerDriver }
+func (a *app) ScannerAddress() string          { return a.scannerAddress }
+func (a *app) ScannerTimeout() time.Duration   { return a.scannerTimeout }
+func (a *app) QuarantinePrefix() string        { return a.quarantinePrefix }
 
 // ------------------------------------------ DB  -----------------------------------
 
@@ -1,10 +1,65 @@
 package appinfo
 
+import "errors"
+
+// ======================================= Error =============================================
+var (
+	ErrCategoryNotFound = errors.New("category is not found")
+	ErrCategoryCycle    = errors.New("category can not be moved under itself or its descendant")
+	ErrCategoryParent   = errors.New("parent category is in trash, restore it first")
+	ErrCategoryTitle    = errors.New("category title already exists in this parent")
+)
+
+// ======================================= Struct ============================================
+// Category 1 node ใน tree  (parent_id nil = root)
 type Category struct {
-	Id    int    `db:"id" json:"id"`
-	Title string `db:"title" json:"title"`
+	Id        int             `db:"id" json:"id"`
+	Title     string          `db:"title" json:"title"`
+	ParentId  *int            `db:"parent_id" json:"parent_id"`
+	Position  int             `db:"position" json:"position"`
+	Path      []*CategoryNode `db:"-" json:"path,omitempty"`                // breadcrumb root ---> category นี้ (ใน product)
+	Children  []*Category     `db:"-" json:"children,omitempty"`            // tree (/v1/appinfo/categories)
+	DeletedAt *string         `db:"deleted_at" json:"deleted_at,omitempty"` // ถังขยะ (/v1/appinfo/categories/trash)
+}
+
+// CategoryNode 1 ชั้นของ breadcrumb
+type CategoryNode struct {
+	Id    int    `json:"id"`
+	Title string `json:"title"`
 }
 
 type CategoryFilter struct {
 	Title string `query:"title"` //เพื่อรองรับ query params
 }
+
+// UpdateCategoryReq เปลี่ยนชื่อ
+type UpdateCategoryReq struct {
+	Id    int    `json:"-"`
+	Title string `json:"title"`
+}
+
+// MoveCategoryReq ย้ายไปอยู่ใต้ parent (nil = root) ที่ลำดับ position  (parent เดิม = จัดลำดับใหม่)
+type MoveCategoryReq struct {
+	Id       int  `json:"-"`
+	ParentId *int `json:"parent_id"`
+	Position int  `json:"position"`
+}
+
+// BuildCategoryTree ประกอบ tree จาก list (เรียง position แล้ว)  node ที่ไม่เจอ parent ใน list = root
+func BuildCategoryTree(categories []*Category) []*Category {
+	nodes := make(map[int]*Category, len(categories))
+	for _, c := range categories {
+		nodes[c.Id] = c
+	}
+
+	roots := make([]*Category, 0)
+	for _, c := range categories {
+		if c.ParentId != nil && nodes[*c.ParentId] != nil {
+			parent := nodes[*c.ParentId]
+			parent.Children = append(parent.Children, c)
+			continue
+		}
+		roots = append(roots, c)
+	}
+	return roots
+}
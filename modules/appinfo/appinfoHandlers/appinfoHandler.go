@@ -1,6 +1,8 @@
 package appinfoHandlers
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 
@@ -20,6 +22,11 @@ const (
 	findCategoryErr   appinfoHandlersErrCode = "appinfo-002"
 	AddCategoryErr    appinfoHandlersErrCode = "appinfo-003"
 	RemoveCategoryErr appinfoHandlersErrCode = "appinfo-004"
+	UpdateCategoryErr appinfoHandlersErrCode = "appinfo-005"
+	MoveCategoryErr   appinfoHandlersErrCode = "appinfo-006"
+	findTrashErr      appinfoHandlersErrCode = "appinfo-007"
+	restoreErr        appinfoHandlersErrCode = "appinfo-008"
+	purgeTrashErr     appinfoHandlersErrCode = "appinfo-009"
 )
 
 // ======================================= Interface =========================================
@@ -28,6 +35,11 @@ type IAppinfoHandler interface {
 	FindCategory(c *fiber.Ctx) error   // Find Category
 	AddCategory(c *fiber.Ctx) error    // Add Category
 	RemoveCategory(c *fiber.Ctx) error // Remove Category
+	UpdateCategory(c *fiber.Ctx) error // Rename Category
+	MoveCategory(c *fiber.Ctx) error   // Move / Reorder Category
+	FindTrashCategory(c *fiber.Ctx) error
+	RestoreCategory(c *fiber.Ctx) error
+	PurgeTrash(c *fiber.Ctx) error
 }
 
 // ======================================= Struct ============================================
@@ -119,6 +131,23 @@ func (h *appinfoHandler) AddCategory(c *fiber.Ctx) error {
 			"categories request are empty",
 		).Res()
 	}
+	for _, cat := range req {
+		cat.Title = strings.TrimSpace(cat.Title)
+		if cat.Title == "" {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(AddCategoryErr),
+				"category title is required",
+			).Res()
+		}
+		if cat.ParentId != nil && *cat.ParentId <= 0 {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(AddCategoryErr),
+				"parent_id must more than 0",
+			).Res()
+		}
+	}
 
 	//Use Add Category
 	if err := h.appinfoUsecase.InsertCategory(req); err != nil {
@@ -157,6 +186,13 @@ func (h *appinfoHandler) RemoveCategory(c *fiber.Ctx) error {
 
 	// Use Delete Category Process
 	if err := h.appinfoUsecase.DeleteCategory(categoryIdInt); err != nil {
+		if errors.Is(err, appinfo.ErrCategoryNotFound) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(RemoveCategoryErr),
+				err.Error(),
+			).Res()
+		}
 		return entities.NewErrorResponse(c).Error(
 			fiber.ErrInternalServerError.Code,
 			string(RemoveCategoryErr),
@@ -172,3 +208,196 @@ func (h *appinfoHandler) RemoveCategory(c *fiber.Ctx) error {
 		},
 	).Res()
 }
+
+// -------------------------------------- Update Category --------------------------------------
+// เปลี่ยนชื่อ
+func (h *appinfoHandler) UpdateCategory(c *fiber.Ctx) error {
+	categoryId, err := categoryIdParam(c)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(UpdateCategoryErr),
+			err.Error(),
+		).Res()
+	}
+
+	req := &appinfo.UpdateCategoryReq{Id: categoryId}
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(UpdateCategoryErr),
+			err.Error(),
+		).Res()
+	}
+	req.Id = categoryId
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(UpdateCategoryErr),
+			"category title is required",
+		).Res()
+	}
+
+	category, err := h.appinfoUsecase.UpdateCategory(req)
+	if err != nil {
+		if errors.Is(err, appinfo.ErrCategoryNotFound) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(UpdateCategoryErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(UpdateCategoryErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, category).Res()
+}
+
+// -------------------------------------- Move Category --------------------------------------
+// ย้ายไปอยู่ใต้ parent_id (null = root) ที่ลำดับ position  ส่ง parent เดิม = จัดลำดับใหม่
+func (h *appinfoHandler) MoveCategory(c *fiber.Ctx) error {
+	categoryId, err := categoryIdParam(c)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(MoveCategoryErr),
+			err.Error(),
+		).Res()
+	}
+
+	req := new(appinfo.MoveCategoryReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(MoveCategoryErr),
+			err.Error(),
+		).Res()
+	}
+	req.Id = categoryId
+	if req.ParentId != nil && *req.ParentId <= 0 {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(MoveCategoryErr),
+			"parent_id must more than 0",
+		).Res()
+	}
+	if req.Position < 0 {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(MoveCategoryErr),
+			"position must not be negative",
+		).Res()
+	}
+
+	category, err := h.appinfoUsecase.MoveCategory(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, appinfo.ErrCategoryNotFound):
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(MoveCategoryErr),
+				err.Error(),
+			).Res()
+		case errors.Is(err, appinfo.ErrCategoryCycle):
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(MoveCategoryErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(MoveCategoryErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, category).Res()
+}
+
+// -------------------------------------- Find Trash Category --------------------------------------
+// category ในถังขยะ (list ไม่ใช่ tree)
+func (h *appinfoHandler) FindTrashCategory(c *fiber.Ctx) error {
+	category, err := h.appinfoUsecase.FindTrashCategory()
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(findTrashErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, category).Res()
+}
+
+// -------------------------------------- Restore Category --------------------------------------
+// เอาออกจากถังขยะ  ต่อท้าย parent เดิม
+func (h *appinfoHandler) RestoreCategory(c *fiber.Ctx) error {
+	categoryId, err := categoryIdParam(c)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(restoreErr),
+			err.Error(),
+		).Res()
+	}
+
+	category, err := h.appinfoUsecase.RestoreCategory(categoryId)
+	if err != nil {
+		switch {
+		case errors.Is(err, appinfo.ErrCategoryNotFound):
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(restoreErr),
+				err.Error(),
+			).Res()
+		case errors.Is(err, appinfo.ErrCategoryParent), errors.Is(err, appinfo.ErrCategoryTitle):
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrConflict.Code,
+				string(restoreErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(restoreErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, category).Res()
+}
+
+// -------------------------------------- Purge Trash --------------------------------------
+// ลบจริงทันที  เฉพาะที่เกิน APP_TRASH_RETENTION
+func (h *appinfoHandler) PurgeTrash(c *fiber.Ctx) error {
+	count, err := h.appinfoUsecase.PurgeTrash()
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(purgeTrashErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(
+		fiber.StatusOK,
+		&struct {
+			Purged int `json:"purged"`
+		}{
+			Purged: count,
+		},
+	).Res()
+}
+
+// categoryIdParam :category_id ต้องเป็นตัวเลขมากกว่า 0
+func categoryIdParam(c *fiber.Ctx) (int, error) {
+	categoryId, err := strconv.Atoi(strings.Trim(c.Params("category_id"), " "))
+	if err != nil {
+		return 0, fmt.Errorf("id type is invalid")
+	}
+	if categoryId <= 0 {
+		return 0, fmt.Errorf("id must more than 0")
+	}
+	return categoryId, nil
+}
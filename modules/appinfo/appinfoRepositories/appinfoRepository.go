@@ -2,8 +2,11 @@ package appinfoRepositories
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/PHURINTOR/phurinshop/modules/appinfo"
 	"github.com/jmoiron/sqlx"
@@ -14,6 +17,11 @@ type IAppinfoRepository interface {
 	FindCategory(req *appinfo.CategoryFilter) ([]*appinfo.Category, error) // Find Category
 	InsertCategory(req []*appinfo.Category) error                          // Insert Category
 	DeleteCategory(categoryId int) error                                   // Delete Category
+	UpdateCategory(req *appinfo.UpdateCategoryReq) (*appinfo.Category, error)
+	MoveCategory(req *appinfo.MoveCategoryReq) (*appinfo.Category, error)
+	FindTrashCategory() ([]*appinfo.Category, error)
+	RestoreCategory(categoryId int) (*appinfo.Category, error)
+	PurgeCategories(retention time.Duration) (int, error)
 }
 
 // ======================================= Struct ============================================
@@ -31,22 +39,52 @@ func AppinfoRepository(db *sqlx.DB) IAppinfoRepository {
 // =======================================Missing Function =======================================
 
 // -------------------------------------- Find Category -------------------------------------
+// ทุก node เรียงตาม position  (ค้นหา title = node ที่เจอ + parent ทุกชั้นขึ้นไปถึง root  เพื่อให้ประกอบ tree ได้)
+// ไม่รวม category ในถังขยะ
 func (r *appinfoRepository) FindCategory(req *appinfo.CategoryFilter) ([]*appinfo.Category, error) {
 	query := `
 	SELECT
 		"id",
-		"title"
+		"title",
+		"parent_id",
+		"position"
 	FROM "categories"
+	WHERE "deleted_at" IS NULL
 	`
 	//Concat String
 	filterValues := make([]any, 0) //เพราะ selectรับเป็น interface เลยสร้างแบบ any ดีกว่า
 	if req.Title != "" {
-		query += `
-		WHERE (LOWER("title") LIKE $1)`
+		query = `
+	WITH RECURSIVE "t" AS (
+		SELECT
+			"id",
+			"title",
+			"parent_id",
+			"position"
+		FROM "categories"
+		WHERE (LOWER("title") LIKE $1)
+			AND "deleted_at" IS NULL
+		UNION
+		SELECT
+			"c"."id",
+			"c"."title",
+			"c"."parent_id",
+			"c"."position"
+		FROM "categories" "c"
+			JOIN "t" ON "t"."parent_id" = "c"."id"
+		WHERE "c"."deleted_at" IS NULL
+	)
+	SELECT
+		"id",
+		"title",
+		"parent_id",
+		"position"
+	FROM "t"
+	`
 
 		filterValues = append(filterValues, "%"+strings.ToLower(req.Title)+"%") //เพิ่มเข้าไปด้านหน้า
 	}
-	query += ";"
+	query += `ORDER BY "position", "id";`
 
 	category := make([]*appinfo.Category, 0)
 	if err := r.db.Select(&category, query, filterValues...); err != nil {
@@ -57,73 +95,432 @@ func (r *appinfoRepository) FindCategory(req *appinfo.CategoryFilter) ([]*appinf
 }
 
 // -------------------------------------- Insert Category -------------------------------------
+// category ใหม่ต่อท้าย parent ของตัวเอง (position = ท้ายสุด)  parent ต้องไม่อยู่ในถังขยะ
 func (r *appinfoRepository) InsertCategory(req []*appinfo.Category) error { //array pointer จะส่งข้อมูลหากมี error กลับมาจะได้สะดวกเพราะว่าเป็น Pointer ของตัวแปร
 	/*Note :  *[]  = pointer to array    pointer ตัวหนึ่ง *  ชี้ไปหา Array ก้อนหนึ่ง
 	  []* = array of pointer    array ก้อนหนึ่ง เก็บ pointer ไว้หลายๆ ตัว
 	*/
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
 
-	//**************** ที่ต้อง Insert หลายๆ ค่าเพราะ รับตัวแปรมาจาก URL หลายๆ ตัว
+	query := `
+	INSERT INTO "categories" (
+		"title",
+		"parent_id",
+		"position"
+	)
+	VALUES (
+		$1,
+		$2::INT,
+		(
+			SELECT
+				COALESCE(MAX("position") + 1, 0)
+			FROM "categories"
+			WHERE "parent_id" IS NOT DISTINCT FROM $2::INT
+				AND "deleted_at" IS NULL
+		)
+	)
+	RETURNING "id", "position";`
 
-	ctx := context.Background()
-	query := `INSERT INTO "categories" ("title") VALUES`
 	//insert แบบ transection คือถ้าไม่สำเร็จ จะ Rollbackใหม่
 	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	if err := lockCategories(ctx, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, cat := range req {
+		if cat.ParentId != nil {
+			if _, err := findCategory(ctx, tx, *cat.ParentId); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("parent %w", err)
+			}
+		}
+		if err := tx.QueryRowxContext(ctx, query, cat.Title, cat.ParentId).Scan(&cat.Id, &cat.Position); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("insert category %s failed: %v", cat.Title, err)
+		}
+	}
+
+	//insert ok = Commit
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// -------------------------------------- Delete Category -------------------------------------
+// ย้ายลงถังขยะ (soft delete) ทั้ง subtree  ลูกหลานยังอยู่ใต้ parent เดิม  deleted_at เดียวกัน (now() ของ transaction) = ลบพร้อมกัน
+// กู้คืนแล้วได้ tree เดิมกลับมาทั้งก้อน   product ที่อยู่ใน category นี้ไม่ถูกลบ  แค่ไม่เห็น category จนกว่าจะกู้คืน
+func (r *appinfoRepository) DeleteCategory(categoryId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := lockCategories(ctx, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	category, err := findCategory(ctx, tx, categoryId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// ลูกหลานที่ลบไปก่อนแล้วเก็บ deleted_at เดิม  (กู้ตัวนี้แล้วไม่กลับมาด้วย)
+	query := `
+	WITH RECURSIVE "d" AS (
+		SELECT
+			"id"
+		FROM "categories"
+		WHERE "id" = $1
+		UNION
+		SELECT
+			"c"."id"
+		FROM "categories" "c"
+			JOIN "d" ON "c"."parent_id" = "d"."id"
+		WHERE "c"."deleted_at" IS NULL
+	)
+	UPDATE "categories" SET
+		"deleted_at" = now()
+	WHERE "id" IN (SELECT "id" FROM "d");`
+	if _, err := tx.ExecContext(ctx, query, categoryId); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("delete categories failed: %v", err)
+	}
+
+	// ปิดช่อง position ของ parent เดิม
+	siblings, err := findSiblings(ctx, tx, category.ParentId, categoryId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := sortCategories(ctx, tx, category.ParentId, siblings); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-	valuesStack := make([]any, 0) //ตัวแปรที่เป็น  Array
+	return tx.Commit()
+}
 
-	for i, cat := range req { //ต้อง insert ตาม Value string ข้างบน  ตามจำนวน | SQL String ===> valuesStack(any array)
-		valuesStack = append(valuesStack, cat.Title)
+// -------------------------------------- Update Category -------------------------------------
+func (r *appinfoRepository) UpdateCategory(req *appinfo.UpdateCategoryReq) (*appinfo.Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
 
-		if i != len(req)-1 {
-			query += fmt.Sprintf(`($%d),`, i+1) // multi value sql String
-		} else {
-			//query += fmt.Sprintf(`($%d);`, i+1) // ;last value sql String
+	query := `
+	UPDATE "categories" SET
+		"title" = $1
+	WHERE "id" = $2
+		AND "deleted_at" IS NULL
+	RETURNING "id", "title", "parent_id", "position";`
 
-			query += fmt.Sprintf(`($%d)`, i+1) // อยากให้ insert แล้ว return ID
+	category := new(appinfo.Category)
+	if err := r.db.GetContext(ctx, category, query, req.Title, req.Id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, appinfo.ErrCategoryNotFound
 		}
+		return nil, fmt.Errorf("update category failed: %v", err)
 	}
+	return category, nil
+}
 
-	query += `
-	RETURNING "id";`
+// -------------------------------------- Move Category -------------------------------------
+// parent ใหม่ต้องไม่ใช่ตัวเอง / ลูกหลาน ---> เรียง parent เดิมใหม่ (ไม่มีตัวเอง) ---> แทรกตัวเองใน parent ใหม่ที่ position
+// lock ทั้งตาราง  ย้ายพร้อมกัน 2 ตัวแล้วเกิด cycle ไม่ได้
+func (r *appinfoRepository) MoveCategory(req *appinfo.MoveCategoryReq) (*appinfo.Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
 
-	//------------------- Insert Part
-	/* Note: =====
-	QueryRowxContext(ctx, query, valuesStack...).StructScan()   = SCAN Stuct ได้
-	QueryRowContext(ctx, query, valuesStack...).Scan()			= SCAN String ธรรมดา
-	*/
-	rows, err := tx.QueryxContext(ctx, query, valuesStack...)
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockCategories(ctx, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	category, err := findCategory(ctx, tx, req.Id)
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("insert categories failed: %v", err)
+		return nil, err
 	}
 
-	var i int
-	for rows.Next() { //Disign pattern loop
-		if err := rows.Scan(&req[i].Id); err != nil {
-			return fmt.Errorf("scan categories id failed: %v", err)
+	if req.ParentId != nil {
+		var isDescendant bool
+		if err := tx.GetContext(ctx, &isDescendant, `
+		WITH RECURSIVE "d" AS (
+			SELECT
+				"id"
+			FROM "categories"
+			WHERE "id" = $1
+			UNION
+			SELECT
+				"c"."id"
+			FROM "categories" "c"
+				JOIN "d" ON "c"."parent_id" = "d"."id"
+		)
+		SELECT EXISTS (SELECT 1 FROM "d" WHERE "id" = $2);`, req.Id, *req.ParentId); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("check category descendants failed: %v", err)
+		}
+		if isDescendant {
+			tx.Rollback()
+			return nil, appinfo.ErrCategoryCycle
+		}
+		if _, err := findCategory(ctx, tx, *req.ParentId); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("parent %w", err)
 		}
-		i++
 	}
 
-	//insert ok = Commit
+	// parent เดิม
+	oldSiblings, err := findSiblings(ctx, tx, category.ParentId, req.Id)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := sortCategories(ctx, tx, category.ParentId, oldSiblings); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// parent ใหม่
+	siblings, err := findSiblings(ctx, tx, req.ParentId, req.Id)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	position := min(max(req.Position, 0), len(siblings))
+	ids := make([]int, 0, len(siblings)+1)
+	ids = append(ids, siblings[:position]...)
+	ids = append(ids, req.Id)
+	ids = append(ids, siblings[position:]...)
+	if err := sortCategories(ctx, tx, req.ParentId, ids); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	category, err = findCategory(ctx, tx, req.Id)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
 	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// -------------------------------------- Find Trash Category -------------------------------------
+// category ในถังขยะ  ลบล่าสุดขึ้นก่อน
+func (r *appinfoRepository) FindTrashCategory() ([]*appinfo.Category, error) {
+	query := `
+	SELECT
+		"id",
+		"title",
+		"parent_id",
+		"position",
+		"deleted_at"
+	FROM "categories"
+	WHERE "deleted_at" IS NOT NULL
+	ORDER BY "deleted_at" DESC, "id";`
+
+	category := make([]*appinfo.Category, 0)
+	if err := r.db.Select(&category, query); err != nil {
+		return nil, fmt.Errorf("select trash categories failed: %v", err)
+	}
+	return category, nil
+}
+
+// -------------------------------------- Restore Category -------------------------------------
+// กลับไปต่อท้าย parent เดิม (parent ถูก purge ไปแล้ว = root)  parent ยังอยู่ในถังขยะ = กู้ parent ก่อน
+// ลูกหลานที่ถูกลบไปพร้อมกัน (deleted_at เดียวกัน) กลับมาด้วยที่ position เดิม
+func (r *appinfoRepository) RestoreCategory(categoryId int) (*appinfo.Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockCategories(ctx, tx); err != nil {
 		tx.Rollback()
-		return err
+		return nil, err
+	}
+
+	category := new(appinfo.Category)
+	if err := tx.GetContext(ctx, category, `
+	SELECT
+		"id",
+		"title",
+		"parent_id",
+		"position",
+		"deleted_at"::TEXT
+	FROM "categories"
+	WHERE "id" = $1
+		AND "deleted_at" IS NOT NULL;`, categoryId); err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w in trash: %d", appinfo.ErrCategoryNotFound, categoryId)
+		}
+		return nil, fmt.Errorf("get category failed: %v", err)
+	}
+	if category.ParentId != nil {
+		if _, err := findCategory(ctx, tx, *category.ParentId); err != nil {
+			tx.Rollback()
+			if errors.Is(err, appinfo.ErrCategoryNotFound) {
+				return nil, appinfo.ErrCategoryParent
+			}
+			return nil, err
+		}
+	}
+
+	siblings, err := findSiblings(ctx, tx, category.ParentId, categoryId)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// ชื่อซ้ำกับ category ที่สร้างใหม่ระหว่างอยู่ในถังขยะ = ไม่กู้คืน  (lock ทั้งตารางอยู่ ไม่มีใครสร้างแทรกได้)
+	// ลูกหลานไม่ต้องเช็ค  parent อยู่ในถังขยะ สร้าง category ใต้มันไม่ได้
+	var duplicated bool
+	if err := tx.GetContext(ctx, &duplicated, `
+	SELECT EXISTS (
+		SELECT 1
+		FROM "categories"
+		WHERE "parent_id" IS NOT DISTINCT FROM $1::INT
+			AND "title" = $2
+			AND "deleted_at" IS NULL
+	);`, category.ParentId, category.Title); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("check category title failed: %v", err)
+	}
+	if duplicated {
+		tx.Rollback()
+		return nil, fmt.Errorf("%w: %s", appinfo.ErrCategoryTitle, category.Title)
 	}
 
+	if _, err := tx.ExecContext(ctx, `
+	WITH RECURSIVE "d" AS (
+		SELECT
+			"id"
+		FROM "categories"
+		WHERE "id" = $1
+		UNION
+		SELECT
+			"c"."id"
+		FROM "categories" "c"
+			JOIN "d" ON "c"."parent_id" = "d"."id"
+		WHERE "c"."deleted_at"::TEXT = $2
+	)
+	UPDATE "categories" SET
+		"deleted_at" = NULL
+	WHERE "id" IN (SELECT "id" FROM "d");`, categoryId, *category.DeletedAt); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("restore category failed: %v", err)
+	}
+	if err := sortCategories(ctx, tx, category.ParentId, append(siblings, categoryId)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	category, err = findCategory(ctx, tx, categoryId)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// -------------------------------------- Purge Categories -------------------------------------
+// ลบจริง category ที่อยู่ในถังขยะเกิน retention  (products_categories ลบตาม ON DELETE CASCADE)
+func (r *appinfoRepository) PurgeCategories(retention time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+	DELETE FROM "categories"
+	WHERE "deleted_at" < now() - make_interval(secs => $1);`, retention.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("purge categories failed: %v", err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// ======================================= Helper =======================================
+// lockCategories แก้ tree ได้ทีละ transaction  (อ่านได้ตามปกติ)
+func lockCategories(ctx context.Context, tx *sqlx.Tx) error {
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE "categories" IN SHARE ROW EXCLUSIVE MODE;`); err != nil {
+		return fmt.Errorf("lock categories failed: %v", err)
+	}
 	return nil
 }
 
-// -------------------------------------- Delete Category -------------------------------------
-func (r *appinfoRepository) DeleteCategory(categoryId int) error {
-	ctx := context.Background()
-	query := `DELETE FROM "categories" WHERE "id" = $1;`
+// findCategory category ที่ใช้งานอยู่  (อยู่ในถังขยะ = not found)
+func findCategory(ctx context.Context, tx *sqlx.Tx, categoryId int) (*appinfo.Category, error) {
+	category := new(appinfo.Category)
+	if err := tx.GetContext(ctx, category, `
+	SELECT
+		"id",
+		"title",
+		"parent_id",
+		"position"
+	FROM "categories"
+	WHERE "id" = $1
+		AND "deleted_at" IS NULL;`, categoryId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %d", appinfo.ErrCategoryNotFound, categoryId)
+		}
+		return nil, fmt.Errorf("get category failed: %v", err)
+	}
+	return category, nil
+}
 
-	if _, err := r.db.ExecContext(ctx, query, categoryId); err != nil {
-		return fmt.Errorf("delete categories failed: %v", err)
+// findSiblings id ของ category ใต้ parent (nil = root) เรียงตาม position  ไม่รวม exceptId
+func findSiblings(ctx context.Context, tx *sqlx.Tx, parentId *int, exceptId int) ([]int, error) {
+	ids := make([]int, 0)
+	if err := tx.SelectContext(ctx, &ids, `
+	SELECT
+		"id"
+	FROM "categories"
+	WHERE "parent_id" IS NOT DISTINCT FROM $1::INT
+		AND "id" <> $2
+		AND "deleted_at" IS NULL
+	ORDER BY "position", "id";`, parentId, exceptId); err != nil {
+		return nil, fmt.Errorf("get categories failed: %v", err)
+	}
+	return ids, nil
+}
+
+// sortCategories ย้าย ids ไปอยู่ใต้ parent  position = ลำดับใน ids (0, 1, 2, ...)
+func sortCategories(ctx context.Context, tx *sqlx.Tx, parentId *int, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+	UPDATE "categories" SET
+		"parent_id" = $1::INT,
+		"position" = "o"."ord" - 1
+	FROM UNNEST($2::INT[]) WITH ORDINALITY AS "o"("id", "ord")
+	WHERE "categories"."id" = "o"."id";`, parentId, ids); err != nil {
+		return fmt.Errorf("sort categories failed: %v", err)
 	}
 	return nil
 }
@@ -1,6 +1,10 @@
 package appinfoUsecases
 
 import (
+	"log"
+	"time"
+
+	"github.com/PHURINTOR/phurinshop/config"
 	"github.com/PHURINTOR/phurinshop/modules/appinfo"
 	appinfoRepositories "github.com/PHURINTOR/phurinshop/modules/appinfo/appinfoRepositories"
 )
@@ -10,16 +14,23 @@ type IAppinfoUsecase interface {
 	FindCategory(req *appinfo.CategoryFilter) ([]*appinfo.Category, error)
 	InsertCategory(req []*appinfo.Category) error
 	DeleteCategory(categoryId int) error // Delete Category
+	UpdateCategory(req *appinfo.UpdateCategoryReq) (*appinfo.Category, error)
+	MoveCategory(req *appinfo.MoveCategoryReq) (*appinfo.Category, error)
+	FindTrashCategory() ([]*appinfo.Category, error)
+	RestoreCategory(categoryId int) (*appinfo.Category, error)
+	PurgeTrash() (int, error)
 }
 
 // ======================================= Struct ============================================
 type appinfoUsecase struct {
+	cfg               config.IConfig
 	appinfoRepository appinfoRepositories.IAppinfoRepository
 }
 
 // ======================================= Constructor =======================================
-func AppinfoUsecase(appinfoRepository appinfoRepositories.IAppinfoRepository) IAppinfoUsecase {
+func AppinfoUsecase(cfg config.IConfig, appinfoRepository appinfoRepositories.IAppinfoRepository) IAppinfoUsecase {
 	return &appinfoUsecase{
+		cfg:               cfg,
 		appinfoRepository: appinfoRepository,
 	}
 }
@@ -27,12 +38,13 @@ func AppinfoUsecase(appinfoRepository appinfoRepositories.IAppinfoRepository) IA
 // =======================================Missing Function =======================================
 
 // -------------------------------------- Find Category -------------------------------------
+// ตอบเป็น tree (children)
 func (u *appinfoUsecase) FindCategory(req *appinfo.CategoryFilter) ([]*appinfo.Category, error) {
 	category, err := u.appinfoRepository.FindCategory(req)
 	if err != nil {
 		return nil, err
 	}
-	return category, nil
+	return appinfo.BuildCategoryTree(category), nil
 }
 
 // -------------------------------------- Insert Category -------------------------------------
@@ -48,3 +60,51 @@ func (u *appinfoUsecase) DeleteCategory(categoryId int) error {
 	}
 	return nil
 }
+
+// -------------------------------------- Update Category -------------------------------------
+func (u *appinfoUsecase) UpdateCategory(req *appinfo.UpdateCategoryReq) (*appinfo.Category, error) {
+	return u.appinfoRepository.UpdateCategory(req)
+}
+
+// -------------------------------------- Move Category -------------------------------------
+func (u *appinfoUsecase) MoveCategory(req *appinfo.MoveCategoryReq) (*appinfo.Category, error) {
+	return u.appinfoRepository.MoveCategory(req)
+}
+
+// -------------------------------------- Find Trash Category -------------------------------------
+func (u *appinfoUsecase) FindTrashCategory() ([]*appinfo.Category, error) {
+	return u.appinfoRepository.FindTrashCategory()
+}
+
+// -------------------------------------- Restore Category -------------------------------------
+func (u *appinfoUsecase) RestoreCategory(categoryId int) (*appinfo.Category, error) {
+	return u.appinfoRepository.RestoreCategory(categoryId)
+}
+
+// -------------------------------------- Purge Trash -------------------------------------
+// ลบจริง category ในถังขยะที่เกิน APP_TRASH_RETENTION
+func (u *appinfoUsecase) PurgeTrash() (int, error) {
+	return u.appinfoRepository.PurgeCategories(u.cfg.App().TrashRetention())
+}
+
+// StartTrashPurger ลบ category ในถังขยะที่เกิน retention ทุก APP_TRASH_INTERVAL
+func StartTrashPurger(usecase IAppinfoUsecase, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			count, err := usecase.PurgeTrash()
+			if err != nil {
+				log.Printf("purge categories trash failed: %v\n", err)
+				continue
+			}
+			if count > 0 {
+				log.Printf("purge categories trash: %d\n", count)
+			}
+		}
+	}()
+}
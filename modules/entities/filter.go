@@ -1,14 +1,73 @@
 package entities
 
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
 // ---------------------  จำกัดจำนวนตอน query find Product
 type PaginationReq struct {
-	Page      int `query:"page"`
-	Limit     int `query:"limit"`
-	TotalPage int `query:"total_page" json:"total_page"`
-	TotalItem int `query:"total_item" json:"total_item"`
+	Page      int     `query:"page"`
+	Limit     int     `query:"limit"`
+	TotalPage int     `query:"total_page" json:"total_page"`
+	TotalItem int     `query:"total_item" json:"total_item"`
+	Cursor    string  `query:"cursor"` // keyset  ?cursor (ว่าง) = หน้าแรก, ?cursor=<next_cursor|prev_cursor>
+	Keyset    *Cursor `query:"-"`      // decode จาก Cursor ใน handler  nil = ใช้ page/limit
 }
 
 type SortReq struct {
 	OrderBy string `query:"order_by"`
 	Sort    string `query:"sort"` // DESC | ASC
 }
+
+// ---------------------  Keyset (cursor) pagination
+// ----------Flow
+//    หน้าแรก (Value, Id ว่าง) ---> WHERE ตาม filter ---> ORDER BY key, id ---> LIMIT limit+1 (แถวเกิน = มีหน้าถัดไป)
+//    next : (key, id) > (value, id) ตามทิศ sort
+//    prev : กลับทิศ เงื่อนไข + ORDER BY ---> กลับลำดับผลลัพธ์อีกที
+//    ไม่ COUNT(*)  total_page, total_item = 0
+
+var ErrInvalidCursor = errors.New("cursor is invalid")
+
+// Cursor ตำแหน่งของแถวสุดท้าย (next) / แถวแรก (prev) ที่เห็นแล้ว  order_by + sort ติดไปกับ cursor
+type Cursor struct {
+	OrderBy string `json:"o"`
+	Sort    string `json:"s"`
+	Value   string `json:"v"`
+	Id      string `json:"i"`
+	Prev    bool   `json:"p,omitempty"`
+}
+
+// First หน้าแรก ยังไม่มีตำแหน่ง
+func (c *Cursor) First() bool {
+	return c.Id == ""
+}
+
+// Encode cursor ---> string ทึบ (base64 url)
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor string ---> cursor  ("" = หน้าแรก)
+func DecodeCursor(raw string) (*Cursor, error) {
+	if raw == "" {
+		return &Cursor{}, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	cursor := new(Cursor)
+	if err := json.Unmarshal(b, cursor); err != nil || cursor.Id == "" {
+		return nil, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// CursorRes cursor ของหน้าถัดไป / ก่อนหน้า  ("" = ไม่มี)
+type CursorRes struct {
+	Next string
+	Prev string
+}
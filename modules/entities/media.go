@@ -1,8 +1,45 @@
 package entities
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
 // Images
 type Images struct {
-	Id       string `db:"id" json:"id"`
-	FileName string `db:"filename" json:"filename"`
-	Url      string `db:"url" json:"url"`
+	Id       string        `db:"id" json:"id"`
+	FileName string        `db:"filename" json:"filename"`
+	Url      string        `db:"url" json:"url"`
+	Variants ImageVariants `db:"variants" json:"variants"`
+}
+
+// ImageVariants = url ของรูปที่ย่อแล้ว  thumbnail, medium, large : url   (jsonb)
+type ImageVariants map[string]string
+
+// Value เก็บลง jsonb  ไม่มี variant = {}
+func (v ImageVariants) Value() (driver.Value, error) {
+	if v == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan อ่านจาก jsonb
+func (v *ImageVariants) Scan(src any) error {
+	switch data := src.(type) {
+	case nil:
+		*v = make(ImageVariants)
+		return nil
+	case []byte:
+		return json.Unmarshal(data, v)
+	case string:
+		return json.Unmarshal([]byte(data), v)
+	default:
+		return fmt.Errorf("scan image variants failed: unsupported type %T", src)
+	}
 }
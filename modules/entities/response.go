@@ -24,11 +24,14 @@ type Response struct {
 // ------------  FindProduct ---------------
 // paginateRes
 type PaginateRes struct {
-	Data      any `json:"data"`
-	Page      int `json:"page"`
-	Limit     int `json:"limit"`
-	TotalPage int `json:"tota_page"`
-	TotalItem int `json:"total_item"`
+	Data       any    `json:"data"`
+	Page       int    `json:"page"`
+	Limit      int    `json:"limit"`
+	TotalPage  int    `json:"tota_page"`
+	TotalItem  int    `json:"total_item"`
+	Facets     any    `json:"facets,omitempty"`      // จำนวนตาม filter สำหรับ sidebar (products)
+	NextCursor string `json:"next_cursor,omitempty"` // keyset  ส่งกลับมาเป็น ?cursor= ("" = หน้าสุดท้าย)
+	PrevCursor string `json:"prev_cursor,omitempty"`
 }
 
 // ----------------------------------------------------------------------
@@ -1,20 +1,137 @@
 package files
 
-import "mime/multipart"
+import (
+	"mime/multipart"
+	"time"
+
+	"github.com/PHURINTOR/phurinshop/modules/entities"
+)
 
 type FileReq struct {
 	File        *multipart.FileHeader `form:"file"`
 	Destination string                `form:"destination"` // Path File
 	Extension   string                //type file
 	FileName    string                //name file
+	Mime        string                //type file จาก magic bytes
+	Data        []byte                //ไฟล์ที่ตรวจแล้ว + ลบ metadata แล้ว  (ว่าง = อ่านจาก Path หรือ File)
+	Path        string                //ไฟล์บน disk ที่ตรวจแล้ว (tus upload ไฟล์ใหญ่)  stream ขึ้น storage โดยไม่โหลดลง memory
+	Private     bool                  //ไม่ make public  เปิดดูได้ผ่าน signed url เท่านั้น
+	UserId      string                //คน upload  บันทึกลง files registry
 }
 
 type FileRes struct {
-	FileName string `json:"filename"`
-	Url      string `json:"url"`
+	FileName    string                  `json:"filename"`
+	Destination string                  `json:"destination,omitempty"` // key ของไฟล์ใน bucket  ใช้ตอนลบ
+	Url         string                  `json:"url"`
+	Size        int64                   `json:"size,omitempty"`
+	Checksum    string                  `json:"checksum,omitempty"`   // sha256 (hex)
+	Duplicated  bool                    `json:"duplicated,omitempty"` // เนื้อหาซ้ำกับไฟล์เดิม  ใช้ object เดิมแทนการ upload ใหม่
+	Variants    entities.ImageVariants  `json:"variants,omitempty"`   // thumbnail, medium, large : url
+	Error       *entities.ErrorResponse `json:"error,omitempty"`      // ไฟล์นี้ upload ไม่ผ่าน
 	//respone detail file after Register file
 }
 
 type DeleteFileReq struct {
 	Destination string `json:"destination"`
 }
+
+// ------------------------- Signed url (client PUT/GET ตรงกับ bucket) -------------------------
+type SignedUrlReq struct {
+	Destination string `json:"destination" query:"destination"` // upload = folder, download = path ของไฟล์
+	ContentType string `json:"content_type"`                    // upload เท่านั้น เช่น image/jpeg
+	UserId      string `json:"-"`                               // upload เท่านั้น  คนที่ confirm ได้
+}
+
+type SignedUrlRes struct {
+	Destination string            `json:"destination"`
+	Url         string            `json:"url"`
+	Method      string            `json:"method"`            // PUT | GET
+	Headers     map[string]string `json:"headers,omitempty"` // header ที่ต้องส่งไปพร้อม request
+	ExpiresAt   time.Time         `json:"expires_at"`
+
+	ConfirmToken string `json:"confirm_token,omitempty"` // upload เท่านั้น  ส่งกลับมาตอน ConfirmUpload
+}
+
+// ConfirmUploadReq หลัง client PUT ไฟล์ขึ้น bucket เสร็จ  server ตรวจไฟล์แล้วค่อยเปิดให้ใช้งาน
+// ต้องมี confirm_token จาก SignUploadUrl ของ user คนเดียวกัน  confirm key อื่นใน bucket ไม่ได้
+type ConfirmUploadReq struct {
+	Destination  string `json:"destination"`
+	ConfirmToken string `json:"confirm_token"`
+	Private      bool   `json:"private"`
+	UserId       string `json:"-"`
+}
+
+// ------------------------- Resumable upload (tus 1.0) -------------------------
+// TusUpload สถานะของ upload ที่ส่งมาทีละ chunk  เก็บเป็น <id>.info คู่กับไฟล์ <id>.bin ใน APP_UPLOAD_TMP_DIR
+type TusUpload struct {
+	Id          string            `json:"id"`
+	UserId      string            `json:"user_id"`     // admin ที่สร้าง upload  คนอื่น resume ต่อไม่ได้
+	Length      int64             `json:"length"`      // Upload-Length
+	Offset      int64             `json:"offset"`      // Upload-Offset  byte ที่ได้รับแล้ว
+	Metadata    map[string]string `json:"metadata"`    // Upload-Metadata (filename, destination ...)
+	Destination string            `json:"destination"` // Path File
+	ExpiresAt   time.Time         `json:"expires_at"`
+	File        *FileRes          `json:"file,omitempty"` // upload ครบแล้ว
+}
+
+// ------------------------- File registry (ตาราง files) -------------------------
+// File 1 row ต่อ 1 object ใน bucket  (ไม่รวมรูปย่อ)
+type File struct {
+	Id           string                 `db:"id" json:"id"`
+	Key          string                 `db:"key" json:"key"` // destination ใน bucket
+	FileName     string                 `db:"filename" json:"filename"`
+	Size         int64                  `db:"size" json:"size"`
+	Mime         string                 `db:"mime" json:"mime"`
+	Checksum     string                 `db:"checksum" json:"checksum"` // sha256 (hex)
+	Private      bool                   `db:"private" json:"private"`
+	RefCount     int                    `db:"ref_count" json:"ref_count"` // upload ซ้ำกี่ครั้ง (dedup)  เหลือ 0 = ลบ blob
+	Variants     entities.ImageVariants `db:"variants" json:"variants"`
+	UserId       string                 `db:"user_id" json:"user_id"` // คน upload
+	ReferencedBy []*FileReference       `json:"referenced_by"`        // product / order ที่ใช้ไฟล์นี้อยู่  (คำนวณตอน query)
+	CreatedAt    string                 `db:"created_at" json:"created_at"`
+}
+
+type FileReference struct {
+	Type string `json:"type"` // product | order
+	Id   string `json:"id"`
+}
+
+type FileFilter struct {
+	Search     string `query:"search"` // key, filename
+	Mime       string `query:"mime"`
+	UserId     string `query:"user_id"`
+	Referenced string `query:"referenced"` // true | false  ว่าง = ทั้งหมด
+	*entities.PaginationReq
+	*entities.SortReq
+}
+
+// ------------------------- Orphan files gc -------------------------
+type OrphanReq struct {
+	DryRun bool `query:"dry_run"` // true = รายงานอย่างเดียว ไม่ลบ
+}
+
+type OrphanFile struct {
+	Key       string    `json:"key"`
+	Size      int64     `json:"size"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Error     string    `json:"error,omitempty"` // ลบไม่สำเร็จ
+}
+
+type OrphanRes struct {
+	DryRun      bool          `json:"dry_run"`
+	Prefixes    []string      `json:"prefixes"`
+	GracePeriod string        `json:"grace_period"`
+	Scanned     int           `json:"scanned"` // จำนวนไฟล์ใต้ prefix ทั้งหมด
+	Orphans     []*OrphanFile `json:"orphans"` // ไฟล์ที่ไม่มี product / order ใช้ และเก่ากว่า grace period
+	Deleted     int           `json:"deleted"`
+}
+
+// ------------------------- Outbox -------------------------
+const DeleteFilesEvent = "files.delete" // payload = []*DeleteFileReq
+
+type OutboxEvent struct {
+	Id        string `db:"id" json:"id"`
+	EventType string `db:"event_type" json:"event_type"`
+	Payload   []byte `db:"payload" json:"payload"`
+	Attempts  int    `db:"attempts" json:"attempts"` // จำนวนครั้งที่ทำไม่สำเร็จ
+}
@@ -1,16 +1,20 @@
 package filesHandlers
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"math"
-	"path/filepath"
+	"io"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/PHURINTOR/phurinshop/config"
 	"github.com/PHURINTOR/phurinshop/modules/entities"
 	"github.com/PHURINTOR/phurinshop/modules/files"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesStorages"
 	fileUsecases "github.com/PHURINTOR/phurinshop/modules/files/filesUsecases"
-	"github.com/PHURINTOR/phurinshop/pkg/utils"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -18,14 +22,28 @@ import (
 type fileHandlerErrCode string
 
 const (
-	uploadFileErr fileHandlerErrCode = "files-001"
-	deleteFileErr fileHandlerErrCode = "files-002"
+	uploadFileErr  fileHandlerErrCode = "files-001"
+	deleteFileErr  fileHandlerErrCode = "files-002"
+	invalidFileErr fileHandlerErrCode = "files-003"
+	signedUrlErr   fileHandlerErrCode = "files-005"
+	confirmFileErr fileHandlerErrCode = "files-006"
+	fileInUseErr   fileHandlerErrCode = "files-007"
+	findFileErr    fileHandlerErrCode = "files-008"
+	orphanFileErr  fileHandlerErrCode = "files-009"
+	infectedErr    fileHandlerErrCode = "files-010"
 )
 
 // ======================================= Interface =========================================
 type IFilesHandler interface {
 	UploadFiles(c *fiber.Ctx) error
 	DeleteFile(c *fiber.Ctx) error
+	SignUploadUrl(c *fiber.Ctx) error
+	SignDownloadUrl(c *fiber.Ctx) error
+	ConfirmUpload(c *fiber.Ctx) error
+	LocalSignedFile(c *fiber.Ctx) error
+	FindFiles(c *fiber.Ctx) error
+	FindOneFile(c *fiber.Ctx) error
+	CollectOrphans(c *fiber.Ctx) error
 }
 
 // ======================================= Struct ============================================
@@ -60,44 +78,53 @@ func (h *filesHandler) UploadFiles(c *fiber.Ctx) error {
 	filesReq := form.File["files"] //อัพหลายๆ รูป  [files] = ชื่อฟิวตอน upload
 	destination := c.FormValue("destination")
 
-	// Files Extention Validation
-	extMap := map[string]string{
-		"png":  "png",
-		"jpg":  "jpg",
-		"jpeg": "jpeg",
+	if len(filesReq) == 0 {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(uploadFileErr),
+			"files are empty",
+		).Res()
 	}
-	// validate extention
+
+	// validate ทีละไฟล์  ไฟล์ไหนไม่ผ่านจะแจ้ง error ของไฟล์นั้น ไฟล์อื่นยัง upload ต่อได้
+	rejected := make([]*files.FileRes, 0)
+	rejectedMsg := make([]string, 0)
 	for _, file := range filesReq {
-		ext := strings.TrimPrefix(filepath.Ext(file.Filename), ".")
-		if extMap[ext] != ext || extMap[ext] == "" {
-			return entities.NewErrorResponse(c).Error(
-				fiber.ErrBadRequest.Code,
-				string(uploadFileErr),
-				"extension is not acceptable",
-			).Res()
-		}
-		// validate File Size
-		if file.Size > int64(h.cfg.App().FileLimit()) {
-			return entities.NewErrorResponse(c).Error(
-				fiber.ErrBadRequest.Code,
-				string(uploadFileErr),
-				fmt.Sprintf("file size must less than %d MiB", int(math.Ceil(float64(h.cfg.App().FileLimit())/math.Pow(1024, 2)))),
-			).Res()
+		fileReq, err := h.fileUsecases.PrepareUpload(file, destination)
+		if err != nil {
+			rejected = append(rejected, &files.FileRes{
+				FileName: file.Filename,
+				Error: &entities.ErrorResponse{
+					TraceId: string(invalidFileErr),
+					Msg:     err.Error(),
+				},
+			})
+			rejectedMsg = append(rejectedMsg, fmt.Sprintf("%s: %v", file.Filename, err))
+			continue
 		}
+		fileReq.UserId = c.Locals("userId").(string)
+		req = append(req, fileReq)
+	}
 
-		// Gen name file before add to array
-		filesname := utils.RanFileName(ext)
-		req = append(req, &files.FileReq{
-			File:        file,
-			Destination: destination + "/" + filesname,
-			FileName:    filesname,
-			Extension:   ext,
-		})
+	// ไม่มีไฟล์ไหนผ่านเลย
+	if len(req) == 0 {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(invalidFileErr),
+			strings.Join(rejectedMsg, "; "),
+		).Res()
 	}
 	// ---------------------- Upload after validation
 
 	res, err := h.fileUsecases.UploadToGCP(req)
 	if err != nil {
+		if errors.Is(err, fileUsecases.ErrFileInfected) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrUnprocessableEntity.Code,
+				string(infectedErr),
+				err.Error(),
+			).Res()
+		}
 		return entities.NewErrorResponse(c).Error(
 			fiber.ErrInternalServerError.Code,
 			string(uploadFileErr),
@@ -106,6 +133,10 @@ func (h *filesHandler) UploadFiles(c *fiber.Ctx) error {
 
 	}
 
+	// ผ่านบางไฟล์ = 207 พร้อม error ของไฟล์ที่ไม่ผ่าน
+	if len(rejected) > 0 {
+		return entities.NewErrorResponse(c).Success(fiber.StatusMultiStatus, append(res, rejected...)).Res()
+	}
 	return entities.NewErrorResponse(c).Success(fiber.StatusCreated, res).Res()
 }
 
@@ -121,6 +152,32 @@ func (h *filesHandler) DeleteFile(c *fiber.Ctx) error {
 			err.Error(),
 		).Res()
 	}
+	// ไฟล์ที่ product / order ยังใช้อยู่ห้ามลบ  (ลบ product / เปลี่ยนสลิป จะลบไฟล์ให้เอง)
+	refs, err := h.fileUsecases.FindFileReferences(req)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(deleteFileErr),
+			err.Error(),
+		).Res()
+	}
+	if len(refs) > 0 {
+		inUse := make([]string, 0, len(refs))
+		for key, ref := range refs {
+			by := make([]string, 0, len(ref))
+			for _, r := range ref {
+				by = append(by, r.Type+" "+r.Id)
+			}
+			inUse = append(inUse, fmt.Sprintf("%s is referenced by %s", key, strings.Join(by, ", ")))
+		}
+		sort.Strings(inUse)
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrConflict.Code,
+			string(fileInUseErr),
+			strings.Join(inUse, "; "),
+		).Res()
+	}
+
 	// ---------------------- deletefile after validation
 	if err := h.fileUsecases.DeleteFileGCP(req); err != nil {
 		return entities.NewErrorResponse(c).Error(
@@ -132,3 +189,309 @@ func (h *filesHandler) DeleteFile(c *fiber.Ctx) error {
 
 	return entities.NewErrorResponse(c).Success(fiber.StatusCreated, nil).Res()
 }
+
+// ------------------------------- Signed Url (upload)
+// client PUT ไฟล์ตรงขึ้น bucket  ไม่ผ่าน api server  เสร็จแล้วต้องเรียก ConfirmUpload
+func (h *filesHandler) SignUploadUrl(c *fiber.Ctx) error {
+	req := new(files.SignedUrlReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(signedUrlErr),
+			err.Error(),
+		).Res()
+	}
+	req.UserId = c.Locals("userId").(string)
+
+	res, err := h.fileUsecases.SignUploadUrl(req)
+	if err != nil {
+		if errors.Is(err, fileUsecases.ErrUploadInvalid) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(invalidFileErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(signedUrlErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusCreated, res).Res()
+}
+
+// ------------------------------- Signed Url (download)
+func (h *filesHandler) SignDownloadUrl(c *fiber.Ctx) error {
+	req := new(files.SignedUrlReq)
+	if err := c.QueryParser(req); err != nil || req.Destination == "" {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(signedUrlErr),
+			"destination is required",
+		).Res()
+	}
+
+	res, err := h.fileUsecases.SignDownloadUrl(req)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(signedUrlErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, res).Res()
+}
+
+// ------------------------------- Confirm Upload
+func (h *filesHandler) ConfirmUpload(c *fiber.Ctx) error {
+	req := new(files.ConfirmUploadReq)
+	if err := c.BodyParser(req); err != nil || req.Destination == "" {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(confirmFileErr),
+			"destination is required",
+		).Res()
+	}
+
+	req.UserId = c.Locals("userId").(string)
+
+	res, err := h.fileUsecases.ConfirmUpload(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, fileUsecases.ErrUploadInvalid):
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(invalidFileErr),
+				err.Error(),
+			).Res()
+		case errors.Is(err, fileUsecases.ErrUploadTooLarge):
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrRequestEntityTooLarge.Code,
+				string(invalidFileErr),
+				err.Error(),
+			).Res()
+		case errors.Is(err, fileUsecases.ErrConfirmForbidden):
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrForbidden.Code,
+				string(confirmFileErr),
+				err.Error(),
+			).Res()
+		case errors.Is(err, fileUsecases.ErrFileInfected):
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrUnprocessableEntity.Code,
+				string(infectedErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(confirmFileErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusCreated, res).Res()
+}
+
+// ------------------------------- Local Signed File
+// local driver ไม่มี bucket  signed url จึงชี้มาที่ route นี้แทน (ตรวจ signature แทน jwt)
+func (h *filesHandler) LocalSignedFile(c *fiber.Ctx) error {
+	destination := c.Params("*")
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	contentType := c.Query("content_type")
+
+	if c.Method() != c.Query("method") {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrForbidden.Code,
+			string(signedUrlErr),
+			"method is not allowed by signed url",
+		).Res()
+	}
+	if c.Method() == fiber.MethodPut && c.Get(fiber.HeaderContentType) != contentType {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrForbidden.Code,
+			string(signedUrlErr),
+			"content-type does not match signed url",
+		).Res()
+	}
+	if err := filesStorages.VerifyLocalSignature(h.cfg, c.Method(), destination, contentType, expires, c.Query("signature")); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrForbidden.Code,
+			string(signedUrlErr),
+			err.Error(),
+		).Res()
+	}
+
+	storage, err := filesStorages.FilesStorage(c.Context(), h.cfg)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(signedUrlErr),
+			err.Error(),
+		).Res()
+	}
+	defer storage.Close()
+
+	if c.Method() == fiber.MethodPut {
+		body := &maxBodyReader{r: requestBody(c), n: int64(h.cfg.App().UploadMaxSize())}
+		if err := storage.Upload(c.Context(), destination, body); err != nil {
+			if body.exceeded {
+				return entities.NewErrorResponse(c).Error(
+					fiber.StatusRequestEntityTooLarge,
+					string(signedUrlErr),
+					"request body is too large",
+				).Res()
+			}
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrInternalServerError.Code,
+				string(signedUrlErr),
+				err.Error(),
+			).Res()
+		}
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	file, err := storage.Open(c.Context(), destination)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrNotFound.Code,
+			string(signedUrlErr),
+			"file not found",
+		).Res()
+	}
+	c.Type(strings.TrimPrefix(path.Ext(destination), "."))
+	return c.SendStream(file)
+}
+
+// requestBody body ของ request เป็น stream (server เปิด StreamRequestBody)  ไม่มี stream = body ที่อ่านไว้แล้ว
+func requestBody(c *fiber.Ctx) io.Reader {
+	if body := c.Context().RequestBodyStream(); body != nil {
+		return body
+	}
+	return bytes.NewReader(c.Body())
+}
+
+// maxBodyReader อ่านได้ไม่เกิน n byte  เกิน = error (upload ล้ม ไม่มีไฟล์ค้าง)
+// chunked ไม่มี Content-Length ให้ middleware BodyLimit ตรวจก่อน  ต้องตัดตอนอ่าน
+type maxBodyReader struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (m *maxBodyReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > m.n+1 {
+		p = p[:m.n+1]
+	}
+	n, err := m.r.Read(p)
+	if int64(n) > m.n {
+		m.exceeded = true
+		return int(m.n), errors.New("request body is too large")
+	}
+	m.n -= int64(n)
+	return n, err
+}
+
+// ------------------------------- Files registry (admin)
+func (h *filesHandler) FindFiles(c *fiber.Ctx) error {
+	req := &files.FileFilter{
+		SortReq:       &entities.SortReq{},
+		PaginationReq: &entities.PaginationReq{},
+	}
+
+	if err := c.QueryParser(req); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findFileErr),
+			err.Error(),
+		).Res()
+	}
+
+	// varidate defult page value
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 5 {
+		req.Limit = 5
+	}
+
+	// Check OrderBy
+	orderByMap := map[string]string{
+		"created_at": `"f"."created_at"`,
+		"filename":   `"f"."filename"`,
+		"size":       `"f"."size"`,
+		"key":        `"f"."key"`,
+	}
+	if orderByMap[req.OrderBy] == "" {
+		req.OrderBy = orderByMap["created_at"]
+	} else {
+		req.OrderBy = orderByMap[req.OrderBy]
+	}
+
+	// Sort
+	req.Sort = strings.ToUpper(req.Sort)
+	sortMap := map[string]string{
+		"DESC": "DESC",
+		"ASC":  "ASC",
+	}
+	if sortMap[req.Sort] == "" {
+		req.Sort = sortMap["DESC"]
+	}
+
+	// Referenced
+	req.Referenced = strings.ToLower(req.Referenced)
+	if req.Referenced != "" && req.Referenced != "true" && req.Referenced != "false" {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findFileErr),
+			"referenced must be true or false",
+		).Res()
+	}
+
+	res := h.fileUsecases.FindFiles(req)
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, res).Res()
+}
+
+func (h *filesHandler) FindOneFile(c *fiber.Ctx) error {
+	fileId := strings.Trim(c.Params("file_id"), " ")
+
+	file, err := h.fileUsecases.FindOneFile(fileId)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrNotFound.Code,
+			string(findFileErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, file).Res()
+}
+
+// ------------------------------- Orphan files gc (admin)
+// ค่าเริ่มต้นเป็น dry run  ต้องส่ง ?dry_run=false ถึงจะลบจริง
+func (h *filesHandler) CollectOrphans(c *fiber.Ctx) error {
+	req := &files.OrphanReq{DryRun: true}
+	if err := c.QueryParser(req); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(orphanFileErr),
+			err.Error(),
+		).Res()
+	}
+
+	res, err := h.fileUsecases.CollectOrphans(req)
+	if err != nil {
+		if errors.Is(err, fileUsecases.ErrOrphanRunning) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrConflict.Code,
+				string(orphanFileErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(orphanFileErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, res).Res()
+}
@@ -0,0 +1,221 @@
+package filesHandlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PHURINTOR/phurinshop/config"
+	"github.com/PHURINTOR/phurinshop/modules/entities"
+	"github.com/PHURINTOR/phurinshop/modules/files"
+	fileUsecases "github.com/PHURINTOR/phurinshop/modules/files/filesUsecases"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ======================================= Enum  ============================================
+const (
+	tusUploadErr fileHandlerErrCode = "files-004"
+
+	tusVersion   = "1.0.0"
+	tusExtension = "creation,termination,expiration"
+)
+
+// ======================================= Interface =========================================
+// ITusHandler resumable upload ตาม tus 1.0  (https://tus.io/protocols/resumable-upload)
+// ไฟล์ใหญ่ส่งมาทีละ chunk  chunk อ่านเป็น stream ลง disk ตรงๆ (ไม่ติด APP_BODY_LIMIT)
+type ITusHandler interface {
+	Options(c *fiber.Ctx) error
+	CheckVersion(c *fiber.Ctx) error
+	CreateUpload(c *fiber.Ctx) error
+	HeadUpload(c *fiber.Ctx) error
+	PatchUpload(c *fiber.Ctx) error
+	DeleteUpload(c *fiber.Ctx) error
+	FindUpload(c *fiber.Ctx) error
+}
+
+// ======================================= Struct ============================================
+type tusHandler struct {
+	cfg        config.IConfig
+	tusUsecase fileUsecases.ITusUsecase
+}
+
+// ======================================= Constructor =======================================
+func TusHandler(cfg config.IConfig, tusUsecase fileUsecases.ITusUsecase) ITusHandler {
+	return &tusHandler{
+		cfg:        cfg,
+		tusUsecase: tusUsecase,
+	}
+}
+
+// ======================================= Missing Func =======================================
+// ------------------------------- OPTIONS  บอกความสามารถของ server
+func (h *tusHandler) Options(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	c.Set("Tus-Version", tusVersion)
+	c.Set("Tus-Extension", tusExtension)
+	c.Set("Tus-Max-Size", strconv.Itoa(h.cfg.App().UploadMaxSize()))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ------------------------------- POST  สร้าง upload  (Upload-Length, Upload-Metadata)
+func (h *tusHandler) CreateUpload(c *fiber.Ctx) error {
+	length, err := strconv.ParseInt(c.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		return h.error(c, fiber.StatusBadRequest, "upload-length is invalid")
+	}
+
+	metadata, err := parseMetadata(c.Get("Upload-Metadata"))
+	if err != nil {
+		return h.error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	upload, err := h.tusUsecase.CreateUpload(&files.TusUpload{
+		UserId:      c.Locals("userId").(string),
+		Length:      length,
+		Metadata:    metadata,
+		Destination: metadata["destination"],
+	})
+	if err != nil {
+		return h.usecaseError(c, err)
+	}
+
+	c.Set("Location", fmt.Sprintf("%s%s/%s", c.BaseURL(), strings.TrimSuffix(c.Path(), "/"), upload.Id))
+	c.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+// ------------------------------- HEAD  ถาม offset ล่าสุดเพื่อ resume
+func (h *tusHandler) HeadUpload(c *fiber.Ctx) error {
+	upload, err := h.tusUsecase.FindUpload(c.Locals("userId").(string), c.Params("upload_id"))
+	if err != nil {
+		return h.usecaseError(c, err)
+	}
+
+	c.Set("Cache-Control", "no-store")
+	c.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if len(upload.Metadata) > 0 {
+		c.Set("Upload-Metadata", encodeMetadata(upload.Metadata))
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// ------------------------------- PATCH  ส่ง chunk ต่อจาก Upload-Offset
+func (h *tusHandler) PatchUpload(c *fiber.Ctx) error {
+	if c.Get(fiber.HeaderContentType) != "application/offset+octet-stream" {
+		return h.error(c, fiber.StatusUnsupportedMediaType, "content-type must be application/offset+octet-stream")
+	}
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return h.error(c, fiber.StatusBadRequest, "upload-offset is invalid")
+	}
+
+	upload, err := h.tusUsecase.WriteChunk(
+		c.Locals("userId").(string),
+		c.Params("upload_id"),
+		offset,
+		requestBody(c),
+	)
+	if err != nil {
+		return h.usecaseError(c, err)
+	}
+
+	c.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ------------------------------- DELETE  ยกเลิก upload (termination)
+func (h *tusHandler) DeleteUpload(c *fiber.Ctx) error {
+	if err := h.tusUsecase.TerminateUpload(c.Locals("userId").(string), c.Params("upload_id")); err != nil {
+		return h.usecaseError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ------------------------------- GET  ผลของ upload (url ของไฟล์เมื่อ upload ครบ)  ไม่ได้อยู่ใน tus
+func (h *tusHandler) FindUpload(c *fiber.Ctx) error {
+	upload, err := h.tusUsecase.FindUpload(c.Locals("userId").(string), c.Params("upload_id"))
+	if err != nil {
+		return h.usecaseError(c, err)
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, upload).Res()
+}
+
+// ------------------------------- Tus-Resumable  ใช้เป็น middleware ก่อน POST, HEAD, PATCH, DELETE
+func (h *tusHandler) CheckVersion(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	if c.Get("Tus-Resumable") != tusVersion {
+		c.Set("Tus-Version", tusVersion)
+		return h.error(c, fiber.StatusPreconditionFailed, "tus-resumable version is not supported")
+	}
+	return c.Next()
+}
+
+// ------------------------------- helper
+func (h *tusHandler) usecaseError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, fileUsecases.ErrUploadNotFound):
+		return h.error(c, fiber.StatusNotFound, err.Error())
+	case errors.Is(err, fileUsecases.ErrUploadExpired):
+		return h.error(c, fiber.StatusGone, err.Error())
+	case errors.Is(err, fileUsecases.ErrUploadOffset):
+		return h.error(c, fiber.StatusConflict, err.Error())
+	case errors.Is(err, fileUsecases.ErrUploadTooLarge):
+		return h.error(c, fiber.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, fileUsecases.ErrUploadLocked):
+		return h.error(c, fiber.StatusLocked, err.Error())
+	case errors.Is(err, fileUsecases.ErrUploadInvalid):
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(invalidFileErr),
+			err.Error(),
+		).Res()
+	case errors.Is(err, fileUsecases.ErrFileInfected):
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrUnprocessableEntity.Code,
+			string(infectedErr),
+			err.Error(),
+		).Res()
+	default:
+		return h.error(c, fiber.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *tusHandler) error(c *fiber.Ctx, code int, msg string) error {
+	return entities.NewErrorResponse(c).Error(code, string(tusUploadErr), msg).Res()
+}
+
+// Upload-Metadata: key base64(value),key base64(value)
+func parseMetadata(raw string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(raw) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("upload-metadata is invalid")
+		}
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("upload-metadata %q is invalid", key)
+		}
+		metadata[key] = string(b)
+	}
+	return metadata, nil
+}
+
+func encodeMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,134 @@
+package filesImages
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"path"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/PHURINTOR/phurinshop/modules/entities"
+	"golang.org/x/image/draw"
+)
+
+// ======================================= Struct ============================================
+// Variant คือรูปที่ย่อขนาดแล้ว  รอ upload ไปเก็บข้างๆ ไฟล์ต้นฉบับ
+type Variant struct {
+	Name        string // thumbnail, medium, large, thumbnail_webp ...
+	Destination string // images/products/abc_123_thumbnail.jpg
+	FileName    string
+	Data        []byte
+}
+
+// ======================================= Function ==========================================
+// IsImage เช็คว่านามสกุลนี้ย่อรูปได้หรือไม่
+func IsImage(ext string) bool {
+	switch strings.ToLower(ext) {
+	case "png", "jpg", "jpeg", "gif", "webp":
+		return true
+	}
+	return false
+}
+
+// Variants decode รูปต้นฉบับแล้วย่อตามขนาดที่ตั้งไว้ใน config (ไม่ขยายรูปที่เล็กกว่า)
+// webp = true จะได้ไฟล์ .webp เพิ่มมาอีกชุด ชื่อ <variant>_webp
+func Variants(data []byte, destination string, sizes map[string]int, webp bool) ([]*Variant, error) {
+	mime, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+	_, decode := decoders(mime)
+	src, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image failed: %v", err)
+	}
+
+	ext := path.Ext(destination)
+	base := strings.TrimSuffix(destination, ext)
+
+	variants := make([]*Variant, 0)
+	for name, size := range sizes {
+		img := resize(src, size)
+
+		// encode กลับเป็น format เดิม
+		buf := new(bytes.Buffer)
+		switch mime {
+		case "image/png":
+			err = png.Encode(buf, img)
+		case "image/gif": // ย่อได้แค่ frame แรก
+			err = gif.Encode(buf, img, nil)
+		case "image/webp":
+			err = nativewebp.Encode(buf, img, nil)
+		default:
+			err = jpeg.Encode(buf, img, &jpeg.Options{Quality: 85})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("encode %s variant failed: %v", name, err)
+		}
+		variants = append(variants, newVariant(name, fmt.Sprintf("%s_%s%s", base, name, ext), buf.Bytes()))
+
+		if webp && mime != "image/webp" {
+			buf := new(bytes.Buffer)
+			if err := nativewebp.Encode(buf, img, nil); err != nil {
+				return nil, fmt.Errorf("encode %s webp variant failed: %v", name, err)
+			}
+			variants = append(variants, newVariant(name+"_webp", fmt.Sprintf("%s_%s.webp", base, name), buf.Bytes()))
+		}
+	}
+	return variants, nil
+}
+
+// VariantDestinations คืน path ของ variant ทุกตัวของไฟล์ต้นฉบับ เอาไว้ลบไฟล์ตามกัน
+func VariantDestinations(destination string, variants entities.ImageVariants) []string {
+	ext := path.Ext(destination)
+	base := strings.TrimSuffix(destination, ext)
+
+	destinations := make([]string, 0)
+	for name := range variants {
+		if n, ok := strings.CutSuffix(name, "_webp"); ok {
+			destinations = append(destinations, fmt.Sprintf("%s_%s.webp", base, n))
+			continue
+		}
+		destinations = append(destinations, fmt.Sprintf("%s_%s%s", base, name, ext))
+	}
+	return destinations
+}
+
+func newVariant(name, destination string, data []byte) *Variant {
+	return &Variant{
+		Name:        name,
+		Destination: destination,
+		FileName:    path.Base(destination),
+		Data:        data,
+	}
+}
+
+// resize ย่อให้ด้านที่ยาวที่สุด = size โดยรักษาสัดส่วนเดิม
+func resize(src image.Image, size int) image.Image {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w <= size && h <= size {
+		return src
+	}
+
+	if w >= h {
+		h = h * size / w
+		w = size
+	} else {
+		w = w * size / h
+		h = size
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+	return dst
+}
@@ -0,0 +1,240 @@
+package filesImages
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StripMetadata ลบ EXIF (GPS, รุ่นกล้อง ฯลฯ) / XMP ออกจากไฟล์โดยไม่ encode รูปใหม่  คุณภาพรูปเท่าเดิม
+//   - jpg  : ตัด segment APP1 (Exif, XMP) และ APP13 (IPTC)
+//   - png  : ตัด chunk eXIf, tEXt, zTXt, iTXt, tIME
+//   - webp : ตัด chunk EXIF, XMP แล้วแก้ flag ใน VP8X
+//
+// รูปที่มี EXIF Orientation 2-8 หมุน pixel ให้ตรงก่อน (encode ใหม่)  ไม่งั้นลบ tag แล้วรูปตะแคง
+// gif และ avif คืนไฟล์เดิม
+func StripMetadata(data []byte, mime string) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	if err := StripMetadataStream(out, bytes.NewReader(data), mime); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// StripMetadataStream แบบอ่านทีละส่วน  ใช้กับไฟล์ใหญ่ที่ไม่อยากโหลดทั้งไฟล์ลง memory
+func StripMetadataStream(dst io.Writer, src io.ReadSeeker, mime string) error {
+	if orientation := Orientation(src, mime); orientation != 1 {
+		return applyOrientation(dst, bufio.NewReader(src), mime, orientation)
+	}
+
+	switch mime {
+	case "image/jpeg":
+		return stripJpeg(dst, bufio.NewReader(src))
+	case "image/png":
+		return stripPng(dst, bufio.NewReader(src))
+	case "image/webp":
+		return stripWebp(dst, src)
+	default:
+		_, err := io.Copy(dst, src)
+		return err
+	}
+}
+
+// ------------------------- JPEG -------------------------
+// SOI (FFD8) ---> segment: FF marker len(2) data ---> SOS (FFDA) ข้อมูลรูปต่อจากนี้ copy ทั้งหมด
+func stripJpeg(dst io.Writer, src *bufio.Reader) error {
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(src, soi); err != nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return errors.New("jpeg header is invalid")
+	}
+	if _, err := dst.Write(soi); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(src, header[:2]); err != nil {
+			return errors.New("jpeg image data not found")
+		}
+		if header[0] != 0xFF {
+			return errors.New("jpeg segment is invalid")
+		}
+		for header[1] == 0xFF { // fill byte
+			b, err := src.ReadByte()
+			if err != nil {
+				return errors.New("jpeg segment is invalid")
+			}
+			header[1] = b
+		}
+		marker := header[1]
+
+		if marker == 0xDA { // SOS
+			if _, err := dst.Write(header[:2]); err != nil {
+				return err
+			}
+			_, err := io.Copy(dst, src)
+			return err
+		}
+
+		if _, err := io.ReadFull(src, header[2:4]); err != nil {
+			return errors.New("jpeg segment is invalid")
+		}
+		size := int64(binary.BigEndian.Uint16(header[2:4]))
+		if size < 2 {
+			return errors.New("jpeg segment is invalid")
+		}
+
+		if marker == 0xE1 || marker == 0xED {
+			if _, err := src.Discard(int(size - 2)); err != nil {
+				return errors.New("jpeg segment is invalid")
+			}
+			continue
+		}
+		if _, err := dst.Write(header); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(dst, src, size-2); err != nil {
+			return errors.New("jpeg segment is invalid")
+		}
+	}
+}
+
+// ------------------------- PNG -------------------------
+// signature(8) ---> chunk: len(4) type(4) data crc(4)
+func stripPng(dst io.Writer, src *bufio.Reader) error {
+	drop := map[string]bool{
+		"eXIf": true,
+		"tEXt": true,
+		"zTXt": true,
+		"iTXt": true,
+		"tIME": true,
+	}
+
+	sig := make([]byte, 8)
+	if _, err := io.ReadFull(src, sig); err != nil {
+		return errors.New("png header is invalid")
+	}
+	if _, err := dst.Write(sig); err != nil {
+		return err
+	}
+
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(src, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.New("png chunk is invalid")
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4])) + 4 // + crc
+
+		if drop[string(header[4:8])] {
+			if _, err := io.CopyN(io.Discard, src, size); err != nil {
+				return errors.New("png chunk is invalid")
+			}
+			continue
+		}
+		if _, err := dst.Write(header); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(dst, src, size); err != nil {
+			return errors.New("png chunk is invalid")
+		}
+	}
+}
+
+// ------------------------- WEBP -------------------------
+// "RIFF" size(4) "WEBP" ---> chunk: fourcc(4) size(4) data (+1 padding ถ้าขนาดคี่)
+// ขนาด RIFF อยู่หัวไฟล์  ต้องอ่านรอบแรกเพื่อคำนวณขนาดใหม่ก่อน แล้วค่อย copy รอบสอง
+func stripWebp(dst io.Writer, src io.ReadSeeker) error {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(src, header); err != nil || string(header[0:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return errors.New("webp header is invalid")
+	}
+
+	// รอบแรก นับขนาดที่เหลือ
+	size := int64(4) // "WEBP"
+	if err := walkWebp(src, func(fourcc string, chunkSize int64) error {
+		if fourcc != "EXIF" && fourcc != "XMP " {
+			size += 8 + chunkSize
+		}
+		_, err := src.Seek(chunkSize, io.SeekCurrent)
+		return err
+	}); err != nil {
+		return err
+	}
+	if size > 0xFFFFFFFF {
+		return errors.New("webp is too large")
+	}
+	binary.LittleEndian.PutUint32(header[4:8], uint32(size))
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+
+	// รอบสอง copy
+	if _, err := src.Seek(12, io.SeekStart); err != nil {
+		return err
+	}
+	return walkWebp(src, func(fourcc string, chunkSize int64) error {
+		switch fourcc {
+		case "EXIF", "XMP ":
+			_, err := src.Seek(chunkSize, io.SeekCurrent)
+			return err
+		case "VP8X":
+			chunk := make([]byte, chunkSize)
+			if _, err := io.ReadFull(src, chunk); err != nil {
+				return errors.New("webp chunk is invalid")
+			}
+			if len(chunk) > 0 {
+				chunk[0] &^= 0x08 | 0x04 // EXIF flag, XMP flag
+			}
+			return writeWebpChunk(dst, fourcc, chunk)
+		default:
+			if err := writeWebpChunkHeader(dst, fourcc, chunkSize); err != nil {
+				return err
+			}
+			if _, err := io.CopyN(dst, src, chunkSize); err != nil {
+				return errors.New("webp chunk is invalid")
+			}
+			return nil
+		}
+	})
+}
+
+// walkWebp อ่าน header ของแต่ละ chunk  fn ต้องอ่านหรือ seek ข้าม data ของ chunk เอง
+// chunkSize ที่ส่งให้ fn รวม padding แล้ว
+func walkWebp(src io.ReadSeeker, fn func(fourcc string, chunkSize int64) error) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(src, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.New("webp chunk is invalid")
+		}
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+		if err := fn(string(header[0:4]), size+size%2); err != nil {
+			return fmt.Errorf("webp chunk %q is invalid: %v", header[0:4], err)
+		}
+	}
+}
+
+func writeWebpChunkHeader(dst io.Writer, fourcc string, chunkSize int64) error {
+	header := make([]byte, 8)
+	copy(header, fourcc)
+	// chunkSize รวม padding มาแล้ว  ใน header ต้องเป็นขนาดจริง
+	binary.LittleEndian.PutUint32(header[4:8], uint32(chunkSize))
+	_, err := dst.Write(header)
+	return err
+}
+
+func writeWebpChunk(dst io.Writer, fourcc string, chunk []byte) error {
+	if err := writeWebpChunkHeader(dst, fourcc, int64(len(chunk))); err != nil {
+		return err
+	}
+	_, err := dst.Write(chunk)
+	return err
+}
@@ -0,0 +1,227 @@
+package filesImages
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+// ----------Flow  (EXIF Orientation)
+//    มือถือเก็บรูปตามแนวเซนเซอร์ + tag Orientation บอกว่าต้องหมุนตอนแสดง  ลบ metadata แล้ว tag หาย = รูปตะแคง
+//    Orientation 2-8 ---> decode ---> หมุน / กลับด้าน pixel ---> encode format เดิม (ไม่มี metadata ติดมา)
+//    Orientation 1 / ไม่มี ---> ตัด metadata แบบไม่ encode ใหม่เหมือนเดิม
+
+// orientationTag EXIF tag 0x0112
+const orientationTag = 0x0112
+
+// Orientation ค่า tag Orientation ของรูป (1-8)  ไม่มี / อ่านไม่ได้ = 1
+func Orientation(src io.ReadSeeker, mime string) int {
+	defer src.Seek(0, io.SeekStart)
+
+	var exif []byte
+	switch mime {
+	case "image/jpeg":
+		exif = jpegExif(bufio.NewReader(src))
+	case "image/png":
+		exif = pngExif(src)
+	case "image/webp":
+		exif = webpExif(src)
+	}
+	if o := exifOrientation(exif); o >= 1 && o <= 8 {
+		return o
+	}
+	return 1
+}
+
+// jpegExif data ของ APP1 "Exif\0\0" (TIFF header ขึ้นไป)
+func jpegExif(src *bufio.Reader) []byte {
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(src, soi); err != nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return nil
+	}
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(src, header); err != nil || header[0] != 0xFF {
+			return nil
+		}
+		marker := header[1]
+		if marker == 0xDA { // SOS  ไม่มี EXIF ก่อนข้อมูลรูป
+			return nil
+		}
+		size := int(binary.BigEndian.Uint16(header[2:4])) - 2
+		if size < 0 {
+			return nil
+		}
+		if marker != 0xE1 {
+			if _, err := src.Discard(size); err != nil {
+				return nil
+			}
+			continue
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(src, data); err != nil {
+			return nil
+		}
+		if bytes.HasPrefix(data, []byte("Exif\x00\x00")) {
+			return data[6:]
+		}
+	}
+}
+
+// pngExif data ของ chunk eXIf
+func pngExif(src io.ReadSeeker) []byte {
+	if _, err := src.Seek(8, io.SeekStart); err != nil {
+		return nil
+	}
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(src, header); err != nil {
+			return nil
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		if string(header[4:8]) == "eXIf" {
+			if size > 1<<20 {
+				return nil
+			}
+			data := make([]byte, size)
+			if _, err := io.ReadFull(src, data); err != nil {
+				return nil
+			}
+			return data
+		}
+		if _, err := src.Seek(size+4, io.SeekCurrent); err != nil { // + crc
+			return nil
+		}
+	}
+}
+
+// webpExif data ของ chunk EXIF
+func webpExif(src io.ReadSeeker) []byte {
+	if _, err := src.Seek(12, io.SeekStart); err != nil {
+		return nil
+	}
+	var exif []byte
+	walkWebp(src, func(fourcc string, chunkSize int64) error {
+		if fourcc != "EXIF" || chunkSize > 1<<20 {
+			_, err := src.Seek(chunkSize, io.SeekCurrent)
+			return err
+		}
+		exif = make([]byte, chunkSize)
+		if _, err := io.ReadFull(src, exif); err != nil {
+			exif = nil
+			return err
+		}
+		// บางโปรแกรมใส่ "Exif\0\0" นำหน้าเหมือน jpeg
+		exif = bytes.TrimPrefix(exif, []byte("Exif\x00\x00"))
+		return nil
+	})
+	return exif
+}
+
+// exifOrientation อ่าน tag Orientation ใน IFD0 ของ TIFF  (II = little endian, MM = big endian)
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:entry+2]) == orientationTag {
+			return int(order.Uint16(tiff[entry+8 : entry+10])) // SHORT อยู่ต้นช่อง value
+		}
+	}
+	return 0
+}
+
+// applyOrientation decode ---> หมุนตาม orientation ---> encode format เดิมลง dst
+func applyOrientation(dst io.Writer, src io.Reader, mime string, orientation int) error {
+	_, decode := decoders(mime)
+	img, err := decode(src)
+	if err != nil {
+		return fmt.Errorf("decode image failed: %v", err)
+	}
+	img = orient(img, orientation)
+
+	switch mime {
+	case "image/png":
+		err = png.Encode(dst, img)
+	case "image/webp":
+		err = nativewebp.Encode(dst, img, nil)
+	default:
+		err = jpeg.Encode(dst, img, &jpeg.Options{Quality: 92})
+	}
+	if err != nil {
+		return fmt.Errorf("encode oriented image failed: %v", err)
+	}
+	return nil
+}
+
+// orient หมุน / กลับด้าน pixel ให้ตรงกับที่ Orientation บอก
+//
+//	2 กลับซ้ายขวา  3 หมุน 180  4 กลับบนล่าง  5 transpose  6 หมุนขวา 90  7 transverse  8 หมุนซ้าย 90
+func orient(src image.Image, orientation int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if orientation >= 5 {
+		w, h = h, w
+	}
+
+	// (x, y) ของรูปใหม่ ---> (x, y) ของรูปเดิม
+	from := func(x, y int) (int, int) {
+		switch orientation {
+		case 2:
+			return w - 1 - x, y
+		case 3:
+			return w - 1 - x, h - 1 - y
+		case 4:
+			return x, h - 1 - y
+		case 5:
+			return y, x
+		case 6:
+			return y, w - 1 - x
+		case 7:
+			return h - 1 - y, w - 1 - x
+		case 8:
+			return h - 1 - y, x
+		}
+		return x, y
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if orientation <= 1 || orientation > 8 {
+		draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+		return dst
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := from(x, y)
+			dst.Set(x, y, src.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,250 @@
+package filesImages
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/webp"
+)
+
+// ======================================= Struct ============================================
+// Limit กันไฟล์ decompression bomb (ไฟล์เล็กแต่ขยายเป็นรูปใหญ่มาก)
+type Limit struct {
+	MaxDimension int // px ด้านใดด้านหนึ่ง
+	MaxPixels    int // กว้าง x สูง
+}
+
+// Info ผลตรวจไฟล์จากเนื้อไฟล์จริง (ไม่เชื่อนามสกุลที่ส่งมา)
+type Info struct {
+	Mime   string
+	Ext    string
+	Width  int
+	Height int
+}
+
+// ======================================= Enum ==============================================
+var mimeExt = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpg",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+	"image/avif": "avif",
+}
+
+// ======================================= Function ==========================================
+// Sniff ดู magic bytes ของไฟล์  คืน mime ที่รองรับ
+func Sniff(data []byte) (string, error) {
+	if isAvif(data) {
+		return "image/avif", nil
+	}
+	mime := http.DetectContentType(data)
+	if _, ok := mimeExt[mime]; !ok {
+		return "", fmt.Errorf("file type %s is not acceptable", mime)
+	}
+	return mime, nil
+}
+
+// MimeExt นามสกุลของ mime ที่รองรับ  ใช้ตั้งชื่อไฟล์ก่อนได้เนื้อไฟล์จริง (signed url)
+func MimeExt(mime string) (string, bool) {
+	ext, ok := mimeExt[mime]
+	return ext, ok
+}
+
+// Inspect ตรวจว่าเป็นรูปจริงและไม่ใหญ่เกิน limit
+// อ่านขนาดจาก header ก่อน แล้วค่อย decode ทั้งไฟล์เพื่อยืนยันว่าไฟล์ไม่เสีย
+func Inspect(data []byte, limit *Limit) (*Info, error) {
+	mime, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{
+		Mime: mime,
+		Ext:  mimeExt[mime],
+	}
+
+	// avif ไม่มี decoder  เช็คได้แค่ขนาดจาก header (ispe)
+	if mime == "image/avif" {
+		w, h, err := avifSize(data)
+		if err != nil {
+			return nil, err
+		}
+		info.Width, info.Height = w, h
+		return info, checkLimit(info, limit)
+	}
+
+	decodeConfig, decode := decoders(mime)
+	cfg, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("file is not a valid %s image: %v", info.Ext, err)
+	}
+	info.Width, info.Height = cfg.Width, cfg.Height
+	if err := checkLimit(info, limit); err != nil {
+		return nil, err
+	}
+
+	if _, err := decode(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("file is not a valid %s image: %v", info.Ext, err)
+	}
+	return info, nil
+}
+
+// InspectHeader ตรวจชนิดไฟล์และขนาดรูปจาก header อย่างเดียว ไม่ decode ทั้งไฟล์
+// ใช้กับไฟล์ใหญ่ที่อยู่บน disk (tus upload)  อ่านเสร็จแล้ว seek กลับไปต้นไฟล์
+func InspectHeader(src io.ReadSeeker, limit *Limit) (*Info, error) {
+	// avif เก็บ meta box ไว้ต้นไฟล์  1MB พอสำหรับหา ispe
+	head, err := io.ReadAll(io.LimitReader(src, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	mime, err := Sniff(head)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{
+		Mime: mime,
+		Ext:  mimeExt[mime],
+	}
+
+	if mime == "image/avif" {
+		info.Width, info.Height, err = avifSize(head)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		decodeConfig, _ := decoders(mime)
+		cfg, err := decodeConfig(bufio.NewReader(src))
+		if err != nil {
+			return nil, fmt.Errorf("file is not a valid %s image: %v", info.Ext, err)
+		}
+		info.Width, info.Height = cfg.Width, cfg.Height
+	}
+	if err := checkLimit(info, limit); err != nil {
+		return nil, err
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func decoders(mime string) (func(r io.Reader) (image.Config, error), func(r io.Reader) (image.Image, error)) {
+	switch mime {
+	case "image/png":
+		return func(r io.Reader) (image.Config, error) { return png.DecodeConfig(r) },
+			func(r io.Reader) (image.Image, error) { return png.Decode(r) }
+	case "image/gif":
+		return func(r io.Reader) (image.Config, error) { return gif.DecodeConfig(r) },
+			func(r io.Reader) (image.Image, error) { return gif.Decode(r) }
+	case "image/webp":
+		return func(r io.Reader) (image.Config, error) { return webp.DecodeConfig(r) },
+			func(r io.Reader) (image.Image, error) { return webp.Decode(r) }
+	default:
+		return func(r io.Reader) (image.Config, error) { return jpeg.DecodeConfig(r) },
+			func(r io.Reader) (image.Image, error) { return jpeg.Decode(r) }
+	}
+}
+
+func checkLimit(info *Info, limit *Limit) error {
+	if info.Width <= 0 || info.Height <= 0 {
+		return errors.New("image dimension is invalid")
+	}
+	if info.Width > limit.MaxDimension || info.Height > limit.MaxDimension {
+		return fmt.Errorf("image dimension must less than %dx%d px", limit.MaxDimension, limit.MaxDimension)
+	}
+	if info.Width*info.Height > limit.MaxPixels {
+		return fmt.Errorf("image must less than %d pixels", limit.MaxPixels)
+	}
+	return nil
+}
+
+// ------------------------- AVIF (ISO-BMFF) -------------------------
+// ftyp box : size(4) "ftyp" major_brand(4) minor_version(4) compatible_brands(4*n)
+func isAvif(data []byte) bool {
+	if len(data) < 16 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	size := int(binary.BigEndian.Uint32(data[0:4]))
+	if size < 16 || size > len(data) {
+		return false
+	}
+	for i := 8; i+4 <= size; i += 4 {
+		if i == 12 { // minor_version
+			continue
+		}
+		if brand := string(data[i : i+4]); brand == "avif" || brand == "avis" {
+			return true
+		}
+	}
+	return false
+}
+
+// avifSize อ่าน ispe (image spatial extents) ใน meta > iprp > ipco
+func avifSize(data []byte) (int, int, error) {
+	path := []struct {
+		box     string
+		fullBox bool
+	}{
+		{"meta", true},
+		{"iprp", false},
+		{"ipco", false},
+		{"ispe", true},
+	}
+
+	body := data
+	for _, p := range path {
+		b, err := findBox(body, p.box)
+		if err != nil {
+			return 0, 0, err
+		}
+		if p.fullBox { // version(1) + flags(3)
+			if len(b) < 4 {
+				return 0, 0, fmt.Errorf("avif %s box is invalid", p.box)
+			}
+			b = b[4:]
+		}
+		body = b
+	}
+	if len(body) < 8 {
+		return 0, 0, errors.New("avif ispe box is invalid")
+	}
+	return int(binary.BigEndian.Uint32(body[0:4])), int(binary.BigEndian.Uint32(body[4:8])), nil
+}
+
+// findBox หา box ชั้นเดียว คืนเนื้อใน box (ไม่รวม header)
+func findBox(data []byte, name string) ([]byte, error) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		header := uint64(8)
+		switch size {
+		case 0: // ถึงท้ายไฟล์
+			size = uint64(len(data))
+		case 1: // largesize 64 bit
+			if len(data) < 16 {
+				return nil, errors.New("avif box is invalid")
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return nil, errors.New("avif box is invalid")
+		}
+		if string(data[4:8]) == name {
+			return data[header:size], nil
+		}
+		data = data[size:]
+	}
+	return nil, fmt.Errorf("avif %s box not found", name)
+}
@@ -0,0 +1,273 @@
+package filesPatterns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/PHURINTOR/phurinshop/modules/files"
+	"github.com/jmoiron/sqlx"
+)
+
+// ReferencedByQuery product / order ที่ใช้ไฟล์ key อยู่  (json array ของ files.FileReference)
+//   - product : images.url หรือ url รูปย่อใน images.variants ลงท้ายด้วย /<key>
+//   - order   : transfer_slip->>'destination' = key
+func ReferencedByQuery(key string) string {
+	return fmt.Sprintf(`(
+				SELECT
+					COALESCE(jsonb_agg("rt"), '[]'::jsonb)
+				FROM (
+					SELECT
+						'product' AS "type",
+						"i"."product_id" AS "id"
+					FROM "images" "i"
+					WHERE right("i"."url", length(%[1]s) + 1) = '/' || %[1]s
+					OR EXISTS (
+						SELECT 1
+						FROM jsonb_each_text("i"."variants") "v"
+						WHERE right("v"."value", length(%[1]s) + 1) = '/' || %[1]s
+					)
+					UNION
+					SELECT
+						'order' AS "type",
+						"o"."id"
+					FROM "orders" "o"
+					WHERE "o"."transfer_slip"->>'destination' = %[1]s
+				) AS "rt"
+			)`, key)
+}
+
+// =================================================== Builder ======================================
+// ---------------- Builder Interface -------------
+type IFindFilesBuilder interface {
+	initQuery()
+	initCountQuery()
+	buildWhereSearch()
+	buildWhereMime()
+	buildWhereUser()
+	buildWhereReferenced()
+	buildSort()
+	buildPaginate()
+	closeQuery()
+	getQuery() string
+	setQuery(query string)
+	getValues() []any
+	setValues(data []any)
+	setLastIndex(n int)
+	getDb() *sqlx.DB
+	reset()
+}
+
+// ---------------- Builder Stuct ------------------------
+type findFilesBuilder struct {
+	db        *sqlx.DB
+	req       *files.FileFilter
+	query     string
+	values    []any
+	lastIndex int
+}
+
+// ---------------- Builder Constructor ------------------
+func FindFilesBuilder(db *sqlx.DB, req *files.FileFilter) IFindFilesBuilder {
+	return &findFilesBuilder{
+		db:     db,
+		req:    req,
+		values: make([]any, 0),
+	}
+}
+
+// =================================================== Engineer ======================================
+// ---------------- Engineer Stuct ------------------------
+type findFilesEngineer struct {
+	builder IFindFilesBuilder
+}
+
+// ---------------- Engineer Constructor ------------------
+func FindFilesEngineer(b IFindFilesBuilder) *findFilesEngineer {
+	return &findFilesEngineer{builder: b}
+}
+
+// ---------------- Builder Missing Function -------------
+
+func (b *findFilesBuilder) initQuery() {
+	b.query += fmt.Sprintf(`
+	SELECT
+		array_to_json(array_agg("at"))
+	FROM (
+		SELECT
+			"f"."id",
+			"f"."key",
+			"f"."filename",
+			"f"."size",
+			"f"."mime",
+			"f"."checksum",
+			"f"."private",
+			"f"."ref_count",
+			"f"."variants",
+			"f"."user_id",
+			%s AS "referenced_by",
+			"f"."created_at"
+		FROM "files" "f"
+		WHERE 1 = 1`, ReferencedByQuery(`"f"."key"`))
+}
+
+func (b *findFilesBuilder) initCountQuery() {
+	b.query += `
+		SELECT
+			COUNT(*) AS "count"
+		FROM "files" "f"
+		WHERE 1 = 1`
+}
+
+func (b *findFilesBuilder) buildWhereSearch() {
+	if b.req.Search != "" {
+		b.values = append(
+			b.values,
+			"%"+strings.ToLower(b.req.Search)+"%", // key
+			"%"+strings.ToLower(b.req.Search)+"%", // filename
+		)
+
+		b.query += fmt.Sprintf(`
+		AND (
+			LOWER("f"."key") LIKE $%d OR
+			LOWER("f"."filename") LIKE $%d
+		)`,
+			b.lastIndex+1,
+			b.lastIndex+2,
+		)
+
+		b.lastIndex = len(b.values)
+	}
+}
+
+func (b *findFilesBuilder) buildWhereMime() {
+	if b.req.Mime != "" {
+		b.values = append(b.values, strings.ToLower(b.req.Mime))
+
+		b.query += fmt.Sprintf(`
+		AND "f"."mime" = $%d`, b.lastIndex+1)
+
+		b.lastIndex = len(b.values)
+	}
+}
+
+func (b *findFilesBuilder) buildWhereUser() {
+	if b.req.UserId != "" {
+		b.values = append(b.values, b.req.UserId)
+
+		b.query += fmt.Sprintf(`
+		AND "f"."user_id" = $%d`, b.lastIndex+1)
+
+		b.lastIndex = len(b.values)
+	}
+}
+
+// referenced ไม่มี parameter  ค่าถูกตรวจใน handler แล้ว (true | false)
+func (b *findFilesBuilder) buildWhereReferenced() {
+	switch b.req.Referenced {
+	case "true":
+		b.query += fmt.Sprintf(`
+		AND jsonb_array_length(%s) > 0`, ReferencedByQuery(`"f"."key"`))
+	case "false":
+		b.query += fmt.Sprintf(`
+		AND jsonb_array_length(%s) = 0`, ReferencedByQuery(`"f"."key"`))
+	}
+}
+
+// order_by เป็นชื่อ column ที่ handler เลือกจาก map แล้ว  ใส่ตรงๆ ได้ (ใส่เป็น parameter จะกลายเป็นค่าคงที่ ไม่เรียงให้)
+func (b *findFilesBuilder) buildSort() {
+	b.query += fmt.Sprintf(`
+		ORDER BY %s %s`, b.req.OrderBy, b.req.Sort)
+}
+
+func (b *findFilesBuilder) buildPaginate() {
+	b.values = append(
+		b.values,
+		(b.req.Page-1)*b.req.Limit, // offset  = page-1* limit
+		b.req.Limit,
+	)
+
+	b.query += fmt.Sprintf(`
+		OFFSET $%d LIMIT $%d`, b.lastIndex+1, b.lastIndex+2)
+
+	b.lastIndex = len(b.values)
+}
+
+func (b *findFilesBuilder) closeQuery() {
+	b.query += `
+	) AS "at"`
+}
+
+func (b *findFilesBuilder) getQuery() string { return b.query }
+
+func (b *findFilesBuilder) setQuery(query string) { b.query = query }
+
+func (b *findFilesBuilder) getValues() []any { return b.values }
+
+func (b *findFilesBuilder) setValues(data []any) { b.values = data }
+
+func (b *findFilesBuilder) setLastIndex(n int) { b.lastIndex = n }
+
+func (b *findFilesBuilder) getDb() *sqlx.DB { return b.db }
+
+func (b *findFilesBuilder) reset() {
+	b.query = ""
+	b.values = make([]any, 0)
+	b.lastIndex = 0
+}
+
+// ---------------- Engineer Missing Function -------------
+// Find
+func (en *findFilesEngineer) FindFiles() []*files.File {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	en.builder.initQuery()
+	en.builder.buildWhereSearch()
+	en.builder.buildWhereMime()
+	en.builder.buildWhereUser()
+	en.builder.buildWhereReferenced()
+	en.builder.buildSort()
+	en.builder.buildPaginate()
+	en.builder.closeQuery()
+
+	raw := make([]byte, 0)
+	if err := en.builder.getDb().GetContext(ctx, &raw, en.builder.getQuery(), en.builder.getValues()...); err != nil {
+		log.Printf("get files failed: %v\n", err)
+		en.builder.reset()
+		return make([]*files.File, 0)
+	}
+
+	filesData := make([]*files.File, 0)
+	if err := json.Unmarshal(raw, &filesData); err != nil {
+		log.Printf("unmarshal files failed: %v\n", err)
+	}
+
+	en.builder.reset()
+	return filesData
+}
+
+// Count
+func (en *findFilesEngineer) CountFiles() int {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	en.builder.initCountQuery()
+	en.builder.buildWhereSearch()
+	en.builder.buildWhereMime()
+	en.builder.buildWhereUser()
+	en.builder.buildWhereReferenced()
+
+	var count int
+	if err := en.builder.getDb().GetContext(ctx, &count, en.builder.getQuery(), en.builder.getValues()...); err != nil {
+		log.Printf("count files failed: %v\n", err)
+		en.builder.reset()
+		return 0
+	}
+
+	en.builder.reset()
+	return count
+}
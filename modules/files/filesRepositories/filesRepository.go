@@ -0,0 +1,484 @@
+package filesRepositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PHURINTOR/phurinshop/modules/files"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesPatterns"
+	"github.com/jmoiron/sqlx"
+)
+
+// ======================================= Interface =========================================
+type IFilesRepository interface {
+	InsertFiles(req []*files.File) error
+	FindOneFile(fileId string) (*files.File, error)
+	FindFiles(req *files.FileFilter) ([]*files.File, int)
+	FindFileReferences(keys []string) (map[string][]*files.FileReference, error)
+	DeleteFiles(keys []string) error
+	ClaimOrphans(keys []string, grace time.Duration) ([]string, error)
+	FindReferences() ([]string, error)
+	FindFilesByChecksum(checksum string) ([]*files.File, error)
+	AcquireFile(fileId string) (*files.File, error)
+	AcquireFilesTx(tx *sqlx.Tx, keys []string) ([]string, error)
+	ReleaseFiles(keys []string) ([]*files.File, error)
+	ReleaseFilesTx(tx *sqlx.Tx, keys []string) ([]*files.File, error)
+	InsertOutboxEvent(tx *sqlx.Tx, eventType string, payload any) error
+	EnqueueOutboxEvent(eventType string, payload any) error
+	ClaimOutboxEvents(eventType string, limit int, lease time.Duration) ([]*files.OutboxEvent, error)
+	DeleteOutboxEvent(eventId string) error
+	RetryOutboxEvent(eventId string, lastError string, delay time.Duration) error
+}
+
+// ======================================= Struct ============================================
+type filesRepository struct {
+	db *sqlx.DB
+}
+
+// ======================================= Constructor =======================================
+func FilesRepository(db *sqlx.DB) IFilesRepository {
+	return &filesRepository{db: db}
+}
+
+// ======================================= missing Func =======================================
+
+// ----------------------- Insert Files -------------------
+// upload ทับ key เดิม (ConfirmUpload) = update ข้อมูลไฟล์แทน
+func (r *filesRepository) InsertFiles(req []*files.File) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	query := `
+	INSERT INTO "files" (
+		"key",
+		"filename",
+		"size",
+		"mime",
+		"checksum",
+		"private",
+		"variants",
+		"user_id"
+	)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))
+	ON CONFLICT ("key") DO UPDATE SET
+		"filename" = EXCLUDED."filename",
+		"size" = EXCLUDED."size",
+		"mime" = EXCLUDED."mime",
+		"checksum" = EXCLUDED."checksum",
+		"private" = EXCLUDED."private",
+		"variants" = EXCLUDED."variants",
+		"user_id" = EXCLUDED."user_id",
+		"acquired_at" = now()
+	RETURNING "id";`
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range req {
+		if err := tx.QueryRowxContext(
+			ctx,
+			query,
+			f.Key,
+			f.FileName,
+			f.Size,
+			f.Mime,
+			f.Checksum,
+			f.Private,
+			f.Variants,
+			f.UserId,
+		).Scan(&f.Id); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("insert file %s failed: %v", f.Key, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ----------------------- FindOneFile -------------------
+func (r *filesRepository) FindOneFile(fileId string) (*files.File, error) {
+	query := fmt.Sprintf(`
+	SELECT
+		to_jsonb("t")
+	FROM (
+		SELECT
+			"f"."id",
+			"f"."key",
+			"f"."filename",
+			"f"."size",
+			"f"."mime",
+			"f"."checksum",
+			"f"."private",
+			"f"."ref_count",
+			"f"."variants",
+			"f"."user_id",
+			%s AS "referenced_by",
+			"f"."created_at"
+		FROM "files" "f"
+		WHERE "f"."id"::TEXT = $1
+	) AS "t";`, filesPatterns.ReferencedByQuery(`"f"."key"`))
+
+	raw := make([]byte, 0)
+	if err := r.db.Get(&raw, query, fileId); err != nil {
+		return nil, fmt.Errorf("get file failed: %v", err)
+	}
+
+	file := &files.File{
+		ReferencedBy: make([]*files.FileReference, 0),
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("unmarshal file failed: %v", err)
+	}
+	return file, nil
+}
+
+// ----------------------- FindFiles -------------------
+func (r *filesRepository) FindFiles(req *files.FileFilter) ([]*files.File, int) {
+	builder := filesPatterns.FindFilesBuilder(r.db, req)
+	engineer := filesPatterns.FindFilesEngineer(builder)
+	return engineer.FindFiles(), engineer.CountFiles()
+}
+
+// ----------------------- FindFileReferences -------------------
+// เช็คจาก key ตรงๆ ไม่ต้องมี row ใน files  (ไฟล์เก่าที่ upload ก่อนมีตาราง files ก็เช็คได้)
+// คืนเฉพาะ key ที่ยังมี product / order ใช้อยู่
+func (r *filesRepository) FindFileReferences(keys []string) (map[string][]*files.FileReference, error) {
+	refs := make(map[string][]*files.FileReference)
+	if len(keys) == 0 {
+		return refs, nil
+	}
+
+	query := fmt.Sprintf(`
+	SELECT
+		COALESCE(jsonb_object_agg("t"."key", "t"."referenced_by"), '{}'::jsonb)
+	FROM (
+		SELECT
+			"k"."key",
+			%s AS "referenced_by"
+		FROM unnest($1::VARCHAR[]) AS "k"("key")
+	) AS "t"
+	WHERE jsonb_array_length("t"."referenced_by") > 0;`, filesPatterns.ReferencedByQuery(`"k"."key"`))
+
+	raw := make([]byte, 0)
+	if err := r.db.Get(&raw, query, keys); err != nil {
+		return nil, fmt.Errorf("get file references failed: %v", err)
+	}
+	if err := json.Unmarshal(raw, &refs); err != nil {
+		return nil, fmt.Errorf("unmarshal file references failed: %v", err)
+	}
+	return refs, nil
+}
+
+// ----------------------- DeleteFiles -------------------
+func (r *filesRepository) DeleteFiles(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	// ลบเฉพาะ row ที่ไม่เหลือคนใช้ (ReleaseFiles / ClaimOrphans ลด ref_count เป็น 0 แล้ว)  ไฟล์ที่ยังมีคนถืออยู่ไม่หายจาก registry
+	query := `
+	DELETE FROM "files"
+	WHERE "key" = ANY($1::VARCHAR[])
+	AND "ref_count" = 0;`
+
+	if _, err := r.db.ExecContext(context.Background(), query, keys); err != nil {
+		return fmt.Errorf("delete files failed: %v", err)
+	}
+	return nil
+}
+
+// ClaimOrphans gc จองไฟล์ที่จะลบ  lock row (FOR UPDATE) ทับกับ AcquireFile ไม่ได้ ---> ref_count = 0 (acquire ไม่ได้อีก)
+// ไฟล์ที่ถูก upload / acquire ภายใน grace ไม่ลบ  key ที่ไม่มีใน registry (รูปย่อ, ไฟล์ก่อนมี registry) ลบได้
+func (r *filesRepository) ClaimOrphans(keys []string, grace time.Duration) ([]string, error) {
+	if len(keys) == 0 {
+		return make([]string, 0), nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	existing := make([]string, 0)
+	if err := tx.SelectContext(ctx, &existing, `
+	SELECT
+		"key"
+	FROM "files"
+	WHERE "key" = ANY($1::VARCHAR[])
+	ORDER BY "key"
+	FOR UPDATE;`, keys); err != nil {
+		return nil, fmt.Errorf("lock files failed: %v", err)
+	}
+	// lock ครบแล้วค่อยดู acquired_at  (AcquireFile ที่ commit ก่อนหน้านี้เห็นค่าใหม่แล้ว  ที่มาทีหลังรอจน gc commit แล้วเจอ ref_count = 0)
+	stale := make([]string, 0)
+	if err := tx.SelectContext(ctx, &stale, `
+	UPDATE "files" SET
+		"ref_count" = 0
+	WHERE "key" = ANY($1::VARCHAR[])
+	AND "acquired_at" <= now() - make_interval(secs => $2)
+	RETURNING "key";`, keys, grace.Seconds()); err != nil {
+		return nil, fmt.Errorf("claim orphan files failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	registered := make(map[string]bool)
+	for _, key := range existing {
+		registered[key] = true
+	}
+	claimed := stale
+	for _, key := range keys {
+		if !registered[key] {
+			claimed = append(claimed, key)
+		}
+	}
+	return claimed, nil
+}
+
+// ----------------------- FindReferences -------------------
+// url / destination ทั้งหมดที่ product (รูป + รูปย่อ) และ order (สลิป) ใช้อยู่  ใช้ใน gc
+func (r *filesRepository) FindReferences() ([]string, error) {
+	query := `
+	SELECT
+		COALESCE(array_to_json(array_agg("r"."ref")), '[]'::json)
+	FROM (
+		SELECT
+			"i"."url" AS "ref"
+		FROM "images" "i"
+		UNION
+		SELECT
+			"v"."value"
+		FROM "images" "i", jsonb_each_text("i"."variants") AS "v"
+		UNION
+		SELECT
+			"o"."transfer_slip"->>'destination'
+		FROM "orders" "o"
+		WHERE "o"."transfer_slip"->>'destination' IS NOT NULL
+		UNION
+		SELECT
+			"o"."transfer_slip"->>'url'
+		FROM "orders" "o"
+		WHERE "o"."transfer_slip"->>'url' IS NOT NULL
+	) AS "r";`
+
+	raw := make([]byte, 0)
+	if err := r.db.Get(&raw, query); err != nil {
+		return nil, fmt.Errorf("get file references failed: %v", err)
+	}
+
+	refs := make([]string, 0)
+	if err := json.Unmarshal(raw, &refs); err != nil {
+		return nil, fmt.Errorf("unmarshal file references failed: %v", err)
+	}
+	return refs, nil
+}
+
+// ----------------------- Dedup -------------------
+// FindFilesByChecksum ไฟล์ public ที่เนื้อหาเดียวกัน (ยังไม่ถูกลบ)
+func (r *filesRepository) FindFilesByChecksum(checksum string) ([]*files.File, error) {
+	query := `
+	SELECT
+		COALESCE(array_to_json(array_agg("at")), '[]'::json)
+	FROM (
+		SELECT
+			"f"."id",
+			"f"."key",
+			"f"."filename",
+			"f"."size",
+			"f"."mime",
+			"f"."checksum",
+			"f"."private",
+			"f"."ref_count",
+			"f"."variants",
+			"f"."user_id",
+			"f"."created_at"
+		FROM "files" "f"
+		WHERE "f"."checksum" = $1
+		AND "f"."private" = FALSE
+		AND "f"."ref_count" > 0
+		ORDER BY "f"."created_at"
+	) AS "at";`
+
+	raw := make([]byte, 0)
+	if err := r.db.Get(&raw, query, checksum); err != nil {
+		return nil, fmt.Errorf("get files by checksum failed: %v", err)
+	}
+
+	filesData := make([]*files.File, 0)
+	if err := json.Unmarshal(raw, &filesData); err != nil {
+		return nil, fmt.Errorf("unmarshal files failed: %v", err)
+	}
+	return filesData, nil
+}
+
+// AcquireFile ref_count + 1  ไฟล์ถูกลบไปก่อน (ref_count = 0 หรือไม่มี row) = nil
+// UPDATE lock row เดียวกับ ClaimOrphans (FOR UPDATE)  gc จองไปก่อน = ref_count 0 ได้ nil,  acquire ก่อน = acquired_at ใหม่ gc ข้าม
+func (r *filesRepository) AcquireFile(fileId string) (*files.File, error) {
+	query := `
+	UPDATE "files" SET
+		"ref_count" = "ref_count" + 1,
+		"acquired_at" = now()
+	WHERE "id"::TEXT = $1
+	AND "ref_count" > 0
+	RETURNING "id", "key", "ref_count";`
+
+	file := new(files.File)
+	if err := r.db.QueryRowxContext(context.Background(), query, fileId).Scan(&file.Id, &file.Key, &file.RefCount); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("acquire file failed: %v", err)
+	}
+	return file, nil
+}
+
+// AcquireFilesTx ref_count + 1 ใน transaction เดียวกับที่แปะ url ให้ product (import)  คืนเฉพาะ key ที่ acquire ได้
+// lock row เหมือน AcquireFile  gc จองไปแล้ว (ref_count = 0) หรือไม่มี row = ไม่คืน key นั้น
+func (r *filesRepository) AcquireFilesTx(tx *sqlx.Tx, keys []string) ([]string, error) {
+	acquired := make([]string, 0, len(keys))
+	if len(keys) == 0 {
+		return acquired, nil
+	}
+
+	query := `
+	UPDATE "files" SET
+		"ref_count" = "ref_count" + 1,
+		"acquired_at" = now()
+	WHERE "key" = ANY($1::VARCHAR[])
+	AND "ref_count" > 0
+	RETURNING "key";`
+
+	if err := tx.SelectContext(context.Background(), &acquired, query, keys); err != nil {
+		return nil, fmt.Errorf("acquire files failed: %v", err)
+	}
+	return acquired, nil
+}
+
+// ReleaseFiles ref_count - 1  คืนเฉพาะ key ที่มีใน files  (ref_count ที่เหลือ + variants)
+func (r *filesRepository) ReleaseFiles(keys []string) ([]*files.File, error) {
+	return releaseFiles(r.db, keys)
+}
+
+// ReleaseFilesTx ลด ref_count ใน transaction เดียวกับที่ลบ product (คู่กับ InsertOutboxEvent)
+func (r *filesRepository) ReleaseFilesTx(tx *sqlx.Tx, keys []string) ([]*files.File, error) {
+	return releaseFiles(tx, keys)
+}
+
+func releaseFiles(db sqlx.QueryerContext, keys []string) ([]*files.File, error) {
+	if len(keys) == 0 {
+		return make([]*files.File, 0), nil
+	}
+
+	query := `
+	UPDATE "files" SET
+		"ref_count" = GREATEST("ref_count" - 1, 0)
+	WHERE "key" = ANY($1::VARCHAR[])
+	RETURNING "key", "ref_count", "variants";`
+
+	rows, err := db.QueryxContext(context.Background(), query, keys)
+	if err != nil {
+		return nil, fmt.Errorf("release files failed: %v", err)
+	}
+	defer rows.Close()
+
+	released := make([]*files.File, 0)
+	for rows.Next() {
+		file := new(files.File)
+		if err := rows.Scan(&file.Key, &file.RefCount, &file.Variants); err != nil {
+			return nil, fmt.Errorf("release files failed: %v", err)
+		}
+		released = append(released, file)
+	}
+	return released, rows.Err()
+}
+
+// ----------------------- Outbox -------------------
+// InsertOutboxEvent ต้องอยู่ใน transaction เดียวกับข้อมูลที่สร้าง event  rollback = ไม่มี event
+func (r *filesRepository) InsertOutboxEvent(tx *sqlx.Tx, eventType string, payload any) error {
+	return insertOutboxEvent(tx, eventType, payload)
+}
+
+// EnqueueOutboxEvent event ที่ไม่ผูกกับ transaction ไหน  (เช่น ลบไฟล์ไม่สำเร็จ ให้ worker ลองใหม่)
+func (r *filesRepository) EnqueueOutboxEvent(eventType string, payload any) error {
+	return insertOutboxEvent(r.db, eventType, payload)
+}
+
+func insertOutboxEvent(db sqlx.ExecerContext, eventType string, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal outbox payload failed: %v", err)
+	}
+
+	query := `
+	INSERT INTO "outbox" (
+		"event_type",
+		"payload"
+	)
+	VALUES ($1, $2);`
+
+	if _, err := db.ExecContext(context.Background(), query, eventType, string(b)); err != nil {
+		return fmt.Errorf("insert outbox event failed: %v", err)
+	}
+	return nil
+}
+
+// ClaimOutboxEvents ดึง event ที่ถึงเวลาแล้วเลื่อน next_attempt_at ออกไป lease  (worker อื่นจะไม่ได้ event ซ้ำ)
+// worker ตายกลางทาง = event กลับมาให้ทำใหม่เมื่อหมด lease
+func (r *filesRepository) ClaimOutboxEvents(eventType string, limit int, lease time.Duration) ([]*files.OutboxEvent, error) {
+	query := `
+	UPDATE "outbox" SET
+		"next_attempt_at" = now() + make_interval(secs => $3)
+	WHERE "id" IN (
+		SELECT
+			"id"
+		FROM "outbox"
+		WHERE "event_type" = $1
+		AND "next_attempt_at" <= now()
+		ORDER BY "next_attempt_at"
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING "id", "event_type", "payload", "attempts";`
+
+	events := make([]*files.OutboxEvent, 0)
+	if err := r.db.SelectContext(context.Background(), &events, query, eventType, limit, lease.Seconds()); err != nil {
+		return nil, fmt.Errorf("claim outbox events failed: %v", err)
+	}
+	return events, nil
+}
+
+func (r *filesRepository) DeleteOutboxEvent(eventId string) error {
+	query := `DELETE FROM "outbox" WHERE "id" = $1;`
+
+	if _, err := r.db.ExecContext(context.Background(), query, eventId); err != nil {
+		return fmt.Errorf("delete outbox event failed: %v", err)
+	}
+	return nil
+}
+
+func (r *filesRepository) RetryOutboxEvent(eventId string, lastError string, delay time.Duration) error {
+	query := `
+	UPDATE "outbox" SET
+		"attempts" = "attempts" + 1,
+		"last_error" = $2,
+		"next_attempt_at" = now() + make_interval(secs => $3)
+	WHERE "id" = $1;`
+
+	if _, err := r.db.ExecContext(context.Background(), query, eventId, lastError, delay.Seconds()); err != nil {
+		return fmt.Errorf("retry outbox event failed: %v", err)
+	}
+	return nil
+}
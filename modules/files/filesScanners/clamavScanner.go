@@ -0,0 +1,116 @@
+package filesScanners
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ----------Flow  (clamd INSTREAM)
+//    zINSTREAM\0 ---> [ขนาด 4 byte big-endian][ข้อมูล] ... ---> [0 0 0 0] ---> อ่านผลถึง \0
+//    ผล: "stream: OK" | "stream: <ชื่อไวรัส> FOUND" | "<ข้อความ> ERROR"
+
+// chunk ต้องไม่เกิน StreamMaxLength ของ clamd
+const clamavChunkSize = 64 * 1024
+
+// ======================================= Struct ============================================
+type clamavScanner struct {
+	network string // tcp | unix
+	address string
+	timeout time.Duration
+}
+
+// ======================================= Constructor =======================================
+// ClamavScanner address = host:port หรือ unix:/path/clamd.ctl
+func ClamavScanner(address string, timeout time.Duration) IFilesScanner {
+	s := &clamavScanner{
+		network: "tcp",
+		address: address,
+		timeout: timeout,
+	}
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		s.network = "unix"
+		s.address = path
+	}
+	return s
+}
+
+// ======================================= Missing Function ==================================
+func (s *clamavScanner) Scan(ctx context.Context, file io.Reader) (*ScanResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	dialer := new(net.Dialer)
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return nil, fmt.Errorf("connect clamd failed: %v", err)
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if err := s.stream(conn, file); err != nil {
+		return nil, fmt.Errorf("send file to clamd failed: %v", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read clamd reply failed: %v", err)
+	}
+	return parseClamavReply(reply)
+}
+
+func (s *clamavScanner) stream(conn net.Conn, file io.Reader) error {
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return err
+	}
+
+	buf := make([]byte, clamavChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, werr := conn.Write(size); werr != nil {
+				return werr
+			}
+			if _, werr := conn.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// chunk ขนาด 0 = จบไฟล์
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+func parseClamavReply(reply string) (*ScanResult, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	switch {
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(reply, " FOUND")
+		if _, after, ok := strings.Cut(signature, ": "); ok {
+			signature = after
+		}
+		return &ScanResult{Infected: true, Signature: signature}, nil
+	case strings.HasSuffix(reply, ": OK"):
+		return &ScanResult{}, nil
+	default:
+		return nil, fmt.Errorf("clamd: %s", reply)
+	}
+}
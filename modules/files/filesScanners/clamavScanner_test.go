@@ -0,0 +1,129 @@
+package filesScanners
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd รับ 1 connection  อ่าน zINSTREAM จนเจอ chunk ขนาด 0 แล้วตอบ reply
+// reply == "" = ไม่ตอบ (ให้ scanner timeout)
+func fakeClamd(t *testing.T, reply string) (string, <-chan []byte) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		cmd, err := r.ReadString(0)
+		if err != nil || cmd != "zINSTREAM\x00" {
+			received <- nil
+			return
+		}
+
+		body := new(bytes.Buffer)
+		size := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(r, size); err != nil {
+				received <- nil
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			if n == 0 {
+				break
+			}
+			if _, err := io.CopyN(body, r, int64(n)); err != nil {
+				received <- nil
+				return
+			}
+		}
+		received <- body.Bytes()
+
+		if reply == "" {
+			// ค้างไว้จน client ปิด connection
+			io.Copy(io.Discard, r)
+			return
+		}
+		conn.Write([]byte(reply + "\x00"))
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestClamavScannerClean(t *testing.T) {
+	addr, received := fakeClamd(t, "stream: OK")
+	file := bytes.Repeat([]byte("a"), clamavChunkSize*2+10) // หลาย chunk
+
+	res, err := ClamavScanner(addr, time.Second).Scan(context.Background(), bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if res.Infected {
+		t.Fatalf("expected clean, got infected %q", res.Signature)
+	}
+	if got := <-received; !bytes.Equal(got, file) {
+		t.Fatalf("clamd received %d bytes, want %d", len(got), len(file))
+	}
+}
+
+func TestClamavScannerFound(t *testing.T) {
+	addr, _ := fakeClamd(t, "stream: Eicar-Test-Signature FOUND")
+
+	res, err := ClamavScanner(addr, time.Second).Scan(context.Background(), strings.NewReader("X5O!P%@AP"))
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if !res.Infected || res.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("expected infected Eicar-Test-Signature, got %+v", res)
+	}
+}
+
+func TestClamavScannerError(t *testing.T) {
+	addr, _ := fakeClamd(t, "INSTREAM size limit exceeded. ERROR")
+
+	if _, err := ClamavScanner(addr, time.Second).Scan(context.Background(), strings.NewReader("data")); err == nil {
+		t.Fatal("expected error from clamd ERROR reply")
+	}
+}
+
+func TestClamavScannerTimeout(t *testing.T) {
+	addr, _ := fakeClamd(t, "")
+
+	start := time.Now()
+	_, err := ClamavScanner(addr, 200*time.Millisecond).Scan(context.Background(), strings.NewReader("data"))
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("scan did not honor timeout, took %v", elapsed)
+	}
+}
+
+func TestClamavScannerUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	if _, err := ClamavScanner(addr, time.Second).Scan(context.Background(), strings.NewReader("data")); err == nil {
+		t.Fatal("expected connect error")
+	}
+}
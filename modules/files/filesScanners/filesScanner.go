@@ -0,0 +1,47 @@
+package filesScanners
+
+import (
+	"context"
+	"io"
+
+	"github.com/PHURINTOR/phurinshop/config"
+)
+
+// ======================================= Enum  ============================================
+type ScannerDriver string
+
+const (
+	NoneDriver   ScannerDriver = "none"   // ไม่สแกน
+	ClamavDriver ScannerDriver = "clamav" // clamd (INSTREAM)
+)
+
+// ======================================= Struct ============================================
+// ScanResult ผลสแกน 1 ไฟล์  Signature = ชื่อไวรัสที่เจอ
+type ScanResult struct {
+	Infected  bool
+	Signature string
+}
+
+// ======================================= Interface =========================================
+// IFilesScanner สแกนเนื้อไฟล์ก่อนขึ้น storage  error = สแกนไม่ได้ (ไม่ใช่ไฟล์ติดไวรัส)
+type IFilesScanner interface {
+	Scan(ctx context.Context, file io.Reader) (*ScanResult, error)
+}
+
+// ======================================= Constructor =======================================
+// เลือก driver ตาม APP_SCANNER_DRIVER  (ค่าถูกตรวจตอน load config แล้ว)
+func FilesScanner(cfg config.IConfig) IFilesScanner {
+	switch ScannerDriver(cfg.App().ScannerDriver()) {
+	case ClamavDriver:
+		return ClamavScanner(cfg.App().ScannerAddress(), cfg.App().ScannerTimeout())
+	default:
+		return noneScanner{}
+	}
+}
+
+// ---------------- none
+type noneScanner struct{}
+
+func (noneScanner) Scan(ctx context.Context, file io.Reader) (*ScanResult, error) {
+	return &ScanResult{}, nil
+}
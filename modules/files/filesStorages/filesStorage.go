@@ -0,0 +1,115 @@
+package filesStorages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PHURINTOR/phurinshop/config"
+)
+
+// ======================================= Enum  ============================================
+type StorageDriver string
+
+const (
+	GcsDriver   StorageDriver = "gcs"
+	LocalDriver StorageDriver = "local"
+	S3Driver    StorageDriver = "s3" // AWS S3, MinIO และ storage ที่ใช้ S3 protocol
+)
+
+// ======================================= Error =============================================
+// ErrObjectNotFound Delete ไฟล์ที่ไม่มีอยู่แล้ว  worker ที่ลบซ้ำ (outbox retry) ถือว่าลบสำเร็จ
+var ErrObjectNotFound = errors.New("object not found")
+
+// ======================================= Struct ============================================
+// SignedUrlOpts url ชั่วคราวที่ให้ client PUT/GET ไฟล์ตรงกับ bucket  ไม่ต้องผ่าน api server
+type SignedUrlOpts struct {
+	Method      string // PUT | GET
+	ContentType string // PUT ต้องส่ง Content-Type ตรงกับที่ sign ไว้
+	Expires     time.Duration
+}
+
+// ObjectAttrs ไฟล์ใน bucket จาก List
+type ObjectAttrs struct {
+	Key       string
+	Size      int64
+	UpdatedAt time.Time
+}
+
+// ======================================= Interface =========================================
+// IFilesStorage คือตัวกลางระหว่าง filesUsecase กับที่เก็บไฟล์จริง (GCP bucket, S3, local disk)
+// เปิด 1 ครั้งต่อ 1 request แล้วต้อง Close ทุกครั้ง
+type IFilesStorage interface {
+	Upload(ctx context.Context, destination string, file io.Reader) error
+	MakePublic(ctx context.Context, destination string) error
+	Delete(ctx context.Context, destination string) error
+	Open(ctx context.Context, destination string) (io.ReadCloser, error)
+	List(ctx context.Context, prefix string) ([]*ObjectAttrs, error)
+	SignedUrl(ctx context.Context, destination string, opts *SignedUrlOpts) (string, error)
+	Url(destination string) string
+	Close() error
+}
+
+// ======================================= Constructor =======================================
+// เลือก driver ตาม APP_STORAGE_DRIVER
+func FilesStorage(ctx context.Context, cfg config.IConfig) (IFilesStorage, error) {
+	switch StorageDriver(cfg.App().StorageDriver()) {
+	case LocalDriver:
+		return localStorage(cfg)
+	case GcsDriver:
+		return gcsStorage(ctx, cfg)
+	case S3Driver:
+		return s3Storage(cfg)
+	default:
+		return nil, fmt.Errorf("storage driver %q is not supported", cfg.App().StorageDriver())
+	}
+}
+
+// BaseUrl url ของ bucket ที่ต่อด้วย key แล้วได้ public url ของไฟล์  (APP_STORAGE_URL ทับค่า default ของ driver)
+func BaseUrl(cfg config.IConfig) string {
+	if base := cfg.App().StorageUrl(); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	switch StorageDriver(cfg.App().StorageDriver()) {
+	case GcsDriver:
+		return fmt.Sprintf("https://storage.googleapis.com/%s", cfg.App().StorageBucket())
+	case S3Driver:
+		return s3BaseUrl(cfg)
+	default:
+		return fmt.Sprintf("http://%s/storage", cfg.App().Url())
+	}
+}
+
+// ObjectKey public url ---> key ใน bucket ของเรา  scheme, host, path ต้องขึ้นต้นด้วย BaseUrl  url ภายนอก = false
+func ObjectKey(cfg config.IConfig, rawUrl string) (string, bool) {
+	base, err := url.Parse(BaseUrl(cfg))
+	if err != nil {
+		return "", false
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil || !strings.EqualFold(u.Scheme, base.Scheme) || !strings.EqualFold(u.Host, base.Host) {
+		return "", false
+	}
+	key, ok := strings.CutPrefix(u.Path, strings.TrimSuffix(base.Path, "/")+"/")
+	if !ok || key == "" || path.Clean("/" + key)[1:] != key {
+		return "", false
+	}
+	return key, true
+}
+
+// IsPrivate ไฟล์ใต้ APP_STORAGE_PRIVATE_PREFIX, APP_SCANNER_QUARANTINE_PREFIX ห้าม make public  เปิดได้ผ่าน signed url เท่านั้น
+func IsPrivate(cfg config.IConfig, destination string) bool {
+	key := path.Clean("/" + destination)[1:] + "/"
+	return strings.HasPrefix(key, cfg.App().StoragePrivatePrefix()+"/") ||
+		strings.HasPrefix(key, cfg.App().QuarantinePrefix()+"/")
+}
+
+// QuarantineKey ที่เก็บไฟล์ติดไวรัส  <quarantine>/<destination เดิม>
+func QuarantineKey(cfg config.IConfig, destination string) string {
+	return cfg.App().QuarantinePrefix() + "/" + strings.TrimPrefix(path.Clean("/"+destination), "/")
+}
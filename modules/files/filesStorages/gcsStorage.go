@@ -0,0 +1,124 @@
+package filesStorages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/PHURINTOR/phurinshop/config"
+	"google.golang.org/api/iterator"
+)
+
+// ======================================= Struct ============================================
+type gcsFilesStorage struct {
+	cfg    config.IConfig
+	client *storage.Client
+}
+
+// ======================================= Constructor =======================================
+func gcsStorage(ctx context.Context, cfg config.IConfig) (IFilesStorage, error) {
+	// GCP  open connect to storage Bucket
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("storage.NewClient: %w", err)
+	}
+	return &gcsFilesStorage{
+		cfg:    cfg,
+		client: client,
+	}, nil
+}
+
+// ======================================= Missing Function ==================================
+func (s *gcsFilesStorage) Upload(ctx context.Context, destination string, file io.Reader) error {
+	wc := s.client.Bucket(s.cfg.App().StorageBucket()).Object(destination).NewWriter(ctx)
+
+	// Upload an object with storage.Writer.
+	if _, err := io.Copy(wc, file); err != nil {
+		return fmt.Errorf("io.Copy: %w", err)
+	}
+
+	// Data can continue to be added to the file until the writer is closed.
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("Writer.Close: %w", err)
+	}
+	return nil
+}
+
+// makePublic gives all users read access to an object.
+func (s *gcsFilesStorage) MakePublic(ctx context.Context, destination string) error {
+	acl := s.client.Bucket(s.cfg.App().StorageBucket()).Object(destination).ACL()
+	if err := acl.Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
+		return fmt.Errorf("ACLHandle.Set: %w", err)
+	}
+	fmt.Printf("Blob %v is now publicly accessible.\n", destination)
+	return nil
+}
+
+func (s *gcsFilesStorage) Delete(ctx context.Context, destination string) error {
+	o := s.client.Bucket(s.cfg.App().StorageBucket()).Object(destination)
+
+	attrs, err := o.Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return fmt.Errorf("%w: %s", ErrObjectNotFound, destination)
+		}
+		return fmt.Errorf("object.Attrs: %v", err)
+	}
+	o = o.If(storage.Conditions{GenerationMatch: attrs.Generation})
+
+	if err := o.Delete(ctx); err != nil {
+		return fmt.Errorf("Object(%q).Delete: %v", destination, err)
+	}
+	return nil
+}
+
+func (s *gcsFilesStorage) Open(ctx context.Context, destination string) (io.ReadCloser, error) {
+	rc, err := s.client.Bucket(s.cfg.App().StorageBucket()).Object(destination).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Object(%q).NewReader: %w", destination, err)
+	}
+	return rc, nil
+}
+
+func (s *gcsFilesStorage) List(ctx context.Context, prefix string) ([]*ObjectAttrs, error) {
+	objects := make([]*ObjectAttrs, 0)
+	it := s.client.Bucket(s.cfg.App().StorageBucket()).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Bucket.Objects(%q): %w", prefix, err)
+		}
+		objects = append(objects, &ObjectAttrs{
+			Key:       attrs.Name,
+			Size:      attrs.Size,
+			UpdatedAt: attrs.Updated,
+		})
+	}
+}
+
+// SignedUrl v4  service account ต้องมีสิทธิ์ sign (private key หรือ iam.serviceAccounts.signBlob)
+func (s *gcsFilesStorage) SignedUrl(ctx context.Context, destination string, opts *SignedUrlOpts) (string, error) {
+	url, err := s.client.Bucket(s.cfg.App().StorageBucket()).SignedURL(destination, &storage.SignedURLOptions{
+		Scheme:      storage.SigningSchemeV4,
+		Method:      opts.Method,
+		ContentType: opts.ContentType,
+		Expires:     time.Now().Add(opts.Expires),
+	})
+	if err != nil {
+		return "", fmt.Errorf("SignedURL(%q): %w", destination, err)
+	}
+	return url, nil
+}
+
+func (s *gcsFilesStorage) Url(destination string) string {
+	return BaseUrl(s.cfg) + "/" + strings.TrimPrefix(destination, "/")
+}
+
+func (s *gcsFilesStorage) Close() error { return s.client.Close() }
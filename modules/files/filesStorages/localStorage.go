@@ -0,0 +1,222 @@
+package filesStorages
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PHURINTOR/phurinshop/config"
+)
+
+// ======================================= Struct ============================================
+// local driver เขียนไฟล์ลง disk ใต้ APP_STORAGE_ROOT แล้วให้ Fiber static route (/storage) เป็นคนเสิร์ฟไฟล์
+type localFilesStorage struct {
+	cfg  config.IConfig
+	root string
+}
+
+// ======================================= Constructor =======================================
+// สร้างทุก request  ห้ามแตะ disk ที่นี่ (root สร้างครั้งเดียวตอน start ใน InitLocalStorage)
+func localStorage(cfg config.IConfig) (IFilesStorage, error) {
+	root, err := filepath.Abs(cfg.App().StorageRoot())
+	if err != nil {
+		return nil, fmt.Errorf("storage root is invalid: %v", err)
+	}
+	return &localFilesStorage{
+		cfg:  cfg,
+		root: root,
+	}, nil
+}
+
+// InitLocalStorage สร้าง APP_STORAGE_ROOT ครั้งเดียวตอน start server
+func InitLocalStorage(cfg config.IConfig) error {
+	root, err := filepath.Abs(cfg.App().StorageRoot())
+	if err != nil {
+		return fmt.Errorf("storage root is invalid: %v", err)
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("create storage root failed: %v", err)
+	}
+	return nil
+}
+
+// ======================================= Missing Function ==================================
+// path จริงบน disk  กัน destination แบบ ../../ หลุดออกนอก root
+func (s *localFilesStorage) path(destination string) (string, error) {
+	p := filepath.Join(s.root, filepath.FromSlash(destination))
+	if p != s.root && !strings.HasPrefix(p, s.root+string(os.PathSeparator)) {
+		return "", fmt.Errorf("destination %q is outside storage root", destination)
+	}
+	return p, nil
+}
+
+func (s *localFilesStorage) Upload(ctx context.Context, destination string, file io.Reader) error {
+	p, err := s.path(destination)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("create directory failed: %v", err)
+	}
+
+	// เขียนลงไฟล์ชั่วคราวก่อนแล้วค่อย rename  ไฟล์จะได้ไม่ค้างครึ่งๆ กลางๆ
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("create file failed: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, file); err != nil {
+		tmp.Close()
+		return fmt.Errorf("io.Copy: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("file.Close: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("rename file failed: %v", err)
+	}
+	return nil
+}
+
+// ไฟล์ใน local root เปิดอ่านผ่าน static route อยู่แล้ว
+func (s *localFilesStorage) MakePublic(ctx context.Context, destination string) error {
+	p, err := s.path(destination)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(p, 0644)
+}
+
+func (s *localFilesStorage) Delete(ctx context.Context, destination string) error {
+	p, err := s.path(destination)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrObjectNotFound, destination)
+		}
+		return fmt.Errorf("delete file %q failed: %v", destination, err)
+	}
+	return nil
+}
+
+func (s *localFilesStorage) Open(ctx context.Context, destination string) (io.ReadCloser, error) {
+	p, err := s.path(destination)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// List prefix แบบเดียวกับ bucket  ("images/products" จะได้ทั้ง images/products/... และ images/products-old/...)
+func (s *localFilesStorage) List(ctx context.Context, prefix string) ([]*ObjectAttrs, error) {
+	objects := make([]*ObjectAttrs, 0)
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if d.IsDir() {
+			// ข้าม folder ที่ไม่มีทางขึ้นต้นด้วย prefix
+			if key != "." && !strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, &ObjectAttrs{
+			Key:       key,
+			Size:      info.Size(),
+			UpdatedAt: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list %q failed: %v", prefix, err)
+	}
+	return objects, nil
+}
+
+// SignedUrl local ไม่มี bucket ให้ sign  เลย sign ด้วย HMAC แล้วให้ route /v1/files/signed/* ของเราเป็นคนรับ-ส่งไฟล์
+func (s *localFilesStorage) SignedUrl(ctx context.Context, destination string, opts *SignedUrlOpts) (string, error) {
+	if _, err := s.path(destination); err != nil {
+		return "", err
+	}
+	expires := time.Now().Add(opts.Expires).Unix()
+
+	query := url.Values{}
+	query.Set("method", opts.Method)
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	if opts.ContentType != "" {
+		query.Set("content_type", opts.ContentType)
+	}
+	query.Set("signature", localSignature(s.cfg, opts.Method, destination, opts.ContentType, expires))
+	return fmt.Sprintf("http://%s/v1/files/signed/%s?%s", s.cfg.App().Url(), strings.TrimPrefix(destination, "/"), query.Encode()), nil
+}
+
+func (s *localFilesStorage) Url(destination string) string {
+	return BaseUrl(s.cfg) + "/" + strings.TrimPrefix(destination, "/")
+}
+
+func (s *localFilesStorage) Close() error { return nil }
+
+// ------------------------- local signed url
+// VerifyLocalSignature ตรวจ url ที่ได้จาก SignedUrl ของ local driver
+func VerifyLocalSignature(cfg config.IConfig, method, destination, contentType string, expires int64, signature string) error {
+	if time.Now().Unix() > expires {
+		return fmt.Errorf("signed url is expired")
+	}
+	expected := localSignature(cfg, method, destination, contentType, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature is invalid")
+	}
+	return nil
+}
+
+// LocalIsPublic ไฟล์ที่ยังไม่ได้ MakePublic (private) จะไม่ถูกเสิร์ฟผ่าน static route
+func LocalIsPublic(cfg config.IConfig, destination string) bool {
+	if IsPrivate(cfg, destination) {
+		return false
+	}
+	s, err := localStorage(cfg)
+	if err != nil {
+		return false
+	}
+	p, err := s.(*localFilesStorage).path(destination)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return false
+	}
+	return info.Mode().Perm()&0004 != 0
+}
+
+func localSignature(cfg config.IConfig, method, destination, contentType string, expires int64) string {
+	mac := hmac.New(sha256.New, cfg.Jwt().SecretKey())
+	mac.Write([]byte(fmt.Sprintf("%s\n%s\n%s\n%d", method, strings.TrimPrefix(destination, "/"), contentType, expires)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,172 @@
+package filesStorages
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/PHURINTOR/phurinshop/config"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// ======================================= Struct ============================================
+// s3 driver ใช้ได้ทั้ง AWS S3 และ MinIO (APP_STORAGE_PATH_STYLE=true)
+type s3FilesStorage struct {
+	cfg    config.IConfig
+	client *minio.Client
+}
+
+// ======================================= Constructor =======================================
+func s3Storage(cfg config.IConfig) (IFilesStorage, error) {
+	// ไม่ได้ใส่ key ไว้ใน env = อ่านจาก AWS_ACCESS_KEY_ID / MINIO_ROOT_USER หรือ IAM role ของเครื่อง
+	creds := credentials.NewStaticV4(cfg.App().StorageAccessKey(), cfg.App().StorageSecretKey(), "")
+	if cfg.App().StorageAccessKey() == "" {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+		})
+	}
+
+	lookup := minio.BucketLookupDNS
+	if cfg.App().StoragePathStyle() {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(cfg.App().StorageEndpoint(), &minio.Options{
+		Creds:        creds,
+		Secure:       cfg.App().StorageUseSSL(),
+		Region:       cfg.App().StorageRegion(),
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("minio.New: %w", err)
+	}
+	return &s3FilesStorage{
+		cfg:    cfg,
+		client: client,
+	}, nil
+}
+
+// ======================================= Missing Function ==================================
+func (s *s3FilesStorage) Upload(ctx context.Context, destination string, file io.Reader) error {
+	// size = -1 ให้ client แบ่ง multipart upload เอง
+	if _, err := s.client.PutObject(ctx, s.cfg.App().StorageBucket(), destination, file, -1, minio.PutObjectOptions{
+		ContentType: mime.TypeByExtension(filepath.Ext(destination)),
+	}); err != nil {
+		return fmt.Errorf("PutObject(%q): %w", destination, err)
+	}
+	return nil
+}
+
+// MakePublic = public-read ACL เหมือน storage.AllUsers ของ gcs
+// S3 ไม่มี api set ACL แยก  เลย copy ทับตัวเองพร้อม x-amz-acl (ต้องใส่ content-type เดิมกลับไปด้วย)
+func (s *s3FilesStorage) MakePublic(ctx context.Context, destination string) error {
+	bucket := s.cfg.App().StorageBucket()
+
+	info, err := s.client.StatObject(ctx, bucket, destination, minio.StatObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("StatObject(%q): %w", destination, err)
+	}
+
+	if _, err := s.client.CopyObject(ctx,
+		minio.CopyDestOptions{
+			Bucket:          bucket,
+			Object:          destination,
+			ReplaceMetadata: true,
+			UserMetadata: map[string]string{
+				"x-amz-acl":    "public-read",
+				"Content-Type": info.ContentType,
+			},
+		},
+		minio.CopySrcOptions{
+			Bucket: bucket,
+			Object: destination,
+		},
+	); err != nil {
+		return fmt.Errorf("set public-read acl %q: %w", destination, err)
+	}
+	fmt.Printf("Blob %v is now publicly accessible.\n", destination)
+	return nil
+}
+
+func (s *s3FilesStorage) Delete(ctx context.Context, destination string) error {
+	// S3 ลบ key ที่ไม่มีอยู่จะไม่ error  เช็คก่อนให้เหมือน gcs
+	if _, err := s.client.StatObject(ctx, s.cfg.App().StorageBucket(), destination, minio.StatObjectOptions{}); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return fmt.Errorf("%w: %s", ErrObjectNotFound, destination)
+		}
+		return fmt.Errorf("StatObject(%q): %v", destination, err)
+	}
+	if err := s.client.RemoveObject(ctx, s.cfg.App().StorageBucket(), destination, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("Object(%q).Delete: %v", destination, err)
+	}
+	return nil
+}
+
+func (s *s3FilesStorage) Open(ctx context.Context, destination string) (io.ReadCloser, error) {
+	// GetObject ไม่ error จนกว่าจะอ่าน  stat ก่อนให้รู้ว่าไม่มีไฟล์ตั้งแต่ตอนเปิด
+	if _, err := s.client.StatObject(ctx, s.cfg.App().StorageBucket(), destination, minio.StatObjectOptions{}); err != nil {
+		return nil, fmt.Errorf("StatObject(%q): %w", destination, err)
+	}
+	obj, err := s.client.GetObject(ctx, s.cfg.App().StorageBucket(), destination, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("GetObject(%q): %w", destination, err)
+	}
+	return obj, nil
+}
+
+func (s *s3FilesStorage) List(ctx context.Context, prefix string) ([]*ObjectAttrs, error) {
+	objects := make([]*ObjectAttrs, 0)
+	for obj := range s.client.ListObjects(ctx, s.cfg.App().StorageBucket(), minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("ListObjects(%q): %w", prefix, obj.Err)
+		}
+		objects = append(objects, &ObjectAttrs{
+			Key:       obj.Key,
+			Size:      obj.Size,
+			UpdatedAt: obj.LastModified,
+		})
+	}
+	return objects, nil
+}
+
+func (s *s3FilesStorage) SignedUrl(ctx context.Context, destination string, opts *SignedUrlOpts) (string, error) {
+	header := make(http.Header)
+	if opts.ContentType != "" {
+		header.Set("Content-Type", opts.ContentType)
+	}
+	u, err := s.client.PresignHeader(ctx, opts.Method, s.cfg.App().StorageBucket(), destination, opts.Expires, nil, header)
+	if err != nil {
+		return "", fmt.Errorf("PresignHeader(%q): %w", destination, err)
+	}
+	return u.String(), nil
+}
+
+func (s *s3FilesStorage) Url(destination string) string {
+	return BaseUrl(s.cfg) + "/" + strings.TrimPrefix(destination, "/")
+}
+
+// s3BaseUrl virtual-hosted style (bucket.endpoint) หรือ path style (endpoint/bucket) ตาม APP_STORAGE_PATH_STYLE
+func s3BaseUrl(cfg config.IConfig) string {
+	scheme := "https"
+	if !cfg.App().StorageUseSSL() {
+		scheme = "http"
+	}
+	endpoint := strings.TrimSuffix(cfg.App().StorageEndpoint(), "/")
+	if cfg.App().StoragePathStyle() {
+		return fmt.Sprintf("%s://%s/%s", scheme, endpoint, cfg.App().StorageBucket())
+	}
+	return fmt.Sprintf("%s://%s.%s", scheme, cfg.App().StorageBucket(), endpoint)
+}
+
+// minio client ไม่ต้องปิด connection
+func (s *s3FilesStorage) Close() error { return nil }
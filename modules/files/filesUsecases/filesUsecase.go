@@ -3,25 +3,67 @@ package filesUsecases
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"log"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
-	"cloud.google.com/go/storage"
 	"github.com/PHURINTOR/phurinshop/config"
+	"github.com/PHURINTOR/phurinshop/modules/entities"
 	"github.com/PHURINTOR/phurinshop/modules/files"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesImages"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesRepositories"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesScanners"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesStorages"
+	"github.com/PHURINTOR/phurinshop/pkg/utils"
+	"github.com/jmoiron/sqlx"
 )
 
+// ======================================= Error =============================================
+// ErrFileInfected ไฟล์ติดไวรัส  ถูกย้ายไป APP_SCANNER_QUARANTINE_PREFIX แล้ว ไม่ขึ้น destination
+var ErrFileInfected = errors.New("file is infected")
+
+// ErrConfirmForbidden confirm_token ไม่ตรงกับ user / destination หรือหมดอายุ  (403)
+var ErrConfirmForbidden = errors.New("destination was not staged by this user")
+
+// ErrFileNotFound ไฟล์ไม่มีใน files registry หรือกำลังถูกลบ (ref_count = 0)
+var ErrFileNotFound = errors.New("file is not found")
+
 // ======================================= Interface =========================================
 type IFilesUsecase interface {
+	PrepareUpload(file *multipart.FileHeader, destination string) (*files.FileReq, error)
 	UploadToGCP(req []*files.FileReq) ([]*files.FileRes, error)
 	DeleteFileGCP(req []*files.DeleteFileReq) error
+	DeleteFileLater(tx *sqlx.Tx, req []*files.DeleteFileReq) error
+	AcquireFiles(tx *sqlx.Tx, keys []string) error
+	SignUploadUrl(req *files.SignedUrlReq) (*files.SignedUrlRes, error)
+	SignDownloadUrl(req *files.SignedUrlReq) (*files.SignedUrlRes, error)
+	ConfirmUpload(req *files.ConfirmUploadReq) (*files.FileRes, error)
+	ObjectKey(rawUrl string) (string, bool)
+	CopyToPrivate(key, destination, userId string) (*files.FileRes, error)
+	FindOneFile(fileId string) (*files.File, error)
+	FindFiles(req *files.FileFilter) *entities.PaginateRes
+	FindFileReferences(req []*files.DeleteFileReq) (map[string][]*files.FileReference, error)
+	CollectOrphans(req *files.OrphanReq) (*files.OrphanRes, error)
+	ProcessOutbox() error
 }
 
 // ======================================= Struct ============================================
 type filesUsecase struct {
-	cfg config.IConfig
+	cfg             config.IConfig
+	filesRepository filesRepositories.IFilesRepository
+	filesScanner    filesScanners.IFilesScanner
 }
 
 type filesPub struct {
@@ -31,14 +73,16 @@ type filesPub struct {
 }
 
 // ======================================= Constructor =======================================
-func FilesUsecase(cfg config.IConfig) IFilesUsecase {
+func FilesUsecase(cfg config.IConfig, filesRepository filesRepositories.IFilesRepository) IFilesUsecase {
 	return &filesUsecase{
-		cfg: cfg,
+		cfg:             cfg,
+		filesRepository: filesRepository,
+		filesScanner:    filesScanners.FilesScanner(cfg),
 	}
 }
 
 // ----------Flow
-//    upload ---> make public  ---> upload worker (func) ---> output
+//    upload ---> scan (ติดไวรัส = quarantine) ---> make public  ---> upload worker (func) ---> output
 
 // ========================================Missing Function ==============================
 // ------------------------- pre Function Upload File to GCP
@@ -46,62 +90,105 @@ func FilesUsecase(cfg config.IConfig) IFilesUsecase {
 
 // --------------- make public ---------
 // makePublic gives all users read access to an object.
-func (f *filesPub) makePublic(ctx context.Context, client *storage.Client) error {
+func (f *filesPub) makePublic(ctx context.Context, storage filesStorages.IFilesStorage) error {
+	return storage.MakePublic(ctx, f.destination)
+}
 
-	acl := client.Bucket(f.bucket).Object(f.destination).ACL()
-	if err := acl.Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
-		return fmt.Errorf("cvcv.Set: %w", err)
+// --------------- publish ---------
+// public = make public แล้วคืน url ถาวร,  private = คืน signed url ที่หมดอายุตาม APP_SIGNED_URL_EXPIRES
+// ไฟล์ใต้ APP_STORAGE_PRIVATE_PREFIX เป็น private เสมอ
+func (u *filesUsecase) publish(ctx context.Context, storage filesStorages.IFilesStorage, f *filesPub, private bool) (string, error) {
+	if private || filesStorages.IsPrivate(u.cfg, f.destination) {
+		return storage.SignedUrl(ctx, f.destination, &filesStorages.SignedUrlOpts{
+			Method:  http.MethodGet,
+			Expires: u.cfg.App().SignedUrlExpires(),
+		})
 	}
-	fmt.Printf("Blob %v is now publicly accessible.\n", f.destination)
-	return nil
+	if err := f.makePublic(ctx, storage); err != nil {
+		return "", err
+	}
+	return storage.Url(f.destination), nil
 }
 
-func (u *filesUsecase) uploadWorkers(ctx context.Context, client *storage.Client, jobs <-chan *files.FileReq, reuslt chan<- *files.FileRes, errs chan<- error) {
-	// สิ่งที่ต้องใช้ใน GCP Files Upload คือ
+func (u *filesUsecase) uploadWorkers(ctx context.Context, storage filesStorages.IFilesStorage, jobs <-chan *files.FileReq, reuslt chan<- *files.FileRes, errs chan<- error) {
+	// สิ่งที่ต้องใช้ใน Files Upload คือ
 	// *** object = jobsCh
-	// *** bucket = config path and detail  to bucket
+	// *** storage = driver ที่เลือกจาก config (gcs, local)
 
 	for job := range jobs {
-		container, err := job.File.Open() // .File.Open()  ---> io.util  = byte
-		if err != nil {
+		// สแกนไวรัสก่อนทุกอย่าง  ไฟล์ติดไวรัสห้ามขึ้น destination และห้ามนับเป็นไฟล์ซ้ำ
+		if err := u.scanFile(ctx, storage, job); err != nil {
 			errs <- err
 			return
 		}
 
-		// Return output byte type
-		b, err := ioutil.ReadAll(container)
+		// sha256 ก่อน upload  เนื้อหาซ้ำกับไฟล์ public เดิมใน folder เดียวกัน = ใช้ object เดิม (ref_count + 1)
+		checksum, size, err := hashFile(job)
 		if err != nil {
 			errs <- err
 			return
 		}
+		private := job.Private || filesStorages.IsPrivate(u.cfg, job.Destination)
+		if !private {
+			duplicated, err := u.duplicateFile(storage, job, checksum)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if duplicated != nil {
+				errs <- nil
+				reuslt <- duplicated
+				continue
+			}
+		}
 
-		//***** buf = object files.Req to byte ก่อน
-		buf := bytes.NewBuffer(b)
-
-		wc := client.Bucket(u.cfg.App().Gcpbucket()).Object(job.Destination).NewWriter(ctx)
-
-		// Upload an object with storage.Writer.
-		if _, err = io.Copy(wc, buf); err != nil {
-			errs <- fmt.Errorf("io.Copy: %w", err)
+		// stream เนื้อไฟล์ขึ้น storage ตรงๆ ไม่ต้อง ReadAll ลง memory อีกรอบ
+		container, err := openFile(job)
+		if err != nil {
+			errs <- err
 			return
 		}
 
-		// Data can continue to be added to the file until the writer is closed.
-		if err := wc.Close(); err != nil {
-			errs <- fmt.Errorf("Writer.Close: %w", err)
+		// Upload an object with storage driver
+		err = storage.Upload(ctx, job.Destination, container)
+		container.Close()
+		if err != nil {
+			errs <- err
 			return
 		}
 		fmt.Printf("%v uploaded to %v. \n", job.FileName, job.Extension)
 		newFile := &filesPub{
 			file: &files.FileRes{
-				FileName: job.FileName,
-				Url:      fmt.Sprintf("https://storage.googleapis.com/%s/%s", u.cfg.App().Gcpbucket(), job.Destination),
+				FileName:    job.FileName,
+				Destination: job.Destination,
+				Size:        size,
+				Checksum:    checksum,
 			},
-			bucket:      u.cfg.App().Gcpbucket(),
+			bucket:      u.cfg.App().StorageBucket(),
 			destination: job.Destination,
 		}
 
-		if err := newFile.makePublic(ctx, client); err != nil {
+		url, err := u.publish(ctx, storage, newFile, job.Private)
+		if err != nil {
+			errs <- err
+			return
+		}
+		newFile.file.Url = url
+
+		// ย่อรูปเป็น thumbnail/medium/large เก็บไว้ข้างๆ ไฟล์ต้นฉบับ
+		// ไฟล์ใหญ่ที่ stream มาจาก disk (Data ว่าง) ไม่ decode เพื่อย่อ กัน memory เต็ม  ไฟล์ private ไม่ต้องมีรูปย่อ
+		if filesImages.IsImage(job.Extension) && job.Data != nil && !private {
+			variants, err := u.uploadVariants(ctx, storage, job.Destination, job.Data)
+			if err != nil {
+				errs <- err
+				return
+			}
+			newFile.file.Variants = variants
+		}
+
+		// บันทึก files registry ทันทีที่ไฟล์นี้ขึ้น storage ครบ (ไม่รอไฟล์อื่น)  บันทึกไม่ได้ = ลบไฟล์ที่เพิ่ง upload ไม่ให้มี blob ที่ไม่มี row
+		if err := u.filesRepository.InsertFiles(registryFiles(u.cfg, []*files.FileReq{job}, []*files.FileRes{newFile.file})); err != nil {
+			removeUploaded(ctx, storage, newFile.file)
 			errs <- err
 			return
 		}
@@ -113,24 +200,228 @@ func (u *filesUsecase) uploadWorkers(ctx context.Context, client *storage.Client
 
 }
 
-// --------------- Delete File Fuction pre to pool worker
-func (u *filesUsecase) deleteFileWorker(ctx context.Context, client *storage.Client, jobs <-chan *files.DeleteFileReq, errs chan<- error) {
-	for job := range jobs {
-		o := client.Bucket(u.cfg.App().Gcpbucket()).Object(job.Destination)
+// --------------- Malware scan
+// scanFile ไฟล์ติดไวรัสถูก upload ไปที่ <quarantine>/<destination> (private) ไว้ให้ admin ตรวจ แล้วคืน ErrFileInfected
+// สแกนไม่ได้ (clamd ล่ม) = ไม่รับไฟล์
+func (u *filesUsecase) scanFile(ctx context.Context, storage filesStorages.IFilesStorage, job *files.FileReq) error {
+	container, err := openFile(job)
+	if err != nil {
+		return err
+	}
+	result, err := u.filesScanner.Scan(ctx, container)
+	container.Close()
+	if err != nil {
+		return fmt.Errorf("scan file failed: %v", err)
+	}
+	if !result.Infected {
+		return nil
+	}
+
+	quarantine := filesStorages.QuarantineKey(u.cfg, job.Destination)
+	if container, err = openFile(job); err != nil {
+		return err
+	}
+	err = storage.Upload(ctx, quarantine, container)
+	container.Close()
+	if err != nil {
+		return fmt.Errorf("quarantine file failed: %v", err)
+	}
+	log.Printf("infected file %s (user %s, signature %s) quarantined to %s\n", job.Destination, job.UserId, result.Signature, quarantine)
+	return fmt.Errorf("%w: %s", ErrFileInfected, result.Signature)
+}
 
-		attrs, err := o.Attrs(ctx)
+// --------------- Dedup
+// hashFile sha256 (hex) + ขนาดของเนื้อไฟล์ที่จะ upload
+func hashFile(job *files.FileReq) (string, int64, error) {
+	container, err := openFile(job)
+	if err != nil {
+		return "", 0, err
+	}
+	defer container.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, container)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// duplicateFile หาไฟล์เนื้อหาเดียวกันใน folder เดียวกับ job  (folder เดียวกันเพราะ product / order หา destination จาก folder + filename)
+// เจอ = ref_count + 1 แล้วคืนผลของไฟล์เดิม,  ไม่เจอ = nil
+func (u *filesUsecase) duplicateFile(storage filesStorages.IFilesStorage, job *files.FileReq, checksum string) (*files.FileRes, error) {
+	candidates, err := u.filesRepository.FindFilesByChecksum(checksum)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range candidates {
+		if path.Dir(f.Key) != path.Dir(job.Destination) {
+			continue
+		}
+		acquired, err := u.filesRepository.AcquireFile(f.Id)
 		if err != nil {
-			errs <- fmt.Errorf("object.Attrs: %v", err)
-			return
+			return nil, err
+		}
+		if acquired == nil { // ถูกลบไประหว่างนี้
+			continue
 		}
-		o = o.If(storage.Conditions{GenerationMatch: attrs.Generation})
+		fmt.Printf("%v is duplicated with %v. \n", job.FileName, f.Key)
+		return &files.FileRes{
+			FileName:    path.Base(f.Key),
+			Destination: f.Key,
+			Url:         storage.Url(f.Key),
+			Size:        f.Size,
+			Checksum:    checksum,
+			Duplicated:  true,
+			Variants:    f.Variants,
+		}, nil
+	}
+	return nil, nil
+}
 
-		if err := o.Delete(ctx); err != nil {
-			errs <- fmt.Errorf("Object(%q).Delete: %v", job.Destination, err)
-			return
+// --------------- Prepare Upload
+// ตรวจจากเนื้อไฟล์จริง (magic bytes + decode) ไม่เชื่อนามสกุลไฟล์  แล้วลบ EXIF/GPS ก่อน upload
+func (u *filesUsecase) PrepareUpload(file *multipart.FileHeader, destination string) (*files.FileReq, error) {
+	// validate File Size
+	if file.Size > int64(u.cfg.App().FileLimit()) {
+		return nil, fmt.Errorf("file size must less than %d MiB", int(math.Ceil(float64(u.cfg.App().FileLimit())/math.Pow(1024, 2))))
+	}
+
+	container, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer container.Close()
+
+	data, err := io.ReadAll(io.LimitReader(container, int64(u.cfg.App().FileLimit())+1))
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := filesImages.Inspect(data, &filesImages.Limit{
+		MaxDimension: u.cfg.App().ImageMaxDimension(),
+		MaxPixels:    u.cfg.App().ImageMaxPixels(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = filesImages.StripMetadata(data, info.Mime)
+	if err != nil {
+		return nil, err
+	}
+
+	// Gen name file ใช้นามสกุลจากชนิดไฟล์จริง
+	filesname := utils.RanFileName(info.Ext)
+	return &files.FileReq{
+		File:        file,
+		Destination: destination + "/" + filesname,
+		FileName:    filesname,
+		Extension:   info.Ext,
+		Mime:        info.Mime,
+		Data:        data,
+	}, nil
+}
+
+// --------------- Open file
+// openFile เลือกที่มาของเนื้อไฟล์  Data (ตรวจแล้ว) > Path (ไฟล์บน disk) > File (multipart)
+func openFile(job *files.FileReq) (io.ReadCloser, error) {
+	switch {
+	case job.Data != nil:
+		return io.NopCloser(bytes.NewReader(job.Data)), nil
+	case job.Path != "":
+		return os.Open(job.Path)
+	default:
+		return job.File.Open() // .File.Open() multipart ไฟล์ใหญ่จะอยู่ใน temp file อยู่แล้ว
+	}
+}
+
+// --------------- Prepare file on disk
+// prepareFile ตรวจไฟล์บน disk (tus, signed url) แบบเดียวกับ /files/upload
+//   - ไฟล์ไม่เกิน APP_FILE_LIMIT : decode ทั้งไฟล์ + ลบ metadata ใน memory + ย่อรูป
+//   - ไฟล์ใหญ่กว่านั้น          : ตรวจจาก header + ลบ metadata ลงไฟล์ <src>.clean  ไม่ย่อรูป (คนเรียกต้องลบ Path เอง)
+//
+// Destination, FileName คนเรียกเป็นคนใส่
+func prepareFile(cfg config.IConfig, src *os.File, size int64) (*files.FileReq, error) {
+	limit := &filesImages.Limit{
+		MaxDimension: cfg.App().ImageMaxDimension(),
+		MaxPixels:    cfg.App().ImageMaxPixels(),
+	}
+
+	req := new(files.FileReq)
+	var info *filesImages.Info
+	var err error
+	if size <= int64(cfg.App().FileLimit()) {
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return nil, err
+		}
+		if info, err = filesImages.Inspect(data, limit); err != nil {
+			return nil, err
+		}
+		if req.Data, err = filesImages.StripMetadata(data, info.Mime); err != nil {
+			return nil, err
+		}
+	} else {
+		if info, err = filesImages.InspectHeader(src, limit); err != nil {
+			return nil, err
+		}
+		clean, err := os.Create(src.Name() + ".clean")
+		if err != nil {
+			return nil, err
+		}
+		req.Path = clean.Name()
+		err = filesImages.StripMetadataStream(clean, src, info.Mime)
+		if cerr := clean.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(req.Path)
+			return nil, err
 		}
-		fmt.Printf("Blob %v delete. \n", job.Destination)
-		errs <- nil
+	}
+	req.Extension = info.Ext
+	req.Mime = info.Mime
+	return req, nil
+}
+
+// --------------- Upload image variants
+func (u *filesUsecase) uploadVariants(ctx context.Context, storage filesStorages.IFilesStorage, destination string, data []byte) (entities.ImageVariants, error) {
+	variants, err := filesImages.Variants(data, destination, u.cfg.App().ImageVariants(), u.cfg.App().ImageWebp())
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make(entities.ImageVariants)
+	for _, v := range variants {
+		if err := storage.Upload(ctx, v.Destination, bytes.NewReader(v.Data)); err != nil {
+			return nil, err
+		}
+		url, err := u.publish(ctx, storage, &filesPub{destination: v.Destination}, false)
+		if err != nil {
+			return nil, err
+		}
+		urls[v.Name] = url
+	}
+	return urls, nil
+}
+
+// --------------- Delete File Fuction pre to pool worker
+type deleteResult struct {
+	destination string
+	err         error
+}
+
+func (u *filesUsecase) deleteFileWorker(ctx context.Context, storage filesStorages.IFilesStorage, jobs <-chan *files.DeleteFileReq, results chan<- *deleteResult) {
+	for job := range jobs {
+		err := storage.Delete(ctx, job.Destination)
+		if errors.Is(err, filesStorages.ErrObjectNotFound) {
+			fmt.Printf("Blob %v already deleted. \n", job.Destination)
+			err = nil
+		} else if err == nil {
+			fmt.Printf("Blob %v delete. \n", job.Destination)
+		}
+		results <- &deleteResult{destination: job.Destination, err: err}
 	}
 }
 
@@ -142,12 +433,12 @@ func (u *filesUsecase) UploadToGCP(req []*files.FileReq) ([]*files.FileRes, erro
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
 	defer cancel()
 
-	//2. GCP  open connect to storage Bucket
-	client, err := storage.NewClient(ctx)
+	//2. open storage driver (gcs | local)
+	storage, err := filesStorages.FilesStorage(ctx, u.cfg)
 	if err != nil {
-		return nil, fmt.Errorf("storage.NewClient: %w", err)
+		return nil, err
 	}
-	defer client.Close()
+	defer storage.Close()
 
 	//3. Upload แบบ PoolWorker
 	//------------------------------- Worker pool-------------------------------
@@ -172,7 +463,7 @@ func (u *filesUsecase) UploadToGCP(req []*files.FileReq) ([]*files.FileRes, erro
 	numWorkers := 5
 	for i := 0; i < numWorkers; i++ {
 		//******worker = function upload
-		go u.uploadWorkers(ctx, client, jobsCh, resultsCh, errCh)
+		go u.uploadWorkers(ctx, storage, jobsCh, resultsCh, errCh)
 	}
 
 	// 3.4 output --> Result
@@ -186,28 +477,130 @@ func (u *filesUsecase) UploadToGCP(req []*files.FileReq) ([]*files.FileRes, erro
 		result := <-resultsCh
 		res = append(res, result) //res (array)
 	}
+
+	// files registry บันทึกใน worker แล้ว (ทีละไฟล์หลัง upload สำเร็จ)
 	return res, nil
 
 	//่ jobsCh ทำงานไปเรื่อย  ----> ถ้ามี error ก็จะใส่ไปเรื่อยๆ  ---> result 3.4 ก็จะทำงานไปเรื่อยๆ เช่นกัน
 }
 
 // ------------------------- Delete File to GCP -------
+// ไฟล์ที่ upload ซ้ำ (ref_count > 1) แค่ลด ref_count  blob + รูปย่อจะถูกลบเมื่อไม่เหลือคนใช้แล้ว
 func (u *filesUsecase) DeleteFileGCP(req []*files.DeleteFileReq) error {
+	released, err := u.filesRepository.ReleaseFiles(destinations(req))
+	if err != nil {
+		return err
+	}
+	return u.deleteObjects(withoutInUse(req, released))
+}
+
+// DeleteFileLater ลบไฟล์หลัง transaction commit  (ลด ref_count + เขียน event ลง outbox ใน tx เดียวกัน)
+// rollback = ไฟล์ไม่ถูกลบ,  commit = outbox worker ลบให้จนสำเร็จ
+func (u *filesUsecase) DeleteFileLater(tx *sqlx.Tx, req []*files.DeleteFileReq) error {
+	released, err := u.filesRepository.ReleaseFilesTx(tx, destinations(req))
+	if err != nil {
+		return err
+	}
+	req = withoutInUse(req, released)
+	if len(req) == 0 {
+		return nil
+	}
+	return u.filesRepository.InsertOutboxEvent(tx, files.DeleteFilesEvent, req)
+}
+
+// AcquireFiles ไฟล์ใน bucket ที่ถูกแปะให้ product ใหม่ (import) ref_count + 1 ใน tx เดียวกัน  คู่กับ DeleteFileLater ตอนเอาออก
+// ไฟล์ไหนไม่มีแล้ว = ErrFileNotFound  (rollback = ref_count ไม่เปลี่ยน)
+func (u *filesUsecase) AcquireFiles(tx *sqlx.Tx, keys []string) error {
+	acquired, err := u.filesRepository.AcquireFilesTx(tx, keys)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]bool)
+	for _, key := range acquired {
+		found[key] = true
+	}
+	for _, key := range keys {
+		if !found[key] {
+			return fmt.Errorf("%w: %s", ErrFileNotFound, key)
+		}
+	}
+	return nil
+}
+
+func destinations(req []*files.DeleteFileReq) []string {
+	keys := make([]string, 0, len(req))
+	for _, r := range req {
+		keys = append(keys, r.Destination)
+	}
+	return keys
+}
+
+// withoutInUse ตัดไฟล์ที่ยังมีคนใช้ (ref_count > 0) และรูปย่อของไฟล์นั้นออก
+// ref_count = 0 ยังต้องผ่าน withoutReferenced ตอน deleteObjects อีกชั้น
+func withoutInUse(req []*files.DeleteFileReq, released []*files.File) []*files.DeleteFileReq {
+	inUse := make(map[string]bool)
+	for _, f := range released {
+		if f.RefCount == 0 {
+			continue
+		}
+		inUse[f.Key] = true
+		for _, v := range filesImages.VariantDestinations(f.Key, f.Variants) {
+			inUse[v] = true
+		}
+	}
+	jobs := make([]*files.DeleteFileReq, 0, len(req))
+	for _, r := range req {
+		if !inUse[r.Destination] {
+			jobs = append(jobs, r)
+		}
+	}
+	return jobs
+}
+
+// withoutReferenced ตัดไฟล์ที่ยังมี product / order ใช้อยู่ออก (เช็คตอนลบจริง)
+// ref_count เพิ่มแค่ตอน upload ซ้ำ  url ที่แปะเองตอน insert / update product ไม่ได้นับ  ref_count = 0 จึงยังไม่แปลว่าไม่มีใครใช้
+func (u *filesUsecase) withoutReferenced(req []*files.DeleteFileReq) ([]*files.DeleteFileReq, error) {
+	refs, err := u.filesRepository.FindFileReferences(destinations(req))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*files.DeleteFileReq, 0, len(req))
+	for _, r := range req {
+		if len(refs[r.Destination]) > 0 {
+			log.Printf("file %s is still referenced, skip delete\n", r.Destination)
+			continue
+		}
+		jobs = append(jobs, r)
+	}
+	return jobs, nil
+}
+
+// deleteObjects ลบ blob ทุกไฟล์ (ไม่หยุดที่ไฟล์แรกที่ error)  ลบซ้ำได้  ไฟล์ที่ไม่มีแล้วถือว่าลบสำเร็จ
+// ไฟล์ที่ยังถูกอ้างอิงอยู่ (images.url, images.variants, orders.transfer_slip) ไม่ลบ
+func (u *filesUsecase) deleteObjects(req []*files.DeleteFileReq) error {
+	req, err := u.withoutReferenced(req)
+	if err != nil {
+		return err
+	}
+	if len(req) == 0 {
+		return nil
+	}
 
 	// 1. New Context
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
 	defer cancel()
 
-	//2. GCP  open connect to storage Bucket
-	client, err := storage.NewClient(ctx)
+	//2. open storage driver (gcs | local)
+	storage, err := filesStorages.FilesStorage(ctx, u.cfg)
 	if err != nil {
-		return fmt.Errorf("storage.NewClient: %w", err)
+		return err
 	}
-	defer client.Close()
+	defer storage.Close()
 
 	// 3.1 inital
 	jobsCh := make(chan *files.DeleteFileReq, len(req)) //len(req) = buffer channal
-	errCh := make(chan error, len(req))
+	resultsCh := make(chan *deleteResult, len(req))
 
 	// 3.2 Assign Req(array) to JobsCh(Chan) = (input) เพราะ req ไม่ได้เป็นตัวแปรชนิด Chan ** การจะให้ Chan สื่อสารกัน ต้องเป็น Chan ทั้งคู่
 	for _, r := range req { // r = req
@@ -219,15 +612,309 @@ func (u *filesUsecase) DeleteFileGCP(req []*files.DeleteFileReq) error {
 	numWorkers := 5
 	for i := 0; i < numWorkers; i++ {
 		//******worker = function upload
-		go u.deleteFileWorker(ctx, client, jobsCh, errCh)
+		go u.deleteFileWorker(ctx, storage, jobsCh, resultsCh)
 	}
 
-	// 3.4 output --> Result
+	// 3.4 output --> Result  รอครบทุกไฟล์
+	deleted := make([]string, 0, len(req))
+	errs := make([]error, 0)
 	for a := 0; a < len(req); a++ {
-		err := <-errCh // err เป็น reciver รับค่าจาก chan errCh ที่เรียกใช้ใน Function 3.3
-		return err
+		result := <-resultsCh
+		if result.err != nil {
+			errs = append(errs, result.err)
+			continue
+		}
+		deleted = append(deleted, result.destination)
+	}
 
+	//4. ลบออกจาก files registry เฉพาะไฟล์ที่ลบสำเร็จ
+	if err := u.filesRepository.DeleteFiles(deleted); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// removeUploaded ลบไฟล์ + รูปย่อที่ upload ไปแล้วแต่บันทึก registry ไม่ได้
+func removeUploaded(ctx context.Context, storage filesStorages.IFilesStorage, file *files.FileRes) {
+	keys := append([]string{file.Destination}, filesImages.VariantDestinations(file.Destination, file.Variants)...)
+	for _, key := range keys {
+		if err := storage.Delete(ctx, key); err != nil {
+			log.Printf("remove unregistered file %s failed: %v\n", key, err)
+		}
+	}
+}
+
+// registryFiles แปลงผล upload เป็น row ของตาราง files  (จับคู่ req กับ res ด้วย destination เพราะ worker ส่งผลกลับไม่เรียงลำดับ)
+func registryFiles(cfg config.IConfig, req []*files.FileReq, res []*files.FileRes) []*files.File {
+	reqMap := make(map[string]*files.FileReq)
+	for _, r := range req {
+		reqMap[r.Destination] = r
+	}
+
+	registry := make([]*files.File, 0, len(res))
+	for _, r := range res {
+		job := reqMap[r.Destination]
+		if job == nil || r.Duplicated { // ไฟล์ซ้ำมี row อยู่แล้ว (ref_count + 1 ไปแล้ว)
+			continue
+		}
+		registry = append(registry, &files.File{
+			Key:      r.Destination,
+			FileName: r.FileName,
+			Size:     r.Size,
+			Mime:     job.Mime,
+			Checksum: r.Checksum,
+			Private:  job.Private || filesStorages.IsPrivate(cfg, r.Destination),
+			Variants: r.Variants,
+			UserId:   job.UserId,
+		})
+	}
+	return registry
+}
+
+// ------------------------- Files registry -------
+func (u *filesUsecase) FindOneFile(fileId string) (*files.File, error) {
+	file, err := u.filesRepository.FindOneFile(fileId)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (u *filesUsecase) FindFiles(req *files.FileFilter) *entities.PaginateRes {
+	filesData, count := u.filesRepository.FindFiles(req)
+	return &entities.PaginateRes{
+		Data:      filesData,
+		Page:      req.Page,
+		Limit:     req.Limit,
+		TotalItem: count,
+		TotalPage: int(math.Ceil(float64(count) / float64(req.Limit))),
+	}
+}
+
+// FindFileReferences key ที่ยังมี product / order ใช้อยู่  (ห้ามลบ)
+func (u *filesUsecase) FindFileReferences(req []*files.DeleteFileReq) (map[string][]*files.FileReference, error) {
+	keys := make([]string, 0, len(req))
+	for _, r := range req {
+		keys = append(keys, r.Destination)
+	}
+	return u.filesRepository.FindFileReferences(keys)
+}
+
+// ------------------------- Signed url -------
+// ----------Flow
+//    SignUploadUrl ---> client PUT ไฟล์ตรงขึ้น bucket ---> ConfirmUpload ตรวจไฟล์ ---> make public (หรือ private)
+
+// SignUploadUrl ตั้งชื่อไฟล์จาก content type แล้ว sign url สำหรับ PUT
+func (u *filesUsecase) SignUploadUrl(req *files.SignedUrlReq) (*files.SignedUrlRes, error) {
+	ext, ok := filesImages.MimeExt(req.ContentType)
+	if !ok {
+		return nil, fmt.Errorf("%w: content type %q is not acceptable", ErrUploadInvalid, req.ContentType)
+	}
+	destination := req.Destination + "/" + utils.RanFileName(ext)
+
+	res, err := u.signUrl(destination, &filesStorages.SignedUrlOpts{
+		Method:      http.MethodPut,
+		ContentType: req.ContentType,
+		Expires:     u.cfg.App().SignedUrlExpires(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// confirm ได้จนถึง 2 เท่าของอายุ url  (PUT เสร็จตอนท้ายๆ ก็ยัง confirm ทัน)
+	res.ConfirmToken = confirmToken(u.cfg, req.UserId, destination, res.ExpiresAt.Add(u.cfg.App().SignedUrlExpires()).Unix())
+	return res, nil
+}
+
+// confirmToken <expires>.<hmac(user, destination, expires)>  ไม่ต้องเก็บ state  ใช้ secret เดียวกับ jwt
+func confirmToken(cfg config.IConfig, userId, destination string, expires int64) string {
+	mac := hmac.New(sha256.New, cfg.Jwt().SecretKey())
+	mac.Write([]byte(fmt.Sprintf("confirm\n%s\n%s\n%d", userId, destination, expires)))
+	return fmt.Sprintf("%d.%s", expires, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// verifyConfirmToken key นี้ user คนนี้เป็นคน sign ไว้ และยังไม่หมดอายุ
+func verifyConfirmToken(cfg config.IConfig, userId, destination, token string) error {
+	raw, _, _ := strings.Cut(token, ".")
+	expires, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ErrConfirmForbidden
+	}
+	if !hmac.Equal([]byte(token), []byte(confirmToken(cfg, userId, destination, expires))) {
+		return ErrConfirmForbidden
 	}
 	return nil
+}
+
+// SignDownloadUrl url ชั่วคราวสำหรับเปิดไฟล์ private
+func (u *filesUsecase) SignDownloadUrl(req *files.SignedUrlReq) (*files.SignedUrlRes, error) {
+	return u.signUrl(req.Destination, &filesStorages.SignedUrlOpts{
+		Method:  http.MethodGet,
+		Expires: u.cfg.App().SignedUrlExpires(),
+	})
+}
+
+func (u *filesUsecase) signUrl(destination string, opts *filesStorages.SignedUrlOpts) (*files.SignedUrlRes, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
+
+	storage, err := filesStorages.FilesStorage(ctx, u.cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer storage.Close()
 
+	url, err := storage.SignedUrl(ctx, destination, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &files.SignedUrlRes{
+		Destination: destination,
+		Url:         url,
+		Method:      opts.Method,
+		ExpiresAt:   time.Now().Add(opts.Expires),
+	}
+	if opts.ContentType != "" {
+		res.Headers = map[string]string{"Content-Type": opts.ContentType}
+	}
+	return res, nil
+}
+
+// ConfirmUpload ดึงไฟล์ที่ client PUT ขึ้นไปมาตรวจ (ชนิดไฟล์, ขนาด, ลบ metadata) แล้วเขียนทับที่เดิมพร้อมย่อรูป
+// ไฟล์ไม่ผ่านจะถูกลบออกจาก bucket
+func (u *filesUsecase) ConfirmUpload(req *files.ConfirmUploadReq) (*files.FileRes, error) {
+	if err := verifyConfirmToken(u.cfg, req.UserId, req.Destination, req.ConfirmToken); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
+
+	storage, err := filesStorages.FilesStorage(ctx, u.cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer storage.Close()
+
+	fileReq, err := u.downloadFile(ctx, storage, req.Destination)
+	if err != nil {
+		if errors.Is(err, ErrUploadInvalid) || errors.Is(err, ErrUploadTooLarge) {
+			return nil, errors.Join(err, u.discardObject(ctx, storage, req.Destination))
+		}
+		return nil, err
+	}
+	if fileReq.Path != "" {
+		defer os.Remove(fileReq.Path)
+	}
+	fileReq.Private = req.Private
+	fileReq.UserId = req.UserId
+
+	res, err := u.UploadToGCP([]*files.FileReq{fileReq})
+	if err != nil {
+		// ติดไวรัส  มีสำเนาใน quarantine แล้ว  ไฟล์ที่ client PUT ขึ้นมาต้องลบทิ้ง
+		if errors.Is(err, ErrFileInfected) {
+			return nil, errors.Join(err, u.discardObject(ctx, storage, req.Destination))
+		}
+		return nil, err
+	}
+	// ซ้ำกับไฟล์เดิม  ไฟล์ที่ client PUT ขึ้นมาไม่ได้ใช้แล้ว
+	if res[0].Duplicated && res[0].Destination != req.Destination {
+		if err := u.discardObject(ctx, storage, req.Destination); err != nil {
+			return nil, err
+		}
+	}
+	return res[0], nil
+}
+
+// discardObject ลบไฟล์ที่ client PUT ขึ้นมาแต่ไม่ได้ใช้  ลบไม่ได้ = เข้า outbox ให้ worker ลบต่อ  เข้า outbox ไม่ได้ = error
+func (u *filesUsecase) discardObject(ctx context.Context, storage filesStorages.IFilesStorage, key string) error {
+	err := storage.Delete(ctx, key)
+	if err == nil || errors.Is(err, filesStorages.ErrObjectNotFound) {
+		return nil
+	}
+	log.Printf("delete %s failed, retry via outbox: %v\n", key, err)
+	if err := u.filesRepository.EnqueueOutboxEvent(files.DeleteFilesEvent, []*files.DeleteFileReq{{Destination: key}}); err != nil {
+		return fmt.Errorf("delete %s failed: %v", key, err)
+	}
+	return nil
+}
+
+// ObjectKey public url ---> key ใน bucket ของเรา  (url ภายนอก = false)
+func (u *filesUsecase) ObjectKey(rawUrl string) (string, bool) {
+	return filesStorages.ObjectKey(u.cfg, rawUrl)
+}
+
+// CopyToPrivate ดึงไฟล์ key เดิมมาตรวจแบบ ConfirmUpload แล้ว upload เป็นไฟล์ private ใต้ destination (ชื่อไฟล์เดิม)
+// ไม่ลบไฟล์เดิม  คนเรียกลบเองหลังเปลี่ยนไปอ้างถึงไฟล์ใหม่แล้ว
+func (u *filesUsecase) CopyToPrivate(key, destination, userId string) (*files.FileRes, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
+
+	storage, err := filesStorages.FilesStorage(ctx, u.cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer storage.Close()
+
+	fileReq, err := u.downloadFile(ctx, storage, key)
+	if err != nil {
+		return nil, err
+	}
+	if fileReq.Path != "" {
+		defer os.Remove(fileReq.Path)
+	}
+	fileReq.Destination = destination + "/" + path.Base(key)
+	fileReq.FileName = path.Base(key)
+	fileReq.Private = true
+	fileReq.UserId = userId
+
+	res, err := u.UploadToGCP([]*files.FileReq{fileReq})
+	if err != nil {
+		return nil, err
+	}
+	return res[0], nil
+}
+
+func (u *filesUsecase) downloadFile(ctx context.Context, storage filesStorages.IFilesStorage, destination string) (*files.FileReq, error) {
+	rc, err := storage.Open(ctx, destination)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	if err := os.MkdirAll(u.cfg.App().UploadTmpDir(), 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(u.cfg.App().UploadTmpDir(), "confirm-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, io.LimitReader(rc, int64(u.cfg.App().UploadMaxSize())+1))
+	if err != nil {
+		return nil, err
+	}
+	if size > int64(u.cfg.App().UploadMaxSize()) {
+		return nil, ErrUploadTooLarge
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	fileReq, err := prepareFile(u.cfg, tmp, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUploadInvalid, err)
+	}
+	// ชื่อไฟล์ตั้งไว้ตอน sign แล้ว  เนื้อไฟล์ต้องตรงกับนามสกุล
+	if strings.TrimPrefix(path.Ext(destination), ".") != fileReq.Extension {
+		if fileReq.Path != "" {
+			os.Remove(fileReq.Path)
+		}
+		return nil, fmt.Errorf("%w: file content is %s but destination is %s", ErrUploadInvalid, fileReq.Mime, path.Ext(destination))
+	}
+	fileReq.Destination = destination
+	fileReq.FileName = path.Base(destination)
+	return fileReq, nil
 }
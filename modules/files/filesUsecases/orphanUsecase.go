@@ -0,0 +1,151 @@
+package filesUsecases
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PHURINTOR/phurinshop/modules/files"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesStorages"
+)
+
+// ======================================= Error =============================================
+var ErrOrphanRunning = errors.New("orphan files gc is running")
+
+// gc ทีละรอบ  (รอบเบื้องหลังกับที่ admin สั่งผ่าน api ห้ามทับกัน)
+var orphanMu sync.Mutex
+
+// ----------Flow
+//    list ไฟล์ใต้ APP_GC_PREFIXES ---> ตัดไฟล์ที่ images (url, variants) / orders (สลิป) ใช้อยู่
+//    ---> ตัดไฟล์ใหม่กว่า APP_GC_GRACE_PERIOD (upload ค้าง, ยังไม่ได้ผูกกับ product) ---> ที่เหลือ = orphan
+
+// ======================================= Missing Function ==================================
+// CollectOrphans DryRun = รายงานอย่างเดียว
+func (u *filesUsecase) CollectOrphans(req *files.OrphanReq) (*files.OrphanRes, error) {
+	if !orphanMu.TryLock() {
+		return nil, ErrOrphanRunning
+	}
+	defer orphanMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	defer cancel()
+
+	storage, err := filesStorages.FilesStorage(ctx, u.cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer storage.Close()
+
+	// อ่าน reference ก่อน list  ไฟล์ที่ถูกผูกระหว่าง list จะยังใหม่กว่า grace period อยู่ดี
+	refs, err := u.filesRepository.FindReferences()
+	if err != nil {
+		return nil, err
+	}
+	referenced := referencedKeys(refs)
+
+	res := &files.OrphanRes{
+		DryRun:      req.DryRun,
+		Prefixes:    u.cfg.App().GcPrefixes(),
+		GracePeriod: u.cfg.App().GcGracePeriod().String(),
+		Orphans:     make([]*files.OrphanFile, 0),
+	}
+	for _, prefix := range u.cfg.App().GcPrefixes() {
+		objects, err := storage.List(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		res.Scanned += len(objects)
+
+		for _, obj := range objects {
+			if referenced[obj.Key] || time.Since(obj.UpdatedAt) < u.cfg.App().GcGracePeriod() {
+				continue
+			}
+			res.Orphans = append(res.Orphans, &files.OrphanFile{
+				Key:       obj.Key,
+				Size:      obj.Size,
+				UpdatedAt: obj.UpdatedAt,
+			})
+		}
+	}
+	if req.DryRun {
+		return res, nil
+	}
+
+	// จอง row ใน registry ก่อนลบ (lock + ref_count = 0)  ไฟล์ที่ระหว่างนี้ถูก dedup ได้ไปใช้ (AcquireFile) ไม่ลบ
+	keys := make([]string, 0, len(res.Orphans))
+	for _, orphan := range res.Orphans {
+		keys = append(keys, orphan.Key)
+	}
+	claimed, err := u.filesRepository.ClaimOrphans(keys, u.cfg.App().GcGracePeriod())
+	if err != nil {
+		return nil, err
+	}
+	isClaimed := make(map[string]bool, len(claimed))
+	for _, key := range claimed {
+		isClaimed[key] = true
+	}
+
+	// ลบทีละไฟล์  ไฟล์ไหนลบไม่ได้ก็ข้ามไป รอบหน้าค่อยลองใหม่
+	deleted := make([]string, 0, len(res.Orphans))
+	for _, orphan := range res.Orphans {
+		if !isClaimed[orphan.Key] {
+			orphan.Error = "file was acquired during gc"
+			continue
+		}
+		if err := storage.Delete(ctx, orphan.Key); err != nil {
+			orphan.Error = err.Error()
+			continue
+		}
+		deleted = append(deleted, orphan.Key)
+	}
+	res.Deleted = len(deleted)
+
+	if err := u.filesRepository.DeleteFiles(deleted); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// referencedKeys แปลง url / destination เป็น key ที่เป็นไปได้ทั้งหมด
+// url มี base ต่างกันตาม driver (https://storage.googleapis.com/<bucket>/..., http://host/storage/...)  เลยเก็บทุก suffix ของ path
+//
+//	http://host/storage/images/products/a.jpg ---> storage/images/products/a.jpg, images/products/a.jpg, products/a.jpg, a.jpg
+func referencedKeys(refs []string) map[string]bool {
+	keys := make(map[string]bool)
+	for _, ref := range refs {
+		p := ref
+		if u, err := url.Parse(ref); err == nil && u.Scheme != "" {
+			p = u.Path
+		}
+
+		segments := strings.Split(strings.Trim(p, "/"), "/")
+		for i := range segments {
+			keys[strings.Join(segments[i:], "/")] = true
+		}
+	}
+	return keys
+}
+
+// StartOrphanCollector gc เบื้องหลังทุก APP_GC_INTERVAL  (ลบจริง ไม่ใช่ dry run)
+func StartOrphanCollector(usecase IFilesUsecase, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			res, err := usecase.CollectOrphans(&files.OrphanReq{DryRun: false})
+			if err != nil {
+				log.Printf("collect orphan files failed: %v\n", err)
+				continue
+			}
+			log.Printf("collect orphan files: scanned %d, orphans %d, deleted %d\n", res.Scanned, len(res.Orphans), res.Deleted)
+		}
+	}()
+}
@@ -0,0 +1,84 @@
+package filesUsecases
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/PHURINTOR/phurinshop/modules/files"
+)
+
+// ----------Flow
+//    tx: ลบ product + DeleteFileLater (outbox event) ---> commit
+//    worker: claim event ---> ลบ blob ---> สำเร็จ = ลบ event,  ไม่สำเร็จ = retry ตาม backoff
+
+const (
+	outboxBatch      = 20
+	outboxLease      = 5 * time.Minute // ต้องนานกว่าเวลาลบไฟล์ 1 batch
+	outboxBackoff    = 10 * time.Second
+	outboxMaxBackoff = time.Hour
+)
+
+// ======================================= Missing Function ==================================
+func (u *filesUsecase) ProcessOutbox() error {
+	events, err := u.filesRepository.ClaimOutboxEvents(files.DeleteFilesEvent, outboxBatch, outboxLease)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		req := make([]*files.DeleteFileReq, 0)
+		if err := json.Unmarshal(event.Payload, &req); err != nil {
+			err = fmt.Errorf("unmarshal outbox payload failed: %v", err)
+			u.retryOutbox(event, err)
+			continue
+		}
+
+		if err := u.deleteObjects(req); err != nil {
+			u.retryOutbox(event, err)
+			continue
+		}
+		if err := u.filesRepository.DeleteOutboxEvent(event.Id); err != nil {
+			log.Printf("outbox event %s: %v\n", event.Id, err)
+		}
+	}
+	return nil
+}
+
+func (u *filesUsecase) retryOutbox(event *files.OutboxEvent, cause error) {
+	delay := outboxDelay(event.Attempts + 1)
+	log.Printf("outbox event %s failed (attempt %d), retry in %v: %v\n", event.Id, event.Attempts+1, delay, cause)
+	if err := u.filesRepository.RetryOutboxEvent(event.Id, cause.Error(), delay); err != nil {
+		log.Printf("outbox event %s: %v\n", event.Id, err)
+	}
+}
+
+// outboxDelay 10s, 20s, 40s, ... ไม่เกิน 1 ชั่วโมง
+func outboxDelay(attempts int) time.Duration {
+	delay := outboxBackoff
+	for i := 1; i < attempts && delay < outboxMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxBackoff {
+		delay = outboxMaxBackoff
+	}
+	return delay
+}
+
+// StartOutboxWorker ดึง event จาก outbox ทุก APP_OUTBOX_INTERVAL
+func StartOutboxWorker(usecase IFilesUsecase, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := usecase.ProcessOutbox(); err != nil {
+				log.Printf("process outbox failed: %v\n", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,299 @@
+package filesUsecases
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PHURINTOR/phurinshop/config"
+	"github.com/PHURINTOR/phurinshop/modules/files"
+	"github.com/PHURINTOR/phurinshop/pkg/utils"
+	"github.com/google/uuid"
+)
+
+// ======================================= Error =============================================
+// handler ใช้ errors.Is แปลงเป็น status code ตาม tus 1.0
+var (
+	ErrUploadNotFound = errors.New("upload not found")                         // 404
+	ErrUploadExpired  = errors.New("upload is expired")                        // 410
+	ErrUploadOffset   = errors.New("upload-offset does not match")             // 409
+	ErrUploadTooLarge = errors.New("upload exceeds upload-length")             // 413
+	ErrUploadLocked   = errors.New("upload is being written by other request") // 423
+	ErrUploadInvalid  = errors.New("uploaded file is invalid")                 // 400
+)
+
+// ======================================= Interface =========================================
+type ITusUsecase interface {
+	CreateUpload(req *files.TusUpload) (*files.TusUpload, error)
+	FindUpload(userId, uploadId string) (*files.TusUpload, error)
+	WriteChunk(userId, uploadId string, offset int64, chunk io.Reader) (*files.TusUpload, error)
+	TerminateUpload(userId, uploadId string) error
+}
+
+// ======================================= Struct ============================================
+type tusUsecase struct {
+	cfg          config.IConfig
+	filesUsecase IFilesUsecase
+	locks        sync.Map // upload id : *sync.Mutex  กัน PATCH ซ้อนกันบน upload เดียว (มี entry เฉพาะตอนมี request ถือ lock)
+}
+
+// ======================================= Constructor =======================================
+func TusUsecase(cfg config.IConfig, filesUsecase IFilesUsecase) ITusUsecase {
+	return &tusUsecase{
+		cfg:          cfg,
+		filesUsecase: filesUsecase,
+	}
+}
+
+// ----------Flow
+//    POST (Upload-Length) ---> <id>.info + <id>.bin ว่าง
+//    PATCH chunk ---> ต่อท้าย <id>.bin ---> ครบ Upload-Length ---> ตรวจไฟล์ ---> stream ขึ้น storage
+
+// ======================================= Missing Function ==================================
+func (u *tusUsecase) CreateUpload(req *files.TusUpload) (*files.TusUpload, error) {
+	if err := os.MkdirAll(u.cfg.App().UploadTmpDir(), 0o755); err != nil {
+		return nil, fmt.Errorf("create upload dir failed: %v", err)
+	}
+	u.removeExpired()
+
+	if req.Length > int64(u.cfg.App().UploadMaxSize()) {
+		return nil, ErrUploadTooLarge
+	}
+
+	req.Id = uuid.NewString()
+	req.Offset = 0
+	req.ExpiresAt = time.Now().Add(u.cfg.App().UploadExpires())
+
+	bin, err := os.OpenFile(u.binPath(req.Id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("create upload failed: %v", err)
+	}
+	bin.Close()
+
+	if err := u.save(req); err != nil {
+		os.Remove(u.binPath(req.Id))
+		return nil, err
+	}
+	return req, nil
+}
+
+func (u *tusUsecase) FindUpload(userId, uploadId string) (*files.TusUpload, error) {
+	return u.load(userId, uploadId)
+}
+
+func (u *tusUsecase) WriteChunk(userId, uploadId string, offset int64, chunk io.Reader) (*files.TusUpload, error) {
+	unlock, err := u.lock(uploadId)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	upload, err := u.load(userId, uploadId)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset || upload.File != nil {
+		return nil, ErrUploadOffset
+	}
+
+	bin, err := os.OpenFile(u.binPath(upload.Id), os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open upload failed: %v", err)
+	}
+	// ตัดส่วนที่เขียนค้างไว้จาก request ที่หลุดไปกลางทาง ให้ไฟล์ตรงกับ offset ที่บันทึกไว้
+	if err := bin.Truncate(upload.Offset); err != nil {
+		bin.Close()
+		return nil, err
+	}
+	if _, err := bin.Seek(upload.Offset, io.SeekStart); err != nil {
+		bin.Close()
+		return nil, err
+	}
+
+	// อ่านเกิน 1 byte ไว้เช็คว่าส่งมาเกิน Upload-Length หรือไม่
+	n, err := io.Copy(bin, io.LimitReader(chunk, upload.Length-upload.Offset+1))
+	if upload.Offset+n > upload.Length {
+		bin.Truncate(upload.Offset)
+		bin.Close()
+		return nil, ErrUploadTooLarge
+	}
+	if cerr := bin.Close(); err == nil {
+		err = cerr
+	}
+
+	// connection หลุดกลาง chunk  เก็บส่วนที่ได้แล้วไว้ client จะ HEAD แล้วส่งต่อจาก offset ใหม่
+	upload.Offset += n
+	if serr := u.save(upload); serr != nil {
+		return nil, serr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.Offset == upload.Length {
+		if err := u.finish(upload); err != nil {
+			return nil, err
+		}
+	}
+	return upload, nil
+}
+
+func (u *tusUsecase) TerminateUpload(userId, uploadId string) error {
+	unlock, err := u.lock(uploadId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := u.load(userId, uploadId); err != nil {
+		return err
+	}
+	u.remove(uploadId)
+	return nil
+}
+
+// ------------------------- finish upload
+// ตรวจไฟล์แบบเดียวกับ /files/upload (prepareFile) แล้ว stream ขึ้น storage
+func (u *tusUsecase) finish(upload *files.TusUpload) error {
+	req, err := u.inspect(upload)
+	if err != nil {
+		u.remove(upload.Id)
+		return fmt.Errorf("%w: %v", ErrUploadInvalid, err)
+	}
+	if req.Path != "" {
+		defer os.Remove(req.Path)
+	}
+
+	res, err := u.filesUsecase.UploadToGCP([]*files.FileReq{req})
+	if err != nil {
+		if errors.Is(err, ErrFileInfected) { // ไม่ต้องให้ client ส่งซ้ำ
+			u.remove(upload.Id)
+		}
+		return err
+	}
+
+	// เก็บ .info ไว้จนหมดอายุ ให้ client ถามผลได้  ไฟล์ .bin ไม่ต้องใช้แล้ว
+	upload.File = res[0]
+	if err := u.save(upload); err != nil {
+		return err
+	}
+	os.Remove(u.binPath(upload.Id))
+	return nil
+}
+
+func (u *tusUsecase) inspect(upload *files.TusUpload) (*files.FileReq, error) {
+	bin, err := os.Open(u.binPath(upload.Id))
+	if err != nil {
+		return nil, err
+	}
+	defer bin.Close()
+
+	req, err := prepareFile(u.cfg, bin, upload.Length)
+	if err != nil {
+		return nil, err
+	}
+
+	// Gen name file ใช้นามสกุลจากชนิดไฟล์จริง
+	filesname := utils.RanFileName(req.Extension)
+	req.Destination = upload.Destination + "/" + filesname
+	req.FileName = filesname
+	req.UserId = upload.UserId
+	return req, nil
+}
+
+// ------------------------- state on disk
+func (u *tusUsecase) binPath(uploadId string) string {
+	return filepath.Join(u.cfg.App().UploadTmpDir(), uploadId+".bin")
+}
+
+func (u *tusUsecase) infoPath(uploadId string) string {
+	return filepath.Join(u.cfg.App().UploadTmpDir(), uploadId+".info")
+}
+
+func (u *tusUsecase) load(userId, uploadId string) (*files.TusUpload, error) {
+	// id มาจาก url  ต้องเป็น uuid เท่านั้น กัน path traversal
+	if _, err := uuid.Parse(uploadId); err != nil {
+		return nil, ErrUploadNotFound
+	}
+
+	b, err := os.ReadFile(u.infoPath(uploadId))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	upload := new(files.TusUpload)
+	if err := json.Unmarshal(b, upload); err != nil {
+		return nil, fmt.Errorf("read upload info failed: %v", err)
+	}
+	if upload.UserId != userId {
+		return nil, ErrUploadNotFound
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		u.remove(uploadId)
+		return nil, ErrUploadExpired
+	}
+	return upload, nil
+}
+
+// save เขียนไฟล์ใหม่แล้ว rename ทับ  ไม่มีจังหวะที่ .info เขียนไม่ครบ
+func (u *tusUsecase) save(upload *files.TusUpload) error {
+	b, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	tmp := u.infoPath(upload.Id) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("save upload info failed: %v", err)
+	}
+	return os.Rename(tmp, u.infoPath(upload.Id))
+}
+
+func (u *tusUsecase) remove(uploadId string) {
+	os.Remove(u.binPath(uploadId))
+	os.Remove(u.infoPath(uploadId))
+}
+
+// removeExpired ลบ upload ที่ค้างจนหมดอายุ  เรียกตอนสร้าง upload ใหม่
+func (u *tusUsecase) removeExpired() {
+	infos, err := filepath.Glob(filepath.Join(u.cfg.App().UploadTmpDir(), "*.info"))
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		b, err := os.ReadFile(info)
+		if err != nil {
+			continue
+		}
+		upload := new(files.TusUpload)
+		if err := json.Unmarshal(b, upload); err != nil || time.Now().After(upload.ExpiresAt) {
+			u.remove(strings.TrimSuffix(filepath.Base(info), ".info"))
+		}
+	}
+}
+
+// lock ถือ lock ของ upload  ปลด lock แล้วลบ entry ทิ้ง  map ไม่โตตาม id ที่เคยส่งมา (upload ที่จบ / หมดอายุ / id มั่ว)
+// ได้ mutex ที่ถูกลบออกจาก map ไปแล้ว (คนเดิมเพิ่งปลด) = ของเก่า  ปล่อยแล้วเอาตัวใหม่จาก map
+func (u *tusUsecase) lock(uploadId string) (func(), error) {
+	for {
+		v, _ := u.locks.LoadOrStore(uploadId, new(sync.Mutex))
+		mu := v.(*sync.Mutex)
+		if !mu.TryLock() {
+			return nil, ErrUploadLocked
+		}
+		if current, ok := u.locks.Load(uploadId); ok && current == mu {
+			return func() {
+				u.locks.Delete(uploadId)
+				mu.Unlock()
+			}, nil
+		}
+		mu.Unlock()
+	}
+}
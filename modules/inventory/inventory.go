@@ -0,0 +1,67 @@
+package inventory
+
+import (
+	"errors"
+
+	"github.com/PHURINTOR/phurinshop/modules/entities"
+)
+
+// ======================================= Enum  ============================================
+type MovementType string
+
+const (
+	ReserveMovement MovementType = "reserve" // จองตอนสั่ง        reserved + qty
+	ReleaseMovement MovementType = "release" // order canceled    reserved - qty
+	SaleMovement    MovementType = "sale"    // order completed   stock - qty, reserved - qty
+	AdjustMovement  MovementType = "adjust"  // admin ปรับ stock   stock + qty (ติดลบได้)
+)
+
+// ======================================= Error =============================================
+var (
+	ErrOutOfStock    = errors.New("out of stock")
+	ErrStockNotFound = errors.New("product or variant is not found")
+	ErrStockReserved = errors.New("stock must not be less than reserved")
+)
+
+// ======================================= Struct ============================================
+// StockItem ของ 1 รายการใน order  (VariantId ว่าง = stock ของ product)
+type StockItem struct {
+	ProductId string `db:"product_id"`
+	VariantId string `db:"variant_id"`
+	Qty       int    `db:"qty"`
+}
+
+// Movement 1 row ใน ledger  Stock, Reserved = ค่าหลังรายการนี้
+type Movement struct {
+	Id        string       `db:"id" json:"id"`
+	ProductId string       `db:"product_id" json:"product_id"`
+	VariantId string       `db:"variant_id" json:"variant_id,omitempty"`
+	Sku       string       `db:"sku" json:"sku,omitempty"`
+	OrderId   string       `db:"order_id" json:"order_id,omitempty"`
+	Type      MovementType `db:"type" json:"type"`
+	Qty       int          `db:"qty" json:"qty"`
+	Stock     int          `db:"stock" json:"stock"`
+	Reserved  int          `db:"reserved" json:"reserved"`
+	Note      string       `db:"note" json:"note"`
+	UserId    string       `db:"user_id" json:"user_id,omitempty"`
+	CreatedAt string       `db:"created_at" json:"created_at"`
+}
+
+// AdjustReq admin เพิ่ม / ลด stock  (Qty ติดลบ = ลด)
+type AdjustReq struct {
+	ProductId string `json:"product_id"`
+	VariantId string `json:"variant_id"`
+	Qty       int    `json:"qty"`
+	Note      string `json:"note"`
+	UserId    string `json:"-"`
+}
+
+// -------------------- Find Movements
+type MovementFilter struct {
+	ProductId string `query:"product_id"`
+	VariantId string `query:"variant_id"`
+	OrderId   string `query:"order_id"`
+	Type      string `query:"type"`
+	*entities.PaginationReq
+	*entities.SortReq
+}
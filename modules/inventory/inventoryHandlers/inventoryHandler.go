@@ -0,0 +1,150 @@
+package inventoryHandlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/PHURINTOR/phurinshop/modules/entities"
+	"github.com/PHURINTOR/phurinshop/modules/inventory"
+	"github.com/PHURINTOR/phurinshop/modules/inventory/inventoryUsecases"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ======================================= Enum  ============================================
+type inventoryHandlerErrCode string
+
+const (
+	findMovementsErr inventoryHandlerErrCode = "inventory-001"
+	adjustStockErr   inventoryHandlerErrCode = "inventory-002"
+)
+
+// ======================================= Interface =========================================
+type IInventoryHandler interface {
+	FindMovements(c *fiber.Ctx) error
+	AdjustStock(c *fiber.Ctx) error
+}
+
+// ======================================= Struct ============================================
+type inventoryHandler struct {
+	inventoryUsecase inventoryUsecases.IInventoryUsecase
+}
+
+// ======================================= Constructor =======================================
+func InventoryHandler(inventoryUsecase inventoryUsecases.IInventoryUsecase) IInventoryHandler {
+	return &inventoryHandler{
+		inventoryUsecase: inventoryUsecase,
+	}
+}
+
+// ======================================= Missing Func =======================================
+// ------------------------------- Movement ledger (admin)
+func (h *inventoryHandler) FindMovements(c *fiber.Ctx) error {
+	req := &inventory.MovementFilter{
+		SortReq:       &entities.SortReq{},
+		PaginationReq: &entities.PaginationReq{},
+	}
+
+	if err := c.QueryParser(req); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findMovementsErr),
+			err.Error(),
+		).Res()
+	}
+
+	// varidate defult page value
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 5 {
+		req.Limit = 5
+	}
+
+	// Check OrderBy
+	orderByMap := map[string]string{
+		"created_at": `"m"."created_at"`,
+		"qty":        `"m"."qty"`,
+	}
+	if orderByMap[req.OrderBy] == "" {
+		req.OrderBy = orderByMap["created_at"]
+	} else {
+		req.OrderBy = orderByMap[req.OrderBy]
+	}
+
+	// Sort
+	req.Sort = strings.ToUpper(req.Sort)
+	sortMap := map[string]string{
+		"DESC": "DESC",
+		"ASC":  "ASC",
+	}
+	if sortMap[req.Sort] == "" {
+		req.Sort = sortMap["DESC"]
+	}
+
+	// Type
+	req.Type = strings.ToLower(req.Type)
+	switch inventory.MovementType(req.Type) {
+	case "", inventory.ReserveMovement, inventory.ReleaseMovement, inventory.SaleMovement, inventory.AdjustMovement:
+	default:
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findMovementsErr),
+			"type must be reserve, release, sale or adjust",
+		).Res()
+	}
+
+	res := h.inventoryUsecase.FindMovements(req)
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, res).Res()
+}
+
+// ------------------------------- Adjust stock (admin)
+func (h *inventoryHandler) AdjustStock(c *fiber.Ctx) error {
+	req := new(inventory.AdjustReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(adjustStockErr),
+			err.Error(),
+		).Res()
+	}
+
+	if req.ProductId == "" {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(adjustStockErr),
+			"product_id is required",
+		).Res()
+	}
+	if req.Qty == 0 {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(adjustStockErr),
+			"qty must not be 0",
+		).Res()
+	}
+	req.UserId = c.Locals("userId").(string)
+
+	movement, err := h.inventoryUsecase.AdjustStock(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, inventory.ErrStockNotFound):
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(adjustStockErr),
+				err.Error(),
+			).Res()
+		case errors.Is(err, inventory.ErrStockReserved):
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrConflict.Code,
+				string(adjustStockErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(adjustStockErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusCreated, movement).Res()
+}
@@ -0,0 +1,226 @@
+package inventoryPatterns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/PHURINTOR/phurinshop/modules/inventory"
+	"github.com/jmoiron/sqlx"
+)
+
+// =================================================== Builder ======================================
+// ---------------- Builder Interface -------------
+type IFindMovementsBuilder interface {
+	initQuery()
+	initCountQuery()
+	buildWhereProduct()
+	buildWhereVariant()
+	buildWhereOrder()
+	buildWhereType()
+	buildSort()
+	buildPaginate()
+	closeQuery()
+	getQuery() string
+	getValues() []any
+	getDb() *sqlx.DB
+	reset()
+}
+
+// ---------------- Builder Stuct ------------------------
+type findMovementsBuilder struct {
+	db        *sqlx.DB
+	req       *inventory.MovementFilter
+	query     string
+	values    []any
+	lastIndex int
+}
+
+// ---------------- Builder Constructor ------------------
+func FindMovementsBuilder(db *sqlx.DB, req *inventory.MovementFilter) IFindMovementsBuilder {
+	return &findMovementsBuilder{
+		db:     db,
+		req:    req,
+		values: make([]any, 0),
+	}
+}
+
+// =================================================== Engineer ======================================
+// ---------------- Engineer Stuct ------------------------
+type findMovementsEngineer struct {
+	builder IFindMovementsBuilder
+}
+
+// ---------------- Engineer Constructor ------------------
+func FindMovementsEngineer(b IFindMovementsBuilder) *findMovementsEngineer {
+	return &findMovementsEngineer{builder: b}
+}
+
+// ---------------- Builder Missing Function -------------
+
+func (b *findMovementsBuilder) initQuery() {
+	b.query += `
+	SELECT
+		array_to_json(array_agg("at"))
+	FROM (
+		SELECT
+			"m"."id",
+			"m"."product_id",
+			"m"."variant_id",
+			"m"."sku",
+			"m"."order_id",
+			"m"."type",
+			"m"."qty",
+			"m"."stock",
+			"m"."reserved",
+			"m"."note",
+			"m"."user_id",
+			"m"."created_at"
+		FROM "inventory_movements" "m"
+		WHERE 1 = 1`
+}
+
+func (b *findMovementsBuilder) initCountQuery() {
+	b.query += `
+		SELECT
+			COUNT(*) AS "count"
+		FROM "inventory_movements" "m"
+		WHERE 1 = 1`
+}
+
+func (b *findMovementsBuilder) buildWhereProduct() {
+	if b.req.ProductId != "" {
+		b.values = append(b.values, b.req.ProductId)
+
+		b.query += fmt.Sprintf(`
+		AND "m"."product_id" = $%d`, b.lastIndex+1)
+
+		b.lastIndex = len(b.values)
+	}
+}
+
+func (b *findMovementsBuilder) buildWhereVariant() {
+	if b.req.VariantId != "" {
+		b.values = append(b.values, b.req.VariantId)
+
+		b.query += fmt.Sprintf(`
+		AND "m"."variant_id"::TEXT = $%d`, b.lastIndex+1)
+
+		b.lastIndex = len(b.values)
+	}
+}
+
+func (b *findMovementsBuilder) buildWhereOrder() {
+	if b.req.OrderId != "" {
+		b.values = append(b.values, b.req.OrderId)
+
+		b.query += fmt.Sprintf(`
+		AND "m"."order_id" = $%d`, b.lastIndex+1)
+
+		b.lastIndex = len(b.values)
+	}
+}
+
+// type ถูกตรวจใน handler แล้ว (reserve | release | sale | adjust)
+func (b *findMovementsBuilder) buildWhereType() {
+	if b.req.Type != "" {
+		b.values = append(b.values, b.req.Type)
+
+		b.query += fmt.Sprintf(`
+		AND "m"."type" = $%d`, b.lastIndex+1)
+
+		b.lastIndex = len(b.values)
+	}
+}
+
+// order_by เป็นชื่อ column ที่ handler เลือกจาก map แล้ว  ใส่ตรงๆ ได้
+func (b *findMovementsBuilder) buildSort() {
+	b.query += fmt.Sprintf(`
+		ORDER BY %s %s, "m"."id"`, b.req.OrderBy, b.req.Sort)
+}
+
+func (b *findMovementsBuilder) buildPaginate() {
+	b.values = append(
+		b.values,
+		(b.req.Page-1)*b.req.Limit, // offset  = page-1* limit
+		b.req.Limit,
+	)
+
+	b.query += fmt.Sprintf(`
+		OFFSET $%d LIMIT $%d`, b.lastIndex+1, b.lastIndex+2)
+
+	b.lastIndex = len(b.values)
+}
+
+func (b *findMovementsBuilder) closeQuery() {
+	b.query += `
+	) AS "at"`
+}
+
+func (b *findMovementsBuilder) getQuery() string { return b.query }
+
+func (b *findMovementsBuilder) getValues() []any { return b.values }
+
+func (b *findMovementsBuilder) getDb() *sqlx.DB { return b.db }
+
+func (b *findMovementsBuilder) reset() {
+	b.query = ""
+	b.values = make([]any, 0)
+	b.lastIndex = 0
+}
+
+// ---------------- Engineer Missing Function -------------
+// Find
+func (en *findMovementsEngineer) FindMovements() []*inventory.Movement {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	en.builder.initQuery()
+	en.buildWhere()
+	en.builder.buildSort()
+	en.builder.buildPaginate()
+	en.builder.closeQuery()
+
+	raw := make([]byte, 0)
+	if err := en.builder.getDb().GetContext(ctx, &raw, en.builder.getQuery(), en.builder.getValues()...); err != nil {
+		log.Printf("get inventory movements failed: %v\n", err)
+		en.builder.reset()
+		return make([]*inventory.Movement, 0)
+	}
+
+	movements := make([]*inventory.Movement, 0)
+	if err := json.Unmarshal(raw, &movements); err != nil {
+		log.Printf("unmarshal inventory movements failed: %v\n", err)
+	}
+
+	en.builder.reset()
+	return movements
+}
+
+// Count
+func (en *findMovementsEngineer) CountMovements() int {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	en.builder.initCountQuery()
+	en.buildWhere()
+
+	var count int
+	if err := en.builder.getDb().GetContext(ctx, &count, en.builder.getQuery(), en.builder.getValues()...); err != nil {
+		log.Printf("count inventory movements failed: %v\n", err)
+		en.builder.reset()
+		return 0
+	}
+
+	en.builder.reset()
+	return count
+}
+
+func (en *findMovementsEngineer) buildWhere() {
+	en.builder.buildWhereProduct()
+	en.builder.buildWhereVariant()
+	en.builder.buildWhereOrder()
+	en.builder.buildWhereType()
+}
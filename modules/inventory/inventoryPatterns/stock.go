@@ -0,0 +1,259 @@
+package inventoryPatterns
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/PHURINTOR/phurinshop/modules/inventory"
+	"github.com/jmoiron/sqlx"
+)
+
+// ----------Flow  (ทุก func ทำใน transaction ของคนเรียก  error = คนเรียก rollback)
+//    insert order     ---> Reserve   lock row (FOR UPDATE) ---> stock - reserved พอ ---> reserved + qty  (product ไม่ track_inventory = ข้าม)
+//    order completed  ---> Sell      ยอดที่ยังจองอยู่ของ order (จาก ledger) ---> stock - qty, reserved - qty
+//    order canceled   ---> Release   ยอดที่ยังจองอยู่ของ order (จาก ledger) ---> reserved - qty
+//    admin            ---> Adjust    stock + qty  (เริ่ม track_inventory ของ product)
+//    ทุกครั้งเขียน inventory_movements
+
+// ======================================= Struct ============================================
+type stockRow struct {
+	Stock    int    `db:"stock"`
+	Reserved int    `db:"reserved"`
+	Sku      string `db:"sku"`
+	Tracked  bool   `db:"track_inventory"` // FALSE = ไม่นับ stock  ไม่จอง ไม่ลง ledger
+}
+
+// ======================================= Missing Function ==================================
+// Reserve จองของทุกรายการของ order
+func Reserve(ctx context.Context, tx *sqlx.Tx, orderId string, items []*inventory.StockItem) error {
+	for _, item := range mergeItems(items) {
+		row, err := lockStock(ctx, tx, item)
+		if err != nil {
+			return err
+		}
+		if !row.Tracked { // ไม่มี reserve ใน ledger  Sell / Release ก็ไม่ทำอะไรกับรายการนี้
+			continue
+		}
+		if available := row.Stock - row.Reserved; available < item.Qty {
+			return fmt.Errorf("%w: %s has %d left", inventory.ErrOutOfStock, itemName(item, row), available)
+		}
+
+		row.Reserved += item.Qty
+		if err := saveStock(ctx, tx, item, row, &inventory.Movement{
+			OrderId: orderId,
+			Type:    inventory.ReserveMovement,
+			Qty:     item.Qty,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Release คืนของที่ order ยังจองอยู่  (เรียกซ้ำได้ ไม่มีของจองเหลือ = ไม่ทำอะไร)
+func Release(ctx context.Context, tx *sqlx.Tx, orderId string) error {
+	return settle(ctx, tx, orderId, inventory.ReleaseMovement)
+}
+
+// Sell ตัด stock ของที่ order จองไว้  (เรียกซ้ำได้)
+func Sell(ctx context.Context, tx *sqlx.Tx, orderId string) error {
+	return settle(ctx, tx, orderId, inventory.SaleMovement)
+}
+
+// Adjust admin เพิ่ม / ลด stock  ลดจนต่ำกว่าที่จองไว้ไม่ได้
+func Adjust(ctx context.Context, tx *sqlx.Tx, req *inventory.AdjustReq) (*inventory.Movement, error) {
+	item := &inventory.StockItem{
+		ProductId: req.ProductId,
+		VariantId: req.VariantId,
+		Qty:       req.Qty,
+	}
+	row, err := lockStock(ctx, tx, item)
+	if err != nil {
+		return nil, err
+	}
+	if row.Stock+req.Qty < row.Reserved {
+		return nil, fmt.Errorf("%w: %s has %d reserved", inventory.ErrStockReserved, itemName(item, row), row.Reserved)
+	}
+
+	row.Stock += req.Qty
+	row.Tracked = true
+	movement := &inventory.Movement{
+		Type:   inventory.AdjustMovement,
+		Qty:    req.Qty,
+		Note:   req.Note,
+		UserId: req.UserId,
+	}
+	if err := saveStock(ctx, tx, item, row, movement); err != nil {
+		return nil, err
+	}
+	return movement, nil
+}
+
+// settle ยอดที่ order ยังจองอยู่ = reserve - release - sale  (ต่อ product / variant)
+func settle(ctx context.Context, tx *sqlx.Tx, orderId string, movementType inventory.MovementType) error {
+	items := make([]*inventory.StockItem, 0)
+	if err := tx.SelectContext(ctx, &items, `
+	SELECT
+		"product_id",
+		COALESCE("variant_id"::TEXT, '') AS "variant_id",
+		SUM(CASE WHEN "type" = 'reserve' THEN "qty" ELSE -"qty" END) AS "qty"
+	FROM "inventory_movements"
+	WHERE "order_id" = $1
+		AND "type" IN ('reserve', 'release', 'sale')
+	GROUP BY "product_id", "variant_id"
+	HAVING SUM(CASE WHEN "type" = 'reserve' THEN "qty" ELSE -"qty" END) > 0;`, orderId); err != nil {
+		return fmt.Errorf("get reserved stock failed: %v", err)
+	}
+
+	for _, item := range mergeItems(items) {
+		row, err := lockStock(ctx, tx, item)
+		if errors.Is(err, inventory.ErrStockNotFound) { // product / variant ถูกลบไปแล้ว
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		row.Reserved -= min(item.Qty, row.Reserved)
+		if movementType == inventory.SaleMovement {
+			row.Stock -= item.Qty
+		}
+		if err := saveStock(ctx, tx, item, row, &inventory.Movement{
+			OrderId: orderId,
+			Type:    movementType,
+			Qty:     item.Qty,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockStock lock row ของ product / variant ไว้จนจบ transaction
+func lockStock(ctx context.Context, tx *sqlx.Tx, item *inventory.StockItem) (*stockRow, error) {
+	query := `
+	SELECT
+		"stock",
+		"reserved",
+		'' AS "sku",
+		"track_inventory"
+	FROM "products"
+	WHERE "id" = $1
+	FOR UPDATE;`
+	args := []any{item.ProductId}
+	if item.VariantId != "" {
+		query = `
+		SELECT
+			"stock",
+			"reserved",
+			"sku",
+			TRUE AS "track_inventory"
+		FROM "product_variants"
+		WHERE "id"::TEXT = $1
+			AND "product_id" = $2
+		FOR UPDATE;`
+		args = []any{item.VariantId, item.ProductId}
+	}
+
+	row := new(stockRow)
+	if err := tx.GetContext(ctx, row, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", inventory.ErrStockNotFound, itemName(item, row))
+		}
+		return nil, fmt.Errorf("lock stock failed: %v", err)
+	}
+	return row, nil
+}
+
+// saveStock เขียน stock, reserved ใหม่ + ledger
+func saveStock(ctx context.Context, tx *sqlx.Tx, item *inventory.StockItem, row *stockRow, movement *inventory.Movement) error {
+	query := `UPDATE "products" SET "stock" = $1, "reserved" = $2, "track_inventory" = $3 WHERE "id" = $4;`
+	args := []any{row.Stock, row.Reserved, row.Tracked, item.ProductId}
+	if item.VariantId != "" {
+		query = `UPDATE "product_variants" SET "stock" = $1, "reserved" = $2 WHERE "id"::TEXT = $3;`
+		args = []any{row.Stock, row.Reserved, item.VariantId}
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("update stock failed: %v", err)
+	}
+
+	movement.ProductId = item.ProductId
+	movement.VariantId = item.VariantId
+	movement.Sku = row.Sku
+	movement.Stock = row.Stock
+	movement.Reserved = row.Reserved
+	return insertMovement(ctx, tx, movement)
+}
+
+func insertMovement(ctx context.Context, tx *sqlx.Tx, m *inventory.Movement) error {
+	query := `
+	INSERT INTO "inventory_movements" (
+		"product_id",
+		"variant_id",
+		"sku",
+		"order_id",
+		"type",
+		"qty",
+		"stock",
+		"reserved",
+		"note",
+		"user_id"
+	)
+	VALUES ($1, NULLIF($2, '')::uuid, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, NULLIF($10, ''))
+		RETURNING "id", "created_at"::TEXT;`
+
+	if err := tx.QueryRowxContext(
+		ctx,
+		query,
+		m.ProductId,
+		m.VariantId,
+		m.Sku,
+		m.OrderId,
+		m.Type,
+		m.Qty,
+		m.Stock,
+		m.Reserved,
+		m.Note,
+		m.UserId,
+	).Scan(&m.Id, &m.CreatedAt); err != nil {
+		return fmt.Errorf("insert inventory movement failed: %v", err)
+	}
+	return nil
+}
+
+// mergeItems รวมรายการ product / variant เดียวกัน แล้วเรียงตาม product, variant  (ทุก transaction lock ตามลำดับเดียวกัน กัน deadlock)
+func mergeItems(items []*inventory.StockItem) []*inventory.StockItem {
+	merged := make(map[[2]string]*inventory.StockItem)
+	for _, item := range items {
+		key := [2]string{item.ProductId, item.VariantId}
+		if merged[key] == nil {
+			merged[key] = &inventory.StockItem{ProductId: item.ProductId, VariantId: item.VariantId}
+		}
+		merged[key].Qty += item.Qty
+	}
+
+	result := make([]*inventory.StockItem, 0, len(merged))
+	for _, item := range merged {
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ProductId != result[j].ProductId {
+			return result[i].ProductId < result[j].ProductId
+		}
+		return result[i].VariantId < result[j].VariantId
+	})
+	return result
+}
+
+func itemName(item *inventory.StockItem, row *stockRow) string {
+	if row != nil && row.Sku != "" {
+		return fmt.Sprintf("sku %s", row.Sku)
+	}
+	if item.VariantId != "" {
+		return fmt.Sprintf("variant %s of product %s", item.VariantId, item.ProductId)
+	}
+	return fmt.Sprintf("product %s", item.ProductId)
+}
@@ -0,0 +1,57 @@
+package inventoryRepositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/PHURINTOR/phurinshop/modules/inventory"
+	"github.com/PHURINTOR/phurinshop/modules/inventory/inventoryPatterns"
+	"github.com/jmoiron/sqlx"
+)
+
+// ======================================= Interface =========================================
+type IInventoryRepository interface {
+	FindMovements(req *inventory.MovementFilter) ([]*inventory.Movement, int)
+	AdjustStock(req *inventory.AdjustReq) (*inventory.Movement, error)
+}
+
+// ======================================= Struct ============================================
+type inventoryRepository struct {
+	db *sqlx.DB
+}
+
+// ======================================= Constructor =======================================
+func InventoryRepository(db *sqlx.DB) IInventoryRepository {
+	return &inventoryRepository{db: db}
+}
+
+// ======================================= missing Func =======================================
+
+// ----------------------- Find Movements -------------------
+func (r *inventoryRepository) FindMovements(req *inventory.MovementFilter) ([]*inventory.Movement, int) {
+	builder := inventoryPatterns.FindMovementsBuilder(r.db, req)
+	engineer := inventoryPatterns.FindMovementsEngineer(builder)
+	return engineer.FindMovements(), engineer.CountMovements()
+}
+
+// ----------------------- Adjust Stock -------------------
+func (r *inventoryRepository) AdjustStock(req *inventory.AdjustReq) (*inventory.Movement, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	movement, err := inventoryPatterns.Adjust(ctx, tx, req)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return movement, nil
+}
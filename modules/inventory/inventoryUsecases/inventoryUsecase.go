@@ -0,0 +1,43 @@
+package inventoryUsecases
+
+import (
+	"math"
+
+	"github.com/PHURINTOR/phurinshop/modules/entities"
+	"github.com/PHURINTOR/phurinshop/modules/inventory"
+	"github.com/PHURINTOR/phurinshop/modules/inventory/inventoryRepositories"
+)
+
+// ======================================= Interface =========================================
+type IInventoryUsecase interface {
+	FindMovements(req *inventory.MovementFilter) *entities.PaginateRes
+	AdjustStock(req *inventory.AdjustReq) (*inventory.Movement, error)
+}
+
+// ======================================= Struct ============================================
+type inventoryUsecase struct {
+	inventoryRepository inventoryRepositories.IInventoryRepository
+}
+
+// ======================================= Constructor =======================================
+func InventoryUsecase(inventoryRepository inventoryRepositories.IInventoryRepository) IInventoryUsecase {
+	return &inventoryUsecase{
+		inventoryRepository: inventoryRepository,
+	}
+}
+
+// ========================================Missing Function ==============================
+func (u *inventoryUsecase) FindMovements(req *inventory.MovementFilter) *entities.PaginateRes {
+	movements, count := u.inventoryRepository.FindMovements(req)
+	return &entities.PaginateRes{
+		Data:      movements,
+		Page:      req.Page,
+		Limit:     req.Limit,
+		TotalItem: count,
+		TotalPage: int(math.Ceil(float64(count) / float64(req.Limit))),
+	}
+}
+
+func (u *inventoryUsecase) AdjustStock(req *inventory.AdjustReq) (*inventory.Movement, error) {
+	return u.inventoryRepository.AdjustStock(req)
+}
@@ -1,6 +1,7 @@
 package middlewaresHandlers
 
 import (
+	"io"
 	"strings"
 
 	"github.com/PHURINTOR/phurinshop/config"
@@ -18,6 +19,7 @@ type IMidlewareHandlers interface {
 	Cors() fiber.Handler
 	RouterCheck() fiber.Handler
 	Logger() fiber.Handler
+	BodyLimit(streamed ...string) fiber.Handler
 
 	//User Token
 	JwtAuth() fiber.Handler
@@ -51,6 +53,9 @@ const (
 	//============ ApiKey
 	//ApikeyAuth
 	apiKeyAuthErr middlewareHandlersErrCode = "middleware-005"
+
+	//============ Body
+	bodyLimitErr middlewareHandlersErrCode = "middleware-006"
 )
 
 // ------------------------------- Constructor -------------------------------------
@@ -65,12 +70,13 @@ func MiddlewareHandler(cfg config.IConfig, middlewaresUsecases middlewareUsecase
 func (h *middlewareHandlers) Cors() fiber.Handler {
 	return cors.New(cors.Config{
 		Next:             cors.ConfigDefault.Next,
-		AllowOrigins:     "*",                              //เข้าถึงได้ทุก IP
-		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH", //เข้าถึงได้ทุก Method
+		AllowOrigins:     "*",                                      //เข้าถึงได้ทุก IP
+		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS", //เข้าถึงได้ทุก Method
 		AllowHeaders:     "",
 		AllowCredentials: false, //เดี๋ยวจะใช้ Token
-		ExposeHeaders:    "",
-		MaxAge:           0,
+		//tus client (resumable upload) ต้องอ่าน header เหล่านี้ได้
+		ExposeHeaders: "Location,Upload-Offset,Upload-Length,Upload-Metadata,Upload-Expires,Tus-Resumable,Tus-Version,Tus-Extension,Tus-Max-Size",
+		MaxAge:        0,
 	})
 }
 
@@ -92,6 +98,70 @@ func (h *middlewareHandlers) Logger() fiber.Handler {
 	})
 }
 
+// ----------------------------------- Middleware Body Limit
+// server เปิด StreamRequestBody  fasthttp ไม่ตัด body ที่เกิน APP_BODY_LIMIT ให้แล้ว  ตรวจเองที่นี่
+//   - route ทั่วไป             : ไม่เกิน APP_BODY_LIMIT  (chunked อ่านมาเก็บใน memory ได้ไม่เกินนี้)
+//   - route ใน streamed (prefix) : upload ไฟล์  handler อ่านจาก stream เอง  ไม่เกิน APP_UPLOAD_MAX_SIZE
+//     chunked ผ่านได้เฉพาะ body ดิบ (tus PATCH ตัดที่ Upload-Length, signed PUT ตัดที่ APP_UPLOAD_MAX_SIZE  handler ตัดตอนอ่านเอง)
+//     multipart ต้องมี Content-Length  c.MultipartForm() อ่าน stream ลง temp file ไม่มีเพดาน  (fasthttp ไม่ตัด chunked stream ให้)
+func (h *middlewareHandlers) BodyLimit(streamed ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		limit := h.cfg.App().BodyLimit()
+		stream := false
+		for _, prefix := range streamed {
+			if strings.HasPrefix(c.Path(), prefix) {
+				limit, stream = h.cfg.App().UploadMaxSize(), true
+				break
+			}
+		}
+
+		length := c.Request().Header.ContentLength()
+		if length > limit {
+			return entities.NewErrorResponse(c).Error(
+				fiber.StatusRequestEntityTooLarge,
+				string(bodyLimitErr),
+				"request body is too large",
+			).Res()
+		}
+		if length >= 0 {
+			return c.Next()
+		}
+		if stream {
+			if strings.HasPrefix(strings.ToLower(c.Get(fiber.HeaderContentType)), fiber.MIMEMultipartForm) {
+				return entities.NewErrorResponse(c).Error(
+					fiber.StatusLengthRequired,
+					string(bodyLimitErr),
+					"multipart upload must have content-length",
+				).Res()
+			}
+			return c.Next()
+		}
+
+		// Transfer-Encoding: chunked  ไม่รู้ขนาดล่วงหน้า  อ่านไม่เกิน limit แล้วใส่กลับเป็น body ปกติ
+		body := c.Context().RequestBodyStream()
+		if body == nil {
+			return c.Next()
+		}
+		data, err := io.ReadAll(io.LimitReader(body, int64(limit)+1))
+		if err != nil {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(bodyLimitErr),
+				err.Error(),
+			).Res()
+		}
+		if len(data) > limit {
+			return entities.NewErrorResponse(c).Error(
+				fiber.StatusRequestEntityTooLarge,
+				string(bodyLimitErr),
+				"request body is too large",
+			).Res()
+		}
+		c.Request().SetBody(data)
+		return c.Next()
+	}
+}
+
 // ----------------------------------- Middleware User Token
 func (h *middlewareHandlers) JwtAuth() fiber.Handler {
 	return func(c *fiber.Ctx) error {
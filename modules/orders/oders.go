@@ -1,10 +1,20 @@
 package orders
 
 import (
+	"errors"
+
 	"github.com/PHURINTOR/phurinshop/modules/entities"
 	"github.com/PHURINTOR/phurinshop/modules/products"
+	"github.com/PHURINTOR/phurinshop/pkg/money"
 )
 
+// ======================================= Error =============================================
+// ErrOrderClosed order ที่ completed / canceled แล้ว เปลี่ยน status ไม่ได้ (stock ถูกตัด / คืนไปแล้ว)
+var ErrOrderClosed = errors.New("order is already closed")
+
+// ErrMixedCurrency order 1 ใบต้องเป็นสกุลเงินเดียว
+var ErrMixedCurrency = errors.New("products in an order must have the same currency")
+
 // ----------------------- FindOneOrder ----------------------------------------------
 type Oders struct {
 	Id          string           `db:"id" json:"id"`
@@ -14,22 +24,26 @@ type Oders struct {
 	Address     string           `db:"address" json:"address"`
 	Contact     string           `db:"contact" json:"contact"`
 	Status      string           `db:"status" json:"status"`
-	TotalPaid   float64          `db:"total_paid" json:"total_paid"`
+	TotalPaid   money.Amount     `db:"total_paid" json:"total_paid"`
+	Currency    string           `db:"currency" json:"currency"` // สกุลของ product ใน order
 	CreatedAt   string           `db:"created_at" json:"created_at"`
 	UpdatedAt   string           `db:"updated_at" json:"updated_at"`
 }
 
 type TranferSlip struct {
-	Id        string `json:"id"`
-	FileName  string `json:"filename"`
-	Url       string `json:"url"`
-	CreatedAt string `json:"created_at"`
+	Id          string `json:"id"`
+	FileName    string `json:"filename"`
+	Url         string `json:"url,omitempty"`         // สลิปเก่าที่เป็น public link
+	Destination string `json:"destination,omitempty"` // ไฟล์ private ใต้ APP_STORAGE_PRIVATE_PREFIX  เปิดดูผ่าน /transfer-slip
+	CreatedAt   string `json:"created_at"`
 }
 
 type ProductsOrder struct {
-	Id      string            `db:"id" json:"id"`
-	Qty     int               `db:"qty" json:"qty"`
-	Product *products.Product `db:"product" json:"product"`
+	Id        string            `db:"id" json:"id"`
+	Qty       int               `db:"qty" json:"qty"`
+	Product   *products.Product `db:"product" json:"product"`
+	VariantId string            `db:"variant_id" json:"variant_id,omitempty"` // product ที่มี variant ต้องระบุ
+	Variant   *products.Variant `db:"variant" json:"variant,omitempty"`       // variant ณ ตอนสั่ง
 }
 
 // ----------------------- FindManyOrder ----------------------------------------------
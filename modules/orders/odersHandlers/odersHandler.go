@@ -1,13 +1,19 @@
 package odersHandlers
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/PHURINTOR/phurinshop/config"
 	"github.com/PHURINTOR/phurinshop/modules/entities"
+	"github.com/PHURINTOR/phurinshop/modules/files"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesUsecases"
+	"github.com/PHURINTOR/phurinshop/modules/inventory"
 	"github.com/PHURINTOR/phurinshop/modules/orders"
 	"github.com/PHURINTOR/phurinshop/modules/orders/odersUsecases"
+	"github.com/PHURINTOR/phurinshop/modules/products"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
@@ -20,6 +26,8 @@ const (
 	findOrderErr    ordersHandlersErrCode = "orders-002"
 	insertOrderErr  ordersHandlersErrCode = "orders-003"
 	updateOrderErr  ordersHandlersErrCode = "orders-004"
+	transferSlipErr ordersHandlersErrCode = "orders-005"
+	fileInfectedErr ordersHandlersErrCode = "files-010" // code เดียวกับ files module  client แยกไฟล์ติดไวรัสได้ทุก endpoint
 )
 
 // ======================================= Interface =========================================
@@ -28,19 +36,23 @@ type IOdersHandler interface {
 	FindOrder(c *fiber.Ctx) error
 	InsertOrder(c *fiber.Ctx) error
 	UpdateOrder(c *fiber.Ctx) error
+	UploadTransferSlip(c *fiber.Ctx) error
+	FindTransferSlip(c *fiber.Ctx) error
 }
 
 // ======================================= Struct ============================================
 type odersHandler struct {
 	cfg          config.IConfig
 	odersUsecase odersUsecases.IOrdersUsecase
+	filesUsecase filesUsecases.IFilesUsecase
 }
 
 // ======================================= Constructor =======================================
-func OdersHandler(cfg config.IConfig, odersUsecase odersUsecases.IOrdersUsecase) IOdersHandler {
+func OdersHandler(cfg config.IConfig, odersUsecase odersUsecases.IOrdersUsecase, filesUsecase filesUsecases.IFilesUsecase) IOdersHandler {
 	return &odersHandler{
 		cfg:          cfg,
 		odersUsecase: odersUsecase,
+		filesUsecase: filesUsecase,
 	}
 }
 
@@ -85,11 +97,30 @@ func (h *odersHandler) FindOrder(c *fiber.Ctx) error {
 		req.Limit = 5
 	}
 
-	// Check OrderBy
+	// Cursor  ?cursor = keyset แทน page  order_by, sort ใช้ตามที่ติดมากับ cursor
 	orderByMap := map[string]string{
-		"id":         `"o","id"`,
-		"created_at": `"o"."created_at"`,
+		"id":         "id",
+		"created_at": "created_at",
 	}
+	if c.Context().QueryArgs().Has("cursor") {
+		cursor, err := entities.DecodeCursor(req.Cursor)
+		if err == nil && !cursor.First() {
+			req.OrderBy, req.Sort = cursor.OrderBy, cursor.Sort
+			if orderByMap[cursor.OrderBy] == "" {
+				err = entities.ErrInvalidCursor
+			}
+		}
+		if err != nil {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(findOrderErr),
+				err.Error(),
+			).Res()
+		}
+		req.Keyset = cursor
+	}
+
+	// Check OrderBy  (sql ของ key อยู่ใน builder)
 	if orderByMap[req.OrderBy] == "" {
 		req.OrderBy = orderByMap["id"]
 	}
@@ -157,6 +188,15 @@ func (h *odersHandler) InsertOrder(c *fiber.Ctx) error {
 			"products are emtry",
 		).Res()
 	}
+	for _, p := range req.Products {
+		if p.Qty < 1 {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(insertOrderErr),
+				"qty must be greater than 0",
+			).Res()
+		}
+	}
 
 	// check role
 	if c.Locals("userRoleId").(int) != 2 { // ต้องแปลงเป็น Int locals valut = type any   ,  2 =Role admin
@@ -172,6 +212,20 @@ func (h *odersHandler) InsertOrder(c *fiber.Ctx) error {
 	// Execute
 	order, err := h.odersUsecase.InsertOrder(req)
 	if err != nil {
+		if errors.Is(err, inventory.ErrOutOfStock) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrConflict.Code,
+				string(insertOrderErr),
+				err.Error(),
+			).Res()
+		}
+		if errors.Is(err, products.ErrProductNotPublished) || errors.Is(err, orders.ErrMixedCurrency) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrUnprocessableEntity.Code,
+				string(insertOrderErr),
+				err.Error(),
+			).Res()
+		}
 		return entities.NewErrorResponse(c).Error(
 			fiber.ErrBadGateway.Code,
 			string(insertOrderErr),
@@ -212,38 +266,156 @@ func (h *odersHandler) UpdateOrder(c *fiber.Ctx) error {
 		req.Status = statusMap[strings.ToLower(req.Status)]
 	} else if strings.ToLower(req.Status) == statusMap["canceled"] { // user
 		req.Status = statusMap["canceled"]
+	} else {
+		req.Status = "" // user เปลี่ยนเป็น status อื่นไม่ได้ (completed = ตัด stock)
 	}
 
-	// Update TranferSlip
+	// TranferSlip ต้อง upload ผ่าน /transfer-slip เท่านั้น (เก็บเป็นไฟล์ private)  ไม่รับ url จาก body
 	if req.TranferSlip != nil {
-		if req.TranferSlip.Id == "" {
-			req.TranferSlip.Id = uuid.NewString()
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(updateOrderErr),
+			"transfer slip must be uploaded to /:user_id/:order_id/transfer-slip",
+		).Res()
+	}
+
+	order, err := h.odersUsecase.UpdateOrder(req)
+	if err != nil {
+		if errors.Is(err, orders.ErrOrderClosed) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrConflict.Code,
+				string(updateOrderErr),
+				err.Error(),
+			).Res()
 		}
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(updateOrderErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusCreated, order).Res()
+}
 
-		if req.TranferSlip.CreatedAt == "" {
-			loc, err := time.LoadLocation("Asia/Bangkok")
-			if err != nil {
-				return entities.NewErrorResponse(c).Error(
-					fiber.ErrInternalServerError.Code,
-					string(updateOrderErr),
-					err.Error(),
-				).Res()
-			}
-			now := time.Now().In(loc)
-			// YYYY-MM-DD HH:MM:SS
-			// YYYY = 2006,   MM = 01,  DD=02   |  HH =15    MM=04  SS=05
-			req.TranferSlip.CreatedAt = now.Format("2006-01-02 15:04:05")
+// ---------- Upload Transfer Slip -------------
+// สลิปมีเลขบัญชี ชื่อ-นามสกุล  เก็บเป็นไฟล์ private  เจ้าของ order หรือ admin เท่านั้นที่เปิดดูได้
+func (h *odersHandler) UploadTransferSlip(c *fiber.Ctx) error {
+	order, err := h.findOwnOrder(c)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrNotFound.Code,
+			string(transferSlipErr),
+			err.Error(),
+		).Res()
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(transferSlipErr),
+			"file is required",
+		).Res()
+	}
 
+	destination := fmt.Sprintf("%s/transfer-slips/%s", h.cfg.App().StoragePrivatePrefix(), order.Id)
+	fileReq, err := h.filesUsecase.PrepareUpload(file, destination)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(transferSlipErr),
+			err.Error(),
+		).Res()
+	}
+	fileReq.Private = true
+	fileReq.UserId = c.Locals("userId").(string)
+
+	res, err := h.filesUsecase.UploadToGCP([]*files.FileReq{fileReq})
+	if err != nil {
+		if errors.Is(err, filesUsecases.ErrFileInfected) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrUnprocessableEntity.Code,
+				string(fileInfectedErr),
+				err.Error(),
+			).Res()
 		}
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(transferSlipErr),
+			err.Error(),
+		).Res()
 	}
 
-	order, err := h.odersUsecase.UpdateOrder(req)
+	loc, err := time.LoadLocation("Asia/Bangkok")
 	if err != nil {
 		return entities.NewErrorResponse(c).Error(
 			fiber.ErrInternalServerError.Code,
-			string(updateOrderErr),
+			string(transferSlipErr),
 			err.Error(),
 		).Res()
 	}
-	return entities.NewErrorResponse(c).Success(fiber.StatusCreated, order).Res()
+
+	updated, err := h.odersUsecase.UpdateOrder(&orders.Oders{
+		Id: order.Id,
+		TranferSlip: &orders.TranferSlip{
+			Id:          uuid.NewString(),
+			FileName:    res[0].FileName,
+			Destination: fileReq.Destination,
+			// YYYY-MM-DD HH:MM:SS
+			CreatedAt: time.Now().In(loc).Format("2006-01-02 15:04:05"),
+		},
+	})
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(transferSlipErr),
+			err.Error(),
+		).Res()
+	}
+
+	// ลบสลิปใบเก่า (ถ้ามี)
+	if order.TranferSlip != nil && order.TranferSlip.Destination != "" {
+		h.filesUsecase.DeleteFileGCP([]*files.DeleteFileReq{{Destination: order.TranferSlip.Destination}})
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusCreated, updated).Res()
+}
+
+// ---------- Find Transfer Slip -------------
+// คืน signed url อายุสั้น (APP_SIGNED_URL_EXPIRES) แทน public link
+func (h *odersHandler) FindTransferSlip(c *fiber.Ctx) error {
+	order, err := h.findOwnOrder(c)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrNotFound.Code,
+			string(transferSlipErr),
+			err.Error(),
+		).Res()
+	}
+
+	if order.TranferSlip == nil || order.TranferSlip.Destination == "" {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrNotFound.Code,
+			string(transferSlipErr),
+			"transfer slip not found",
+		).Res()
+	}
+
+	res, err := h.filesUsecase.SignDownloadUrl(&files.SignedUrlReq{Destination: order.TranferSlip.Destination})
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(transferSlipErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, res).Res()
+}
+
+// findOwnOrder ParamsCheck เช็คแค่ :user_id กับ token  ต้องเช็คต่อว่า order เป็นของ :user_id จริง
+func (h *odersHandler) findOwnOrder(c *fiber.Ctx) (*orders.Oders, error) {
+	order, err := h.odersUsecase.FindOneOrder(strings.Trim(c.Params("order_id"), " "))
+	if err != nil || order.UserId != c.Params("user_id") {
+		return nil, fmt.Errorf("order not found")
+	}
+	return order, nil
 }
@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/PHURINTOR/phurinshop/modules/entities"
+	"github.com/PHURINTOR/phurinshop/modules/inventory/inventoryPatterns"
 	"github.com/PHURINTOR/phurinshop/modules/orders"
 	"github.com/PHURINTOR/phurinshop/modules/orders/ordersPatterns"
 	"github.com/jmoiron/sqlx"
@@ -14,9 +17,11 @@ import (
 // ======================================= Interface =========================================
 type IOrdersRepository interface {
 	FindOneOrder(orderId string) (*orders.Oders, error)
-	FindOrder(req *orders.OrderFilter) ([]*orders.Oders, int)
+	FindOrder(req *orders.OrderFilter) ([]*orders.Oders, int, *entities.CursorRes)
 	InsertOrder(req *orders.Oders) (string, error)
 	UpdateOrder(req *orders.Oders) error
+	FindPublicSlips(afterId string, limit int) ([]*orders.Oders, error)
+	MoveTransferSlip(orderId, oldUrl string, slip *orders.TranferSlip) (bool, error)
 }
 
 // ======================================= Struct ============================================
@@ -40,10 +45,10 @@ func (r *ordersRepository) FindOneOrder(orderId string) (*orders.Oders, error) {
 
 	/*		SELECT
 			SUM("po"."product"->>'price')  |   ->> เข้าถึงฟิวด์ json -> เข้าถึง index ด้วย sql
-			SUM(("po"."product"->>'price')::FLOAT)   = ::FLOAT คือแปลงค่าเนื่องจาก ๋json เป็น text
+			SUM(("po"."product"->>'price')::NUMERIC)   = ::NUMERIC คือแปลงค่าเนื่องจาก ๋json เป็น text
 
 			SELECT
-					SUM(COALESCE(("po"."product"->>'price')::FLOAT*("po"."qty")::FLOAT, 0))
+					SUM(COALESCE(("po"."product"->>'price')::NUMERIC*"po"."qty", 0))
 
 					COALESCE เอาไว้ตรวจค่า Null ใน sql ถ้า null จะให้เท่ากับ 0
 	*/
@@ -63,7 +68,9 @@ func (r *ordersRepository) FindOneOrder(orderId string) (*orders.Oders, error) {
 					SELECT
 						"spo"."id",
 						"spo","qty",
-						"spo","product"
+						"spo","product",
+						"spo"."variant_id",
+						"spo"."variant"
 					FROM "products_orders" "spo"
 					WHERE "spo"."order_id" = "o"."id"
 				) AS "pt"
@@ -72,10 +79,11 @@ func (r *ordersRepository) FindOneOrder(orderId string) (*orders.Oders, error) {
 			"o"."contact",
 			(
 				SELECT
-					SUM(COALESCE(("po"."product"->>'price')::FLOAT*("po"."qty")::FLOAT, 0))
+					COALESCE(SUM(COALESCE(("po"."variant"->>'price')::NUMERIC, ("po"."product"->>'effective_price')::NUMERIC, ("po"."product"->>'price')::NUMERIC, 0) * "po"."qty"), 0)
 				FROM "products_orders" "po"
 				WHERE "po"."order_id" = "o"."id"
 			) AS "total_paid",
+			"o"."currency",
 			"o"."created_at",
 			"o"."updated_at"
 		FROM "orders" "o"
@@ -104,10 +112,16 @@ func (r *ordersRepository) FindOneOrder(orderId string) (*orders.Oders, error) {
 
 // ----------------------- FindManyOrder -------------------
 
-func (r *ordersRepository) FindOrder(req *orders.OrderFilter) ([]*orders.Oders, int) {
+func (r *ordersRepository) FindOrder(req *orders.OrderFilter) ([]*orders.Oders, int, *entities.CursorRes) {
 	builder := ordersPatterns.FindOrderBuilder(r.db, req)
 	engineer := ordersPatterns.FindOrderEngineer(builder)
-	return engineer.FindOrder(), engineer.CountOrder()
+
+	// keyset (req.Keyset) ไม่ COUNT  ได้ cursor แทน
+	data := engineer.FindOrder()
+	if req.Keyset != nil {
+		return data, 0, engineer.Cursors()
+	}
+	return data, engineer.CountOrder(), nil
 }
 
 // ----------------------- Insert Orders -------------------
@@ -121,7 +135,11 @@ func (r *ordersRepository) InsertOrder(req *orders.Oders) (string, error) {
 }
 
 // ----------------------- Update Orders -------------------
+// lock order ---> completed / canceled แล้วเปลี่ยนไม่ได้ ---> completed = ตัด stock, canceled = คืนของที่จอง ---> update  (transaction เดียว)
 func (r *ordersRepository) UpdateOrder(req *orders.Oders) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
 	query := `
 	UPDATE "orders" SET`
 
@@ -145,6 +163,11 @@ func (r *ordersRepository) UpdateOrder(req *orders.Oders) error {
 		lastIndex++
 	}
 
+	// ไม่มีอะไรให้แก้
+	if len(queryWhereStack) == 0 {
+		return nil
+	}
+
 	// Where = id
 	values = append(values, req.Id)
 
@@ -163,11 +186,100 @@ func (r *ordersRepository) UpdateOrder(req *orders.Oders) error {
 	// Summary Query
 	query += queryClose
 
-	fmt.Println(query)
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// Stock  lock order กัน update status พร้อมกัน (ตัด / คืน stock ซ้ำ)
+	if req.Status != "" {
+		var status string
+		if err := tx.GetContext(ctx, &status, `SELECT "status" FROM "orders" WHERE "id" = $1 FOR UPDATE;`, req.Id); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("get order status failed: %v", err)
+		}
+
+		if status != req.Status {
+			if status == "completed" || status == "canceled" {
+				tx.Rollback()
+				return fmt.Errorf("%w: %s", orders.ErrOrderClosed, status)
+			}
+
+			switch req.Status {
+			case "completed":
+				err = inventoryPatterns.Sell(ctx, tx, req.Id)
+			case "canceled":
+				err = inventoryPatterns.Release(ctx, tx, req.Id)
+			}
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
 
 	// Update excute
-	if _, err := r.db.ExecContext(context.Background(), query, values...); err != nil {
+	if _, err := tx.ExecContext(ctx, query, values...); err != nil {
+		tx.Rollback()
 		return fmt.Errorf("update error failed: %v", err)
 	}
-	return nil
+	return tx.Commit()
+}
+
+// ----------------------- Public transfer slips -------------------
+// FindPublicSlips order ที่สลิปยังเป็น public link (ก่อนเก็บสลิปแบบ private)  เรียงตาม id ต่อจาก afterId
+func (r *ordersRepository) FindPublicSlips(afterId string, limit int) ([]*orders.Oders, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	rows, err := r.db.QueryxContext(ctx, `
+	SELECT
+		"id",
+		"user_id",
+		"transfer_slip"
+	FROM "orders"
+	WHERE COALESCE("transfer_slip"->>'url', '') <> ''
+		AND COALESCE("transfer_slip"->>'destination', '') = ''
+		AND "id" > $1
+	ORDER BY "id"
+	LIMIT $2;`, afterId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get public transfer slips failed: %v", err)
+	}
+	defer rows.Close()
+
+	data := make([]*orders.Oders, 0)
+	for rows.Next() {
+		order := &orders.Oders{TranferSlip: &orders.TranferSlip{}}
+		var slip []byte
+		if err := rows.Scan(&order.Id, &order.UserId, &slip); err != nil {
+			return nil, fmt.Errorf("scan transfer slip failed: %v", err)
+		}
+		if err := json.Unmarshal(slip, order.TranferSlip); err != nil {
+			return nil, fmt.Errorf("unmarshal transfer slip of order %s failed: %v", order.Id, err)
+		}
+		data = append(data, order)
+	}
+	return data, rows.Err()
+}
+
+// MoveTransferSlip เปลี่ยนสลิปเป็นไฟล์ private  เฉพาะเมื่อสลิปยังเป็น url เดิม (ไม่ทับสลิปใบใหม่ที่ user เพิ่ง upload)
+func (r *ordersRepository) MoveTransferSlip(orderId, oldUrl string, slip *orders.TranferSlip) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+	UPDATE "orders" SET
+		"transfer_slip" = $1
+	WHERE "id" = $2
+		AND "transfer_slip"->>'url' = $3
+		AND COALESCE("transfer_slip"->>'destination', '') = '';`, slip, orderId, oldUrl)
+	if err != nil {
+		return false, fmt.Errorf("update transfer slip of order %s failed: %v", orderId, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
 }
@@ -2,11 +2,16 @@ package odersUsecases
 
 import (
 	"fmt"
+	"log"
 	"math"
 
+	"github.com/PHURINTOR/phurinshop/config"
 	"github.com/PHURINTOR/phurinshop/modules/entities"
+	"github.com/PHURINTOR/phurinshop/modules/files"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesUsecases"
 	"github.com/PHURINTOR/phurinshop/modules/orders"
 	"github.com/PHURINTOR/phurinshop/modules/orders/odersRepositories"
+	"github.com/PHURINTOR/phurinshop/modules/products"
 	"github.com/PHURINTOR/phurinshop/modules/products/productsRepositories"
 )
 
@@ -16,19 +21,24 @@ type IOrdersUsecase interface {
 	FindOrder(req *orders.OrderFilter) *entities.PaginateRes
 	InsertOrder(req *orders.Oders) (*orders.Oders, error)
 	UpdateOrder(req *orders.Oders) (*orders.Oders, error)
+	MigrateTransferSlips() (int, error)
 }
 
 // ======================================= Struct ============================================
 type odersUsecase struct {
+	cfg                config.IConfig
 	ordersRepository   odersRepositories.IOrdersRepository
 	productsRepository productsRepositories.IProductsRepository
+	filesUsecase       filesUsecases.IFilesUsecase
 }
 
 // ======================================= Constructor =======================================
-func OdersUsecase(ordersRepository odersRepositories.IOrdersRepository, productsRepository productsRepositories.IProductsRepository) IOrdersUsecase {
+func OdersUsecase(cfg config.IConfig, ordersRepository odersRepositories.IOrdersRepository, productsRepository productsRepositories.IProductsRepository, filesUsecase filesUsecases.IFilesUsecase) IOrdersUsecase {
 	return &odersUsecase{
+		cfg:                cfg,
 		ordersRepository:   ordersRepository,
 		productsRepository: productsRepository,
+		filesUsecase:       filesUsecase,
 	}
 }
 
@@ -44,7 +54,17 @@ func (u *odersUsecase) FindOneOrder(orderId string) (*orders.Oders, error) {
 
 // ---------- FindManyOrder -------------
 func (u *odersUsecase) FindOrder(req *orders.OrderFilter) *entities.PaginateRes {
-	orders, count := u.ordersRepository.FindOrder(req)
+	orders, count, cursors := u.ordersRepository.FindOrder(req)
+
+	// keyset  ไม่มี page / total
+	if cursors != nil {
+		return &entities.PaginateRes{
+			Data:       orders,
+			Limit:      req.Limit,
+			NextCursor: cursors.Next,
+			PrevCursor: cursors.Prev,
+		}
+	}
 	return &entities.PaginateRes{
 		Data:      orders,
 		Page:      req.Page,
@@ -65,10 +85,36 @@ func (u *odersUsecase) InsertOrder(req *orders.Oders) (*orders.Oders, error) {
 		if err != nil {
 			return nil, err
 		}
+		// draft, scheduled, archived สั่งไม่ได้
+		if prod.Status != products.StatusPublished {
+			return nil, fmt.Errorf("product %s: %w", prod.Id, products.ErrProductNotPublished)
+		}
+
+		// product ที่มี variant ต้องเลือก variant  ราคาใช้ของ variant
+		var variant *products.Variant
+		if len(prod.Variants) > 0 || req.Products[i].VariantId != "" {
+			variant = prod.FindVariant(req.Products[i].VariantId)
+			if variant == nil {
+				return nil, fmt.Errorf("variant %q of product %s is not found", req.Products[i].VariantId, prod.Id)
+			}
+		}
+
+		// สกุลเงินต้องตรงกันทั้ง order
+		if i == 0 {
+			req.Currency = prod.Currency
+		} else if prod.Currency != req.Currency {
+			return nil, fmt.Errorf("product %s (%s), order (%s): %w", prod.Id, prod.Currency, req.Currency, orders.ErrMixedCurrency)
+		}
+
+		// Set price  (หน่วยย่อย  ไม่ผ่าน float)
+		req.TotalPaid += prod.VariantPrice(variant).Mul(req.Products[i].Qty)
 
-		// Set price
-		req.TotalPaid += req.Products[i].Product.Price * float64(req.Products[i].Qty)
+		// stock ตรวจ / จองตอน insert (lock row ใน transaction)  ไม่ตรวจตรงนี้ กันขายเกิน
+
+		// เก็บเฉพาะ variant ที่ซื้อ  ไม่ต้องเก็บทุก variant ไว้ใน product
+		prod.Variants = nil
 		req.Products[i].Product = prod
+		req.Products[i].Variant = variant
 	}
 
 	orderId, err := u.ordersRepository.InsertOrder(req)
@@ -99,3 +145,73 @@ func (u *odersUsecase) UpdateOrder(req *orders.Oders) (*orders.Oders, error) {
 
 	return order, nil
 }
+
+// ---------- Migrate Transfer Slips ------------
+// ----------Flow
+//    สลิปเก่า (public url) ---> copy เป็นไฟล์ private ใต้ <APP_STORAGE_PRIVATE_PREFIX>/transfer-slips/<order id>
+//    ---> order ชี้ไปที่ destination ใหม่ ---> ลบไฟล์ public เดิม  (ลบหลังสุด  ล่มกลางทางสลิปยังเปิดได้)
+
+// slipBatch จำนวน order ต่อรอบ
+const slipBatch = 50
+
+// MigrateTransferSlips ย้ายสลิป public ทั้งหมด  คืนจำนวนที่ย้ายได้  ใบที่ย้ายไม่ได้ log ไว้แล้วข้ามไป
+func (u *odersUsecase) MigrateTransferSlips() (int, error) {
+	var moved int
+	var after string
+	for {
+		data, err := u.ordersRepository.FindPublicSlips(after, slipBatch)
+		if err != nil {
+			return moved, err
+		}
+		if len(data) == 0 {
+			return moved, nil
+		}
+		for _, order := range data {
+			after = order.Id
+			if err := u.migrateTransferSlip(order); err != nil {
+				log.Printf("migrate transfer slip of order %s failed: %v\n", order.Id, err)
+				continue
+			}
+			moved++
+		}
+	}
+}
+
+func (u *odersUsecase) migrateTransferSlip(order *orders.Oders) error {
+	key, ok := u.filesUsecase.ObjectKey(order.TranferSlip.Url)
+	if !ok {
+		return fmt.Errorf("url %q is not in storage", order.TranferSlip.Url)
+	}
+
+	destination := fmt.Sprintf("%s/transfer-slips/%s", u.cfg.App().StoragePrivatePrefix(), order.Id)
+	res, err := u.filesUsecase.CopyToPrivate(key, destination, order.UserId)
+	if err != nil {
+		return err
+	}
+
+	updated, err := u.ordersRepository.MoveTransferSlip(order.Id, order.TranferSlip.Url, &orders.TranferSlip{
+		Id:          order.TranferSlip.Id,
+		FileName:    res.FileName,
+		Destination: res.Destination,
+		CreatedAt:   order.TranferSlip.CreatedAt,
+	})
+	if err != nil || !updated {
+		// ไม่ได้ใช้ไฟล์ใหม่ (error หรือ user upload สลิปใบใหม่ระหว่างย้าย)
+		u.filesUsecase.DeleteFileGCP([]*files.DeleteFileReq{{Destination: res.Destination}})
+		return err
+	}
+	return u.filesUsecase.DeleteFileGCP([]*files.DeleteFileReq{{Destination: key}})
+}
+
+// StartSlipMigration ย้ายสลิป public เก่าครั้งเดียวตอน start server  (รันซ้ำได้  ใบที่ย้ายแล้วไม่ถูกเลือกอีก)
+func StartSlipMigration(usecase IOrdersUsecase) {
+	go func() {
+		moved, err := usecase.MigrateTransferSlips()
+		if err != nil {
+			log.Printf("migrate transfer slips failed: %v\n", err)
+		}
+		if moved > 0 {
+			log.Printf("migrate transfer slips: %d\n", moved)
+		}
+	}()
+}
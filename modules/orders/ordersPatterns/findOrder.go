@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/PHURINTOR/phurinshop/modules/entities"
 	"github.com/PHURINTOR/phurinshop/modules/orders"
 	"github.com/jmoiron/sqlx"
 )
@@ -20,6 +21,7 @@ type IFindOrderBuilder interface {
 	buildWhereSearch()
 	buildWhereStatus()
 	buildWhereDate()
+	buildCursor()
 	buildSort()
 	buildPaginate()
 	closeQuery()
@@ -29,6 +31,7 @@ type IFindOrderBuilder interface {
 	setValues(data []any)
 	setLastIndex(n int)
 	getDb() *sqlx.DB
+	keyset(data []*orders.Oders) ([]*orders.Oders, *entities.CursorRes)
 	reset()
 }
 
@@ -54,6 +57,7 @@ func FindOrderBuilder(db *sqlx.DB, req *orders.OrderFilter) IFindOrderBuilder {
 // ---------------- Engineer Stuct ------------------------
 type findOrderEngineer struct {
 	builder IFindOrderBuilder
+	cursors *entities.CursorRes // keyset  หลัง FindOrder()
 }
 
 // ---------------- Engineer Constructor ------------------
@@ -80,7 +84,9 @@ func (b *findOrderBuilder) initQuery() {
 					SELECT
 						"spo"."id",
 						"spo"."qty",
-						"spo"."product"
+						"spo"."product",
+						"spo"."variant_id",
+						"spo"."variant"
 					FROM "products_orders" "spo"
 					WHERE "spo"."order_id" = "o"."id"
 				) AS "pt"
@@ -89,10 +95,11 @@ func (b *findOrderBuilder) initQuery() {
 			"o"."contact",
 			(
 				SELECT
-					SUM(COALESCE(("po"."product"->>'price')::FLOAT*("po"."qty")::FLOAT, 0))
+					COALESCE(SUM(COALESCE(("po"."variant"->>'price')::NUMERIC, ("po"."product"->>'effective_price')::NUMERIC, ("po"."product"->>'price')::NUMERIC, 0) * "po"."qty"), 0)
 				FROM "products_orders" "po"
 				WHERE "po"."order_id" = "o"."id"
 			) AS "total_paid",
+			"o"."currency",
 			"o"."created_at",
 			"o"."updated_at"
 		FROM "orders" "o"
@@ -176,18 +183,81 @@ func (b *findOrderBuilder) buildWhereDate() {
 	}
 }
 
-func (b *findOrderBuilder) buildSort() {
-	b.values = append(b.values, b.req.OrderBy) //เหตุผลที่ไม่เพิ่ม sort ใน อากิวแม้นเพราะว่า ASC, DESC จะเรียงอากิวเม้นไม่ได้
+// order_by เลือกจาก map เท่านั้น (ORDER BY $1 = เรียงด้วยค่าคงที่)   key, sql, type ของค่าใน cursor
+func (b *findOrderBuilder) orderByColumn() (string, string, string) {
+	columns := map[string][2]string{
+		"id":         {`"o"."id"`, "VARCHAR"},
+		"created_at": {`"o"."created_at"`, "TIMESTAMP"},
+	}
+	key := b.req.OrderBy
+	if _, ok := columns[key]; !ok {
+		key = "id"
+	}
+	return key, columns[key][0], columns[key][1]
+}
 
-	// Fix
-	// ต้องแปลงเป็น string ก่อนค่อยเรียง
-	b.query += fmt.Sprintf(`
-		ORDER BY $%d %s`, b.lastIndex+1, b.req.Sort)
+func (b *findOrderBuilder) direction() string {
+	if strings.ToUpper(b.req.Sort) == "ASC" {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+// keyset  (key, id) ต่อจากแถวใน cursor  prev = ย้อนทิศ
+func (b *findOrderBuilder) buildCursor() {
+	if b.req.Keyset == nil || b.req.Keyset.First() {
+		return
+	}
+	_, orderBy, cast := b.orderByColumn()
+
+	operator := ">"
+	if b.direction() == "DESC" {
+		operator = "<"
+	}
+	if b.req.Keyset.Prev {
+		operator = map[string]string{">": "<", "<": ">"}[operator]
+	}
+
+	b.values = append(b.values, b.req.Keyset.Value, b.req.Keyset.Id)
+
+	query := fmt.Sprintf(`
+		AND (%s, "o"."id") %s ($%d::%s, $%d)`,
+		orderBy,
+		operator,
+		b.lastIndex+1,
+		cast,
+		b.lastIndex+2,
+	)
+	temp := b.getQuery()
+	temp += query
+	b.setQuery(temp)
 
 	b.lastIndex = len(b.values)
 }
 
+// id เรียงทิศเดียวกับ key  (ให้ keyset เทียบเป็น row ได้)
+func (b *findOrderBuilder) buildSort() {
+	_, orderBy, _ := b.orderByColumn()
+
+	direction := b.direction()
+	if b.req.Keyset != nil && b.req.Keyset.Prev {
+		direction = map[string]string{"ASC": "DESC", "DESC": "ASC"}[direction]
+	}
+
+	b.query += fmt.Sprintf(`
+		ORDER BY %s %s, "o"."id" %s`, orderBy, direction, direction)
+}
+
 func (b *findOrderBuilder) buildPaginate() {
+	// keyset  ดึงเกิน 1 แถว เอาไว้ดูว่ามีหน้าถัดไปไหม
+	if b.req.Keyset != nil {
+		b.values = append(b.values, b.req.Limit+1)
+		b.query += fmt.Sprintf(`
+		LIMIT $%d`, b.lastIndex+1)
+		b.lastIndex = len(b.values)
+		return
+	}
+
 	b.values = append(
 		b.values,
 		(b.req.Page-1)*b.req.Limit, // offset  = page-1* limit
@@ -218,6 +288,50 @@ func (b *findOrderBuilder) setLastIndex(n int) { b.lastIndex = n }
 
 func (b *findOrderBuilder) getDb() *sqlx.DB { return b.db }
 
+// keyset  ตัดแถวเกิน ---> prev กลับลำดับ ---> cursor หน้าถัดไป / ก่อนหน้า  (page/limit = nil)
+func (b *findOrderBuilder) keyset(data []*orders.Oders) ([]*orders.Oders, *entities.CursorRes) {
+	if b.req.Keyset == nil {
+		return data, nil
+	}
+	hasMore := len(data) > b.req.Limit
+	if hasMore {
+		data = data[:b.req.Limit]
+	}
+	if b.req.Keyset.Prev {
+		for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+		}
+	}
+
+	cursors := new(entities.CursorRes)
+	if len(data) == 0 {
+		return data, cursors
+	}
+	key, _, _ := b.orderByColumn()
+	cursor := func(o *orders.Oders, prev bool) string {
+		value := o.Id
+		if key == "created_at" {
+			value = o.CreatedAt
+		}
+		return (&entities.Cursor{
+			OrderBy: key,
+			Sort:    b.direction(),
+			Value:   value,
+			Id:      o.Id,
+			Prev:    prev,
+		}).Encode()
+	}
+
+	// ไปต่อได้ = มีแถวเกินในทิศที่ดึง  หรือ มาจากอีกฝั่ง
+	if (!b.req.Keyset.Prev && hasMore) || (b.req.Keyset.Prev && !b.req.Keyset.First()) {
+		cursors.Next = cursor(data[len(data)-1], false)
+	}
+	if (b.req.Keyset.Prev && hasMore) || (!b.req.Keyset.Prev && !b.req.Keyset.First()) {
+		cursors.Prev = cursor(data[0], true)
+	}
+	return data, cursors
+}
+
 func (b *findOrderBuilder) reset() {
 	b.query = ""
 	b.values = make([]any, 0)
@@ -234,6 +348,7 @@ func (en *findOrderEngineer) FindOrder() []*orders.Oders {
 	en.builder.buildWhereSearch()
 	en.builder.buildWhereStatus()
 	en.builder.buildWhereDate()
+	en.builder.buildCursor()
 	en.builder.buildSort()
 	en.builder.buildPaginate()
 	en.builder.closeQuery()
@@ -250,11 +365,20 @@ func (en *findOrderEngineer) FindOrder() []*orders.Oders {
 	if err := json.Unmarshal(raw, &ordersData); err != nil {
 		log.Printf("unmarshal orders failed: %v\n", err)
 	}
+	ordersData, en.cursors = en.builder.keyset(ordersData)
 
 	en.builder.reset()
 	return ordersData
 }
 
+// Cursors keyset  หลัง FindOrder()
+func (en *findOrderEngineer) Cursors() *entities.CursorRes {
+	if en.cursors == nil {
+		return new(entities.CursorRes)
+	}
+	return en.cursors
+}
+
 // Count
 func (en *findOrderEngineer) CountOrder() int {
 	_, cancel := context.WithTimeout(context.Background(), time.Second*30)
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/PHURINTOR/phurinshop/modules/inventory"
+	"github.com/PHURINTOR/phurinshop/modules/inventory/inventoryPatterns"
 	"github.com/PHURINTOR/phurinshop/modules/orders"
+	"github.com/PHURINTOR/phurinshop/pkg/money"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -15,6 +18,7 @@ type IInsertOrderBuilder interface {
 	initTransaction() error
 	insertOrder() error
 	insertProductsOrder() error
+	reserveStock() error
 	getOrderId() string
 	commit() error
 }
@@ -57,6 +61,9 @@ func (en *insertOrderEngineer) InsertOrder() (string, error) {
 	if err := en.builder.insertProductsOrder(); err != nil {
 		return "", err
 	}
+	if err := en.builder.reserveStock(); err != nil {
+		return "", err
+	}
 	if err := en.builder.commit(); err != nil {
 		return "", err
 	}
@@ -77,8 +84,7 @@ func (b *insertOrderBuilder) initTransaction() error {
 
 // ---- getOrderID -----------
 func (b *insertOrderBuilder) getOrderId() string {
-
-	return ""
+	return b.req.Id
 }
 
 // ---- insert -----------
@@ -92,10 +98,11 @@ func (b *insertOrderBuilder) insertOrder() error {
 		"contact",
 		"address",
 		"transfer_slip",
-		"status"
+		"status",
+		"currency"
 	)
 	VALUES
-	($1, $2, $3, $4, $5)
+	($1, $2, $3, $4, $5, $6)
 		RETURNING "id";`
 
 	if err := b.tx.QueryRowxContext(
@@ -106,6 +113,7 @@ func (b *insertOrderBuilder) insertOrder() error {
 		b.req.Address,
 		b.req.TranferSlip,
 		b.req.Status,
+		money.NormalizeCurrency(b.req.Currency),
 	).Scan(&b.req.Id); err != nil {
 		b.tx.Rollback()
 		return fmt.Errorf("insert order failed: %v", err)
@@ -122,7 +130,9 @@ func (b *insertOrderBuilder) insertProductsOrder() error {
 	INSERT INTO "products_orders"(
 		"order_id",
 		"qty",
-		"product"
+		"product",
+		"variant_id",
+		"variant"
 	)
 	VALUES`
 
@@ -130,20 +140,26 @@ func (b *insertOrderBuilder) insertProductsOrder() error {
 	value := make([]any, 0)
 	lastIndex := 0
 	for i := range b.req.Products {
+		var variantId any // ไม่มี variant = NULL
+		if b.req.Products[i].VariantId != "" {
+			variantId = b.req.Products[i].VariantId
+		}
 		value = append(
 			value,
 			b.req.Id,
 			b.req.Products[i].Qty,
 			b.req.Products[i].Product,
+			variantId,
+			b.req.Products[i].Variant,
 		)
 		if i != len(b.req.Products)-1 {
 			query += fmt.Sprintf(`
-			($%d, $%d, $%d),`, lastIndex+1, lastIndex+2, lastIndex+3)
+			($%d, $%d, $%d, $%d, $%d),`, lastIndex+1, lastIndex+2, lastIndex+3, lastIndex+4, lastIndex+5)
 		} else {
 			query += fmt.Sprintf(`
-			($%d, $%d, $%d);`, lastIndex+1, lastIndex+2, lastIndex+3)
+			($%d, $%d, $%d, $%d, $%d);`, lastIndex+1, lastIndex+2, lastIndex+3, lastIndex+4, lastIndex+5)
 		}
-		lastIndex += 3
+		lastIndex += 5
 	}
 
 	// Excute
@@ -154,6 +170,28 @@ func (b *insertOrderBuilder) insertProductsOrder() error {
 	return nil
 }
 
+// ---- reserveStock -----------
+// จองของใน transaction เดียวกับ order  ของไม่พอ = rollback ทั้ง order (inventory.ErrOutOfStock)
+func (b *insertOrderBuilder) reserveStock() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	items := make([]*inventory.StockItem, 0, len(b.req.Products))
+	for _, p := range b.req.Products {
+		items = append(items, &inventory.StockItem{
+			ProductId: p.Product.Id,
+			VariantId: p.VariantId,
+			Qty:       p.Qty,
+		})
+	}
+
+	if err := inventoryPatterns.Reserve(ctx, b.tx, b.req.Id, items); err != nil {
+		b.tx.Rollback()
+		return fmt.Errorf("reserve stock failed: %w", err)
+	}
+	return nil
+}
+
 // ---- commit -----------
 func (b *insertOrderBuilder) commit() error {
 	if err := b.tx.Commit(); err != nil {
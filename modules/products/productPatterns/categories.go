@@ -0,0 +1,125 @@
+package productPatterns
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PHURINTOR/phurinshop/modules/appinfo"
+	"github.com/jmoiron/sqlx"
+)
+
+// ----------Flow  (product : category = M:N ผ่าน products_categories)
+//    insert : insertProduct ---> insertCategories
+//    update : categories nil = ไม่แก้,  ส่งมา = ลบของเดิมทั้งหมด ---> insert ใหม่
+//    filter : category ที่ส่งมา + ลูกหลานทุกชั้น (DescendantCategoriesQuery)
+//    category ในถังขยะ (deleted_at) ไม่แสดงใน product / filter  แต่ยังผูกกันอยู่ กู้คืนแล้วกลับมาเหมือนเดิม
+
+// CategoriesQuery category ทั้งหมดของ product + path (breadcrumb root ---> category)  (json array ของ appinfo.Category)
+func CategoriesQuery(productId string) string {
+	return fmt.Sprintf(`(
+				SELECT
+					COALESCE(array_to_json(array_agg("ct")), '[]'::json)
+				FROM (
+					SELECT
+						"c"."id",
+						"c"."title",
+						"c"."parent_id",
+						"c"."position",
+						(
+							WITH RECURSIVE "anc" AS (
+								SELECT
+									"ac"."id",
+									"ac"."title",
+									"ac"."parent_id",
+									0 AS "depth"
+								FROM "categories" "ac"
+								WHERE "ac"."id" = "c"."id"
+								UNION ALL
+								SELECT
+									"pac"."id",
+									"pac"."title",
+									"pac"."parent_id",
+									"anc"."depth" + 1
+								FROM "categories" "pac"
+									JOIN "anc" ON "anc"."parent_id" = "pac"."id"
+							)
+							SELECT
+								json_agg(json_build_object('id', "anc"."id", 'title', "anc"."title") ORDER BY "anc"."depth" DESC)
+							FROM "anc"
+						) AS "path"
+					FROM "categories" "c"
+						JOIN "products_categories" "pc" ON "pc"."category_id" = "c"."id"
+					WHERE "pc"."product_id" = %s
+						AND "c"."deleted_at" IS NULL
+					ORDER BY "c"."id"
+				) AS "ct"
+			)`, productId)
+}
+
+// DescendantCategoriesQuery id ของ category ที่ส่งมา (INT[]) + ลูกหลานทุกชั้น
+func DescendantCategoriesQuery(categoryIds string) string {
+	return fmt.Sprintf(`(
+				WITH RECURSIVE "tree" AS (
+					SELECT
+						"id"
+					FROM "categories"
+					WHERE "id" = ANY(%s)
+						AND "deleted_at" IS NULL
+					UNION
+					SELECT
+						"ch"."id"
+					FROM "categories" "ch"
+						JOIN "tree" ON "ch"."parent_id" = "tree"."id"
+					WHERE "ch"."deleted_at" IS NULL
+				)
+				SELECT
+					"id"
+				FROM "tree"
+			)`, categoryIds)
+}
+
+// ------------------------- Insert Categories --------
+// ไม่ใช่การสร้าง Category ใหม่แต่เป็นการระบุว่า product อยู่ใน category ใด
+func insertCategories(ctx context.Context, tx *sqlx.Tx, productId string, categories []*appinfo.Category) error {
+	ids := CategoryIds(categories)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+	INSERT INTO "products_categories"(
+		"product_id",
+		"category_id"
+	)
+	SELECT
+		$1,
+		UNNEST($2::INT[]);`,
+		productId,
+		ids,
+	); err != nil {
+		return fmt.Errorf("insert product categories failed: %v", err)
+	}
+	return nil
+}
+
+// ------------------------- Replace Categories (update) --------
+func replaceCategories(ctx context.Context, tx *sqlx.Tx, productId string, categories []*appinfo.Category) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM "products_categories" WHERE "product_id" = $1;`, productId); err != nil {
+		return fmt.Errorf("delete product categories failed: %v", err)
+	}
+	return insertCategories(ctx, tx, productId, categories)
+}
+
+// CategoryIds id ของ category ไม่ซ้ำ  เรียงตามที่ส่งมา
+func CategoryIds(categories []*appinfo.Category) []int {
+	ids := make([]int, 0, len(categories))
+	seen := make(map[int]bool)
+	for _, c := range categories {
+		if c == nil || seen[c.Id] {
+			continue
+		}
+		seen[c.Id] = true
+		ids = append(ids, c.Id)
+	}
+	return ids
+}
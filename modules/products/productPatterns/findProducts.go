@@ -5,11 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/PHURINTOR/phurinshop/modules/entities"
 	"github.com/PHURINTOR/phurinshop/modules/products"
+	"github.com/PHURINTOR/phurinshop/pkg/search"
 	"github.com/PHURINTOR/phurinshop/pkg/utils"
 	"github.com/jmoiron/sqlx"
 )
@@ -22,15 +25,21 @@ import (
 // ---------------- Builder Interface -------------
 type IFindProductBuilder interface {
 	openJsonQuery()
-	initQuery()  // ดึงข้อมูลปกติ
-	countQuery() // นับข้อมูลเฉยๆ
-	whereQuery() // คิวรีเงื่อนไข
-	sort()       // เรียง
+	initQuery()   // ดึงข้อมูลปกติ
+	countQuery()  // นับข้อมูลเฉยๆ
+	whereQuery()  // คิวรีเงื่อนไข
+	cursorQuery() // keyset ต่อจากตำแหน่งใน cursor
+	sort()        // เรียง
 	paginate()
 	closeJsonQuery()
+	categoryFacetQuery()         // นับ product ต่อ category (ไม่ใช้ filter category)
+	priceFacetQuery()            // นับ product ต่อช่วงราคา (ไม่ใช้ filter ราคา)
 	resetQuery()                 // รีค่าใน stuct ค้าง
 	Result() []*products.Product //ผลลัพธ์
 	Count() int
+	Cursors() *entities.CursorRes // keyset  หลัง Result()
+	CategoryFacets() []*products.CategoryFacet
+	PriceFacets() []*products.PriceFacet
 	PrintQuery()
 }
 
@@ -40,7 +49,10 @@ type findProductBuilder struct {
 	req            *products.ProductFilter
 	query          string //อาจมีการคิวรีที่ซับซ้อน  ทำให้ประกาศในนี้ไว้ประกอบ
 	lastStackIndex int
-	values         []any // อากิวเม้นหลายๆ ตัว กัน sql injection
+	values         []any  // อากิวเม้นหลายๆ ตัว กัน sql injection
+	searchIndex    int    // $ ของ tsquery  ใช้ซ้ำตอน sort rank  (0 = ไม่ได้ค้นหา)
+	except         string // filter ที่ไม่ใช้ตอนนับ facet ของตัวเอง  (category, price)
+	cursors        *entities.CursorRes
 }
 
 // ---------------- Builder Constructor -------------
@@ -70,26 +82,28 @@ func (b *findProductBuilder) closeJsonQuery() {
 
 // ------------- Sql Find Product
 func (b *findProductBuilder) initQuery() { // ดึงข้อมูลปกติ
-	b.query += `
+	b.query += fmt.Sprintf(`
 		SELECT
 			"p"."id",
 			"p"."title",
 			"p"."description",
 			"p"."price",
-			(
-				SELECT
-					to_jsonb("ct")
-				FROM (
-					SELECT
-						"c"."id",
-						"c"."title"
-					FROM "categories" "c"
-						LEFT JOIN "products_categories" "pc" ON "pc"."category_id" = "c"."id"
-					WHERE "pc"."product_id" = "p"."id"
-				) AS "ct"
-			) AS "category",
+			"p"."currency",
+			"p"."sale_price",
+			"p"."sale_start_at",
+			"p"."sale_end_at",
+			%s AS "effective_price",
+			"p"."stock",
+			"p"."reserved",
+			"p"."track_inventory",
+			%s AS "status",
+			"p"."publish_at",
+			"p"."unpublish_at",
+			%s AS "rank",
+			%s AS "categories",
 			"p"."created_at",
 			"p"."updated_at",
+			"p"."deleted_at",
 			(
 				SELECT
 					COALESCE(array_to_json(array_agg("it")), '[]'::json)
@@ -97,13 +111,36 @@ func (b *findProductBuilder) initQuery() { // ดึงข้อมูลปก
 					SELECT
 						"i"."id",
 						"i"."filename",
-						"i"."url"
+						"i"."url",
+						"i"."variants"
 					FROM "images" "i"
 					WHERE "i"."product_id" = "p"."id"
+						AND "i"."variant_id" IS NULL
 				) AS "it"
-			) AS "images"
+			) AS "images",
+			%s AS "variants"
 		FROM "products" "p"
-		WHERE 1 = 1`
+		WHERE 1 = 1`, EffectivePriceQuery(`"p"`), StatusQuery(`"p"`), b.rankQuery(), CategoriesQuery(`"p"."id"`), VariantsQuery(`"p"."id"`))
+}
+
+// ------- tsquery
+// $ ของ tsquery  append ครั้งเดียวต่อ query  (select rank ---> where ---> sort ใช้ตัวเดียวกัน)  0 = ไม่ได้ค้นหา
+func (b *findProductBuilder) searchParam() int {
+	if b.searchIndex == 0 {
+		if tsQuery := search.TsQuery(b.req.Search); tsQuery != "" {
+			b.values = append(b.values, tsQuery)
+			b.searchIndex = len(b.values)
+		}
+	}
+	return b.searchIndex
+}
+
+// ------- rank  ความเกี่ยวข้องกับคำค้น  ไม่ได้ค้นหา = NULL
+func (b *findProductBuilder) rankQuery() string {
+	if b.searchParam() == 0 {
+		return "NULL"
+	}
+	return fmt.Sprintf(`ts_rank("p"."search", to_tsquery('simple', $%d))`, b.searchIndex)
 }
 
 // ------- Count
@@ -119,76 +156,198 @@ func (b *findProductBuilder) countQuery() { // นับข้อมูลเฉ
 
 // ------- คิวรีเงื่อนไข
 func (b *findProductBuilder) whereQuery() {
-	// reset qeuey and value
-	var queryWhere string
-	queryWhereStack := make([]string, 0)
+	b.lastStackIndex = len(b.values)
+
+	// Trash Check  ถังขยะ = เฉพาะที่ถูกลบ,  ปกติ = ไม่เห็นที่ถูกลบ
+	if b.req.Trash {
+		b.query += `
+		AND "p"."deleted_at" IS NOT NULL`
+	} else {
+		b.query += `
+		AND "p"."deleted_at" IS NULL`
+	}
 
 	// ID Check
 	if b.req.Id != "" {
 		b.values = append(b.values, b.req.Id)
-		queryWhereStack = append(queryWhereStack, `
-		AND "p"."id" = ?`)
+		b.query += fmt.Sprintf(`
+		AND "p"."id" = $%d`, b.lastStackIndex+1)
+		b.lastStackIndex = len(b.values)
 	}
 
-	// Search Check
-	if b.req.Search != "" {
-		b.values = append(
-			b.values,
-			"%"+strings.ToLower(b.req.Search)+"%",
-			"%"+strings.ToLower(b.req.Search)+"%",
-		)
-		queryWhereStack = append(queryWhereStack, `
-		AND (LOWER("p"."title") LIKE ? OR LOWER("p"."description") LIKE ?)`) // รอ convert string ข้างล่าง
+	// Search Check  full-text (search tsvector)  ทุกคำต้องเจอ แบบ prefix  ภาษาไทยตัดคำก่อน
+	if b.searchParam() > 0 {
+		b.query += fmt.Sprintf(`
+		AND "p"."search" @@ to_tsquery('simple', $%d)`, b.searchIndex)
+		b.lastStackIndex = len(b.values)
 	}
 
-	// Concat string
-	for i := range queryWhereStack {
-		if i != len(queryWhereStack)-1 {
-			queryWhere += strings.Replace(queryWhereStack[i], "?", "$"+strconv.Itoa(i+1), 1) //convert to $1
-		} else {
-			queryWhere += strings.Replace(queryWhereStack[i], "?", "$"+strconv.Itoa(i+1), 1)
-			queryWhere = strings.Replace(queryWhere, "?", "$"+strconv.Itoa(i+2), 1)
-		}
+	// Status Check  สถานะ ณ ตอนนี้ (รวม scheduled)
+	if len(b.req.Statuses) > 0 {
+		b.values = append(b.values, b.req.Statuses)
+		b.query += fmt.Sprintf(`
+		AND %s = ANY($%d::TEXT[])`, StatusQuery(`"p"`), b.lastStackIndex+1)
+		b.lastStackIndex = len(b.values)
+	}
 
-		// Last Stack Record
+	// Category Check  อยู่ใน category ใดก็ได้ที่ส่งมา หรือลูกหลานของมัน
+	if len(b.req.CategoryIds) > 0 && b.except != "category" {
+		b.values = append(b.values, b.req.CategoryIds)
+		b.query += fmt.Sprintf(`
+		AND EXISTS (
+			SELECT 1
+			FROM "products_categories" "fpc"
+			WHERE "fpc"."product_id" = "p"."id"
+				AND "fpc"."category_id" IN %s
+		)`, DescendantCategoriesQuery(fmt.Sprintf("$%d::INT[]", b.lastStackIndex+1)))
 		b.lastStackIndex = len(b.values)
+	}
 
-		// Summary Qeury
-		b.query += queryWhere
+	// Price Check  ราคาที่ขายจริง (รวมราคาลด)
+	if b.except != "price" {
+		if b.req.MinPrice != nil {
+			b.values = append(b.values, *b.req.MinPrice)
+			b.query += fmt.Sprintf(`
+		AND %s >= $%d`, EffectivePriceQuery(`"p"`), b.lastStackIndex+1)
+			b.lastStackIndex = len(b.values)
+		}
+		if b.req.MaxPrice != nil {
+			b.values = append(b.values, *b.req.MaxPrice)
+			b.query += fmt.Sprintf(`
+		AND %s <= $%d`, EffectivePriceQuery(`"p"`), b.lastStackIndex+1)
+			b.lastStackIndex = len(b.values)
+		}
 	}
 
+	// Images Check  รูปของ product หรือของ variant ก็ได้
+	if b.req.HasImages != nil {
+		not := ""
+		if !*b.req.HasImages {
+			not = "NOT "
+		}
+		b.query += fmt.Sprintf(`
+		AND %sEXISTS (
+			SELECT 1
+			FROM "images" "fi"
+			WHERE "fi"."product_id" = "p"."id"
+		)`, not)
+	}
+
+	// Date Check  YYYY-MM-DD  (end_date รวมทั้งวัน)
+	if b.req.StartDate != "" {
+		b.values = append(b.values, b.req.StartDate)
+		b.query += fmt.Sprintf(`
+		AND "p"."created_at" >= DATE($%d)`, b.lastStackIndex+1)
+		b.lastStackIndex = len(b.values)
+	}
+	if b.req.EndDate != "" {
+		b.values = append(b.values, b.req.EndDate)
+		b.query += fmt.Sprintf(`
+		AND "p"."created_at" < ($%d)::DATE + 1`, b.lastStackIndex+1)
+		b.lastStackIndex = len(b.values)
+	}
+
+	// Attribute Check  variant เดียวกันต้องตรงทุก key  (key เดียวกันหลายค่า = ค่าใดก็ได้)
+	if len(b.req.Attributes) > 0 {
+		keys := make([]string, 0, len(b.req.Attributes))
+		for key := range b.req.Attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys) // ลำดับ $ คงที่
+
+		conditions := ""
+		for _, key := range keys {
+			b.values = append(b.values, key, b.req.Attributes[key])
+			conditions += fmt.Sprintf(`
+				AND "fv"."options" ->> $%d = ANY($%d::TEXT[])`, b.lastStackIndex+1, b.lastStackIndex+2)
+			b.lastStackIndex = len(b.values)
+		}
+		b.query += fmt.Sprintf(`
+		AND EXISTS (
+			SELECT 1
+			FROM "product_variants" "fv"
+			WHERE "fv"."product_id" = "p"."id"%s
+		)`, conditions)
+	}
 }
 
-// -------เรียง
-func (b *findProductBuilder) sort() {
-	orderByMap := map[string]string{
-		"id":    "\"p\".\"id\"",
-		"title": "\"p\".\"title\"",
-		"price": "\"p\".\"price\"",
+// ------- คอลัมน์ที่เรียงได้
+// order_by เลือกจาก map เท่านั้น  rank = ความเกี่ยวข้องกับคำค้น (ไม่มีคำค้น = title)   key, sql, type ของค่าใน cursor
+// price = ราคาที่ขายจริงตอน query (ไม่มี index)  cursor ไม่คงที่ข้ามช่วงลดราคา: sale เริ่ม / จบระหว่างเลื่อนหน้า สินค้าอาจหลุดหรือซ้ำ
+func (b *findProductBuilder) orderByColumn() (string, string, string) {
+	columns := map[string][2]string{
+		"id":    {`"p"."id"`, "VARCHAR"},
+		"title": {`"p"."title"`, "VARCHAR"},
+		"price": {EffectivePriceQuery(`"p"`), "NUMERIC"},
+	}
+	if b.searchIndex > 0 {
+		columns["rank"] = [2]string{b.rankQuery(), "REAL"}
 	}
 	// ถ้า ไม่ได้ใส่ type sort มาก็จะเป็นค่าเริ่มต้น
-	if orderByMap[b.req.OrderBy] == "" {
-		b.req.OrderBy = orderByMap["title"]
-	} else {
-		b.req.OrderBy = orderByMap[b.req.OrderBy]
+	key := b.req.OrderBy
+	if _, ok := columns[key]; !ok {
+		key = "title"
 	}
+	return key, columns[key][0], columns[key][1]
+}
 
-	//มากไปน้อย น้อยไปมาก
+// ------- มากไปน้อย น้อยไปมาก
+func (b *findProductBuilder) direction() string {
 	sortMap := map[string]string{
 		"DESC": "DESC",
 		"ASC":  "ASC",
 	}
-	if sortMap[b.req.Sort] == "" {
-		b.req.Sort = sortMap["ASC"]
-	} else {
-		b.req.Sort = sortMap[strings.ToUpper(b.req.OrderBy)]
+	direction := sortMap[strings.ToUpper(b.req.Sort)]
+	if direction == "" {
+		direction = sortMap["ASC"]
+	}
+	return direction
+}
+
+// ------- keyset  (key, id) ต่อจากแถวใน cursor  prev = ย้อนทิศ
+func (b *findProductBuilder) cursorQuery() {
+	if b.req.Keyset == nil || b.req.Keyset.First() {
+		return
 	}
-	b.values = append(b.values, b.req.OrderBy)
+	_, orderBy, cast := b.orderByColumn()
+
+	operator := ">"
+	if b.direction() == "DESC" {
+		operator = "<"
+	}
+	if b.req.Keyset.Prev {
+		operator = map[string]string{">": "<", "<": ">"}[operator]
+	}
+
+	b.values = append(b.values, b.req.Keyset.Value, b.req.Keyset.Id)
 	b.query += fmt.Sprintf(`
-		ORDER BY $%d %s`, b.lastStackIndex+1, b.req.Sort)
+		AND (%s, "p"."id") %s ($%d::%s, $%d)`, orderBy, operator, b.lastStackIndex+1, cast, b.lastStackIndex+2)
 	b.lastStackIndex = len(b.values)
 }
+
+// -------เรียง
+// id เรียงทิศเดียวกับ key  (ให้ keyset เทียบเป็น row ได้)
+func (b *findProductBuilder) sort() {
+	_, orderBy, _ := b.orderByColumn()
+
+	direction := b.direction()
+	if b.req.Keyset != nil && b.req.Keyset.Prev {
+		direction = map[string]string{"ASC": "DESC", "DESC": "ASC"}[direction]
+	}
+
+	b.query += fmt.Sprintf(`
+		ORDER BY %s %s, "p"."id" %s`, orderBy, direction, direction)
+}
+
 func (b *findProductBuilder) paginate() {
+	// keyset  ดึงเกิน 1 แถว เอาไว้ดูว่ามีหน้าถัดไปไหม
+	if b.req.Keyset != nil {
+		b.values = append(b.values, b.req.Limit+1)
+		b.query += fmt.Sprintf(`	LIMIT $%d`, b.lastStackIndex+1)
+		b.lastStackIndex = len(b.values)
+		return
+	}
+
 	// offset (page -1)*limit
 
 	b.values = append(b.values, (b.req.Page-1)*b.req.Limit, b.req.Limit)
@@ -198,11 +357,96 @@ func (b *findProductBuilder) paginate() {
 
 }
 
+// ------- Facet: Category
+// category ที่มี product ตรง filter (ยกเว้น category)  นับรวมลูกหลาน เหมือนตอน filter
+func (b *findProductBuilder) categoryFacetQuery() {
+	b.except = "category"
+	b.query += `
+	WITH RECURSIVE "ct" AS (
+		SELECT
+			"id" AS "root",
+			"id"
+		FROM "categories"
+		WHERE "deleted_at" IS NULL
+		UNION ALL
+		SELECT
+			"ct"."root",
+			"ch"."id"
+		FROM "categories" "ch"
+			JOIN "ct" ON "ch"."parent_id" = "ct"."id"
+		WHERE "ch"."deleted_at" IS NULL
+	)
+	SELECT
+		"c"."id",
+		"c"."title",
+		"c"."parent_id",
+		COUNT(DISTINCT "fp"."id") AS "count"
+	FROM "categories" "c"
+		JOIN "ct" ON "ct"."root" = "c"."id"
+		JOIN "products_categories" "pc" ON "pc"."category_id" = "ct"."id"
+		JOIN (
+			SELECT
+				"p"."id"
+			FROM "products" "p"
+			WHERE 1 = 1`
+	b.whereQuery()
+	b.query += `
+		) AS "fp" ON "fp"."id" = "pc"."product_id"
+	GROUP BY "c"."id"
+	ORDER BY "c"."parent_id" NULLS FIRST, "c"."position", "c"."id";`
+}
+
+// ------- Facet: Price
+// ช่วงราคาตาม PriceEdges  [edge, edge ถัดไป)  ช่วงสุดท้ายไม่มีเพดาน  ช่วงที่ไม่มี product = 0
+func (b *findProductBuilder) priceFacetQuery() {
+	b.except = "price"
+
+	edges := b.req.PriceEdges
+	if len(edges) == 0 {
+		edges = products.DefaultPriceEdges
+	}
+	// ส่งเป็นข้อความ  cast เป็น NUMERIC ใน sql (ไม่ผ่าน float)
+	mins := make([]string, 0, len(edges))
+	maxs := make([]*string, 0, len(edges))
+	for i := range edges {
+		mins = append(mins, edges[i].String())
+		if i+1 < len(edges) {
+			upper := edges[i+1].String()
+			maxs = append(maxs, &upper)
+		} else {
+			maxs = append(maxs, nil)
+		}
+	}
+	b.values = append(b.values, mins, maxs)
+
+	// ราคาที่ขายจริง (รวมราคาลด)
+	b.query += fmt.Sprintf(`
+	SELECT
+		"b"."min",
+		"b"."max",
+		COUNT("fp"."id") AS "count"
+	FROM UNNEST($1::NUMERIC[], $2::NUMERIC[]) AS "b"("min", "max")
+		LEFT JOIN (
+			SELECT
+				"p"."id",
+				%s AS "price"
+			FROM "products" "p"
+			WHERE 1 = 1`, EffectivePriceQuery(`"p"`))
+	b.whereQuery()
+	b.query += `
+		) AS "fp" ON "fp"."price" >= "b"."min"
+			AND ("b"."max" IS NULL OR "fp"."price" < "b"."max")
+	GROUP BY "b"."min", "b"."max"
+	ORDER BY "b"."min";`
+}
+
 // ------- ResetQuery
 // รีค่าใน stuct ค้าง
 func (b *findProductBuilder) resetQuery() {
 	b.query = ""
 	b.values = make([]any, 0)
+	b.except = ""
+	b.searchIndex = 0
 }
 
 // ------- Result-----------------------------
@@ -224,10 +468,75 @@ func (b *findProductBuilder) Result() []*products.Product {
 		log.Printf("unmarshal products failed: %v", err)
 		return make([]*products.Product, 0)
 	}
+	if b.req.Keyset != nil {
+		productsData = b.keyset(productsData)
+	}
 	b.resetQuery()
 	return productsData
 }
 
+// ------- keyset  ตัดแถวเกิน ---> prev กลับลำดับ ---> cursor หน้าถัดไป / ก่อนหน้า
+func (b *findProductBuilder) keyset(productsData []*products.Product) []*products.Product {
+	hasMore := len(productsData) > b.req.Limit
+	if hasMore {
+		productsData = productsData[:b.req.Limit]
+	}
+	if b.req.Keyset.Prev {
+		for i, j := 0, len(productsData)-1; i < j; i, j = i+1, j-1 {
+			productsData[i], productsData[j] = productsData[j], productsData[i]
+		}
+	}
+
+	b.cursors = new(entities.CursorRes)
+	if len(productsData) == 0 {
+		return productsData
+	}
+	key, _, _ := b.orderByColumn()
+	cursor := func(p *products.Product, prev bool) string {
+		return (&entities.Cursor{
+			OrderBy: key,
+			Sort:    b.direction(),
+			Value:   productSortValue(p, key),
+			Id:      p.Id,
+			Prev:    prev,
+		}).Encode()
+	}
+
+	// ไปต่อได้ = มีแถวเกินในทิศที่ดึง  หรือ มาจากอีกฝั่ง
+	if (!b.req.Keyset.Prev && hasMore) || (b.req.Keyset.Prev && !b.req.Keyset.First()) {
+		b.cursors.Next = cursor(productsData[len(productsData)-1], false)
+	}
+	if (b.req.Keyset.Prev && hasMore) || (!b.req.Keyset.Prev && !b.req.Keyset.First()) {
+		b.cursors.Prev = cursor(productsData[0], true)
+	}
+	return productsData
+}
+
+// productSortValue ค่าของ key ที่ใช้เรียง (text)  cast กลับใน cursorQuery
+func productSortValue(p *products.Product, key string) string {
+	switch key {
+	case "id":
+		return p.Id
+	case "price":
+		return p.EffectivePrice.String() // orderByColumn เรียง price ด้วย EffectivePriceQuery
+	case "rank":
+		if p.Rank == nil {
+			return "0"
+		}
+		return strconv.FormatFloat(*p.Rank, 'g', -1, 32) // ts_rank = REAL
+	default:
+		return p.Title
+	}
+}
+
+// ------- Cursors Result-----------------------------
+func (b *findProductBuilder) Cursors() *entities.CursorRes {
+	if b.cursors == nil {
+		return new(entities.CursorRes)
+	}
+	return b.cursors
+}
+
 // ------- Count Result-----------------------------
 func (b *findProductBuilder) Count() int {
 	_, cancel := context.WithTimeout(context.Background(), time.Second*15)
@@ -242,6 +551,34 @@ func (b *findProductBuilder) Count() int {
 	b.resetQuery()
 	return count
 }
+
+// ------- Facets Result-----------------------------
+func (b *findProductBuilder) CategoryFacets() []*products.CategoryFacet {
+	_, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	facets := make([]*products.CategoryFacet, 0)
+	if err := b.db.Select(&facets, b.query, b.values...); err != nil {
+		log.Printf("find category facets failed: %v\n", err)
+		facets = make([]*products.CategoryFacet, 0)
+	}
+	b.resetQuery()
+	return facets
+}
+
+func (b *findProductBuilder) PriceFacets() []*products.PriceFacet {
+	_, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	facets := make([]*products.PriceFacet, 0)
+	if err := b.db.Select(&facets, b.query, b.values...); err != nil {
+		log.Printf("find price facets failed: %v\n", err)
+		facets = make([]*products.PriceFacet, 0)
+	}
+	b.resetQuery()
+	return facets
+}
+
 func (b *findProductBuilder) PrintQuery() {
 	utils.Debug(b.values)
 	fmt.Println(b.query)
@@ -264,6 +601,7 @@ func (en *findProductEngineer) FindProduct() IFindProductBuilder {
 	en.builder.openJsonQuery()
 	en.builder.initQuery()
 	en.builder.whereQuery()
+	en.builder.cursorQuery()
 	en.builder.sort()
 	en.builder.paginate()
 	en.builder.closeJsonQuery()
@@ -275,3 +613,13 @@ func (en *findProductEngineer) CountProduct() IFindProductBuilder {
 	en.builder.whereQuery()
 	return en.builder
 }
+
+func (en *findProductEngineer) FindCategoryFacets() IFindProductBuilder {
+	en.builder.categoryFacetQuery()
+	return en.builder
+}
+
+func (en *findProductEngineer) FindPriceFacets() IFindProductBuilder {
+	en.builder.priceFacetQuery()
+	return en.builder
+}
@@ -0,0 +1,268 @@
+package productPatterns
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/PHURINTOR/phurinshop/modules/entities"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesUsecases"
+	"github.com/PHURINTOR/phurinshop/modules/inventory"
+	"github.com/PHURINTOR/phurinshop/modules/inventory/inventoryPatterns"
+	"github.com/PHURINTOR/phurinshop/modules/products"
+	"github.com/jmoiron/sqlx"
+)
+
+// ----------Flow  (import ไฟล์ CSV / XLSX)
+//    handler ตรวจทีละแถว (แถวที่ผิดไม่ส่งมา) ---> แบ่ง batch ละ ImportBatchSize แถว  1 batch = 1 transaction
+//    1 แถว = 1 savepoint  แถวที่ error ย้อนเฉพาะแถวนั้น  แถวอื่นใน batch ยังบันทึก
+//    id ว่าง = insert (stock เริ่มต้น),  มี id = update + เก็บ revision  (ช่อง stock = ตั้ง stock ผ่าน ledger เป็น adjust ส่วนต่าง)
+//    dry run = ทำทุกขั้นแล้ว rollback ทุก batch  (เห็น error จาก database ด้วย เช่น category ไม่มี)
+
+const ImportBatchSize = 100
+
+// ImportProducts upsert ทุกแถว  error รายแถวอยู่ใน result (ไม่หยุดทั้งไฟล์)
+func ImportProducts(db *sqlx.DB, filesUsecase filesUsecases.IFilesUsecase, req *products.ImportReq) *products.ImportResult {
+	result := &products.ImportResult{
+		DryRun: req.DryRun,
+		Errors: make([]*products.ImportError, 0),
+	}
+
+	for start := 0; start < len(req.Rows); start += ImportBatchSize {
+		end := min(start+ImportBatchSize, len(req.Rows))
+		importBatch(db, filesUsecase, req, req.Rows[start:end], result)
+	}
+	return result
+}
+
+// importBatch 1 transaction  commit ไม่ผ่าน = ทุกแถวใน batch error
+func importBatch(db *sqlx.DB, filesUsecase filesUsecases.IFilesUsecase, req *products.ImportReq, rows []*products.ImportRow, result *products.ImportResult) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
+
+	failAll := func(done []*products.ImportRow, err error) {
+		for _, row := range done {
+			result.Errors = append(result.Errors, &products.ImportError{
+				Row:   row.Row,
+				Id:    row.Product.Id,
+				Error: err.Error(),
+			})
+		}
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		failAll(rows, err)
+		return
+	}
+
+	done := make([]*products.ImportRow, 0, len(rows))
+	inserted := make(map[*products.ImportRow]bool)
+	for i, row := range rows {
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT "import_row";`); err != nil {
+			tx.Rollback()
+			failAll(append(done, rows[i:]...), fmt.Errorf("import batch failed: %v", err))
+			return
+		}
+
+		insert := row.Product.Id == ""
+		if err := importRow(ctx, tx, filesUsecase, row, req.UserId); err != nil {
+			if _, rbErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT "import_row";`); rbErr != nil {
+				tx.Rollback()
+				failAll(append(done, rows[i:]...), fmt.Errorf("import batch failed: %v", rbErr))
+				return
+			}
+			if insert {
+				row.Product.Id = ""
+			}
+			result.Errors = append(result.Errors, &products.ImportError{
+				Row:   row.Row,
+				Id:    row.Product.Id,
+				Error: err.Error(),
+			})
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT "import_row";`); err != nil {
+			tx.Rollback()
+			failAll(append(done, rows[i:]...), fmt.Errorf("import batch failed: %v", err))
+			return
+		}
+		done = append(done, row)
+		inserted[row] = insert
+	}
+
+	// dry run  ไม่บันทึก  id ของแถวที่ insert ไม่มีจริง
+	if req.DryRun {
+		tx.Rollback()
+		for _, row := range done {
+			if inserted[row] {
+				row.Product.Id = ""
+			}
+		}
+	} else if err := tx.Commit(); err != nil {
+		failAll(done, fmt.Errorf("import batch failed: %v", err))
+		return
+	}
+
+	for _, row := range done {
+		if inserted[row] {
+			result.Inserted++
+		} else {
+			result.Updated++
+		}
+	}
+}
+
+// importRow insert / update 1 product ใน tx  (ไม่ rollback เอง  importBatch ย้อน savepoint ให้)
+func importRow(ctx context.Context, tx *sqlx.Tx, filesUsecase filesUsecases.IFilesUsecase, row *products.ImportRow, userId string) error {
+	p := row.Product
+	if p.Id == "" {
+		if err := insertProductRow(ctx, tx, p); err != nil {
+			return err
+		}
+		if err := insertCategories(ctx, tx, p.Id, p.Categories); err != nil {
+			return err
+		}
+		if err := filesUsecase.AcquireFiles(tx, imageKeys(p.Images)); err != nil {
+			return err
+		}
+		return insertImages(ctx, tx, p.Id, p.Images)
+	}
+
+	before, err := SnapshotProduct(ctx, tx, p.Id)
+	if err != nil {
+		return err
+	}
+	if err := updateProductFields(ctx, tx, p.Id, importFields(p)); err != nil {
+		return fmt.Errorf("update product failed: %v", err)
+	}
+	if p.Categories != nil {
+		if err := replaceCategories(ctx, tx, p.Id, p.Categories); err != nil {
+			return err
+		}
+	}
+	if p.Images != nil {
+		if err := replaceImages(ctx, tx, filesUsecase, p.Id, p.Images); err != nil {
+			return err
+		}
+	}
+
+	if row.Stock != nil {
+		if err := importStock(ctx, tx, p.Id, *row.Stock, userId); err != nil {
+			return err
+		}
+	}
+
+	after, err := SnapshotProduct(ctx, tx, p.Id)
+	if err != nil {
+		return err
+	}
+	return InsertRevision(ctx, tx, &products.Revision{
+		ProductId: p.Id,
+		UserId:    userId,
+		Action:    products.RevisionImport,
+		Before:    before,
+		After:     after,
+	})
+}
+
+// importStock ตั้ง stock ของ product = stock  ลง ledger เป็น adjust ส่วนต่าง (เท่าเดิม = ไม่ทำอะไร  ไฟล์ที่ export แล้ว import กลับไม่เกิด movement)
+// ต่ำกว่าที่จองไว้ = error ของแถวนี้ (inventory.ErrStockReserved)
+func importStock(ctx context.Context, tx *sqlx.Tx, productId string, stock int, userId string) error {
+	var current int
+	if err := tx.GetContext(ctx, &current, `
+	SELECT
+		"stock"
+	FROM "products"
+	WHERE "id" = $1
+	FOR UPDATE;`, productId); err != nil {
+		return fmt.Errorf("get stock failed: %v", err)
+	}
+	if stock == current {
+		return nil
+	}
+	if _, err := inventoryPatterns.Adjust(ctx, tx, &inventory.AdjustReq{
+		ProductId: productId,
+		Qty:       stock - current,
+		Note:      "import",
+		UserId:    userId,
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// importFields field ที่แถวนี้แก้  ("" / 0 / nil = ไม่แก้ เหมือน PATCH /products/:product_id)
+func importFields(p *products.Product) products.RevisionValues {
+	values := make(products.RevisionValues)
+	if p.Title != "" {
+		values["title"] = p.Title
+	}
+	if p.Description != "" {
+		values["description"] = p.Description
+	}
+	if p.Price > 0 {
+		values["price"] = p.Price
+	}
+	if p.Currency != "" {
+		values["currency"] = p.Currency
+	}
+	if p.SalePrice != nil {
+		values["sale_price"] = *p.SalePrice
+	}
+	if p.SaleStartAt != nil {
+		values["sale_start_at"] = *p.SaleStartAt
+	}
+	if p.SaleEndAt != nil {
+		values["sale_end_at"] = *p.SaleEndAt
+	}
+	if p.Status != "" {
+		values["status"] = p.Status
+	}
+	if p.PublishAt != nil {
+		values["publish_at"] = *p.PublishAt
+	}
+	if p.UnpublishAt != nil {
+		values["unpublish_at"] = *p.UnpublishAt
+	}
+	return values
+}
+
+// replaceImages แทนรูปเดิมของ product ทั้งหมด  รูปเดิมใน bucket ถูกลบหลัง commit (outbox)
+func replaceImages(ctx context.Context, tx *sqlx.Tx, filesUsecase filesUsecases.IFilesUsecase, productId string, images []*entities.Images) error {
+	// acquire รูปใหม่ก่อนคืนรูปเดิม  url เดิมที่ import กลับมาไม่ลด ref_count ถึง 0 ระหว่างทาง
+	if err := filesUsecase.AcquireFiles(tx, imageKeys(images)); err != nil {
+		return err
+	}
+
+	old := make([]*entities.Images, 0)
+	if err := tx.SelectContext(ctx, &old, `
+	SELECT
+		"id",
+		"filename",
+		"url",
+		"variants"
+	FROM "images"
+	WHERE "product_id" = $1
+		AND "variant_id" IS NULL;`, productId); err != nil {
+		return fmt.Errorf("get images failed: %v", err)
+	}
+	if err := filesUsecase.DeleteFileLater(tx, DeleteImagesReq(old)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM "images" WHERE "product_id" = $1 AND "variant_id" IS NULL;`, productId); err != nil {
+		return fmt.Errorf("delete images failed: %v", err)
+	}
+	return insertImages(ctx, tx, productId, images)
+}
+
+// imageKeys key ของรูปที่อยู่ใน bucket ของเรา (filename != "")  รูปภายนอกไม่นับ ref_count
+func imageKeys(images []*entities.Images) []string {
+	keys := make([]string, 0, len(images))
+	for _, img := range images {
+		if img.FileName != "" {
+			keys = append(keys, fmt.Sprintf("images/products/%s", img.FileName))
+		}
+	}
+	return keys
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/PHURINTOR/phurinshop/modules/entities"
 	"github.com/PHURINTOR/phurinshop/modules/products"
+	"github.com/PHURINTOR/phurinshop/pkg/money"
+	"github.com/PHURINTOR/phurinshop/pkg/search"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -16,8 +19,9 @@ type IInsertProductsBuilder interface {
 	// Input
 	initTransaction() error
 	insertProduct() error
-	insertCategory() error
+	insertCategories() error
 	insertAttachment() error
+	insertVariants() error
 	commit() error
 
 	// Output
@@ -55,50 +59,64 @@ func (b *insertProductsBuilder) insertProduct() error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 
+	if err := insertProductRow(ctx, b.tx, b.req); err != nil {
+		b.tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// insertProductRow เพิ่ม product 1 ตัว + stock เริ่มต้น  (id ที่ได้เก็บใน req.Id)
+func insertProductRow(ctx context.Context, tx *sqlx.Tx, req *products.Product) error {
 	query := `
 	INSERT INTO "products" (
 		"title",
 		"description",
-		"price"
+		"price",
+		"currency",
+		"title_tokens",
+		"description_tokens",
+		"status",
+		"publish_at",
+		"unpublish_at",
+		"sale_price",
+		"sale_start_at",
+		"sale_end_at"
 	)
-	VALUES ($1, $2, $3)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::TIMESTAMPTZ, NULLIF($9, '')::TIMESTAMPTZ, $10, NULLIF($11, '')::TIMESTAMPTZ, NULLIF($12, '')::TIMESTAMPTZ)
 		RETURNING "id";`
 
-	if err := b.tx.QueryRowContext( //QueryRowContext สามารถ scan ต่อได้เลย,  QueryRow ต้องไป for Row . Next และไม่ต้อง close.db ด้วย
+	if err := tx.QueryRowContext( //QueryRowContext สามารถ scan ต่อได้เลย,  QueryRow ต้องไป for Row . Next และไม่ต้อง close.db ด้วย
 		ctx, //QueryRowxContext สามารถ scan แบบ struct ได้
 		query,
-		b.req.Title,
-		b.req.Description,
-		b.req.Price,
-	).Scan(&b.req.Id); err != nil {
-		b.tx.Rollback()
+		req.Title,
+		req.Description,
+		req.Price,
+		money.NormalizeCurrency(req.Currency),
+		search.ThaiTokens(req.Title), // คำไทยที่ตัดแล้ว  trigger เอาไปทำ search (tsvector)
+		search.ThaiTokens(req.Description),
+		req.Status,
+		timeValue(req.PublishAt),
+		timeValue(req.UnpublishAt),
+		req.SalePrice,
+		timeValue(req.SaleStartAt),
+		timeValue(req.SaleEndAt),
+	).Scan(&req.Id); err != nil {
 		return fmt.Errorf("insert product failed: %v", err)
 	}
-	return nil
+
+	return initialStock(ctx, tx, req.Id, "", req.Stock)
 }
 
-// ------------ Insert Category  ------
-// ไม่ใช่การสร้าง Category ใหม่แต่เป็นการระบุว่า product อยู่ใน category ใด
-func (b *insertProductsBuilder) insertCategory() error {
+// ------------ Insert Categories  ------
+// ไม่ใช่การสร้าง Category ใหม่แต่เป็นการระบุว่า product อยู่ใน category ใด (ได้หลาย category)
+func (b *insertProductsBuilder) insertCategories() error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 
-	query := `
-	INSERT INTO "products_categories"(
-		"product_id",
-		"category_id"
-	)
-	VALUES($1, $2);`
-
-	//ไม่ต้องการรีเทรนใช้ execContext ได้เลย
-	if _, err := b.tx.ExecContext(
-		ctx,
-		query,
-		b.req.Id,
-		b.req.Category.Id,
-	); err != nil {
+	if err := insertCategories(ctx, b.tx, b.req.Id, b.req.Categories); err != nil {
 		b.tx.Rollback()
-		return fmt.Errorf("insert product category Failed: %v", err)
+		return err
 	}
 	return nil
 }
@@ -107,47 +125,77 @@ func (b *insertProductsBuilder) insertCategory() error {
 //
 //	call --> Upload api = linkPic ---> insertAttachment
 func (b *insertProductsBuilder) insertAttachment() error {
+	if len(b.req.Images) == 0 { // product ที่มีแต่รูปของ variant
+		return nil
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 
+	if err := insertImages(ctx, b.tx, b.req.Id, b.req.Images); err != nil {
+		b.tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// insertImages รูปของ product (ไม่ใช่รูปของ variant)
+func insertImages(ctx context.Context, tx *sqlx.Tx, productId string, images []*entities.Images) error {
+	if len(images) == 0 {
+		return nil
+	}
+
 	query := `
 	INSERT INTO "images" (
 		"filename",
 		"url",
+		"variants",
 		"product_id"
 	)
 	VALUES`
 
 	valueStack := make([]any, 0)
 	var index int
-	for i := range b.req.Images {
+	for i := range images {
 		valueStack = append(valueStack,
-			b.req.Images[i].FileName,
-			b.req.Images[i].Url,
-			b.req.Id,
+			images[i].FileName,
+			images[i].Url,
+			images[i].Variants,
+			productId,
 		)
 
-		if i != len(b.req.Images)-1 {
+		if i != len(images)-1 {
 			query += fmt.Sprintf(`
-			($%d, $%d, $%d),`, index+1, index+2, index+3)
+			($%d, $%d, $%d, $%d),`, index+1, index+2, index+3, index+4)
 		} else {
 			query += fmt.Sprintf(`
-			($%d, $%d, $%d);`, index+1, index+2, index+3)
+			($%d, $%d, $%d, $%d);`, index+1, index+2, index+3, index+4)
 		}
-		index += 3
+		index += 4
 	}
 
-	if _, err := b.tx.ExecContext(
+	if _, err := tx.ExecContext(
 		ctx,
 		query,
 		valueStack...,
 	); err != nil {
-		b.tx.Rollback()
 		return fmt.Errorf("insert images failed: %v", err)
 	}
 	return nil
 }
 
+// ------------------------- Insert Variants --------
+func (b *insertProductsBuilder) insertVariants() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	if err := insertVariants(ctx, b.tx, b.req.Id, b.req.Variants); err != nil {
+		b.tx.Rollback()
+		return err
+	}
+	return nil
+}
+
 // Commit TX of DB
 func (b *insertProductsBuilder) commit() error {
 	if err := b.tx.Commit(); err != nil {
@@ -180,14 +228,18 @@ func (en *insertProductsEngineer) InsertProduct() (string, error) {
 	if err := en.builder.insertProduct(); err != nil {
 		return "", err
 	}
-	// Insert Category
-	if err := en.builder.insertCategory(); err != nil {
+	// Insert Categories
+	if err := en.builder.insertCategories(); err != nil {
 		return "", err
 	}
 	// Insert Attachment
 	if err := en.builder.insertAttachment(); err != nil {
 		return "", err
 	}
+	// Insert Variants
+	if err := en.builder.insertVariants(); err != nil {
+		return "", err
+	}
 	// Commit
 	if err := en.builder.commit(); err != nil {
 		return "", err
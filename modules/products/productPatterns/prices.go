@@ -0,0 +1,126 @@
+package productPatterns
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PHURINTOR/phurinshop/modules/products"
+	"github.com/PHURINTOR/phurinshop/pkg/money"
+	"github.com/jmoiron/sqlx"
+)
+
+// ----------Flow  (ราคา)
+//    sale      : sale_price + ช่วง sale_start_at, sale_end_at ---> effective_price คำนวณตอน query (หมดช่วง = กลับเป็น price เอง ไม่ต้องมี job)
+//    schedule  : product_price_schedules ถึง apply_at ---> job ตั้ง price ใหม่ ---> applied_at + product_revisions (action schedule)
+//                price ใหม่ <= sale_price ---> ล้าง sale ไปพร้อมกัน (ราคาปกติต้องสูงกว่าราคาลดเสมอ  products_sale_price_check)
+//    order     : คิดเงินจาก effective_price (variant ที่ตั้งราคาเองใช้ราคา variant)
+
+// EffectivePriceQuery ราคาที่ขายจริง ณ ตอนนี้ (alias ของตาราง products)
+func EffectivePriceQuery(alias string) string {
+	return fmt.Sprintf(`(
+				CASE
+					WHEN %[1]s."sale_price" IS NOT NULL
+						AND (%[1]s."sale_start_at" IS NULL OR %[1]s."sale_start_at" <= now())
+						AND (%[1]s."sale_end_at" IS NULL OR %[1]s."sale_end_at" > now())
+					THEN %[1]s."sale_price"
+					ELSE %[1]s."price"
+				END
+			)`, alias)
+}
+
+// DuePriceSchedules schedule ที่ถึงเวลาแล้ว เรียงตาม apply_at  lock จนจบ transaction (SKIP LOCKED = job 2 ตัวไม่ทับกัน)
+// product ในถังขยะข้ามไปก่อน  กู้คืนแล้วค่อยตั้งราคา
+func DuePriceSchedules(ctx context.Context, tx *sqlx.Tx, limit int) ([]*products.PriceSchedule, error) {
+	schedules := make([]*products.PriceSchedule, 0)
+	if err := tx.SelectContext(ctx, &schedules, `
+	SELECT
+		"s"."id",
+		"s"."product_id",
+		"s"."price",
+		"s"."apply_at",
+		"s"."applied_at",
+		"s"."user_id",
+		"s"."created_at"
+	FROM "product_price_schedules" "s"
+		JOIN "products" "p" ON "p"."id" = "s"."product_id"
+	WHERE "s"."applied_at" IS NULL
+		AND "s"."apply_at" <= now()
+		AND "p"."deleted_at" IS NULL
+	ORDER BY "s"."apply_at", "s"."id"
+	LIMIT $1
+	FOR UPDATE OF "s" SKIP LOCKED;`, limit); err != nil {
+		return nil, fmt.Errorf("get due price schedules failed: %v", err)
+	}
+	return schedules, nil
+}
+
+// ApplyPriceSchedule ตั้ง price ตาม schedule + เก็บ revision  (คนตั้ง schedule = คนแก้)
+// sale ถูกตั้งทีหลัง schedule จน sale_price >= price ใหม่ = ล้าง sale  (ตรวจซ้ำใน transaction  row ถูก lock ตั้งแต่ snapshot)
+func ApplyPriceSchedule(ctx context.Context, tx *sqlx.Tx, schedule *products.PriceSchedule) error {
+	before, err := SnapshotProduct(ctx, tx, schedule.ProductId)
+	if err != nil {
+		return err
+	}
+	values := products.RevisionValues{"price": schedule.Price}
+	if sale := before["sale_price"]; sale != nil {
+		salePrice, err := money.Parse(fmt.Sprint(sale))
+		if err != nil {
+			return fmt.Errorf("apply price schedule %d failed: %v", schedule.Id, err)
+		}
+		if salePrice >= schedule.Price {
+			values["sale_price"] = nil
+			values["sale_start_at"] = ""
+			values["sale_end_at"] = ""
+		}
+	}
+	if err := updateProductFields(ctx, tx, schedule.ProductId, values); err != nil {
+		return fmt.Errorf("apply price schedule %d failed: %v", schedule.Id, err)
+	}
+	after, err := SnapshotProduct(ctx, tx, schedule.ProductId)
+	if err != nil {
+		return err
+	}
+	if err := InsertRevision(ctx, tx, &products.Revision{
+		ProductId: schedule.ProductId,
+		UserId:    schedule.UserId,
+		Action:    products.RevisionSchedule,
+		Before:    before,
+		After:     after,
+	}); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+	UPDATE "product_price_schedules" SET
+		"applied_at" = now()
+	WHERE "id" = $1;`, schedule.Id); err != nil {
+		return fmt.Errorf("update price schedule %d failed: %v", schedule.Id, err)
+	}
+	return nil
+}
+
+// ClearSale ล้างราคาลด (sale_price, sale_start_at, sale_end_at) + เก็บ revision
+func ClearSale(ctx context.Context, tx *sqlx.Tx, productId, userId string) error {
+	before, err := SnapshotProduct(ctx, tx, productId)
+	if err != nil {
+		return err
+	}
+	if err := updateProductFields(ctx, tx, productId, products.RevisionValues{
+		"sale_price":    nil,
+		"sale_start_at": "",
+		"sale_end_at":   "",
+	}); err != nil {
+		return fmt.Errorf("clear sale failed: %v", err)
+	}
+	after, err := SnapshotProduct(ctx, tx, productId)
+	if err != nil {
+		return err
+	}
+	return InsertRevision(ctx, tx, &products.Revision{
+		ProductId: productId,
+		UserId:    userId,
+		Action:    products.RevisionUpdate,
+		Before:    before,
+		After:     after,
+	})
+}
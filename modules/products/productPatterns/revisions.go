@@ -0,0 +1,182 @@
+package productPatterns
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/PHURINTOR/phurinshop/modules/products"
+	"github.com/PHURINTOR/phurinshop/pkg/money"
+	"github.com/PHURINTOR/phurinshop/pkg/search"
+	"github.com/jmoiron/sqlx"
+)
+
+// ----------Flow  (product_revisions)
+//    update   : SnapshotProduct (lock row) ---> UPDATE ---> SnapshotProduct ---> InsertRevision เฉพาะ field ที่เปลี่ยน
+//    rollback : before ของ revision ---> UPDATE ---> เก็บเป็น revision ใหม่ (action rollback)  ประวัติเดิมไม่ถูกลบ
+//    category / รูป / variant ไม่อยู่ในประวัติ
+
+// revisionColumns field ที่เก็บประวัติ  (ลำดับที่ rollback แก้)
+var revisionColumns = []string{"title", "description", "price", "currency", "sale_price", "sale_start_at", "sale_end_at", "status", "publish_at", "unpublish_at"}
+
+// SnapshotProduct ค่าปัจจุบันของ field ที่เก็บประวัติ + lock row จนจบ transaction  (ไม่มี / อยู่ในถังขยะ = ErrProductNotFound)
+func SnapshotProduct(ctx context.Context, tx *sqlx.Tx, productId string) (products.RevisionValues, error) {
+	query := `
+	SELECT
+		jsonb_build_object(
+			'title', "title",
+			'description', "description",
+			'price', "price",
+			'currency', "currency",
+			'sale_price', "sale_price",
+			'sale_start_at', "sale_start_at",
+			'sale_end_at', "sale_end_at",
+			'status', "status",
+			'publish_at', "publish_at",
+			'unpublish_at', "unpublish_at"
+		)
+	FROM "products"
+	WHERE "id" = $1
+		AND "deleted_at" IS NULL
+	FOR UPDATE;`
+
+	values := make(products.RevisionValues)
+	if err := tx.GetContext(ctx, &values, query, productId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", products.ErrProductNotFound, productId)
+		}
+		return nil, fmt.Errorf("get product snapshot failed: %v", err)
+	}
+	return values, nil
+}
+
+// InsertRevision เก็บเฉพาะ field ที่ค่าใน Before กับ After ต่างกัน  ไม่มีอะไรเปลี่ยน = ไม่เก็บ
+func InsertRevision(ctx context.Context, tx *sqlx.Tx, rev *products.Revision) error {
+	before, after := make(products.RevisionValues), make(products.RevisionValues)
+	for key, value := range rev.After {
+		if !reflect.DeepEqual(rev.Before[key], value) {
+			before[key] = rev.Before[key]
+			after[key] = value
+		}
+	}
+	if len(after) == 0 {
+		return nil
+	}
+
+	query := `
+	INSERT INTO "product_revisions" (
+		"product_id",
+		"user_id",
+		"action",
+		"rollback_of",
+		"before",
+		"after"
+	)
+	VALUES ($1, $2, $3, $4, $5, $6);`
+
+	if _, err := tx.ExecContext(ctx, query, rev.ProductId, rev.UserId, rev.Action, rev.RollbackOf, before, after); err != nil {
+		return fmt.Errorf("insert product revision failed: %v", err)
+	}
+	return nil
+}
+
+// RollbackRevision แก้ product กลับเป็นค่า before ของ revision  (ต้องเป็น revision ของ product นี้)
+func RollbackRevision(ctx context.Context, tx *sqlx.Tx, productId string, revisionId int, userId string) error {
+	rev := new(products.Revision)
+	if err := tx.GetContext(ctx, rev, `
+	SELECT
+		"id",
+		"product_id",
+		"user_id",
+		"action",
+		"rollback_of",
+		"before",
+		"after",
+		"created_at"
+	FROM "product_revisions"
+	WHERE "id" = $1
+		AND "product_id" = $2;`, revisionId, productId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %d", products.ErrRevisionNotFound, revisionId)
+		}
+		return fmt.Errorf("get product revision failed: %v", err)
+	}
+
+	before, err := SnapshotProduct(ctx, tx, productId)
+	if err != nil {
+		return err
+	}
+	if err := updateProductFields(ctx, tx, productId, rev.Before); err != nil {
+		return fmt.Errorf("rollback product failed: %v", err)
+	}
+
+	after, err := SnapshotProduct(ctx, tx, productId)
+	if err != nil {
+		return err
+	}
+	return InsertRevision(ctx, tx, &products.Revision{
+		ProductId:  productId,
+		UserId:     userId,
+		Action:     products.RevisionRollback,
+		RollbackOf: &rev.Id,
+		Before:     before,
+		After:      after,
+	})
+}
+
+// updateProductFields แก้ field ที่เก็บประวัติตามที่มีใน values  (ไม่มี key = ไม่แก้)
+func updateProductFields(ctx context.Context, tx *sqlx.Tx, productId string, values products.RevisionValues) error {
+	fields := make([]string, 0)
+	args := make([]any, 0)
+	for _, column := range revisionColumns {
+		value, ok := values[column]
+		if !ok {
+			continue
+		}
+		switch column {
+		case "title", "description":
+			// คำไทยที่ตัดแล้วต้องเปลี่ยนตาม (search)
+			text, _ := value.(string)
+			args = append(args, text, search.ThaiTokens(text))
+			fields = append(fields,
+				fmt.Sprintf(`"%s" = $%d`, column, len(args)-1),
+				fmt.Sprintf(`"%s_tokens" = $%d`, column, len(args)),
+			)
+		case "price", "sale_price":
+			// json.Number (snapshot) / money.Amount (import)  ---> ข้อความ  ไม่ผ่าน float   sale_price null = ล้าง
+			if value == nil {
+				args = append(args, nil)
+				fields = append(fields, fmt.Sprintf(`"%s" = $%d`, column, len(args)))
+				continue
+			}
+			price, err := money.Parse(fmt.Sprint(value))
+			if err != nil {
+				return err
+			}
+			args = append(args, price)
+			fields = append(fields, fmt.Sprintf(`"%s" = $%d`, column, len(args)))
+		case "publish_at", "unpublish_at", "sale_start_at", "sale_end_at":
+			// null ---> "" ---> NULL
+			text, _ := value.(string)
+			args = append(args, text)
+			fields = append(fields, fmt.Sprintf(`"%s" = NULLIF($%d, '')::TIMESTAMPTZ`, column, len(args)))
+		default:
+			args = append(args, value)
+			fields = append(fields, fmt.Sprintf(`"%s" = $%d`, column, len(args)))
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	args = append(args, productId)
+	query := fmt.Sprintf(`
+	UPDATE "products" SET
+		%s
+	WHERE "id" = $%d;`, strings.Join(fields, ",\n\t\t"), len(args))
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,26 @@
+package productPatterns
+
+import "fmt"
+
+// ----------Flow  (status ของ product)
+//    draft ---> published ---> archived   (admin เปลี่ยนเองได้ทุกทาง)
+//    published + publish_at อนาคต = scheduled,  published + เลย unpublish_at = archived   ไม่ต้องมี job คอยเปลี่ยน
+
+// StatusQuery สถานะ ณ ตอนนี้ของ product (alias ของตาราง products)
+func StatusQuery(alias string) string {
+	return fmt.Sprintf(`(
+				CASE
+					WHEN %[1]s."status" = 'published' AND %[1]s."unpublish_at" <= now() THEN 'archived'
+					WHEN %[1]s."status" = 'published' AND %[1]s."publish_at" > now() THEN 'scheduled'
+					ELSE %[1]s."status"::TEXT
+				END
+			)`, alias)
+}
+
+// timeValue publish_at, unpublish_at ---> string  (nil, "" = NULL ผ่าน NULLIF)
+func timeValue(t *string) string {
+	if t == nil {
+		return ""
+	}
+	return *t
+}
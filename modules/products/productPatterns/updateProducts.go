@@ -6,8 +6,10 @@ import (
 
 	"github.com/PHURINTOR/phurinshop/modules/entities"
 	"github.com/PHURINTOR/phurinshop/modules/files"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesImages"
 	"github.com/PHURINTOR/phurinshop/modules/files/filesUsecases"
 	"github.com/PHURINTOR/phurinshop/modules/products"
+	"github.com/PHURINTOR/phurinshop/pkg/search"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -22,14 +24,20 @@ type IUpdateProductsBuilder interface {
 	updateTitleQuery()
 	updateDescriptionQuery()
 	updatePriceQuery()
-	updateCategoryQuery() error //คนละ Talble update error แยกไปเลย
+	updateStatusQuery()
+	updateSaleQuery()
+	updateCategoriesQuery() error //คนละ Talble update error แยกไปเลย
 
 	// Images
 	insertImages() error
 	getOldImages() []*entities.Images // เป็น pointer ด้วยกรณีรองรับเป็น null
 	deleteOldImages() error
 
+	// Variants
+	updateVariants() error
+
 	updateProducts() error
+	insertRevision() error
 	getQueryFields() []string // Get ว่าฟิวด์ไหนถูก update บ้าง
 	getValues() []any
 	getQuery() string
@@ -48,6 +56,7 @@ type updateProductsBuilder struct {
 	queryFields    []string
 	lastStackIndex int
 	values         []any
+	before         products.RevisionValues // ค่าก่อนแก้ (product_revisions)
 }
 
 // ============ Builder Constructor =====
@@ -87,7 +96,8 @@ func (b *updateProductsBuilder) closeQuery() {
 	b.lastStackIndex = len(b.values)      // นับเพื่อใช้เป็นลำดับ อากิวเม้นต์ $		 update len
 
 	b.query += fmt.Sprintf(`
-	WHERE "id" = $%d`, b.lastStackIndex) // =====> $(len) = $1, $2 ไปเรื่อยๆ
+	WHERE "id" = $%d
+		AND "deleted_at" IS NULL`, b.lastStackIndex) // =====> $(len) = $1, $2 ไปเรื่อยๆ  (อยู่ในถังขยะ = แก้ไม่ได้)
 
 } //concat string
 
@@ -100,6 +110,12 @@ func (b *updateProductsBuilder) updateTitleQuery() {
 
 		b.queryFields = append(b.queryFields, fmt.Sprintf(`	
 		"title" = $%d`, b.lastStackIndex)) // =====> $(len) = $1, $2 ไปเรื่อยๆ
+
+		// คำไทยที่ตัดแล้ว  trigger เอาไปทำ search (tsvector)
+		b.values = append(b.values, search.ThaiTokens(b.req.Title))
+		b.lastStackIndex = len(b.values)
+		b.queryFields = append(b.queryFields, fmt.Sprintf(`
+		"title_tokens" = $%d`, b.lastStackIndex))
 	}
 }
 
@@ -112,85 +128,98 @@ func (b *updateProductsBuilder) updateDescriptionQuery() {
 
 		b.queryFields = append(b.queryFields, fmt.Sprintf(`	
 			"description" = $%d`, b.lastStackIndex)) // =====> $(len) = $1, $2 ไปเรื่อยๆ
+
+		b.values = append(b.values, search.ThaiTokens(b.req.Description))
+		b.lastStackIndex = len(b.values)
+		b.queryFields = append(b.queryFields, fmt.Sprintf(`
+			"description_tokens" = $%d`, b.lastStackIndex))
 	}
 }
 
 // --------updatePriceQuery --------------
+// price 0 = ไม่แก้,  currency "" = ไม่แก้
 func (b *updateProductsBuilder) updatePriceQuery() {
 	// จะ  Stack query String (initQuery) + values: [] any ที่ส่งเข้ามา
-	if b.req.Price != 0 && b.req.Price < 0 {
+	if b.req.Price > 0 {
 		b.values = append(b.values, b.req.Price) // Add data
 		b.lastStackIndex = len(b.values)         // นับเพื่อใช้เป็นลำดับ อากิวเม้นต์ $		 update len
 
 		b.queryFields = append(b.queryFields, fmt.Sprintf(`	
 			"price" = $%d`, b.lastStackIndex)) // =====> $(len) = $1, $2 ไปเรื่อยๆ
 	}
+	if b.req.Currency != "" {
+		b.values = append(b.values, b.req.Currency)
+		b.lastStackIndex = len(b.values)
+		b.queryFields = append(b.queryFields, fmt.Sprintf(`
+			"currency" = $%d`, b.lastStackIndex))
+	}
 }
 
-// --------updateCategoryQuery --------------
-func (b *updateProductsBuilder) updateCategoryQuery() error { //คนละ Talble update error{return nil} แยกไปเลย
-	if b.req.Category == nil {
-		return nil
+// --------updateStatusQuery --------------
+// status "" = ไม่แก้   publish_at, unpublish_at nil = ไม่แก้, "" = ล้าง
+func (b *updateProductsBuilder) updateStatusQuery() {
+	if b.req.Status != "" {
+		b.values = append(b.values, b.req.Status)
+		b.lastStackIndex = len(b.values)
+		b.queryFields = append(b.queryFields, fmt.Sprintf(`
+		"status" = $%d`, b.lastStackIndex))
 	}
+	if b.req.PublishAt != nil {
+		b.values = append(b.values, *b.req.PublishAt)
+		b.lastStackIndex = len(b.values)
+		b.queryFields = append(b.queryFields, fmt.Sprintf(`
+		"publish_at" = NULLIF($%d, '')::TIMESTAMPTZ`, b.lastStackIndex))
+	}
+	if b.req.UnpublishAt != nil {
+		b.values = append(b.values, *b.req.UnpublishAt)
+		b.lastStackIndex = len(b.values)
+		b.queryFields = append(b.queryFields, fmt.Sprintf(`
+		"unpublish_at" = NULLIF($%d, '')::TIMESTAMPTZ`, b.lastStackIndex))
+	}
+}
 
-	if b.req.Category.Id == 0 {
-		return nil
+// --------updateSaleQuery --------------
+// sale_price nil = ไม่แก้   sale_start_at, sale_end_at nil = ไม่แก้, "" = ล้าง
+func (b *updateProductsBuilder) updateSaleQuery() {
+	if b.req.SalePrice != nil {
+		b.values = append(b.values, *b.req.SalePrice)
+		b.lastStackIndex = len(b.values)
+		b.queryFields = append(b.queryFields, fmt.Sprintf(`
+		"sale_price" = $%d`, b.lastStackIndex))
 	}
+	if b.req.SaleStartAt != nil {
+		b.values = append(b.values, *b.req.SaleStartAt)
+		b.lastStackIndex = len(b.values)
+		b.queryFields = append(b.queryFields, fmt.Sprintf(`
+		"sale_start_at" = NULLIF($%d, '')::TIMESTAMPTZ`, b.lastStackIndex))
+	}
+	if b.req.SaleEndAt != nil {
+		b.values = append(b.values, *b.req.SaleEndAt)
+		b.lastStackIndex = len(b.values)
+		b.queryFields = append(b.queryFields, fmt.Sprintf(`
+		"sale_end_at" = NULLIF($%d, '')::TIMESTAMPTZ`, b.lastStackIndex))
+	}
+}
 
-	query := `
-	UPDATE "products_categories" SET
-		"category_id" = $1
-	WHERE "product_id" = $2;`
-	//เนื่องจากไม่ได้ขึ้นกับอันเดิม  Update แยกส่วนทำให้รู้ ตัวแปรที่แน่นอน ไม่ต้องไล่ลำดับเหมือน len
+// --------updateCategoriesQuery --------------
+// categories nil = ไม่แก้,  ส่งมา = แทนที่ category เดิมทั้งหมด
+func (b *updateProductsBuilder) updateCategoriesQuery() error { //คนละ Talble update error{return nil} แยกไปเลย
+	if b.req.Categories == nil {
+		return nil
+	}
 
-	if _, err := b.tx.ExecContext(
-		context.Background(),
-		query,
-		b.req.Category.Id,
-		b.req.Id,
-	); err != nil {
+	if err := replaceCategories(context.Background(), b.tx, b.req.Id, b.req.Categories); err != nil {
 		b.tx.Rollback()
-		return fmt.Errorf("update products_categories failed: %v", err)
+		return err
 	}
 	return nil
 }
 
 // --------insertImages --------------
 func (b *updateProductsBuilder) insertImages() error {
-	query := `
-	INSERT INTO "images" (
-		"filename",
-		"url",
-		"product_id"
-	)
-	VALUES`
-
-	valueStack := make([]any, 0)
-	var index int
-	for i := range b.req.Images {
-		valueStack = append(valueStack,
-			b.req.Images[i].FileName,
-			b.req.Images[i].Url,
-			b.req.Id,
-		)
-
-		if i != len(b.req.Images)-1 {
-			query += fmt.Sprintf(`
-			($%d, $%d, $%d),`, index+1, index+2, index+3)
-		} else {
-			query += fmt.Sprintf(`
-			($%d, $%d, $%d);`, index+1, index+2, index+3)
-		}
-		index += 3
-	}
-
-	if _, err := b.tx.ExecContext(
-		context.Background(),
-		query,
-		valueStack...,
-	); err != nil {
+	if err := insertImages(context.Background(), b.tx, b.req.Id, b.req.Images); err != nil {
 		b.tx.Rollback()
-		return fmt.Errorf("insert images failed: %v", err)
+		return err
 	}
 	return nil
 }
@@ -201,9 +230,11 @@ func (b *updateProductsBuilder) getOldImages() []*entities.Images { // เป็
 		SELECT
 			"id",
 			"filename",
-			"url"
+			"url",
+			"variants"
 		FROM "images"
-		WHERE "product_id" = $1;`
+		WHERE "product_id" = $1
+			AND "variant_id" IS NULL;`
 
 	images := make([]*entities.Images, 0) // Create const
 	if err := b.db.Select(
@@ -219,23 +250,16 @@ func (b *updateProductsBuilder) getOldImages() []*entities.Images { // เป็
 // --------deleteOldImages --------------
 func (b *updateProductsBuilder) deleteOldImages() error {
 	// import fileusecase file storage  + func get old images
-	query := `DELETE FROM "images" WHERE "product_id" = $1;`
+	query := `DELETE FROM "images" WHERE "product_id" = $1 AND "variant_id" IS NULL;`
 
 	//Check old images  loop delete
+	// ไฟล์ถูกลบหลัง commit ผ่าน outbox  rollback = รูปเดิมยังอยู่ครบ
 	images := b.getOldImages()
 	if len(images) > 0 {
-		deleteFileReq := make([]*files.DeleteFileReq, 0)
-		for _, img := range images {
-			deleteFileReq = append(deleteFileReq, &files.DeleteFileReq{
-				Destination: fmt.Sprintf("images/products/%s", img.FileName),
-			})
+		if err := b.filesUsecases.DeleteFileLater(b.tx, DeleteImagesReq(images)); err != nil {
+			b.tx.Rollback()
+			return err
 		}
-		//ลบไปแล้วไม่ต้อง ดัก err
-		// if err := b.filesUsecases.DeleteFileGCP(deleteFileReq); err != nil {
-		// 	b.tx.Rollback()
-		// 	return err
-		// }
-		b.filesUsecases.DeleteFileGCP(deleteFileReq)
 	}
 
 	// use
@@ -250,9 +274,30 @@ func (b *updateProductsBuilder) deleteOldImages() error {
 	return nil
 }
 
+// --------updateVariants --------------
+// nil = ไม่ได้ส่ง variants มา ไม่ต้องแก้
+func (b *updateProductsBuilder) updateVariants() error {
+	if b.req.Variants == nil {
+		return nil
+	}
+	if err := syncVariants(context.Background(), b.tx, b.filesUsecases, b.req.Id, b.req.Variants); err != nil {
+		b.tx.Rollback()
+		return err
+	}
+	return nil
+}
+
 // --------updateProducts --------------
 func (b *updateProductsBuilder) updateProducts() error {
 	// เป็นเพียง func ว่าอนุญาติรัน Update ได้ไหม ส่วน sql query จะไปทำ fuction อื่น
+	// ไม่มี product / อยู่ในถังขยะ  ไม่ต้องแก้ category, รูป, variant ต่อ
+	before, err := SnapshotProduct(context.Background(), b.tx, b.req.Id)
+	if err != nil {
+		b.tx.Rollback()
+		return err
+	}
+	b.before = before
+
 	fmt.Printf(b.query)
 	if _, err := b.tx.ExecContext(context.Background(), b.query, b.values...); err != nil {
 		b.tx.Rollback()
@@ -261,6 +306,27 @@ func (b *updateProductsBuilder) updateProducts() error {
 	return nil
 }
 
+// --------insertRevision --------------
+// ประวัติการแก้  ค่าก่อน / หลัง + คนแก้
+func (b *updateProductsBuilder) insertRevision() error {
+	after, err := SnapshotProduct(context.Background(), b.tx, b.req.Id)
+	if err != nil {
+		b.tx.Rollback()
+		return err
+	}
+	if err := InsertRevision(context.Background(), b.tx, &products.Revision{
+		ProductId: b.req.Id,
+		UserId:    b.req.UserId,
+		Action:    products.RevisionUpdate,
+		Before:    b.before,
+		After:     after,
+	}); err != nil {
+		b.tx.Rollback()
+		return err
+	}
+	return nil
+}
+
 // --------getQueryFields --------------
 func (b *updateProductsBuilder) getQueryFields() []string { // Get List ว่าฟิวด์ไหนถูก update บ้าง
 
@@ -303,8 +369,14 @@ func (en *updateProductsEngineer) sumQueryFields() {
 	en.builder.updateTitleQuery()
 	en.builder.updateDescriptionQuery()
 	en.builder.updatePriceQuery()
+	en.builder.updateStatusQuery()
+	en.builder.updateSaleQuery()
 
 	fields := en.builder.getQueryFields()
+	if len(fields) == 0 { // แก้แค่รูป / variants  ให้ updated_at เปลี่ยนด้วย
+		fields = append(fields, `
+		"updated_at" = now()`)
+	}
 
 	for i := range fields {
 		query := en.builder.getQuery() //ของเดิม
@@ -330,8 +402,13 @@ func (en *updateProductsEngineer) UpdateProduct() error {
 		return err
 	}
 
-	// Update category
-	if err := en.builder.updateCategoryQuery(); err != nil {
+	// Revision
+	if err := en.builder.insertRevision(); err != nil {
+		return err
+	}
+
+	// Update categories
+	if err := en.builder.updateCategoriesQuery(); err != nil {
 		return err
 	}
 
@@ -346,6 +423,11 @@ func (en *updateProductsEngineer) UpdateProduct() error {
 		}
 	}
 
+	// Update variants
+	if err := en.builder.updateVariants(); err != nil {
+		return err
+	}
+
 	// Commit
 	if err := en.builder.commit(); err != nil {
 		return err
@@ -353,3 +435,24 @@ func (en *updateProductsEngineer) UpdateProduct() error {
 
 	return nil
 }
+
+// DeleteImagesReq path ของรูป product + รูปย่อ สำหรับลบใน bucket  (filename ว่าง = รูปจาก url ภายนอก ไม่มีใน bucket)
+func DeleteImagesReq(images []*entities.Images) []*files.DeleteFileReq {
+	deleteFileReq := make([]*files.DeleteFileReq, 0)
+	for _, img := range images {
+		if img.FileName == "" {
+			continue
+		}
+		destination := fmt.Sprintf("images/products/%s", img.FileName)
+		deleteFileReq = append(deleteFileReq, &files.DeleteFileReq{
+			Destination: destination,
+		})
+		// ลบ thumbnail/medium/large ตามไปด้วย
+		for _, v := range filesImages.VariantDestinations(destination, img.Variants) {
+			deleteFileReq = append(deleteFileReq, &files.DeleteFileReq{
+				Destination: v,
+			})
+		}
+	}
+	return deleteFileReq
+}
@@ -0,0 +1,242 @@
+package productPatterns
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PHURINTOR/phurinshop/modules/entities"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesUsecases"
+	"github.com/PHURINTOR/phurinshop/modules/inventory"
+	"github.com/PHURINTOR/phurinshop/modules/inventory/inventoryPatterns"
+	"github.com/PHURINTOR/phurinshop/modules/products"
+	"github.com/jmoiron/sqlx"
+)
+
+// ----------Flow  (variant ทำใน transaction เดียวกับ product)
+//    insert : insertProduct ---> insertVariants (+ รูปของ variant)
+//    update : ลบ variant ที่ไม่อยู่ใน req ---> update variant ที่มี id ---> insert variant ที่ไม่มี id
+//    รูปของ variant อยู่ในตาราง images (variant_id)  ลบ variant = ลบรูปผ่าน outbox
+//    stock ตั้งได้ตอนสร้างเท่านั้น (ลง ledger เป็น adjust)  หลังจากนั้นแก้ผ่าน /inventory/adjust
+
+// VariantsQuery variant ของ product + รูปของแต่ละ variant  (json array ของ products.Variant)
+func VariantsQuery(productId string) string {
+	return fmt.Sprintf(`(
+				SELECT
+					COALESCE(array_to_json(array_agg("vt")), '[]'::json)
+				FROM (
+					SELECT
+						"v"."id",
+						"v"."sku",
+						"v"."options",
+						"v"."price",
+						"v"."stock",
+						"v"."reserved",
+						(
+							SELECT
+								COALESCE(array_to_json(array_agg("vit")), '[]'::json)
+							FROM (
+								SELECT
+									"vi"."id",
+									"vi"."filename",
+									"vi"."url",
+									"vi"."variants"
+								FROM "images" "vi"
+								WHERE "vi"."variant_id" = "v"."id"
+							) AS "vit"
+						) AS "images"
+					FROM "product_variants" "v"
+					WHERE "v"."product_id" = %s
+					ORDER BY "v"."created_at", "v"."sku"
+				) AS "vt"
+			)`, productId)
+}
+
+// ------------------------- Insert Variants --------
+func insertVariants(ctx context.Context, tx *sqlx.Tx, productId string, variants []*products.Variant) error {
+	query := `
+	INSERT INTO "product_variants" (
+		"product_id",
+		"sku",
+		"options",
+		"price"
+	)
+	VALUES ($1, $2, $3, $4)
+		RETURNING "id";`
+
+	for _, v := range variants {
+		if err := tx.QueryRowContext(
+			ctx,
+			query,
+			productId,
+			v.Sku,
+			v.Options,
+			v.Price,
+		).Scan(&v.Id); err != nil {
+			return fmt.Errorf("insert variant %s failed: %v", v.Sku, err)
+		}
+		if err := initialStock(ctx, tx, productId, v.Id, v.Stock); err != nil {
+			return err
+		}
+		if err := insertVariantImages(ctx, tx, productId, v.Id, v.Images); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ------------------------- Insert Variant Images --------
+func insertVariantImages(ctx context.Context, tx *sqlx.Tx, productId, variantId string, images []*entities.Images) error {
+	if len(images) == 0 {
+		return nil
+	}
+
+	query := `
+	INSERT INTO "images" (
+		"filename",
+		"url",
+		"variants",
+		"product_id",
+		"variant_id"
+	)
+	VALUES`
+
+	valueStack := make([]any, 0)
+	var index int
+	for i := range images {
+		valueStack = append(valueStack,
+			images[i].FileName,
+			images[i].Url,
+			images[i].Variants,
+			productId,
+			variantId,
+		)
+
+		if i != len(images)-1 {
+			query += fmt.Sprintf(`
+			($%d, $%d, $%d, $%d, $%d),`, index+1, index+2, index+3, index+4, index+5)
+		} else {
+			query += fmt.Sprintf(`
+			($%d, $%d, $%d, $%d, $%d);`, index+1, index+2, index+3, index+4, index+5)
+		}
+		index += 5
+	}
+
+	if _, err := tx.ExecContext(ctx, query, valueStack...); err != nil {
+		return fmt.Errorf("insert variant images failed: %v", err)
+	}
+	return nil
+}
+
+// ------------------------- Sync Variants (update) --------
+// variant ที่มี id ต้องเป็นของ product นี้  แก้ทั้งแถว (price nil = กลับไปใช้ราคา product)  ยกเว้น stock
+// รูปของ variant: ส่งมา = แทนที่รูปเดิม, ไม่ส่ง = ใช้รูปเดิม
+func syncVariants(ctx context.Context, tx *sqlx.Tx, filesUsecase filesUsecases.IFilesUsecase, productId string, variants []*products.Variant) error {
+	existing := make([]string, 0)
+	if err := tx.SelectContext(ctx, &existing, `
+	SELECT
+		"id"
+	FROM "product_variants"
+	WHERE "product_id" = $1
+	FOR UPDATE;`, productId); err != nil {
+		return fmt.Errorf("get variants failed: %v", err)
+	}
+
+	keep := make(map[string]bool)
+	for _, v := range variants {
+		if v.Id != "" {
+			keep[v.Id] = true
+		}
+	}
+	removed := make([]string, 0)
+	owned := make(map[string]bool)
+	for _, id := range existing {
+		owned[id] = true
+		if !keep[id] {
+			removed = append(removed, id)
+		}
+	}
+
+	// 1. ลบ variant ที่ไม่อยู่ใน req ก่อน  (sku เดิมเอาไปใช้กับ variant ใหม่ได้)
+	if len(removed) > 0 {
+		if err := deleteVariantImages(ctx, tx, filesUsecase, removed); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM "product_variants" WHERE "id"::TEXT = ANY($1::VARCHAR[]);`, removed); err != nil {
+			return fmt.Errorf("delete variants failed: %v", err)
+		}
+	}
+
+	// 2. update / insert
+	newVariants := make([]*products.Variant, 0)
+	for _, v := range variants {
+		if v.Id == "" {
+			newVariants = append(newVariants, v)
+			continue
+		}
+		if !owned[v.Id] {
+			return fmt.Errorf("variant %s is not found in product %s", v.Id, productId)
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+		UPDATE "product_variants" SET
+			"sku" = $1,
+			"options" = $2,
+			"price" = $3
+		WHERE "id" = $4;`,
+			v.Sku,
+			v.Options,
+			v.Price,
+			v.Id,
+		); err != nil {
+			return fmt.Errorf("update variant %s failed: %v", v.Sku, err)
+		}
+
+		if len(v.Images) > 0 {
+			if err := deleteVariantImages(ctx, tx, filesUsecase, []string{v.Id}); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM "images" WHERE "variant_id" = $1;`, v.Id); err != nil {
+				return fmt.Errorf("delete variant images failed: %v", err)
+			}
+			if err := insertVariantImages(ctx, tx, productId, v.Id, v.Images); err != nil {
+				return err
+			}
+		}
+	}
+	return insertVariants(ctx, tx, productId, newVariants)
+}
+
+// initialStock stock ตอนสร้าง product / variant  ลง ledger (adjust) เหมือนเติมของ
+func initialStock(ctx context.Context, tx *sqlx.Tx, productId, variantId string, qty int) error {
+	if qty <= 0 {
+		return nil
+	}
+	if _, err := inventoryPatterns.Adjust(ctx, tx, &inventory.AdjustReq{
+		ProductId: productId,
+		VariantId: variantId,
+		Qty:       qty,
+		Note:      "initial stock",
+	}); err != nil {
+		return fmt.Errorf("insert initial stock failed: %v", err)
+	}
+	return nil
+}
+
+// deleteVariantImages ลบรูปของ variant ใน bucket หลัง commit (outbox)  row ใน images คนเรียกลบเอง / cascade
+func deleteVariantImages(ctx context.Context, tx *sqlx.Tx, filesUsecase filesUsecases.IFilesUsecase, variantIds []string) error {
+	images := make([]*entities.Images, 0)
+	if err := tx.SelectContext(ctx, &images, `
+	SELECT
+		"id",
+		"filename",
+		"url",
+		"variants"
+	FROM "images"
+	WHERE "variant_id"::TEXT = ANY($1::VARCHAR[]);`, variantIds); err != nil {
+		return fmt.Errorf("get variant images failed: %v", err)
+	}
+	if len(images) == 0 {
+		return nil
+	}
+	return filesUsecase.DeleteFileLater(tx, DeleteImagesReq(images))
+}
@@ -1,25 +1,281 @@
 package products
 
 import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+
 	"github.com/PHURINTOR/phurinshop/modules/appinfo"
 	"github.com/PHURINTOR/phurinshop/modules/entities"
+	"github.com/PHURINTOR/phurinshop/pkg/money"
+)
+
+// -------------------- Status
+// เก็บจริงแค่ draft, published, archived  scheduled = published ที่ยังไม่ถึง publish_at (คำนวณตอน query)
+// published ที่เลย unpublish_at แล้ว = archived
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+	StatusScheduled = "scheduled"
 )
 
+var (
+	ErrProductNotPublished = errors.New("product is not published")
+	ErrProductNotFound     = errors.New("product is not found")
+	ErrRevisionNotFound    = errors.New("revision is not found")
+	ErrScheduleNotFound    = errors.New("price schedule is not found or already applied")
+	ErrInvalidPrice        = errors.New("price is invalid") // ตรวจกับค่าใน database (PATCH บางช่อง, schedule)  handler ตอบ 400
+)
+
+// Statuses สถานะทั้งหมด (filter ของ admin)
+var Statuses = map[string]bool{
+	StatusDraft:     true,
+	StatusPublished: true,
+	StatusArchived:  true,
+	StatusScheduled: true,
+}
+
 type Product struct {
-	Id          string             `json:"id"`
-	Title       string             `json:"title"`
-	Description string             `json:"description"`
-	Category    *appinfo.Category  `json:"category"`
-	CreatedAt   string             `json:"created_at"` // ดึงเป็น time.time ก็ได้
-	UpdatedAt   string             `json:"updated_at"`
-	Price       float64            `json:"price"`
-	Images      []*entities.Images `json:"images"`
+	Id          string              `json:"id"`
+	Title       string              `json:"title"`
+	Description string              `json:"description"`
+	Categories  []*appinfo.Category `json:"categories"`   // update: nil = ไม่แก้
+	Status      string              `json:"status"`       // insert ไม่ส่ง = draft,  update "" = ไม่แก้
+	PublishAt   *string             `json:"publish_at"`   // RFC3339  update: nil = ไม่แก้, "" = ล้าง
+	UnpublishAt *string             `json:"unpublish_at"` // RFC3339  update: nil = ไม่แก้, "" = ล้าง
+	CreatedAt   string              `json:"created_at"`   // ดึงเป็น time.time ก็ได้
+	UpdatedAt   string              `json:"updated_at"`
+	DeletedAt   *string             `json:"deleted_at,omitempty"` // อยู่ในถังขยะ (/products/trash)
+	Price       money.Amount        `json:"price"`
+	Currency    string              `json:"currency"`       // ISO 4217  insert ไม่ส่ง = THB,  update "" = ไม่แก้
+	Stock       int                 `json:"stock"`          // ไม่มี variant ใช้ stock ของ product  แก้ผ่าน /inventory/adjust
+	Reserved    int                 `json:"reserved"`       // จองโดย order ที่ยังไม่ completed / canceled
+	Rank        *float64            `json:"rank,omitempty"` // ความเกี่ยวข้องกับคำค้น (find + search เท่านั้น)
+	Images      []*entities.Images  `json:"images"`
+	Variants    []*Variant          `json:"variants"` // update: nil = ไม่แก้, [] = ลบทุก variant
+	UserId      string              `json:"-"`        // คนแก้ (JwtAuth)  บันทึกลง product_revisions
+
+	// ราคาลดช่วงเวลา  price = ราคาปกติ,  effective_price = ราคาที่ขายจริง ณ ตอนนี้ (ในช่วง sale = sale_price)
+	SalePrice      *money.Amount `json:"sale_price"`      // update: nil = ไม่แก้  (ล้างผ่าน DELETE /products/:product_id/sale)
+	SaleStartAt    *string       `json:"sale_start_at"`   // RFC3339  nil = ไม่แก้, "" = ล้าง (เริ่มทันที)
+	SaleEndAt      *string       `json:"sale_end_at"`     // RFC3339  nil = ไม่แก้, "" = ล้าง (ไม่มีวันจบ)
+	EffectivePrice money.Amount  `json:"effective_price"` // คำนวณตอน query  ไม่รับจาก req
+
+	TrackInventory bool `json:"track_inventory"` // false = ไม่นับ stock (product เก่า)  เริ่มนับเมื่อ /inventory/adjust
+}
+
+// -------------------- Variant (SKU)
+// Price nil = ใช้ราคาของ product
+type Variant struct {
+	Id       string             `db:"id" json:"id"`
+	Sku      string             `db:"sku" json:"sku"`
+	Options  VariantOptions     `db:"options" json:"options"`
+	Price    *money.Amount      `db:"price" json:"price"` // สกุลเดียวกับ product
+	Stock    int                `db:"stock" json:"stock"`
+	Reserved int                `db:"reserved" json:"reserved"`
+	Images   []*entities.Images `json:"images"`
+}
+
+// VariantOptions ตัวเลือกของ variant  size, color : value   (jsonb)
+type VariantOptions map[string]string
+
+// Value เก็บลง jsonb  ไม่มีตัวเลือก = {}
+func (o VariantOptions) Value() (driver.Value, error) {
+	if o == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan อ่านจาก jsonb
+func (o *VariantOptions) Scan(src any) error {
+	switch data := src.(type) {
+	case nil:
+		*o = make(VariantOptions)
+		return nil
+	case []byte:
+		return json.Unmarshal(data, o)
+	case string:
+		return json.Unmarshal([]byte(data), o)
+	default:
+		return fmt.Errorf("scan variant options failed: unsupported type %T", src)
+	}
+}
+
+// FindVariant variant ของ product ตาม id  ไม่เจอ = nil
+func (p *Product) FindVariant(variantId string) *Variant {
+	for _, v := range p.Variants {
+		if v.Id == variantId {
+			return v
+		}
+	}
+	return nil
+}
+
+// VariantPrice ราคาที่ขายจริงของ variant  (ไม่ได้ตั้งราคา = effective_price ของ product รวมราคาลด)
+func (p *Product) VariantPrice(v *Variant) money.Amount {
+	if v == nil || v.Price == nil {
+		return p.EffectivePrice
+	}
+	return *v.Price
 }
 
 // -------------------- Find Product (Array)
 type ProductFilter struct {
-	Id                      string `query:"id"`     //param
-	Search                  string `query:"search"` // title & description
-	*entities.PaginationReq        //ประกาศแบบนี้ไม่ต้องใส่ตัวแปร เราไม่ต้อง .ตัวแปรหลายครั้ง สามารถเข้าใช้ stuct ได้เลย
+	Id                      string              `query:"id"`            //param
+	Search                  string              `query:"search"`        // title & description  (full-text, ภาษาไทยตัดคำ, prefix)
+	CategoryId              []string            `query:"category_id"`   // ?category_id=1&category_id=2 หรือ ?category_id=1,2  (อยู่ใน category ใดก็ได้ รวมลูกหลาน)
+	CategoryIds             []int               `query:"-"`             // แปลงจาก CategoryId ใน handler
+	MinPrice                *money.Amount       `query:"min_price"`     // ราคา product >= min_price
+	MaxPrice                *money.Amount       `query:"max_price"`     // ราคา product <= max_price
+	HasImages               *bool               `query:"has_images"`    // true = มีรูป (product หรือ variant), false = ไม่มีรูป
+	StartDate               string              `query:"start_date"`    // created_at YYYY-MM-DD
+	EndDate                 string              `query:"end_date"`      // created_at YYYY-MM-DD (รวมวันนั้น)
+	Attr                    []string            `query:"attr"`          // ?attr=color:red&attr=size:M,L  (variant options)
+	Attributes              map[string][]string `query:"-"`             // แปลงจาก Attr ใน handler  key ---> values
+	PriceBuckets            []string            `query:"price_buckets"` // ขอบช่วงราคาของ facet  ?price_buckets=0,100,500
+	PriceEdges              []money.Amount      `query:"-"`             // แปลงจาก PriceBuckets ใน handler (เรียงแล้ว เริ่มที่ 0)
+	Status                  []string            `query:"status"`        // admin  ?status=draft,scheduled
+	Statuses                []string            `query:"-"`             // แปลงจาก Status ใน handler  public = published เท่านั้น
+	Trash                   bool                `query:"-"`             // true = เฉพาะที่ถูกลบ (soft delete)
+	*entities.PaginationReq                     //ประกาศแบบนี้ไม่ต้องใส่ตัวแปร เราไม่ต้อง .ตัวแปรหลายครั้ง สามารถเข้าใช้ stuct ได้เลย
 	*entities.SortReq
 }
+
+// -------------------- Facets (sidebar filter)
+// แต่ละ facet นับตาม filter อื่นทั้งหมด ยกเว้น filter ของตัวเอง  (เลือกหลายค่าใน facet เดียวกันได้)
+type ProductFacets struct {
+	Categories []*CategoryFacet `json:"categories"`
+	Prices     []*PriceFacet    `json:"prices"`
+}
+
+// CategoryFacet จำนวน product ใน category (รวมลูกหลาน)  ไม่มี product = ไม่แสดง
+type CategoryFacet struct {
+	Id       int    `db:"id" json:"id"`
+	Title    string `db:"title" json:"title"`
+	ParentId *int   `db:"parent_id" json:"parent_id"`
+	Count    int    `db:"count" json:"count"`
+}
+
+// PriceFacet จำนวน product ที่ราคา min <= price < max  (max nil = ไม่มีเพดาน)
+type PriceFacet struct {
+	Min   money.Amount  `db:"min" json:"min"`
+	Max   *money.Amount `db:"max" json:"max"`
+	Count int           `db:"count" json:"count"`
+}
+
+// DefaultPriceEdges ขอบช่วงราคาเริ่มต้นของ facet
+var DefaultPriceEdges = []money.Amount{0, 100_00, 500_00, 1000_00, 5000_00}
+
+// -------------------- Revision (ประวัติการแก้)
+// Before, After เฉพาะ field ที่เปลี่ยน  title, description, price, currency, sale_*, status, publish_at, unpublish_at
+const (
+	RevisionUpdate   = "update"
+	RevisionRollback = "rollback" // ย้อนกลับไปค่า before ของ revision RollbackOf
+	RevisionImport   = "import"   // แก้ผ่าน import ไฟล์
+	RevisionSchedule = "schedule" // ราคาเปลี่ยนตาม product_price_schedules
+)
+
+type Revision struct {
+	Id         int            `db:"id" json:"id"`
+	ProductId  string         `db:"product_id" json:"product_id"`
+	UserId     string         `db:"user_id" json:"user_id"`
+	Action     string         `db:"action" json:"action"`
+	RollbackOf *int           `db:"rollback_of" json:"rollback_of,omitempty"`
+	Before     RevisionValues `db:"before" json:"before"`
+	After      RevisionValues `db:"after" json:"after"`
+	CreatedAt  string         `db:"created_at" json:"created_at"`
+}
+
+// RevisionValues column ---> ค่า  (jsonb)  publish_at, unpublish_at ว่าง = null
+type RevisionValues map[string]any
+
+// Value เก็บลง jsonb  ไม่มีค่า = {}
+func (v RevisionValues) Value() (driver.Value, error) {
+	if v == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan อ่านจาก jsonb  ตัวเลข (price) เป็น json.Number ไม่ผ่าน float64
+func (v *RevisionValues) Scan(src any) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		*v = make(RevisionValues)
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("scan revision values failed: unsupported type %T", src)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// RevisionFilter ประวัติของ product  ใหม่สุดขึ้นก่อน
+type RevisionFilter struct {
+	ProductId string `query:"-"`
+	*entities.PaginationReq
+}
+
+// -------------------- Price Schedule (เปลี่ยนราคาปกติล่วงหน้า)
+// job ตั้ง price ของ product เมื่อถึง apply_at  (applied_at nil = ยังไม่ถึง / ยกเลิกได้)
+type PriceSchedule struct {
+	Id        int          `db:"id" json:"id"`
+	ProductId string       `db:"product_id" json:"product_id"`
+	Price     money.Amount `db:"price" json:"price"`
+	ApplyAt   string       `db:"apply_at" json:"apply_at"` // RFC3339  ต้องเป็นอนาคต
+	AppliedAt *string      `db:"applied_at" json:"applied_at"`
+	UserId    string       `db:"user_id" json:"user_id"`
+	CreatedAt string       `db:"created_at" json:"created_at"`
+}
+
+// -------------------- Import / Export (CSV, XLSX)
+// SheetColumns หัวตารางของไฟล์  export เรียงตามนี้,  import สลับลำดับ / ไม่มีบาง column ได้
+// categories = id คั่นด้วย |   images = url คั่นด้วย |
+var SheetColumns = []string{"id", "title", "description", "price", "currency", "sale_price", "sale_start_at", "sale_end_at", "status", "publish_at", "unpublish_at", "stock", "categories", "images"}
+
+// ImportRow 1 แถวที่ผ่านการตรวจแล้ว  id ว่าง = เพิ่มใหม่,  มี id = แก้ (ช่องว่าง = ไม่แก้ เหมือน PATCH)
+type ImportRow struct {
+	Row     int // บรรทัดในไฟล์ (หัวตาราง = 1)
+	Product *Product
+	Stock   *int // update: nil = ไม่แก้,  มีค่า = ตั้ง stock เป็นค่านี้ผ่าน ledger (adjust ส่วนต่าง)   insert ใช้ Product.Stock
+}
+
+type ImportReq struct {
+	Rows   []*ImportRow
+	DryRun bool   // ทำทุกขั้นแล้ว rollback  ไม่บันทึกจริง
+	UserId string // คน import  บันทึกลง product_revisions
+}
+
+type ImportError struct {
+	Row   int    `json:"row"`
+	Id    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+// ImportResult dry run = จำนวนที่จะเพิ่ม / แก้ถ้า import จริง
+type ImportResult struct {
+	DryRun   bool           `json:"dry_run"`
+	Total    int            `json:"total"`
+	Inserted int            `json:"inserted"`
+	Updated  int            `json:"updated"`
+	Failed   int            `json:"failed"`
+	Errors   []*ImportError `json:"errors"`
+}
@@ -0,0 +1,407 @@
+package productshandlers
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PHURINTOR/phurinshop/config"
+	"github.com/PHURINTOR/phurinshop/modules/appinfo"
+	"github.com/PHURINTOR/phurinshop/modules/entities"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesStorages"
+	"github.com/PHURINTOR/phurinshop/modules/products"
+	"github.com/PHURINTOR/phurinshop/pkg/money"
+	"github.com/PHURINTOR/phurinshop/pkg/sheets"
+	"github.com/gofiber/fiber/v2"
+)
+
+// importMaxRows จำนวนแถวสูงสุดต่อไฟล์ (ไม่รวมหัวตาราง)
+const importMaxRows = 10000
+
+// ------------  Import Products ---------------
+// POST /products/import?dry_run=true  form-data file = .csv / .xlsx  (หัวตาราง = products.SheetColumns)
+// แถวที่ผิดไม่หยุดทั้งไฟล์  ตอบจำนวนที่เพิ่ม / แก้ + error รายแถว
+func (h *productsHandle) ImportProducts(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(importProductsErr),
+			"file is required",
+		).Res()
+	}
+	format, err := sheets.Format(file.Filename)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(importProductsErr),
+			err.Error(),
+		).Res()
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(importProductsErr),
+			err.Error(),
+		).Res()
+	}
+	defer f.Close()
+
+	rows, err := sheets.Read(format, f)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(importProductsErr),
+			err.Error(),
+		).Res()
+	}
+	if len(rows) < 2 {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(importProductsErr),
+			"file has no product rows",
+		).Res()
+	}
+	if len(rows)-1 > importMaxRows {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(importProductsErr),
+			fmt.Sprintf("file must not exceed %d rows", importMaxRows),
+		).Res()
+	}
+	columns, err := importColumns(rows[0])
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(importProductsErr),
+			err.Error(),
+		).Res()
+	}
+
+	// ตรวจทีละแถว  แถวที่ผิดไม่ส่งไป upsert
+	req := &products.ImportReq{
+		Rows:   make([]*products.ImportRow, 0, len(rows)-1),
+		DryRun: c.QueryBool("dry_run"),
+		UserId: c.Locals("userId").(string),
+	}
+	invalid := make([]*products.ImportError, 0)
+	var total int
+	for i, cells := range rows[1:] {
+		if strings.TrimSpace(strings.Join(cells, "")) == "" {
+			continue
+		}
+		total++
+
+		row, err := importProduct(h.cfg, columns, cells)
+		if err != nil {
+			invalid = append(invalid, &products.ImportError{
+				Row:   i + 2,
+				Id:    cellValue(columns, cells, "id"),
+				Error: err.Error(),
+			})
+			continue
+		}
+		row.Row = i + 2
+		req.Rows = append(req.Rows, row)
+	}
+
+	result := h.productsUsecase.ImportProducts(req)
+	result.Errors = append(invalid, result.Errors...)
+	sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Row < result.Errors[j].Row })
+	result.Total = total
+	result.Failed = len(result.Errors)
+
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+// ------------  Export Products ---------------
+// GET /products/admin/export?format=csv|xlsx  filter เหมือน /products/admin  ไฟล์ import กลับได้
+func (h *productsHandle) ExportProducts(c *fiber.Ctx) error {
+	format := strings.ToLower(c.Query("format", sheets.CSV))
+	if format != sheets.CSV && format != sheets.XLSX {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(exportProductsErr),
+			sheets.ErrUnsupportedFormat.Error(),
+		).Res()
+	}
+	req, err := productFilter(c, false)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(exportProductsErr),
+			err.Error(),
+		).Res()
+	}
+
+	// เขียนลง temp file ทีละหน้า ไม่เก็บทั้งไฟล์ใน memory  ยังไม่ส่ง header จนเขียนครบ  error กลางทาง = ตอบ 500 ได้ (ไม่ได้ไฟล์ครึ่งๆ)
+	tmp, err := os.CreateTemp("", "products-export-*."+format)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(exportProductsErr),
+			err.Error(),
+		).Res()
+	}
+	os.Remove(tmp.Name()) // unlink ไว้ก่อน  fd ที่เปิดอยู่ยังอ่านได้  ปิดแล้ว (หลังส่งเสร็จ) หายเอง
+
+	size, err := h.writeExport(tmp, format, req)
+	if err != nil {
+		tmp.Close()
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(exportProductsErr),
+			err.Error(),
+		).Res()
+	}
+
+	c.Attachment(fmt.Sprintf("products-%s.%s", time.Now().Format("20060102-150405"), format))
+	c.Set(fiber.HeaderContentType, sheets.ContentType(format))
+	return c.Status(fiber.StatusOK).SendStream(tmp, int(size)) // fasthttp ปิด tmp หลังส่ง
+}
+
+// writeExport หัวตาราง + ทุก product ทีละหน้าลง tmp  แล้วกลับไปต้นไฟล์  (คืนขนาดไฟล์)
+func (h *productsHandle) writeExport(tmp *os.File, format string, req *products.ProductFilter) (int64, error) {
+	writer, err := sheets.NewWriter(tmp, format)
+	if err != nil {
+		return 0, err
+	}
+
+	header := make([]any, 0, len(products.SheetColumns))
+	for _, column := range products.SheetColumns {
+		header = append(header, column)
+	}
+	err = writer.WriteRow(header)
+	if err == nil {
+		err = h.productsUsecase.ExportProducts(req, func(data []*products.Product) error {
+			for _, p := range data {
+				if err := writer.WriteRow(exportRow(p)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if cerr := writer.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// ------------  helper ---------------
+// importColumns ชื่อ column ---> index  (ไม่สนตัวพิมพ์)  ต้องมี id หรือ title
+func importColumns(header []string) (map[string]int, error) {
+	known := make(map[string]bool, len(products.SheetColumns))
+	for _, column := range products.SheetColumns {
+		known[column] = true
+	}
+
+	columns := make(map[string]int)
+	for i, raw := range header {
+		column := strings.ToLower(strings.TrimSpace(raw))
+		if column == "" {
+			continue
+		}
+		if !known[column] {
+			return nil, fmt.Errorf("column %q is unknown, use %s", raw, strings.Join(products.SheetColumns, ", "))
+		}
+		if _, ok := columns[column]; ok {
+			return nil, fmt.Errorf("column %q is duplicated", raw)
+		}
+		columns[column] = i
+	}
+
+	_, hasId := columns["id"]
+	_, hasTitle := columns["title"]
+	if !hasId && !hasTitle {
+		return nil, fmt.Errorf("column id or title is required")
+	}
+	return columns, nil
+}
+
+// cellValue ค่าของ column ในแถว  (ไม่มี column / แถวสั้นกว่าหัวตาราง = "")
+func cellValue(columns map[string]int, cells []string, column string) string {
+	i, ok := columns[column]
+	if !ok || i >= len(cells) {
+		return ""
+	}
+	return strings.TrimSpace(cells[i])
+}
+
+// importProduct 1 แถว ---> product  ตรวจเหมือน POST / PATCH /products
+// id ว่าง = เพิ่มใหม่ (ต้องมี title, categories),  มี id = แก้ (ช่องว่าง = ไม่แก้,  stock ตั้งผ่าน ledger)
+func importProduct(cfg config.IConfig, columns map[string]int, cells []string) (*products.ImportRow, error) {
+	value := func(column string) string { return cellValue(columns, cells, column) }
+
+	p := &products.Product{
+		Id:          value("id"),
+		Title:       value("title"),
+		Description: value("description"),
+		Currency:    value("currency"),
+		Status:      value("status"),
+	}
+	row := &products.ImportRow{Product: p}
+	insert := p.Id == ""
+
+	if v := value("price"); v != "" {
+		price, err := money.Parse(v)
+		if err != nil || price < 0 {
+			return nil, fmt.Errorf("price %q is invalid", v)
+		}
+		p.Price = price
+	}
+	if v := value("sale_price"); v != "" {
+		price, err := money.Parse(v)
+		if err != nil || price < 0 {
+			return nil, fmt.Errorf("sale_price %q is invalid", v)
+		}
+		p.SalePrice = &price
+	}
+	if v := value("sale_start_at"); v != "" {
+		p.SaleStartAt = &v
+	}
+	if v := value("sale_end_at"); v != "" {
+		p.SaleEndAt = &v
+	}
+	if v := value("stock"); v != "" {
+		stock, err := strconv.Atoi(v)
+		if err != nil || stock < 0 {
+			return nil, fmt.Errorf("stock %q is invalid", v)
+		}
+		if insert {
+			p.Stock = stock
+		} else {
+			row.Stock = &stock
+		}
+	}
+	if v := value("publish_at"); v != "" {
+		p.PublishAt = &v
+	}
+	if v := value("unpublish_at"); v != "" {
+		p.UnpublishAt = &v
+	}
+
+	if v := value("categories"); v != "" {
+		p.Categories = make([]*appinfo.Category, 0)
+		for _, id := range splitCell(v) {
+			categoryId, err := strconv.Atoi(id)
+			if err != nil || categoryId <= 0 {
+				return nil, fmt.Errorf("category id %q is invalid", id)
+			}
+			p.Categories = append(p.Categories, &appinfo.Category{Id: categoryId})
+		}
+	}
+	if v := value("images"); v != "" {
+		p.Images = make([]*entities.Images, 0)
+		for _, raw := range splitCell(v) {
+			u, err := url.ParseRequestURI(raw)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("image url %q is invalid", raw)
+			}
+			p.Images = append(p.Images, &entities.Images{
+				FileName: imageFileName(cfg, raw),
+				Url:      raw,
+				Variants: make(entities.ImageVariants),
+			})
+		}
+	}
+
+	if insert {
+		if p.Title == "" {
+			return nil, fmt.Errorf("title is required")
+		}
+		if len(p.Categories) == 0 {
+			return nil, fmt.Errorf("categories are required")
+		}
+	}
+	if err := validatePrice(p, insert); err != nil {
+		return nil, err
+	}
+	if err := validateStatus(p, insert); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// splitCell ค่าหลายตัวในช่องเดียว คั่นด้วย |
+func splitCell(v string) []string {
+	values := make([]string, 0)
+	for _, s := range strings.Split(v, "|") {
+		if s = strings.TrimSpace(s); s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// imageFileName รูปที่อยู่ใน bucket ของเรา (scheme, host ตรงกับ storage + key images/products/...) ใช้ชื่อไฟล์เดิม
+// ตอน import ต้อง acquire ไฟล์นั้นได้ (ref_count + 1)  ไฟล์ไม่มีแล้ว = error ของแถวนั้น
+// url อื่น = ภายนอก "" (ไม่ลบใน bucket)  กัน url ปลอมที่ path เหมือน key ของเราทำให้ลบไฟล์จริง
+func imageFileName(cfg config.IConfig, raw string) string {
+	key, ok := filesStorages.ObjectKey(cfg, raw)
+	if !ok {
+		return ""
+	}
+	filename, ok := strings.CutPrefix(key, "images/products/")
+	if !ok {
+		return ""
+	}
+	return filename
+}
+
+// exportRow 1 product ---> 1 แถว  เรียงตาม products.SheetColumns
+func exportRow(p *products.Product) []any {
+	categories := make([]string, 0, len(p.Categories))
+	for _, c := range p.Categories {
+		categories = append(categories, strconv.Itoa(c.Id))
+	}
+	images := make([]string, 0, len(p.Images))
+	for _, img := range p.Images {
+		images = append(images, img.Url)
+	}
+	timeCell := func(t *string) string {
+		if t == nil {
+			return ""
+		}
+		return *t
+	}
+	var salePrice any
+	if p.SalePrice != nil {
+		salePrice = p.SalePrice.Float64()
+	}
+
+	return []any{
+		p.Id,
+		p.Title,
+		p.Description,
+		p.Price.Float64(), // number cell ใน xlsx  (ทศนิยม 2 ตำแหน่ง แสดงได้ตรง)
+		p.Currency,
+		salePrice,
+		timeCell(p.SaleStartAt),
+		timeCell(p.SaleEndAt),
+		p.Status,
+		timeCell(p.PublishAt),
+		timeCell(p.UnpublishAt),
+		p.Stock,
+		strings.Join(categories, "|"),
+		strings.Join(images, "|"),
+	}
+}
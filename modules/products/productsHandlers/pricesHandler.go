@@ -0,0 +1,137 @@
+package productshandlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PHURINTOR/phurinshop/modules/entities"
+	"github.com/PHURINTOR/phurinshop/modules/products"
+	"github.com/PHURINTOR/phurinshop/pkg/money"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ------------  Clear Sale ---------------
+// DELETE /products/:product_id/sale  ล้าง sale_price, sale_start_at, sale_end_at  กลับไปขายราคาปกติ
+func (h *productsHandle) ClearSale(c *fiber.Ctx) error {
+	productId := strings.Trim(c.Params("product_id"), " ")
+
+	product, err := h.productsUsecase.ClearSale(productId, c.Locals("userId").(string))
+	if err != nil {
+		if errors.Is(err, products.ErrProductNotFound) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(clearSaleErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(clearSaleErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, product).Res()
+}
+
+// ------------  Find Price Schedules ---------------
+// GET /products/:product_id/prices  ราคาที่ตั้งล่วงหน้า (applied_at = ตั้งไปแล้ว)
+func (h *productsHandle) FindPriceSchedules(c *fiber.Ctx) error {
+	productId := strings.Trim(c.Params("product_id"), " ")
+
+	schedules, err := h.productsUsecase.FindPriceSchedules(productId)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(findPricesErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, schedules).Res()
+}
+
+// ------------  Add Price Schedule ---------------
+// POST /products/:product_id/prices  {"price": 199.00, "apply_at": "2026-11-01T00:00:00+07:00"}
+func (h *productsHandle) AddPriceSchedule(c *fiber.Ctx) error {
+	req := new(products.PriceSchedule)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(addPriceErr),
+			err.Error(),
+		).Res()
+	}
+	req.ProductId = strings.Trim(c.Params("product_id"), " ")
+	req.UserId = c.Locals("userId").(string)
+
+	if req.Price <= 0 || req.Price > money.Max {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(addPriceErr),
+			"price must be more than 0",
+		).Res()
+	}
+	applyAt, err := parseScheduleTime(&req.ApplyAt, "apply_at")
+	if err != nil || applyAt == nil || !applyAt.After(time.Now()) {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(addPriceErr),
+			"apply_at must be RFC3339 in the future",
+		).Res()
+	}
+
+	schedule, err := h.productsUsecase.AddPriceSchedule(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, products.ErrProductNotFound):
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(addPriceErr),
+				err.Error(),
+			).Res()
+		case errors.Is(err, products.ErrInvalidPrice):
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(addPriceErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(addPriceErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusCreated, schedule).Res()
+}
+
+// ------------  Delete Price Schedule ---------------
+// DELETE /products/:product_id/prices/:schedule_id  ยกเลิกได้เฉพาะที่ยังไม่ถึงเวลา
+func (h *productsHandle) DeletePriceSchedule(c *fiber.Ctx) error {
+	productId := strings.Trim(c.Params("product_id"), " ")
+	scheduleId, err := strconv.Atoi(strings.Trim(c.Params("schedule_id"), " "))
+	if err != nil || scheduleId <= 0 {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(deletePriceErr),
+			"schedule_id must be a number more than 0",
+		).Res()
+	}
+
+	if err := h.productsUsecase.DeletePriceSchedule(productId, scheduleId); err != nil {
+		if errors.Is(err, products.ErrScheduleNotFound) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(deletePriceErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(deletePriceErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, nil).Res()
+}
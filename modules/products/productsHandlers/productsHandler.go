@@ -1,16 +1,20 @@
 package productshandlers
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/PHURINTOR/phurinshop/config"
 	"github.com/PHURINTOR/phurinshop/modules/appinfo"
 	"github.com/PHURINTOR/phurinshop/modules/entities"
-	"github.com/PHURINTOR/phurinshop/modules/files"
 	"github.com/PHURINTOR/phurinshop/modules/files/filesUsecases"
 	"github.com/PHURINTOR/phurinshop/modules/products"
 	productsusecases "github.com/PHURINTOR/phurinshop/modules/products/productsUsecases"
+	"github.com/PHURINTOR/phurinshop/pkg/money"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -23,8 +27,27 @@ const (
 	InsertProductErr  productsHandlersErrCode = "product-003"
 	UpdateProductErr  productsHandlersErrCode = "product-004"
 	deleteProductErr  productsHandlersErrCode = "product-005"
+	reindexSearchErr  productsHandlersErrCode = "product-006"
+	restoreProductErr productsHandlersErrCode = "product-007"
+	purgeTrashErr     productsHandlersErrCode = "product-008"
+	findRevisionsErr  productsHandlersErrCode = "product-009"
+	rollbackErr       productsHandlersErrCode = "product-010"
+	importProductsErr productsHandlersErrCode = "product-011"
+	exportProductsErr productsHandlersErrCode = "product-012"
+	clearSaleErr      productsHandlersErrCode = "product-013"
+	findPricesErr     productsHandlersErrCode = "product-014"
+	addPriceErr       productsHandlersErrCode = "product-015"
+	deletePriceErr    productsHandlersErrCode = "product-016"
 )
 
+// order_by ที่เรียงได้  (rank ต้องมี search)
+var productsOrderBy = map[string]bool{
+	"id":    true,
+	"title": true,
+	"price": true,
+	"rank":  true,
+}
+
 // ======================================= Interface =========================================
 type IProductsHandler interface {
 	FindOneProduct(c *fiber.Ctx) error
@@ -32,6 +55,18 @@ type IProductsHandler interface {
 	AddProducts(c *fiber.Ctx) error
 	UpdateProducts(c *fiber.Ctx) error
 	DeleteProduct(c *fiber.Ctx) error
+	FindTrashProducts(c *fiber.Ctx) error
+	RestoreProduct(c *fiber.Ctx) error
+	PurgeTrash(c *fiber.Ctx) error
+	FindRevisions(c *fiber.Ctx) error
+	RollbackRevision(c *fiber.Ctx) error
+	ImportProducts(c *fiber.Ctx) error
+	ExportProducts(c *fiber.Ctx) error
+	ClearSale(c *fiber.Ctx) error
+	FindPriceSchedules(c *fiber.Ctx) error
+	AddPriceSchedule(c *fiber.Ctx) error
+	DeletePriceSchedule(c *fiber.Ctx) error
+	ReindexSearch(c *fiber.Ctx) error
 }
 
 // ======================================= Struct ============================================
@@ -57,32 +92,71 @@ func (h *productsHandle) FindOneProduct(c *fiber.Ctx) error {
 	fmt.Print(productId)
 	product, err := h.productsUsecase.FindOneProduct(productId)
 	if err != nil {
+		if errors.Is(err, products.ErrProductNotFound) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(findOneProductErr),
+				err.Error(),
+			).Res()
+		}
 		return entities.NewErrorResponse(c).Error(
 			fiber.ErrInternalServerError.Code,
 			string(findOneProductErr),
 			err.Error(),
 		).Res()
 	}
+	// ยังไม่ published  เห็นได้เฉพาะ admin (/products/admin/:product_id)
+	if !isAdmin(c) && product.Status != products.StatusPublished {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrNotFound.Code,
+			string(findOneProductErr),
+			"product is not found",
+		).Res()
+	}
 
 	// Ok Res
 	return entities.NewErrorResponse(c).Success(fiber.StatusOK, product).Res()
 }
 
-// ------------  FindOneProduct ---------------
+// ------------  FindProducts ---------------
 func (h *productsHandle) FindProducts(c *fiber.Ctx) error {
+	return h.findProducts(c, false)
+}
+
+// ------------  FindTrashProducts ---------------
+// product ที่ถูกลบ (ยังไม่เกิน retention)  filter เหมือน /products/admin
+func (h *productsHandle) FindTrashProducts(c *fiber.Ctx) error {
+	return h.findProducts(c, true)
+}
+
+func (h *productsHandle) findProducts(c *fiber.Ctx, trash bool) error {
+	req, err := productFilter(c, trash)
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findProductsErr),
+			err.Error(),
+		).Res()
+	}
+
+	// ------- Use
+	products := h.productsUsecase.FindProducts(req)
 
+	// Ok Res
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, products).Res()
+}
+
+// productFilter query ของ /products  (find, trash, export ใช้ร่วมกัน)
+func productFilter(c *fiber.Ctx, trash bool) (*products.ProductFilter, error) {
 	req := &products.ProductFilter{
 		PaginationReq: &entities.PaginationReq{},
 		SortReq:       &entities.SortReq{},
+		Trash:         trash,
 	}
 	// รับ query เป็น Struct = queryParser
 
 	if err := c.QueryParser(req); err != nil {
-		return entities.NewErrorResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(findProductsErr),
-			err.Error(),
-		).Res()
+		return nil, err
 	}
 
 	// Check And Defult Qeury
@@ -94,29 +168,112 @@ func (h *productsHandle) FindProducts(c *fiber.Ctx) error {
 		req.Limit = 5
 	}
 
-	// Orderby
+	// Cursor  ?cursor = keyset แทน page  order_by, sort ใช้ตามที่ติดมากับ cursor
+	if c.Context().QueryArgs().Has("cursor") {
+		cursor, err := entities.DecodeCursor(req.Cursor)
+		if err == nil && !cursor.First() {
+			req.OrderBy, req.Sort = cursor.OrderBy, cursor.Sort
+			if !productsOrderBy[cursor.OrderBy] || (cursor.OrderBy == "rank" && strings.TrimSpace(req.Search) == "") {
+				err = entities.ErrInvalidCursor
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		req.Keyset = cursor
+	}
+
+	// Orderby  ค้นหา = เรียงตามความเกี่ยวข้อง (rank)
 	if req.OrderBy == "" {
 		req.OrderBy = "title"
+		if strings.TrimSpace(req.Search) != "" {
+			req.OrderBy = "rank"
+		}
 	}
 
 	// Sort
 	if req.Sort == "" {
 		req.Sort = "ASC"
+		if req.OrderBy == "rank" {
+			req.Sort = "DESC"
+		}
 	}
 
-	// ------- Use
-	products := h.productsUsecase.FindProducts(req)
+	// Category  ?category_id=1&category_id=2 หรือ ?category_id=1,2
+	for _, raw := range req.CategoryId {
+		for _, id := range strings.Split(raw, ",") {
+			categoryId, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil || categoryId <= 0 {
+				return nil, fmt.Errorf("category_id %q is invalid", id)
+			}
+			req.CategoryIds = append(req.CategoryIds, categoryId)
+		}
+	}
 
-	// Ok Res
-	return entities.NewErrorResponse(c).Success(fiber.StatusOK, products).Res()
+	// Status  public เห็นแค่ published,  admin ?status=draft,scheduled (ไม่ส่ง = ทุกสถานะ)
+	if !isAdmin(c) {
+		req.Statuses = []string{products.StatusPublished}
+	} else {
+		for _, raw := range req.Status {
+			for _, status := range strings.Split(raw, ",") {
+				status = strings.ToLower(strings.TrimSpace(status))
+				if !products.Statuses[status] {
+					return nil, fmt.Errorf("status %q is invalid", status)
+				}
+				req.Statuses = append(req.Statuses, status)
+			}
+		}
+	}
+
+	// Price
+	for _, price := range []*money.Amount{req.MinPrice, req.MaxPrice} {
+		if price != nil && *price < 0 {
+			return nil, fmt.Errorf("min_price and max_price must be a number >= 0")
+		}
+	}
+	if req.MinPrice != nil && req.MaxPrice != nil && *req.MinPrice > *req.MaxPrice {
+		return nil, fmt.Errorf("min_price must not be greater than max_price")
+	}
+
+	// Date YYYY-MM-DD
+	if req.StartDate != "" {
+		start, err := time.Parse("2006-01-02", req.StartDate)
+		if err != nil {
+			return nil, fmt.Errorf("start date invalid")
+		}
+		req.StartDate = start.Format("2006-01-02")
+	}
+	if req.EndDate != "" {
+		end, err := time.Parse("2006-01-02", req.EndDate)
+		if err != nil {
+			return nil, fmt.Errorf("end date invalid")
+		}
+		req.EndDate = end.Format("2006-01-02")
+	}
+
+	// Attribute  ?attr=color:red&attr=size:M,L
+	attributes, err := parseAttributes(req.Attr)
+	if err != nil {
+		return nil, err
+	}
+	req.Attributes = attributes
+
+	// Price buckets ของ facet  ?price_buckets=0,100,500
+	edges, err := parsePriceEdges(req.PriceBuckets)
+	if err != nil {
+		return nil, err
+	}
+	req.PriceEdges = edges
+
+	return req, nil
 }
 
 // ------------  Add Product ---------------
 func (h *productsHandle) AddProducts(c *fiber.Ctx) error {
 
 	req := &products.Product{
-		Category: &appinfo.Category{},
-		Images:   make([]*entities.Images, 0),
+		Categories: make([]*appinfo.Category, 0),
+		Images:     make([]*entities.Images, 0),
 	}
 
 	if err := c.BodyParser(req); err != nil {
@@ -128,11 +285,46 @@ func (h *productsHandle) AddProducts(c *fiber.Ctx) error {
 	}
 
 	// check
-	if req.Category.Id <= 0 {
+	if len(req.Categories) == 0 {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(InsertProductErr),
+			"categories are required",
+		).Res()
+	}
+	if err := validateCategories(req.Categories); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(InsertProductErr),
+			err.Error(),
+		).Res()
+	}
+	if req.Stock < 0 {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(InsertProductErr),
+			"stock must not be negative",
+		).Res()
+	}
+	if err := validateVariants(req.Variants); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(InsertProductErr),
+			err.Error(),
+		).Res()
+	}
+	if err := validatePrice(req, true); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(InsertProductErr),
+			err.Error(),
+		).Res()
+	}
+	if err := validateStatus(req, true); err != nil {
 		return entities.NewErrorResponse(c).Error(
 			fiber.ErrBadRequest.Code,
 			string(InsertProductErr),
-			"category id is invalid",
+			err.Error(),
 		).Res()
 	}
 
@@ -154,8 +346,7 @@ func (h *productsHandle) UpdateProducts(c *fiber.Ctx) error {
 	productId := strings.Trim(c.Params("product_id"), " ")
 
 	req := &products.Product{
-		Images:   make([]*entities.Images, 0),
-		Category: &appinfo.Category{},
+		Images: make([]*entities.Images, 0),
 	}
 
 	if err := c.BodyParser(req); err != nil {
@@ -167,9 +358,62 @@ func (h *productsHandle) UpdateProducts(c *fiber.Ctx) error {
 	}
 
 	req.Id = productId
+	req.UserId = c.Locals("userId").(string)
+
+	// categories ไม่ส่งมา = ไม่แก้,  ส่งมาต้องมีอย่างน้อย 1
+	if req.Categories != nil && len(req.Categories) == 0 {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(UpdateProductErr),
+			"categories must not be empty",
+		).Res()
+	}
+	if err := validateCategories(req.Categories); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(UpdateProductErr),
+			err.Error(),
+		).Res()
+	}
+
+	if err := validateVariants(req.Variants); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(UpdateProductErr),
+			err.Error(),
+		).Res()
+	}
+	if err := validatePrice(req, false); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(UpdateProductErr),
+			err.Error(),
+		).Res()
+	}
+	if err := validateStatus(req, false); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(UpdateProductErr),
+			err.Error(),
+		).Res()
+	}
 
 	product, err := h.productsUsecase.UpdateProduct(req)
 	if err != nil {
+		switch {
+		case errors.Is(err, products.ErrProductNotFound):
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(UpdateProductErr),
+				err.Error(),
+			).Res()
+		case errors.Is(err, products.ErrInvalidPrice):
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(UpdateProductErr),
+				err.Error(),
+			).Res()
+		}
 		return entities.NewErrorResponse(c).Error(
 			fiber.ErrInternalServerError.Code,
 			string(UpdateProductErr),
@@ -183,11 +427,17 @@ func (h *productsHandle) UpdateProducts(c *fiber.Ctx) error {
 
 // ------------  Delete Product ---------------
 func (h *productsHandle) DeleteProduct(c *fiber.Ctx) error {
-	// 1. Delete local, 2. Delete From GCP
+	// ย้ายลงถังขยะ (soft delete)  ลบจริง + ลบรูปใน bucket ตอน purge หลังเกิน retention
 	productId := strings.Trim(c.Params("product_id"), " ")
 
-	product, err := h.productsUsecase.FindOneProduct(productId)
-	if err != nil {
+	if err := h.productsUsecase.DeleteProduct(productId); err != nil {
+		if errors.Is(err, products.ErrProductNotFound) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(deleteProductErr),
+				err.Error(),
+			).Res()
+		}
 		return entities.NewErrorResponse(c).Error(
 			fiber.ErrInternalServerError.Code,
 			string(deleteProductErr),
@@ -195,32 +445,318 @@ func (h *productsHandle) DeleteProduct(c *fiber.Ctx) error {
 		).Res()
 	}
 
-	// delete
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+// ------------  Restore Product ---------------
+// เอาออกจากถังขยะ  (status เดิมไม่เปลี่ยน)
+func (h *productsHandle) RestoreProduct(c *fiber.Ctx) error {
+	productId := strings.Trim(c.Params("product_id"), " ")
 
-	// --- Stack sql command
-	deleteFileReq := make([]*files.DeleteFileReq, 0)
-	for _, p := range product.Images {
-		deleteFileReq = append(deleteFileReq, &files.DeleteFileReq{
-			Destination: fmt.Sprintf("Images/test/%s", p.FileName),
-		})
+	product, err := h.productsUsecase.RestoreProduct(productId)
+	if err != nil {
+		if errors.Is(err, products.ErrProductNotFound) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(restoreProductErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(restoreProductErr),
+			err.Error(),
+		).Res()
 	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, product).Res()
+}
 
-	// Excute Delete GCP
-	if err := h.filesUsecases.DeleteFileGCP(deleteFileReq); err != nil {
+// ------------  Purge Trash ---------------
+// ลบจริงทันที  (ไม่ต้องรอ APP_TRASH_INTERVAL)  เฉพาะที่เกิน retention
+func (h *productsHandle) PurgeTrash(c *fiber.Ctx) error {
+	count, err := h.productsUsecase.PurgeTrash()
+	if err != nil {
 		return entities.NewErrorResponse(c).Error(
 			fiber.ErrInternalServerError.Code,
-			string(deleteProductErr),
+			string(purgeTrashErr),
 			err.Error(),
 		).Res()
 	}
-	// Excute Delete Database local
-	if err := h.productsUsecase.DeleteProduct(productId); err != nil {
+	return entities.NewErrorResponse(c).Success(
+		fiber.StatusOK,
+		&struct {
+			Purged int `json:"purged"`
+		}{
+			Purged: count,
+		},
+	).Res()
+}
+
+// ------------  Find Revisions ---------------
+// ประวัติการแก้ของ product  ใหม่สุดขึ้นก่อน
+func (h *productsHandle) FindRevisions(c *fiber.Ctx) error {
+	req := &products.RevisionFilter{
+		PaginationReq: &entities.PaginationReq{},
+	}
+	if err := c.QueryParser(req); err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findRevisionsErr),
+			err.Error(),
+		).Res()
+	}
+	req.ProductId = strings.Trim(c.Params("product_id"), " ")
+
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 5 {
+		req.Limit = 5
+	}
+
+	revisions, err := h.productsUsecase.FindRevisions(req)
+	if err != nil {
 		return entities.NewErrorResponse(c).Error(
 			fiber.ErrInternalServerError.Code,
-			string(deleteProductErr),
+			string(findRevisionsErr),
 			err.Error(),
 		).Res()
 	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, revisions).Res()
+}
 
-	return entities.NewErrorResponse(c).Success(fiber.StatusOK, nil).Res()
+// ------------  Rollback Revision ---------------
+// ย้อนกลับไปค่าก่อน revision  (category, รูป, variant ไม่ย้อน)
+func (h *productsHandle) RollbackRevision(c *fiber.Ctx) error {
+	productId := strings.Trim(c.Params("product_id"), " ")
+	revisionId, err := strconv.Atoi(strings.Trim(c.Params("revision_id"), " "))
+	if err != nil || revisionId <= 0 {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(rollbackErr),
+			"revision_id must be a number more than 0",
+		).Res()
+	}
+
+	product, err := h.productsUsecase.RollbackRevision(productId, revisionId, c.Locals("userId").(string))
+	if err != nil {
+		if errors.Is(err, products.ErrProductNotFound) || errors.Is(err, products.ErrRevisionNotFound) {
+			return entities.NewErrorResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(rollbackErr),
+				err.Error(),
+			).Res()
+		}
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(rollbackErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(fiber.StatusOK, product).Res()
+}
+
+// ------------  Reindex Search ---------------
+// ตัดคำไทยใหม่ทุก product  (หลัง migrate / แก้ dictionary)
+func (h *productsHandle) ReindexSearch(c *fiber.Ctx) error {
+	count, err := h.productsUsecase.ReindexSearch()
+	if err != nil {
+		return entities.NewErrorResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(reindexSearchErr),
+			err.Error(),
+		).Res()
+	}
+	return entities.NewErrorResponse(c).Success(
+		fiber.StatusOK,
+		&struct {
+			Reindexed int `json:"reindexed"`
+		}{
+			Reindexed: count,
+		},
+	).Res()
+}
+
+// ------------  helper ---------------
+// isAdmin ผ่าน JwtAuth มาแล้วเป็น admin (route /products/admin)  route public ไม่มี userRoleId
+func isAdmin(c *fiber.Ctx) bool {
+	roleId, ok := c.Locals("userRoleId").(int)
+	return ok && roleId == 2
+}
+
+// validateStatus status + ช่วงเวลา publish  (insert ไม่ส่ง status = draft)
+// scheduled ---> เก็บเป็น published + publish_at อนาคต
+func validateStatus(p *products.Product, insert bool) error {
+	p.Status = strings.ToLower(strings.TrimSpace(p.Status))
+	if p.Status == "" && insert {
+		p.Status = products.StatusDraft
+	}
+	if p.Status != "" && !products.Statuses[p.Status] {
+		return fmt.Errorf("status %q is invalid", p.Status)
+	}
+
+	publishAt, err := parseScheduleTime(p.PublishAt, "publish_at")
+	if err != nil {
+		return err
+	}
+	unpublishAt, err := parseScheduleTime(p.UnpublishAt, "unpublish_at")
+	if err != nil {
+		return err
+	}
+	if publishAt != nil && unpublishAt != nil && !unpublishAt.After(*publishAt) {
+		return fmt.Errorf("unpublish_at must be after publish_at")
+	}
+
+	if p.Status == products.StatusScheduled {
+		if publishAt == nil || !publishAt.After(time.Now()) {
+			return fmt.Errorf("scheduled status requires publish_at in the future")
+		}
+		p.Status = products.StatusPublished
+	}
+	return nil
+}
+
+// validatePrice currency ที่รองรับ (insert ไม่ส่ง = THB)  ราคา product / ราคาลด / variant ต้องเป็นจำนวนที่สกุลนั้นใช้ได้
+// update ไม่ส่ง currency  ตรวจแค่ช่วงของราคา (ไม่รู้สกุลเดิม)   ช่วงราคาลด sale_end_at ต้องหลัง sale_start_at
+func validatePrice(p *products.Product, insert bool) error {
+	if insert || p.Currency != "" {
+		p.Currency = money.NormalizeCurrency(p.Currency)
+	}
+	currency := p.Currency
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+
+	if err := money.Validate(p.Price, currency); err != nil {
+		return fmt.Errorf("price: %v", err)
+	}
+	if p.SalePrice != nil {
+		if err := money.Validate(*p.SalePrice, currency); err != nil {
+			return fmt.Errorf("sale_price: %v", err)
+		}
+		// update เทียบกับราคาใน database ที่ usecase
+		if insert && *p.SalePrice >= p.Price {
+			return fmt.Errorf("sale_price must be less than price")
+		}
+	}
+	for _, v := range p.Variants {
+		if v.Price == nil {
+			continue
+		}
+		if err := money.Validate(*v.Price, currency); err != nil {
+			return fmt.Errorf("price of variant %s: %v", v.Sku, err)
+		}
+	}
+
+	saleStart, err := parseScheduleTime(p.SaleStartAt, "sale_start_at")
+	if err != nil {
+		return err
+	}
+	saleEnd, err := parseScheduleTime(p.SaleEndAt, "sale_end_at")
+	if err != nil {
+		return err
+	}
+	if saleStart != nil && saleEnd != nil && !saleEnd.After(*saleStart) {
+		return fmt.Errorf("sale_end_at must be after sale_start_at")
+	}
+	return nil
+}
+
+// parseScheduleTime RFC3339  nil, "" = ไม่ได้ตั้ง
+func parseScheduleTime(t *string, field string) (*time.Time, error) {
+	if t == nil {
+		return nil, nil
+	}
+	*t = strings.TrimSpace(*t)
+	if *t == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, *t)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be RFC3339 (2006-01-02T15:04:05+07:00)", field)
+	}
+	*t = parsed.Format(time.RFC3339)
+	return &parsed, nil
+}
+
+// validateCategories id ของ category ต้องมากกว่า 0
+func validateCategories(categories []*appinfo.Category) error {
+	for _, c := range categories {
+		if c == nil || c.Id <= 0 {
+			return fmt.Errorf("category id is invalid")
+		}
+	}
+	return nil
+}
+
+// validateVariants sku ห้ามว่าง/ซ้ำกันใน req, ราคา และ stock ห้ามติดลบ
+func validateVariants(variants []*products.Variant) error {
+	skus := make(map[string]bool)
+	for _, v := range variants {
+		v.Sku = strings.TrimSpace(v.Sku)
+		if v.Sku == "" {
+			return fmt.Errorf("variant sku is required")
+		}
+		if skus[v.Sku] {
+			return fmt.Errorf("variant sku %s is duplicated", v.Sku)
+		}
+		skus[v.Sku] = true
+
+		if v.Price != nil && *v.Price < 0 {
+			return fmt.Errorf("price of variant %s must not be negative", v.Sku)
+		}
+		if v.Stock < 0 {
+			return fmt.Errorf("stock of variant %s must not be negative", v.Sku)
+		}
+	}
+	return nil
+}
+
+// parseAttributes  key:value1,value2  ---> key ---> values  (key ซ้ำ = รวมค่า)
+func parseAttributes(raws []string) (map[string][]string, error) {
+	attributes := make(map[string][]string)
+	for _, raw := range raws {
+		key, values, ok := strings.Cut(raw, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("attr %q is invalid, use key:value", raw)
+		}
+		for _, value := range strings.Split(values, ",") {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				return nil, fmt.Errorf("attr %q is invalid, use key:value", raw)
+			}
+			attributes[key] = append(attributes[key], value)
+		}
+	}
+	return attributes, nil
+}
+
+// parsePriceEdges ขอบช่วงราคา  เรียง ไม่ซ้ำ เริ่มที่ 0 เสมอ  (ไม่ส่ง = nil ใช้ค่าเริ่มต้น)
+func parsePriceEdges(raws []string) ([]money.Amount, error) {
+	edges := make([]money.Amount, 0)
+	seen := make(map[money.Amount]bool)
+	for _, raw := range raws {
+		for _, s := range strings.Split(raw, ",") {
+			edge, err := money.Parse(s)
+			if err != nil || edge < 0 {
+				return nil, fmt.Errorf("price_buckets %q is invalid", s)
+			}
+			if !seen[edge] {
+				seen[edge] = true
+				edges = append(edges, edge)
+			}
+		}
+	}
+	if len(edges) == 0 {
+		return nil, nil
+	}
+	if len(edges) > 20 {
+		return nil, fmt.Errorf("price_buckets must not exceed 20 edges")
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i] < edges[j] })
+	if edges[0] > 0 {
+		edges = append([]money.Amount{0}, edges...)
+	}
+	return edges, nil
 }
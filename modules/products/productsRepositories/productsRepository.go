@@ -2,24 +2,40 @@ package productsRepositories
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/PHURINTOR/phurinshop/config"
 	"github.com/PHURINTOR/phurinshop/modules/entities"
 	"github.com/PHURINTOR/phurinshop/modules/files/filesUsecases"
 	"github.com/PHURINTOR/phurinshop/modules/products"
 	"github.com/PHURINTOR/phurinshop/modules/products/productPatterns"
+	"github.com/PHURINTOR/phurinshop/pkg/search"
 	"github.com/jmoiron/sqlx"
 )
 
 // ======================================= Interface =========================================
 type IProductsRepository interface {
 	FindOneProduct(productId string) (*products.Product, error)
-	FindProducts(req *products.ProductFilter) ([]*products.Product, int)
+	FindProducts(req *products.ProductFilter) ([]*products.Product, int, *entities.CursorRes)
+	FindProductFacets(req *products.ProductFilter) *products.ProductFacets
 	InsertProducts(req *products.Product) (*products.Product, error)
 	UpdateProduct(req *products.Product) (*products.Product, error)
 	DeleteProduct(productId string) error
+	RestoreProduct(productId string) error
+	PurgeProducts() (int, error)
+	FindRevisions(req *products.RevisionFilter) ([]*products.Revision, int, error)
+	RollbackRevision(productId string, revisionId int, userId string) (*products.Product, error)
+	ImportProducts(req *products.ImportReq) *products.ImportResult
+	ClearSale(productId, userId string) (*products.Product, error)
+	FindPriceSchedules(productId string) ([]*products.PriceSchedule, error)
+	InsertPriceSchedule(req *products.PriceSchedule) (*products.PriceSchedule, error)
+	DeletePriceSchedule(productId string, scheduleId int) error
+	ApplyPriceSchedules() (int, error)
+	ReindexSearch() (int, error)
 }
 
 // ======================================= Struct ============================================
@@ -44,7 +60,7 @@ func ProductsRepository(db *sqlx.DB, cfg config.IConfig, fileUsecases filesUseca
 // ** *COALESCE เช็คค่าว่าง
 func (r *productsRepository) FindOneProduct(productId string) (*products.Product, error) {
 	fmt.Println(productId)
-	query := `
+	query := fmt.Sprintf(`
 	SELECT
 		to_jsonb("t")
 	FROM (
@@ -53,18 +69,18 @@ func (r *productsRepository) FindOneProduct(productId string) (*products.Product
 			"p"."title",
 			"p"."description",
 			"p"."price",
-			(
-				SELECT
-					to_jsonb("ct")
-				FROM (
-					SELECT
-						"c"."id",
-						"c"."title"
-					FROM "categories" "c"
-						LEFT JOIN "products_categories" "pc" ON "pc"."category_id" = "c"."id"
-					WHERE "pc"."product_id" = "p"."id"
-				) AS "ct"
-			) AS "category",
+			"p"."currency",
+			"p"."sale_price",
+			"p"."sale_start_at",
+			"p"."sale_end_at",
+			%s AS "effective_price",
+			"p"."stock",
+			"p"."reserved",
+			"p"."track_inventory",
+			%s AS "status",
+			"p"."publish_at",
+			"p"."unpublish_at",
+			%s AS "categories",
 			"p"."created_at",
 			"p"."updated_at",
 			(
@@ -74,24 +90,32 @@ func (r *productsRepository) FindOneProduct(productId string) (*products.Product
 					SELECT
 						"i"."id",
 						"i"."filename",
-						"i"."url"
+						"i"."url",
+						"i"."variants"
 					FROM "images" "i"
 					WHERE "i"."product_id" = "p"."id"
+						AND "i"."variant_id" IS NULL
 				) AS "it"
-			) AS "images"
+			) AS "images",
+			%s AS "variants"
 		FROM "products" "p"
 		WHERE "p"."id" = $1
+			AND "p"."deleted_at" IS NULL
 		LIMIT 1
-	) AS "t";`
+	) AS "t";`, productPatterns.EffectivePriceQuery(`"p"`), productPatterns.StatusQuery(`"p"`), productPatterns.CategoriesQuery(`"p"."id"`), productPatterns.VariantsQuery(`"p"."id"`))
 
 	// inital const
 	productBytes := make([]byte, 0)
 	product := &products.Product{
-		Images: make([]*entities.Images, 0),
+		Images:   make([]*entities.Images, 0),
+		Variants: make([]*products.Variant, 0),
 	}
 
 	// query product
 	if err := r.db.Get(&productBytes, query, productId); err != nil { //retrun bytes type
+		if errors.Is(err, sql.ErrNoRows) { // ไม่มี / อยู่ในถังขยะ
+			return nil, fmt.Errorf("%w: %s", products.ErrProductNotFound, productId)
+		}
 		return nil, fmt.Errorf("get Product failed: %v", err)
 	}
 
@@ -104,14 +128,30 @@ func (r *productsRepository) FindOneProduct(productId string) (*products.Product
 
 // ------------------------------- Find Product
 
-func (r *productsRepository) FindProducts(req *products.ProductFilter) ([]*products.Product, int) {
+// keyset (req.Keyset) ไม่ COUNT  ได้ cursor แทน
+func (r *productsRepository) FindProducts(req *products.ProductFilter) ([]*products.Product, int, *entities.CursorRes) {
 	builder := productPatterns.FindProductBuilder(r.db, req)
 	engineer := productPatterns.FindProductEngineer(builder)
 
 	result := engineer.FindProduct().Result()
+	if req.Keyset != nil {
+		return result, 0, builder.Cursors()
+	}
 	count := engineer.CountProduct().Count()
 
-	return result, count
+	return result, count, nil
+}
+
+// ------------------------------- Facets
+// builder แยกต่อ facet  เพราะแต่ละ facet ตัด filter ของตัวเองออก
+func (r *productsRepository) FindProductFacets(req *products.ProductFilter) *products.ProductFacets {
+	categories := productPatterns.FindProductEngineer(productPatterns.FindProductBuilder(r.db, req)).FindCategoryFacets().CategoryFacets()
+	prices := productPatterns.FindProductEngineer(productPatterns.FindProductBuilder(r.db, req)).FindPriceFacets().PriceFacets()
+
+	return &products.ProductFacets{
+		Categories: categories,
+		Prices:     prices,
+	}
 }
 
 // ------------------------------- Insert Product
@@ -150,14 +190,375 @@ func (r *productsRepository) UpdateProduct(req *products.Product) (*products.Pro
 }
 
 // ------------------------------- Delete Product
+// soft delete  ย้ายไปถังขยะ  รูป / category / variant ยังอยู่ครบ กู้คืนได้จนกว่า PurgeProducts จะลบจริง
 func (r *productsRepository) DeleteProduct(productId string) error {
-	// Delete 2 ส่วน 1. Database local 2. GCP buket (Handler)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
 
-	// 1. local delete  ----> Repository
-	//
-	query := `DELETE FROM "products" WHERE "id" = $1;`
-	if _, err := r.db.ExecContext(context.Background(), query, productId); err != nil {
+	result, err := r.db.ExecContext(ctx, `
+	UPDATE "products" SET
+		"deleted_at" = now()
+	WHERE "id" = $1
+		AND "deleted_at" IS NULL;`, productId)
+	if err != nil {
 		return fmt.Errorf("delete product failed: %v", err)
 	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("%w: %s", products.ErrProductNotFound, productId)
+	}
+	return nil
+}
+
+// ------------------------------- Restore Product
+// เอาออกจากถังขยะ
+func (r *productsRepository) RestoreProduct(productId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+	UPDATE "products" SET
+		"deleted_at" = NULL
+	WHERE "id" = $1
+		AND "deleted_at" IS NOT NULL;`, productId)
+	if err != nil {
+		return fmt.Errorf("restore product failed: %v", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("%w in trash: %s", products.ErrProductNotFound, productId)
+	}
+	return nil
+}
+
+// ------------------------------- Find Revisions
+// ประวัติการแก้ของ product  ใหม่สุดขึ้นก่อน
+func (r *productsRepository) FindRevisions(req *products.RevisionFilter) ([]*products.Revision, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	revisions := make([]*products.Revision, 0)
+	if err := r.db.SelectContext(ctx, &revisions, `
+	SELECT
+		"id",
+		"product_id",
+		"user_id",
+		"action",
+		"rollback_of",
+		"before",
+		"after",
+		"created_at"
+	FROM "product_revisions"
+	WHERE "product_id" = $1
+	ORDER BY "id" DESC
+	OFFSET $2 LIMIT $3;`, req.ProductId, (req.Page-1)*req.Limit, req.Limit); err != nil {
+		return nil, 0, fmt.Errorf("select product revisions failed: %v", err)
+	}
+
+	var count int
+	if err := r.db.GetContext(ctx, &count, `
+	SELECT
+		COUNT(*) AS "count"
+	FROM "product_revisions"
+	WHERE "product_id" = $1;`, req.ProductId); err != nil {
+		return nil, 0, fmt.Errorf("count product revisions failed: %v", err)
+	}
+	return revisions, count, nil
+}
+
+// ------------------------------- Rollback Revision
+// ย้อน title, description, price, currency, sale_*, status, publish_at, unpublish_at กลับเป็นค่าก่อน revision นั้น  (เก็บเป็น revision ใหม่)
+func (r *productsRepository) RollbackRevision(productId string, revisionId int, userId string) (*products.Product, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := productPatterns.RollbackRevision(ctx, tx, productId, revisionId, userId); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.FindOneProduct(productId)
+}
+
+// ------------------------------- Import Products
+// upsert จากไฟล์  batch ละ transaction  error รายแถวอยู่ใน result
+func (r *productsRepository) ImportProducts(req *products.ImportReq) *products.ImportResult {
+	return productPatterns.ImportProducts(r.db, r.filesUsecases, req)
+}
+
+// ------------------------------- Clear Sale
+// ล้างราคาลด  กลับไปขายราคาปกติ (เก็บเป็น revision)
+func (r *productsRepository) ClearSale(productId, userId string) (*products.Product, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := productPatterns.ClearSale(ctx, tx, productId, userId); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.FindOneProduct(productId)
+}
+
+// ------------------------------- Price Schedules
+// ทุก schedule ของ product  ยังไม่ถึงเวลาขึ้นก่อน แล้วเรียงตาม apply_at
+func (r *productsRepository) FindPriceSchedules(productId string) ([]*products.PriceSchedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	schedules := make([]*products.PriceSchedule, 0)
+	if err := r.db.SelectContext(ctx, &schedules, `
+	SELECT
+		"id",
+		"product_id",
+		"price",
+		"apply_at",
+		"applied_at",
+		"user_id",
+		"created_at"
+	FROM "product_price_schedules"
+	WHERE "product_id" = $1
+	ORDER BY "applied_at" IS NOT NULL, "apply_at", "id";`, productId); err != nil {
+		return nil, fmt.Errorf("select price schedules failed: %v", err)
+	}
+	return schedules, nil
+}
+
+// InsertPriceSchedule ตั้งราคาล่วงหน้า  product ต้องไม่อยู่ในถังขยะ
+func (r *productsRepository) InsertPriceSchedule(req *products.PriceSchedule) (*products.PriceSchedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	schedule := new(products.PriceSchedule)
+	if err := r.db.GetContext(ctx, schedule, `
+	INSERT INTO "product_price_schedules" (
+		"product_id",
+		"price",
+		"apply_at",
+		"user_id"
+	)
+	SELECT
+		"p"."id",
+		$2,
+		$3::TIMESTAMPTZ,
+		$4
+	FROM "products" "p"
+	WHERE "p"."id" = $1
+		AND "p"."deleted_at" IS NULL
+	RETURNING
+		"id",
+		"product_id",
+		"price",
+		"apply_at",
+		"applied_at",
+		"user_id",
+		"created_at";`, req.ProductId, req.Price, req.ApplyAt, req.UserId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", products.ErrProductNotFound, req.ProductId)
+		}
+		return nil, fmt.Errorf("insert price schedule failed: %v", err)
+	}
+	return schedule, nil
+}
+
+// DeletePriceSchedule ยกเลิก schedule ที่ยังไม่ถึงเวลา  (ที่ตั้งราคาไปแล้วเป็นประวัติ ลบไม่ได้)
+func (r *productsRepository) DeletePriceSchedule(productId string, scheduleId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+	DELETE FROM "product_price_schedules"
+	WHERE "id" = $1
+		AND "product_id" = $2
+		AND "applied_at" IS NULL;`, scheduleId, productId)
+	if err != nil {
+		return fmt.Errorf("delete price schedule failed: %v", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("%w: %d", products.ErrScheduleNotFound, scheduleId)
+	}
 	return nil
 }
+
+// ApplyPriceSchedules ตั้งราคาตาม schedule ที่ถึงเวลาแล้ว  ทีละ 100 รายการต่อ transaction
+func (r *productsRepository) ApplyPriceSchedules() (int, error) {
+	var count int
+	for {
+		applied, err := r.applyPriceSchedules(100)
+		count += applied
+		if err != nil {
+			return count, err
+		}
+		if applied < 100 {
+			return count, nil
+		}
+	}
+}
+
+func (r *productsRepository) applyPriceSchedules(limit int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	schedules, err := productPatterns.DuePriceSchedules(ctx, tx, limit)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if len(schedules) == 0 {
+		tx.Rollback()
+		return 0, nil
+	}
+	for _, schedule := range schedules {
+		if err := productPatterns.ApplyPriceSchedule(ctx, tx, schedule); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(schedules), nil
+}
+
+// ------------------------------- Purge Products
+// ลบจริง product ที่อยู่ในถังขยะเกิน APP_TRASH_RETENTION  ทีละ 100 ตัว
+// ลบ product กับ event "ลบรูปใน bucket" ใน transaction เดียวกัน  outbox worker ลบรูปให้หลัง commit (retry จนสำเร็จ)
+func (r *productsRepository) PurgeProducts() (int, error) {
+	var count int
+	for {
+		purged, err := r.purgeProducts(r.cfg.App().TrashRetention(), 100)
+		count += purged
+		if err != nil {
+			return count, err
+		}
+		if purged < 100 {
+			return count, nil
+		}
+	}
+}
+
+func (r *productsRepository) purgeProducts(retention time.Duration, limit int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	// 1. product ที่หมดเวลา  (SKIP LOCKED = job 2 ตัวไม่ทับกัน, กำลังกู้คืนอยู่ก็ข้ามไป)
+	productIds := make([]string, 0)
+	if err := tx.SelectContext(ctx, &productIds, `
+	SELECT
+		"id"
+	FROM "products"
+	WHERE "deleted_at" < now() - make_interval(secs => $1)
+	ORDER BY "deleted_at"
+	LIMIT $2
+	FOR UPDATE SKIP LOCKED;`, retention.Seconds(), limit); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("get deleted products failed: %v", err)
+	}
+	if len(productIds) == 0 {
+		tx.Rollback()
+		return 0, nil
+	}
+
+	// 2. รูปของ product + variant  (images ลบตาม product ด้วย ON DELETE CASCADE)
+	images := make([]*entities.Images, 0)
+	if err := tx.SelectContext(ctx, &images, `
+	SELECT
+		"id",
+		"filename",
+		"url",
+		"variants"
+	FROM "images"
+	WHERE "product_id" = ANY($1::VARCHAR[])
+	FOR UPDATE;`, productIds); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("get images failed: %v", err)
+	}
+
+	// 3. outbox event
+	if err := r.filesUsecases.DeleteFileLater(tx, productPatterns.DeleteImagesReq(images)); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	// 4. local delete
+	if _, err := tx.ExecContext(ctx, `DELETE FROM "products" WHERE "id" = ANY($1::VARCHAR[]);`, productIds); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("purge products failed: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(productIds), nil
+}
+
+// ------------------------------- Reindex Search
+// ตัดคำไทยของ title, description ใหม่ทุก product (product เก่าก่อนมี search / dictionary เปลี่ยน)  ทีละ 500 ตัว
+func (r *productsRepository) ReindexSearch() (int, error) {
+	type productText struct {
+		Id          string `db:"id"`
+		Title       string `db:"title"`
+		Description string `db:"description"`
+	}
+
+	var lastId string
+	var count int
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		batch := make([]*productText, 0)
+		if err := r.db.SelectContext(ctx, &batch, `
+		SELECT
+			"id",
+			"title",
+			"description"
+		FROM "products"
+		WHERE "id" > $1
+		ORDER BY "id"
+		LIMIT 500;`, lastId); err != nil {
+			cancel()
+			return count, fmt.Errorf("get products failed: %v", err)
+		}
+
+		for _, p := range batch {
+			if _, err := r.db.ExecContext(ctx, `
+			UPDATE "products" SET
+				"title_tokens" = $1,
+				"description_tokens" = $2
+			WHERE "id" = $3;`,
+				search.ThaiTokens(p.Title),
+				search.ThaiTokens(p.Description),
+				p.Id,
+			); err != nil {
+				cancel()
+				return count, fmt.Errorf("reindex product %s failed: %v", p.Id, err)
+			}
+			count++
+			lastId = p.Id
+		}
+		cancel()
+
+		if len(batch) < 500 {
+			return count, nil
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package productsUsecases
 
 import (
+	"fmt"
+	"log"
 	"math"
+	"time"
 
 	"github.com/PHURINTOR/phurinshop/modules/entities"
 	"github.com/PHURINTOR/phurinshop/modules/products"
 	productsrepositories "github.com/PHURINTOR/phurinshop/modules/products/productsRepositories"
+	"github.com/PHURINTOR/phurinshop/pkg/money"
 )
 
 // ======================================= Interface =========================================
@@ -15,6 +19,18 @@ type IProductsUsecase interface {
 	AddProducts(req *products.Product) (*products.Product, error)
 	UpdateProduct(req *products.Product) (*products.Product, error)
 	DeleteProduct(productId string) error
+	RestoreProduct(productId string) (*products.Product, error)
+	PurgeTrash() (int, error)
+	FindRevisions(req *products.RevisionFilter) (*entities.PaginateRes, error)
+	RollbackRevision(productId string, revisionId int, userId string) (*products.Product, error)
+	ImportProducts(req *products.ImportReq) *products.ImportResult
+	ExportProducts(req *products.ProductFilter, write func([]*products.Product) error) error
+	ClearSale(productId, userId string) (*products.Product, error)
+	FindPriceSchedules(productId string) ([]*products.PriceSchedule, error)
+	AddPriceSchedule(req *products.PriceSchedule) (*products.PriceSchedule, error)
+	DeletePriceSchedule(productId string, scheduleId int) error
+	ApplyPriceSchedules() (int, error)
+	ReindexSearch() (int, error)
 }
 
 // ======================================= Struct ============================================
@@ -41,7 +57,19 @@ func (u *productsUsecase) FindOneProduct(productId string) (*products.Product, e
 
 // ------------  FindProducts ---------------
 func (u *productsUsecase) FindProducts(req *products.ProductFilter) *entities.PaginateRes {
-	products, count := u.productsRepository.FindProducts(req)
+	products, count, cursors := u.productsRepository.FindProducts(req)
+	facets := u.productsRepository.FindProductFacets(req)
+
+	// keyset  ไม่มี page / total
+	if cursors != nil {
+		return &entities.PaginateRes{
+			Data:       products,
+			Limit:      req.Limit,
+			Facets:     facets,
+			NextCursor: cursors.Next,
+			PrevCursor: cursors.Prev,
+		}
+	}
 
 	return &entities.PaginateRes{
 		Data:      products,
@@ -49,6 +77,7 @@ func (u *productsUsecase) FindProducts(req *products.ProductFilter) *entities.Pa
 		Limit:     req.Limit,
 		TotalItem: count,
 		TotalPage: int(math.Ceil(float64(count) / float64(req.Limit))), //หาญปัดเศษ = จำนวนทั้งหมด(count) / จำนวน limit
+		Facets:    facets,
 	}
 }
 
@@ -62,7 +91,18 @@ func (u *productsUsecase) AddProducts(req *products.Product) (*products.Product,
 }
 
 // ------------  UpdateProduct ---------------
+// แก้ราคา / sale บางช่อง  ตรวจกับค่าที่จะได้หลังแก้ (ค่าเดิมใน database + ที่ส่งมา)  ไม่ให้ไปตกที่ check ของ database เป็น 500
 func (u *productsUsecase) UpdateProduct(req *products.Product) (*products.Product, error) {
+	if req.Price > 0 || req.Currency != "" || req.SalePrice != nil || req.SaleStartAt != nil || req.SaleEndAt != nil {
+		current, err := u.productsRepository.FindOneProduct(req.Id)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateSale(current, req); err != nil {
+			return nil, fmt.Errorf("%w: %v", products.ErrInvalidPrice, err)
+		}
+	}
+
 	products, err := u.productsRepository.UpdateProduct(req)
 	if err != nil {
 		return nil, err
@@ -77,3 +117,207 @@ func (u *productsUsecase) DeleteProduct(productId string) error {
 	}
 	return nil
 }
+
+// ------------  RestoreProduct ---------------
+func (u *productsUsecase) RestoreProduct(productId string) (*products.Product, error) {
+	if err := u.productsRepository.RestoreProduct(productId); err != nil {
+		return nil, err
+	}
+	return u.productsRepository.FindOneProduct(productId)
+}
+
+// ------------  PurgeTrash ---------------
+// ลบจริง product ในถังขยะที่เกิน retention
+func (u *productsUsecase) PurgeTrash() (int, error) {
+	return u.productsRepository.PurgeProducts()
+}
+
+// ------------  FindRevisions ---------------
+func (u *productsUsecase) FindRevisions(req *products.RevisionFilter) (*entities.PaginateRes, error) {
+	revisions, count, err := u.productsRepository.FindRevisions(req)
+	if err != nil {
+		return nil, err
+	}
+	return &entities.PaginateRes{
+		Data:      revisions,
+		Page:      req.Page,
+		Limit:     req.Limit,
+		TotalItem: count,
+		TotalPage: int(math.Ceil(float64(count) / float64(req.Limit))),
+	}, nil
+}
+
+// ------------  RollbackRevision ---------------
+func (u *productsUsecase) RollbackRevision(productId string, revisionId int, userId string) (*products.Product, error) {
+	return u.productsRepository.RollbackRevision(productId, revisionId, userId)
+}
+
+// ------------  ImportProducts ---------------
+func (u *productsUsecase) ImportProducts(req *products.ImportReq) *products.ImportResult {
+	return u.productsRepository.ImportProducts(req)
+}
+
+// ------------  ExportProducts ---------------
+// ทุก product ที่ตรง filter  ดึงทีละ 500 ตัวด้วย keyset (ไม่ต้อง count)  ส่งให้ write ทีละหน้า ไม่เก็บทั้ง catalog ไว้ใน memory
+func (u *productsUsecase) ExportProducts(req *products.ProductFilter, write func([]*products.Product) error) error {
+	req.Limit = 500
+	req.Keyset = new(entities.Cursor)
+
+	for {
+		data, _, cursors := u.productsRepository.FindProducts(req)
+		if err := write(data); err != nil {
+			return err
+		}
+		if cursors == nil || cursors.Next == "" {
+			return nil
+		}
+		cursor, err := entities.DecodeCursor(cursors.Next)
+		if err != nil {
+			return fmt.Errorf("export next page failed: %v", err)
+		}
+		req.Keyset = cursor
+	}
+}
+
+// ------------  ClearSale ---------------
+func (u *productsUsecase) ClearSale(productId, userId string) (*products.Product, error) {
+	return u.productsRepository.ClearSale(productId, userId)
+}
+
+// ------------  Price Schedules ---------------
+func (u *productsUsecase) FindPriceSchedules(productId string) ([]*products.PriceSchedule, error) {
+	return u.productsRepository.FindPriceSchedules(productId)
+}
+
+// AddPriceSchedule ราคาต้องใช้ทศนิยมได้ตามสกุลเงินของ product และสูงกว่า sale_price ที่ตั้งไว้
+// sale ที่ตั้งทีหลังจนราคาชนกัน job จัดการตอนถึงเวลา (ล้าง sale)
+func (u *productsUsecase) AddPriceSchedule(req *products.PriceSchedule) (*products.PriceSchedule, error) {
+	product, err := u.productsRepository.FindOneProduct(req.ProductId)
+	if err != nil {
+		return nil, err
+	}
+	if err := money.Validate(req.Price, product.Currency); err != nil {
+		return nil, fmt.Errorf("%w: price: %v", products.ErrInvalidPrice, err)
+	}
+	if product.SalePrice != nil && req.Price <= *product.SalePrice {
+		return nil, fmt.Errorf("%w: price must be more than sale_price %s", products.ErrInvalidPrice, product.SalePrice.String())
+	}
+	return u.productsRepository.InsertPriceSchedule(req)
+}
+
+func (u *productsUsecase) DeletePriceSchedule(productId string, scheduleId int) error {
+	return u.productsRepository.DeletePriceSchedule(productId, scheduleId)
+}
+
+// ApplyPriceSchedules ตั้งราคาตาม schedule ที่ถึงเวลาแล้ว
+func (u *productsUsecase) ApplyPriceSchedules() (int, error) {
+	return u.productsRepository.ApplyPriceSchedules()
+}
+
+// ------------  ReindexSearch ---------------
+func (u *productsUsecase) ReindexSearch() (int, error) {
+	return u.productsRepository.ReindexSearch()
+}
+
+// StartTrashPurger ลบ product ในถังขยะที่เกิน retention ทุก APP_TRASH_INTERVAL
+func StartTrashPurger(usecase IProductsUsecase, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			count, err := usecase.PurgeTrash()
+			if err != nil {
+				log.Printf("purge products trash failed: %v\n", err)
+				continue
+			}
+			if count > 0 {
+				log.Printf("purge products trash: %d\n", count)
+			}
+		}
+	}()
+}
+
+// StartPriceScheduler ตั้งราคาตาม product_price_schedules ทุก APP_PRICE_INTERVAL
+func StartPriceScheduler(usecase IProductsUsecase, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			count, err := usecase.ApplyPriceSchedules()
+			if err != nil {
+				log.Printf("apply price schedules failed: %v\n", err)
+				continue
+			}
+			if count > 0 {
+				log.Printf("apply price schedules: %d\n", count)
+			}
+		}
+	}()
+}
+
+// ======================================= Helper =======================================
+// validateSale ราคา / sale หลังแก้ = ที่ส่งมาทับค่าเดิม  (price 0, currency "", sale_price nil = ใช้ค่าเดิม)
+// sale_price ต้องน้อยกว่า price (price = ราคาเต็มที่ขีดฆ่า)  sale_end_at ต้องหลัง sale_start_at แม้ส่งมาแค่ช่องเดียว
+func validateSale(current, req *products.Product) error {
+	price := current.Price
+	if req.Price > 0 {
+		price = req.Price
+	}
+	currency := current.Currency
+	if req.Currency != "" {
+		currency = req.Currency
+	}
+	if err := money.Validate(price, currency); err != nil {
+		return fmt.Errorf("price: %v", err)
+	}
+
+	salePrice := current.SalePrice
+	if req.SalePrice != nil {
+		salePrice = req.SalePrice
+	}
+	if salePrice != nil {
+		if err := money.Validate(*salePrice, currency); err != nil {
+			return fmt.Errorf("sale_price: %v", err)
+		}
+		if *salePrice >= price {
+			return fmt.Errorf("sale_price must be less than price")
+		}
+	}
+
+	start, err := saleTime(current.SaleStartAt, req.SaleStartAt)
+	if err != nil {
+		return fmt.Errorf("sale_start_at: %v", err)
+	}
+	end, err := saleTime(current.SaleEndAt, req.SaleEndAt)
+	if err != nil {
+		return fmt.Errorf("sale_end_at: %v", err)
+	}
+	if start != nil && end != nil && !end.After(*start) {
+		return fmt.Errorf("sale_end_at must be after sale_start_at")
+	}
+	return nil
+}
+
+// saleTime เวลาหลังแก้  req nil = ค่าเดิม, "" = ล้าง
+func saleTime(current, req *string) (*time.Time, error) {
+	value := current
+	if req != nil {
+		value = req
+	}
+	if value == nil || *value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, *value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
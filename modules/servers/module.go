@@ -1,11 +1,19 @@
 package servers
 
 import (
+	"log"
+	"strings"
+
 	"github.com/PHURINTOR/phurinshop/modules/appinfo/appinfoHandlers"
 	"github.com/PHURINTOR/phurinshop/modules/appinfo/appinfoRepositories"
 	"github.com/PHURINTOR/phurinshop/modules/appinfo/appinfoUsecases"
 	"github.com/PHURINTOR/phurinshop/modules/files/filesHandlers"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesRepositories"
+	"github.com/PHURINTOR/phurinshop/modules/files/filesStorages"
 	"github.com/PHURINTOR/phurinshop/modules/files/filesUsecases"
+	"github.com/PHURINTOR/phurinshop/modules/inventory/inventoryHandlers"
+	"github.com/PHURINTOR/phurinshop/modules/inventory/inventoryRepositories"
+	"github.com/PHURINTOR/phurinshop/modules/inventory/inventoryUsecases"
 	"github.com/PHURINTOR/phurinshop/modules/middlewares/middlewareUsecases"
 	"github.com/PHURINTOR/phurinshop/modules/middlewares/middlewaresHandlers"
 	"github.com/PHURINTOR/phurinshop/modules/middlewares/middlewaresRepositories"
@@ -31,6 +39,7 @@ type IModuleFactory interface {
 	FilesModule()
 	ProductsModule()
 	OdersModule()
+	InventoryModule()
 }
 
 //struct
@@ -98,7 +107,7 @@ func (m *moduleFactory) UsersModule() {
 func (m *moduleFactory) AppinfoModule() {
 
 	repository := appinfoRepositories.AppinfoRepository(m.server.db)
-	usecase := appinfoUsecases.AppinfoUsecase(repository)
+	usecase := appinfoUsecases.AppinfoUsecase(m.server.cfg, repository)
 	handler := appinfoHandlers.AppinfoHandler(m.server.cfg, usecase)
 	router := m.router.Group("/appinfo")
 
@@ -114,13 +123,28 @@ func (m *moduleFactory) AppinfoModule() {
 	//Delete Category
 	router.Delete("/:category_id/categories", m.mid.JwtAuth(), m.mid.Authorize(2), handler.RemoveCategory)
 
+	//Rename Category
+	router.Patch("/:category_id/categories", m.mid.JwtAuth(), m.mid.Authorize(2), handler.UpdateCategory)
+
+	//Move / Reorder Category  (parent_id, position)
+	router.Patch("/:category_id/categories/move", m.mid.JwtAuth(), m.mid.Authorize(2), handler.MoveCategory)
+
+	//Trash Category  (ลบจริงเมื่อเกิน APP_TRASH_RETENTION  รันเองทุก APP_TRASH_INTERVAL)
+	router.Get("/categories/trash", m.mid.JwtAuth(), m.mid.Authorize(2), handler.FindTrashCategory)
+	router.Post("/categories/trash/purge", m.mid.JwtAuth(), m.mid.Authorize(2), handler.PurgeTrash)
+	appinfoUsecases.StartTrashPurger(usecase, m.server.cfg.App().TrashInterval())
+
+	//Restore Category
+	router.Patch("/:category_id/categories/restore", m.mid.JwtAuth(), m.mid.Authorize(2), handler.RestoreCategory)
+
 }
 
 // ============================================================ FilesModule ===========================================
 // ============================  /v1/Files/ =================================
 func (m *moduleFactory) FilesModule() {
 
-	usecase := filesUsecases.FilesUsecase(m.server.cfg)
+	repository := filesRepositories.FilesRepository(m.server.db)
+	usecase := filesUsecases.FilesUsecase(m.server.cfg, repository)
 	handler := filesHandlers.FilesHandler(m.server.cfg, usecase)
 	router := m.router.Group("/files")
 
@@ -132,11 +156,55 @@ func (m *moduleFactory) FilesModule() {
 
 	// *** เหตุผลที่ใช้ Patch เพราะสามารถเพิ่ม Body เข้าไปได้
 
+	// Signed Url  client PUT/GET ไฟล์ตรงกับ bucket  ไม่กิน bandwidth ของ api server
+	router.Post("/signed-url/upload", m.mid.JwtAuth(), m.mid.Authorize(2), handler.SignUploadUrl)
+	router.Get("/signed-url/download", m.mid.JwtAuth(), m.mid.Authorize(2), handler.SignDownloadUrl)
+	router.Post("/signed-url/confirm", m.mid.JwtAuth(), m.mid.Authorize(2), handler.ConfirmUpload)
+
+	// Resumable Upload (tus 1.0)  ไฟล์ใหญ่ส่งทีละ chunk  หลุดกลางทางก็ส่งต่อจาก offset เดิมได้
+	tusUsecase := filesUsecases.TusUsecase(m.server.cfg, usecase)
+	tusHandler := filesHandlers.TusHandler(m.server.cfg, tusUsecase)
+	tus := router.Group("/tus")
+
+	tus.Options("/", tusHandler.Options)
+	tus.Options("/:upload_id", tusHandler.Options)
+	tus.Post("/", m.mid.JwtAuth(), m.mid.Authorize(2), tusHandler.CheckVersion, tusHandler.CreateUpload)
+	tus.Head("/:upload_id", m.mid.JwtAuth(), m.mid.Authorize(2), tusHandler.CheckVersion, tusHandler.HeadUpload)
+	tus.Patch("/:upload_id", m.mid.JwtAuth(), m.mid.Authorize(2), tusHandler.CheckVersion, tusHandler.PatchUpload)
+	tus.Delete("/:upload_id", m.mid.JwtAuth(), m.mid.Authorize(2), tusHandler.CheckVersion, tusHandler.DeleteUpload)
+	// ผลของ upload (url ไฟล์)
+	tus.Get("/:upload_id", m.mid.JwtAuth(), m.mid.Authorize(2), tusHandler.FindUpload)
+
+	// Local storage driver = เสิร์ฟไฟล์จาก disk ผ่าน static route  (/storage/...)  เฉพาะไฟล์ที่ make public แล้ว
+	// signed url ของ local driver ใช้ route /v1/files/signed/* แทน bucket (ตรวจ signature ไม่ใช้ jwt)
+	if filesStorages.StorageDriver(m.server.cfg.App().StorageDriver()) == filesStorages.LocalDriver {
+		if err := filesStorages.InitLocalStorage(m.server.cfg); err != nil {
+			log.Fatalf("init local storage failed: %v", err)
+		}
+		m.server.app.Static("/storage", m.server.cfg.App().StorageRoot(), fiber.Static{
+			Next: func(c *fiber.Ctx) bool {
+				return !filesStorages.LocalIsPublic(m.server.cfg, strings.TrimPrefix(c.Path(), "/storage/"))
+			},
+		})
+		router.Put("/signed/*", handler.LocalSignedFile)
+		router.Get("/signed/*", handler.LocalSignedFile)
+	}
+
+	// Orphan files gc  ไฟล์ใต้ APP_GC_PREFIXES ที่ไม่มี product / order ใช้  (admin สั่ง dry run ได้ + รันเองทุก APP_GC_INTERVAL)
+	router.Post("/orphans", m.mid.JwtAuth(), m.mid.Authorize(2), handler.CollectOrphans)
+	filesUsecases.StartOrphanCollector(usecase, m.server.cfg.App().GcInterval())
+
+	// Outbox worker  ลบไฟล์ที่ค้างจาก transaction (ลบ / แก้รูป product) จนกว่าจะสำเร็จ
+	filesUsecases.StartOutboxWorker(usecase, m.server.cfg.App().OutboxInterval())
+
+	// Files registry (admin)  ไฟล์ทั้งหมดใน bucket + product / order ที่ใช้อยู่
+	router.Get("/", m.mid.JwtAuth(), m.mid.Authorize(2), handler.FindFiles)
+	router.Get("/:file_id", m.mid.JwtAuth(), m.mid.Authorize(2), handler.FindOneFile)
 }
 
 // ============================================================ ProductsModule ===========================================
 func (m *moduleFactory) ProductsModule() {
-	filesUsecases := filesUsecases.FilesUsecase(m.server.cfg)
+	filesUsecases := filesUsecases.FilesUsecase(m.server.cfg, filesRepositories.FilesRepository(m.server.db))
 
 	repository := productsrepositories.ProductsRepository(m.server.db, m.server.cfg, filesUsecases)
 	usecase := productsUsecases.ProductsUsecase(repository)
@@ -144,26 +212,54 @@ func (m *moduleFactory) ProductsModule() {
 
 	router := m.router.Group("/products")
 
-	// FindOneProduct
+	// Admin  เห็นทุก status (draft, scheduled, archived)  ต้องอยู่ก่อน /:product_id
+	router.Get("/admin", m.mid.JwtAuth(), m.mid.Authorize(2), handler.FindProducts)
+	router.Get("/admin/export", m.mid.JwtAuth(), m.mid.Authorize(2), handler.ExportProducts)
+	router.Get("/admin/:product_id", m.mid.JwtAuth(), m.mid.Authorize(2), handler.FindOneProduct)
+	// Trash  ถังขยะ (Admin)  purge = ลบจริงที่เกิน APP_TRASH_RETENTION  (รันเองทุก APP_TRASH_INTERVAL)
+	router.Get("/trash", m.mid.JwtAuth(), m.mid.Authorize(2), handler.FindTrashProducts)
+	router.Post("/trash/purge", m.mid.JwtAuth(), m.mid.Authorize(2), handler.PurgeTrash)
+	productsUsecases.StartTrashPurger(usecase, m.server.cfg.App().TrashInterval())
+	// Price schedules  ตั้งราคาล่วงหน้า (Admin)  job ตั้งราคาให้ทุก APP_PRICE_INTERVAL
+	productsUsecases.StartPriceScheduler(usecase, m.server.cfg.App().PriceInterval())
+	// FindOneProduct  (published เท่านั้น)
 	router.Get("/:product_id", m.mid.ApiKeyAuth(), handler.FindOneProduct)
-	// FindProducts
+	// FindProducts  (published เท่านั้น)
 	router.Get("/", m.mid.ApiKeyAuth(), handler.FindProducts)
 	// AddProduct
 	router.Post("/", m.mid.JwtAuth(), m.mid.Authorize(2), handler.AddProducts)
+	// Import  เพิ่ม / แก้หลาย product จากไฟล์ csv, xlsx  (?dry_run=true = ตรวจอย่างเดียว)
+	router.Post("/import", m.mid.JwtAuth(), m.mid.Authorize(2), handler.ImportProducts)
 	// UpdateProduct
 	router.Patch("/:product_id", m.mid.JwtAuth(), m.mid.Authorize(2), handler.UpdateProducts)
-	// DELETE
+	// DELETE  (ย้ายลงถังขยะ)
 	router.Delete("/:product_id", m.mid.JwtAuth(), m.mid.Authorize(2), handler.DeleteProduct)
+	// Restore  เอาออกจากถังขยะ
+	router.Patch("/:product_id/restore", m.mid.JwtAuth(), m.mid.Authorize(2), handler.RestoreProduct)
+	// Revisions  ประวัติการแก้ + ย้อนกลับ (Admin)
+	router.Get("/:product_id/revisions", m.mid.JwtAuth(), m.mid.Authorize(2), handler.FindRevisions)
+	router.Post("/:product_id/revisions/:revision_id/rollback", m.mid.JwtAuth(), m.mid.Authorize(2), handler.RollbackRevision)
+	// Sale  ล้างราคาลด (ตั้งผ่าน POST / PATCH sale_price, sale_start_at, sale_end_at)
+	router.Delete("/:product_id/sale", m.mid.JwtAuth(), m.mid.Authorize(2), handler.ClearSale)
+	// Price schedules  เปลี่ยนราคาปกติล่วงหน้า (Admin)
+	router.Get("/:product_id/prices", m.mid.JwtAuth(), m.mid.Authorize(2), handler.FindPriceSchedules)
+	router.Post("/:product_id/prices", m.mid.JwtAuth(), m.mid.Authorize(2), handler.AddPriceSchedule)
+	router.Delete("/:product_id/prices/:schedule_id", m.mid.JwtAuth(), m.mid.Authorize(2), handler.DeletePriceSchedule)
+	// Reindex search  ตัดคำไทยของทุก product ใหม่ (Admin)
+	router.Post("/search/reindex", m.mid.JwtAuth(), m.mid.Authorize(2), handler.ReindexSearch)
 }
 
 // ============================================================ OdersModule ===========================================
 func (m *moduleFactory) OdersModule() {
-	filesUsecases := filesUsecases.FilesUsecase(m.server.cfg)
+	filesUsecases := filesUsecases.FilesUsecase(m.server.cfg, filesRepositories.FilesRepository(m.server.db))
 	productRepository := productsrepositories.ProductsRepository(m.server.db, m.server.cfg, filesUsecases)
 
 	repository := odersRepositories.OdersRepository(m.server.db)
-	usecase := odersUsecases.OdersUsecase(repository, productRepository)
-	handler := odersHandlers.OdersHandler(m.server.cfg, usecase)
+	usecase := odersUsecases.OdersUsecase(m.server.cfg, repository, productRepository, filesUsecases)
+	handler := odersHandlers.OdersHandler(m.server.cfg, usecase, filesUsecases)
+
+	// สลิปเก่าที่เป็น public link ย้ายไปเก็บแบบ private (ครั้งเดียวตอน start)
+	odersUsecases.StartSlipMigration(usecase)
 
 	router := m.router.Group("/orders")
 
@@ -178,4 +274,24 @@ func (m *moduleFactory) OdersModule() {
 
 	// Update Order
 	router.Patch("/:user_id/:order_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), handler.UpdateOrder)
+
+	// Transfer Slip (private)  เจ้าของ order หรือ admin
+	router.Post("/:user_id/:order_id/transfer-slip", m.mid.JwtAuth(), m.mid.ParamsCheck(), handler.UploadTransferSlip)
+	router.Get("/:user_id/:order_id/transfer-slip", m.mid.JwtAuth(), m.mid.ParamsCheck(), handler.FindTransferSlip)
+}
+
+// ============================================================ InventoryModule ===========================================
+// ============================  /v1/inventory/ =================================
+func (m *moduleFactory) InventoryModule() {
+	repository := inventoryRepositories.InventoryRepository(m.server.db)
+	usecase := inventoryUsecases.InventoryUsecase(repository)
+	handler := inventoryHandlers.InventoryHandler(usecase)
+
+	router := m.router.Group("/inventory")
+
+	// Movement ledger  reserve / release / sale / adjust ทุกรายการ (Admin)
+	router.Get("/movements", m.mid.JwtAuth(), m.mid.Authorize(2), handler.FindMovements)
+
+	// Adjust stock  เติม / ลด stock ของ product หรือ variant (Admin)
+	router.Post("/adjust", m.mid.JwtAuth(), m.mid.Authorize(2), handler.AdjustStock)
 }
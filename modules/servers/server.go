@@ -32,6 +32,10 @@ func NewServer(cfg config.IConfig, db *sqlx.DB) IServer {
 			WriteTimeout: cfg.App().WriteTimeout(),
 			JSONEncoder:  json.Marshal,
 			JSONDecoder:  json.Unmarshal,
+
+			// upload ไฟล์อ่าน body เป็น stream (ไม่โหลดทั้งก้อนลง memory)  ขนาด body ตรวจใน middleware BodyLimit
+			StreamRequestBody:            true,
+			DisablePreParseMultipartForm: true,
 		}),
 	}
 }
@@ -42,6 +46,7 @@ func (s *server) Start() {
 	middlewares := InitMiddlewares(s)
 	s.app.Use(middlewares.Logger())
 	s.app.Use(middlewares.Cors()) //คือคำสั่งที่สั่งให้ middleware ถูกประยุกค์ใช้ กับ endpoint ทั้งหมด
+	s.app.Use(middlewares.BodyLimit("/v1/files/upload", "/v1/files/tus/", "/v1/files/signed/"))
 
 	//Modules
 	v1 := s.app.Group("v1")
@@ -52,6 +57,7 @@ func (s *server) Start() {
 	modules.FilesModule()
 	modules.ProductsModule()
 	modules.OdersModule()
+	modules.InventoryModule()
 	//RouterCheck
 	s.app.Use(middlewares.RouterCheck())
 
@@ -0,0 +1,7 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Image variants   url ของรูปที่ย่อแล้ว  {"thumbnail": "...", "medium": "...", "large": "..."}
+ALTER TABLE "images" ADD COLUMN "variants" jsonb NOT NULL DEFAULT '{}'::jsonb;
+
+COMMIT;
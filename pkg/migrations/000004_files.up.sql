@@ -0,0 +1,23 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Files registry   1 row ต่อ 1 object ใน bucket  (ไม่รวมรูปย่อ)
+--referenced_by ไม่ได้เก็บในตาราง  คำนวณตอน query จาก images.url และ orders.transfer_slip->>'destination'
+CREATE TABLE "files" (
+  "id" uuid NOT NULL UNIQUE PRIMARY KEY DEFAULT uuid_generate_v4(),
+  "key" VARCHAR NOT NULL UNIQUE,
+  "filename" VARCHAR NOT NULL,
+  "size" BIGINT NOT NULL DEFAULT 0,
+  "mime" VARCHAR NOT NULL DEFAULT '',
+  "checksum" VARCHAR NOT NULL DEFAULT '',
+  "private" BOOLEAN NOT NULL DEFAULT FALSE,
+  "user_id" VARCHAR,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+ALTER TABLE "files" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE SET NULL;
+
+CREATE INDEX "files_checksum_idx" ON "files" ("checksum");
+CREATE INDEX "files_user_id_idx" ON "files" ("user_id");
+
+COMMIT;
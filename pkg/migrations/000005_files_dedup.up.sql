@@ -0,0 +1,10 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Files dedup   ไฟล์เนื้อหาเดียวกัน (checksum) ใน folder เดียวกันใช้ object เดียว
+--ref_count = จำนวนครั้งที่ upload ได้ object นี้  ลบ blob จริงเมื่อเหลือ 0
+--variants  = url ของรูปย่อ  ใช้ตอนคืนผล upload ที่ซ้ำ และตอนลบ
+ALTER TABLE "files" ADD COLUMN "ref_count" INT NOT NULL DEFAULT 1;
+ALTER TABLE "files" ADD COLUMN "variants" jsonb NOT NULL DEFAULT '{}'::jsonb;
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Transactional outbox   event ที่ต้องทำนอก database (เช่น ลบไฟล์ใน bucket) commit พร้อมกับ transaction ที่สร้าง event
+--worker ดึง event ที่ถึงเวลา (next_attempt_at) ไปทำ  สำเร็จ = ลบ row,  ไม่สำเร็จ = attempts + 1 แล้วเลื่อน next_attempt_at (backoff)
+CREATE TABLE "outbox" (
+  "id" uuid NOT NULL UNIQUE PRIMARY KEY DEFAULT uuid_generate_v4(),
+  "event_type" VARCHAR NOT NULL,
+  "payload" jsonb NOT NULL DEFAULT '{}'::jsonb,
+  "attempts" INT NOT NULL DEFAULT 0,
+  "last_error" VARCHAR NOT NULL DEFAULT '',
+  "next_attempt_at" TIMESTAMP NOT NULL DEFAULT now(),
+  "created_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "outbox_next_attempt_at_idx" ON "outbox" ("event_type", "next_attempt_at");
+
+COMMIT;
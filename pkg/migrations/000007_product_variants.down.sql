@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE "products_orders" DROP COLUMN IF EXISTS "variant";
+ALTER TABLE "products_orders" DROP COLUMN IF EXISTS "variant_id";
+ALTER TABLE "images" DROP COLUMN IF EXISTS "variant_id";
+
+DROP TRIGGER IF EXISTS set_updated_at_timestamp_product_variants_table ON "product_variants";
+DROP TABLE IF EXISTS "product_variants" CASCADE;
+
+COMMIT;
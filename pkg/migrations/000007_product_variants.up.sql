@@ -0,0 +1,32 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Product variants   1 product มีหลายแบบ (ไซส์, สี)  แต่ละแบบมี SKU, ราคา, stock ของตัวเอง
+--options = {"size": "M", "color": "red"}   price NULL = ใช้ราคาของ product
+CREATE TABLE "product_variants" (
+  "id" uuid NOT NULL UNIQUE PRIMARY KEY DEFAULT uuid_generate_v4(),
+  "product_id" VARCHAR NOT NULL,
+  "sku" VARCHAR NOT NULL UNIQUE,
+  "options" jsonb NOT NULL DEFAULT '{}'::jsonb,
+  "price" FLOAT CHECK ("price" >= 0),
+  "stock" INT NOT NULL DEFAULT 0 CHECK ("stock" >= 0),
+  "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+  "updated_at" TIMESTAMP NOT NULL DEFAULT now(),
+  UNIQUE ("product_id", "options")
+);
+
+ALTER TABLE "product_variants" ADD FOREIGN KEY ("product_id") REFERENCES "products" ("id") ON DELETE CASCADE;
+
+CREATE TRIGGER set_updated_at_timestamp_product_variants_table BEFORE UPDATE ON "product_variants" FOR EACH ROW EXECUTE PROCEDURE set_updated_at_column();
+
+--รูปของ variant อยู่ในตาราง images เหมือนรูป product  (variant_id NULL = รูปของ product)
+ALTER TABLE "images" ADD COLUMN "variant_id" uuid;
+ALTER TABLE "images" ADD FOREIGN KEY ("variant_id") REFERENCES "product_variants" ("id") ON DELETE CASCADE;
+CREATE INDEX "images_variant_id_idx" ON "images" ("variant_id");
+
+--order อ้างถึง variant ที่ซื้อ  variant = ข้อมูล ณ ตอนสั่ง (เหมือน product)
+ALTER TABLE "products_orders" ADD COLUMN "variant_id" uuid;
+ALTER TABLE "products_orders" ADD COLUMN "variant" jsonb;
+ALTER TABLE "products_orders" ADD FOREIGN KEY ("variant_id") REFERENCES "product_variants" ("id") ON DELETE SET NULL;
+
+COMMIT;
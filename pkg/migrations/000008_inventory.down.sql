@@ -0,0 +1,12 @@
+BEGIN;
+
+DROP TABLE IF EXISTS "inventory_movements" CASCADE;
+
+ALTER TABLE "product_variants" DROP CONSTRAINT IF EXISTS "product_variants_reserved_check";
+ALTER TABLE "product_variants" DROP COLUMN IF EXISTS "reserved";
+
+ALTER TABLE "products" DROP CONSTRAINT IF EXISTS "products_stock_check";
+ALTER TABLE "products" DROP COLUMN IF EXISTS "reserved";
+ALTER TABLE "products" DROP COLUMN IF EXISTS "stock";
+
+COMMIT;
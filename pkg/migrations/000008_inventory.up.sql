@@ -0,0 +1,35 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Inventory   stock = ของที่มีอยู่จริง,  reserved = ถูกจองโดย order ที่ยังไม่จบ   ขายได้ = stock - reserved
+--product ที่มี variant ใช้ stock ของ variant  (stock ของ product ไม่ถูกใช้)
+ALTER TABLE "products" ADD COLUMN "stock" INT NOT NULL DEFAULT 0;
+ALTER TABLE "products" ADD COLUMN "reserved" INT NOT NULL DEFAULT 0;
+ALTER TABLE "products" ADD CONSTRAINT "products_stock_check" CHECK ("reserved" >= 0 AND "reserved" <= "stock");
+
+ALTER TABLE "product_variants" ADD COLUMN "reserved" INT NOT NULL DEFAULT 0;
+ALTER TABLE "product_variants" ADD CONSTRAINT "product_variants_reserved_check" CHECK ("reserved" >= 0 AND "reserved" <= "stock");
+
+--====================================================================================================================================================
+--Inventory movements (ledger)   1 row ต่อการเปลี่ยน stock / reserved 1 ครั้ง
+--type: reserve = จองตอนสั่ง, release = คืนตอน cancel, sale = ตัด stock ตอน completed, adjust = admin ปรับ stock (qty ติดลบได้)
+--stock, reserved = ค่าหลังรายการนี้   ไม่มี foreign key  ประวัติต้องอยู่แม้ product / variant / order ถูกลบ
+CREATE TABLE "inventory_movements" (
+  "id" uuid NOT NULL UNIQUE PRIMARY KEY DEFAULT uuid_generate_v4(),
+  "product_id" VARCHAR NOT NULL,
+  "variant_id" uuid,
+  "sku" VARCHAR NOT NULL DEFAULT '',
+  "order_id" VARCHAR,
+  "type" VARCHAR NOT NULL,
+  "qty" INT NOT NULL,
+  "stock" INT NOT NULL,
+  "reserved" INT NOT NULL,
+  "note" VARCHAR NOT NULL DEFAULT '',
+  "user_id" VARCHAR,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "inventory_movements_product_id_idx" ON "inventory_movements" ("product_id", "created_at");
+CREATE INDEX "inventory_movements_order_id_idx" ON "inventory_movements" ("order_id");
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Product 1 ตัวอยู่ได้หลาย category   ห้ามคู่ (product, category) ซ้ำ  ลบแถวซ้ำที่มีอยู่ก่อน
+DELETE FROM "products_categories" "a"
+  USING "products_categories" "b"
+WHERE "a"."product_id" = "b"."product_id"
+  AND "a"."category_id" = "b"."category_id"
+  AND "a"."id"::TEXT > "b"."id"::TEXT;
+
+ALTER TABLE "products_categories" ADD CONSTRAINT "products_categories_product_id_category_id_key" UNIQUE ("product_id", "category_id");
+
+--filter product ตาม category
+CREATE INDEX "products_categories_category_id_idx" ON "products_categories" ("category_id");
+
+COMMIT;
@@ -0,0 +1,22 @@
+BEGIN;
+
+DROP INDEX IF EXISTS "categories_parent_id_idx";
+DROP INDEX IF EXISTS "categories_parent_id_title_key";
+--ชื่อซ้ำคนละ parent ใส่ UNIQUE ("title") ไม่ได้  ตัวแรก (id น้อยสุด) ใช้ชื่อเดิม  ตัวอื่นต่อท้ายด้วย id  "เสื้อ (12)"
+UPDATE "categories" SET
+  "title" = "categories"."title" || ' (' || "categories"."id" || ')'
+FROM (
+  SELECT
+    "id",
+    ROW_NUMBER() OVER (PARTITION BY "title" ORDER BY "id") AS "n"
+  FROM "categories"
+) AS "d"
+WHERE "categories"."id" = "d"."id"
+  AND "d"."n" > 1;
+ALTER TABLE "categories" ADD CONSTRAINT "categories_title_key" UNIQUE ("title");
+
+ALTER TABLE "categories" DROP CONSTRAINT IF EXISTS "categories_parent_id_check";
+ALTER TABLE "categories" DROP COLUMN IF EXISTS "position";
+ALTER TABLE "categories" DROP COLUMN IF EXISTS "parent_id";
+
+COMMIT;
@@ -0,0 +1,27 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Category tree   parent_id NULL = root,  position = ลำดับในระดับเดียวกัน (0, 1, 2, ...)
+ALTER TABLE "categories" ADD COLUMN "parent_id" INT;
+ALTER TABLE "categories" ADD COLUMN "position" INT NOT NULL DEFAULT 0;
+ALTER TABLE "categories" ADD FOREIGN KEY ("parent_id") REFERENCES "categories" ("id") ON DELETE SET NULL;
+ALTER TABLE "categories" ADD CONSTRAINT "categories_parent_id_check" CHECK ("parent_id" <> "id");
+
+--category เดิมทั้งหมดเป็น root  เรียงตาม id
+UPDATE "categories" SET
+  "position" = "o"."position"
+FROM (
+  SELECT
+    "id",
+    ROW_NUMBER() OVER (ORDER BY "id") - 1 AS "position"
+  FROM "categories"
+) AS "o"
+WHERE "categories"."id" = "o"."id";
+
+--ชื่อซ้ำได้ถ้าอยู่คนละ parent  (เสื้อ ใต้ ผู้ชาย / ผู้หญิง)
+ALTER TABLE "categories" DROP CONSTRAINT IF EXISTS "categories_title_key";
+CREATE UNIQUE INDEX "categories_parent_id_title_key" ON "categories" (COALESCE("parent_id", 0), "title");
+
+CREATE INDEX "categories_parent_id_idx" ON "categories" ("parent_id", "position");
+
+COMMIT;
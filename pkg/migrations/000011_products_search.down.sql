@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP INDEX IF EXISTS "products_search_idx";
+DROP TRIGGER IF EXISTS set_search_products_table ON "products";
+DROP FUNCTION IF EXISTS set_products_search_column();
+
+ALTER TABLE "products" DROP COLUMN IF EXISTS "search";
+ALTER TABLE "products" DROP COLUMN IF EXISTS "description_tokens";
+ALTER TABLE "products" DROP COLUMN IF EXISTS "title_tokens";
+
+COMMIT;
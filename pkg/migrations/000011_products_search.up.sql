@@ -0,0 +1,27 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Product search (full-text)   search = tsvector ของ title (A) + description (B)  ดูแลโดย trigger
+--ภาษาไทยไม่มีช่องว่างระหว่างคำ  app ตัดคำแล้วเก็บใน title_tokens / description_tokens (คั่นด้วย space)
+ALTER TABLE "products" ADD COLUMN "title_tokens" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "products" ADD COLUMN "description_tokens" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "products" ADD COLUMN "search" tsvector;
+
+CREATE OR REPLACE FUNCTION set_products_search_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search =
+        setweight(to_tsvector('simple', COALESCE(NEW.title, '') || ' ' || COALESCE(NEW.title_tokens, '')), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(NEW.description, '') || ' ' || COALESCE(NEW.description_tokens, '')), 'B');
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER set_search_products_table BEFORE INSERT OR UPDATE OF "title", "description", "title_tokens", "description_tokens" ON "products" FOR EACH ROW EXECUTE PROCEDURE set_products_search_column();
+
+--product เดิม  (คำไทยยังไม่ถูกตัด จนกว่าจะ POST /v1/products/search/reindex)
+UPDATE "products" SET "title_tokens" = '';
+
+CREATE INDEX "products_search_idx" ON "products" USING GIN ("search");
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS "orders_created_at_id_idx";
+DROP INDEX IF EXISTS "products_price_id_idx";
+DROP INDEX IF EXISTS "products_title_id_idx";
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Keyset (cursor) pagination  WHERE (key, id) > ($1, $2) ORDER BY key, id  ใช้ index ได้ทั้ง 2 ทิศ
+CREATE INDEX "products_title_id_idx" ON "products" ("title", "id");
+CREATE INDEX "products_price_id_idx" ON "products" ("price", "id");
+CREATE INDEX "orders_created_at_id_idx" ON "orders" ("created_at", "id");
+
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP INDEX IF EXISTS "products_status_idx";
+ALTER TABLE "products"
+  DROP CONSTRAINT IF EXISTS "products_publish_window_check",
+  DROP COLUMN IF EXISTS "unpublish_at",
+  DROP COLUMN IF EXISTS "publish_at",
+  DROP COLUMN IF EXISTS "status";
+DROP TYPE IF EXISTS "product_status";
+
+COMMIT;
@@ -0,0 +1,22 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Product Status  scheduled ไม่ได้เก็บ = published ที่ publish_at ยังไม่ถึง (คำนวณตอน query)
+CREATE TYPE "product_status" AS ENUM(
+    'draft',
+    'published',
+    'archived'
+);
+
+--product เดิมยังแสดงอยู่ = published   product ใหม่ = draft
+ALTER TABLE "products"
+  ADD COLUMN "status" product_status NOT NULL DEFAULT 'published',
+  ADD COLUMN "publish_at" TIMESTAMPTZ,
+  ADD COLUMN "unpublish_at" TIMESTAMPTZ,
+  ADD CONSTRAINT "products_publish_window_check" CHECK ("publish_at" IS NULL OR "unpublish_at" IS NULL OR "unpublish_at" > "publish_at");
+
+ALTER TABLE "products" ALTER COLUMN "status" SET DEFAULT 'draft';
+
+CREATE INDEX "products_status_idx" ON "products" ("status");
+
+COMMIT;
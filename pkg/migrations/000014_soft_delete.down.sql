@@ -0,0 +1,15 @@
+BEGIN;
+
+--ของในถังขยะหายไปพร้อมกับ column
+DELETE FROM "products" WHERE "deleted_at" IS NOT NULL;
+DELETE FROM "categories" WHERE "deleted_at" IS NOT NULL;
+
+DROP INDEX IF EXISTS "categories_parent_id_title_key";
+CREATE UNIQUE INDEX "categories_parent_id_title_key" ON "categories" (COALESCE("parent_id", 0), "title");
+
+DROP INDEX IF EXISTS "categories_deleted_at_idx";
+DROP INDEX IF EXISTS "products_deleted_at_idx";
+ALTER TABLE "categories" DROP COLUMN IF EXISTS "deleted_at";
+ALTER TABLE "products" DROP COLUMN IF EXISTS "deleted_at";
+
+COMMIT;
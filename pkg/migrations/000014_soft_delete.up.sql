@@ -0,0 +1,15 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Soft delete   deleted_at NULL = ใช้งานอยู่,  มีค่า = อยู่ในถังขยะ (กู้คืนได้)  job ลบจริงเมื่อเกิน APP_TRASH_RETENTION
+ALTER TABLE "products" ADD COLUMN "deleted_at" TIMESTAMP;
+ALTER TABLE "categories" ADD COLUMN "deleted_at" TIMESTAMP;
+
+CREATE INDEX "products_deleted_at_idx" ON "products" ("deleted_at") WHERE "deleted_at" IS NOT NULL;
+CREATE INDEX "categories_deleted_at_idx" ON "categories" ("deleted_at") WHERE "deleted_at" IS NOT NULL;
+
+--ชื่อซ้ำใน parent เดียวกันห้ามเฉพาะ category ที่ใช้งานอยู่  (ลบแล้วสร้างชื่อเดิมใหม่ได้)
+DROP INDEX IF EXISTS "categories_parent_id_title_key";
+CREATE UNIQUE INDEX "categories_parent_id_title_key" ON "categories" (COALESCE("parent_id", 0), "title") WHERE "deleted_at" IS NULL;
+
+COMMIT;
@@ -0,0 +1,23 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Product revisions   1 row ต่อการแก้ product 1 ครั้ง  เก็บเฉพาะ field ที่เปลี่ยน (title, description, price, status, publish_at, unpublish_at)
+--action: update = แก้ผ่าน PATCH /products/:id,  rollback = ย้อนกลับไปค่า before ของ revision rollback_of
+--user_id ไม่มี foreign key  ประวัติต้องอยู่แม้ user ถูกลบ   product ถูก purge = ลบประวัติตาม
+CREATE TABLE "product_revisions" (
+  "id" BIGSERIAL PRIMARY KEY,
+  "product_id" VARCHAR NOT NULL,
+  "user_id" VARCHAR NOT NULL DEFAULT '',
+  "action" VARCHAR NOT NULL DEFAULT 'update',
+  "rollback_of" BIGINT,
+  "before" jsonb NOT NULL DEFAULT '{}'::jsonb,
+  "after" jsonb NOT NULL DEFAULT '{}'::jsonb,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+ALTER TABLE "product_revisions" ADD FOREIGN KEY ("product_id") REFERENCES "products" ("id") ON DELETE CASCADE;
+ALTER TABLE "product_revisions" ADD FOREIGN KEY ("rollback_of") REFERENCES "product_revisions" ("id") ON DELETE SET NULL;
+
+CREATE INDEX "product_revisions_product_id_idx" ON "product_revisions" ("product_id", "id");
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+UPDATE "products_orders" SET "product" = "product" - 'currency'
+WHERE jsonb_typeof("product") = 'object';
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "currency";
+
+ALTER TABLE "product_variants" ALTER COLUMN "price" TYPE FLOAT USING "price"::FLOAT;
+
+ALTER TABLE "products" DROP COLUMN IF EXISTS "currency";
+ALTER TABLE "products" ALTER COLUMN "price" TYPE FLOAT USING "price"::FLOAT;
+
+COMMIT;
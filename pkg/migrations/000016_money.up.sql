@@ -0,0 +1,41 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Money   ราคาเก็บเป็น NUMERIC(14, 2) แทน FLOAT  (บวก / คูณสตางค์ไม่เพี้ยน)  ค่าเดิมปัดเป็นทศนิยม 2 ตำแหน่ง
+--currency = ISO 4217  ราคาของ variant ใช้สกุลของ product   order 1 ใบ = 1 สกุล
+ALTER TABLE "products" ALTER COLUMN "price" TYPE NUMERIC(14, 2) USING ROUND("price"::NUMERIC, 2);
+ALTER TABLE "products" ADD COLUMN "currency" VARCHAR(3) NOT NULL DEFAULT 'THB';
+
+ALTER TABLE "product_variants" ALTER COLUMN "price" TYPE NUMERIC(14, 2) USING ROUND("price"::NUMERIC, 2);
+
+ALTER TABLE "orders" ADD COLUMN "currency" VARCHAR(3) NOT NULL DEFAULT 'THB';
+
+--product / variant ที่เก็บไว้ใน order (jsonb)  ราคาปัด 2 ตำแหน่ง + currency  (total_paid รวมจากตรงนี้)
+UPDATE "products_orders" SET
+  "product" = jsonb_set(
+    "product",
+    '{price}',
+    to_jsonb(ROUND(COALESCE(("product"->>'price')::NUMERIC, 0), 2))
+  ) || '{"currency": "THB"}'::jsonb
+WHERE "product" IS NOT NULL
+  AND jsonb_typeof("product") = 'object';
+
+UPDATE "products_orders" SET
+  "variant" = jsonb_set(
+    "variant",
+    '{price}',
+    to_jsonb(ROUND(("variant"->>'price')::NUMERIC, 2))
+  )
+WHERE "variant" IS NOT NULL
+  AND jsonb_typeof("variant"->'price') = 'number';
+
+--ประวัติราคาใน product_revisions
+UPDATE "product_revisions" SET
+  "before" = jsonb_set("before", '{price}', to_jsonb(ROUND(("before"->>'price')::NUMERIC, 2)))
+WHERE jsonb_typeof("before"->'price') = 'number';
+
+UPDATE "product_revisions" SET
+  "after" = jsonb_set("after", '{price}', to_jsonb(ROUND(("after"->>'price')::NUMERIC, 2)))
+WHERE jsonb_typeof("after"->'price') = 'number';
+
+COMMIT;
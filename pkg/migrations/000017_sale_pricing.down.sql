@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP TABLE IF EXISTS "product_price_schedules" CASCADE;
+
+ALTER TABLE "products" DROP CONSTRAINT IF EXISTS "products_sale_window_check";
+ALTER TABLE "products" DROP COLUMN IF EXISTS "sale_end_at";
+ALTER TABLE "products" DROP COLUMN IF EXISTS "sale_start_at";
+ALTER TABLE "products" DROP COLUMN IF EXISTS "sale_price";
+
+COMMIT;
@@ -0,0 +1,29 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Sale price   ราคาลดช่วงเวลา  sale_start_at / sale_end_at NULL = ไม่มีขอบ   ราคาที่ขายจริง (effective_price) คำนวณตอน query ไม่ต้องมี job คืนราคา
+--price = ราคาปกติ (compare-at)  variant ที่ไม่ได้ตั้งราคาเองใช้ราคาลดของ product
+ALTER TABLE "products" ADD COLUMN "sale_price" NUMERIC(14, 2) CHECK ("sale_price" >= 0);
+ALTER TABLE "products" ADD COLUMN "sale_start_at" TIMESTAMPTZ;
+ALTER TABLE "products" ADD COLUMN "sale_end_at" TIMESTAMPTZ;
+
+ALTER TABLE "products" ADD CONSTRAINT "products_sale_window_check" CHECK ("sale_end_at" IS NULL OR "sale_start_at" IS NULL OR "sale_end_at" > "sale_start_at");
+
+--====================================================================================================================================================
+--Price schedules   เปลี่ยนราคาปกติ (price) ล่วงหน้า  job ตั้งราคาเมื่อถึง apply_at แล้วเก็บ applied_at + product_revisions (action schedule)
+CREATE TABLE "product_price_schedules" (
+  "id" BIGSERIAL PRIMARY KEY,
+  "product_id" VARCHAR NOT NULL,
+  "price" NUMERIC(14, 2) NOT NULL CHECK ("price" >= 0),
+  "apply_at" TIMESTAMPTZ NOT NULL,
+  "applied_at" TIMESTAMPTZ,
+  "user_id" VARCHAR NOT NULL DEFAULT '',
+  "created_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+ALTER TABLE "product_price_schedules" ADD FOREIGN KEY ("product_id") REFERENCES "products" ("id") ON DELETE CASCADE;
+
+CREATE INDEX "product_price_schedules_product_id_idx" ON "product_price_schedules" ("product_id", "apply_at");
+CREATE INDEX "product_price_schedules_pending_idx" ON "product_price_schedules" ("apply_at") WHERE "applied_at" IS NULL;
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Files gc   acquired_at = ครั้งล่าสุดที่ upload / dedup (AcquireFile) ได้ไฟล์นี้
+--gc lock row (FOR UPDATE) แล้วข้ามไฟล์ที่ถูก acquire ภายใน APP_GC_GRACE_PERIOD  ไม่ลบไฟล์ที่เพิ่งมีคนได้ไปใช้
+ALTER TABLE "files" ADD COLUMN "acquired_at" TIMESTAMP NOT NULL DEFAULT now();
+UPDATE "files" SET "acquired_at" = "created_at";
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Track inventory   product ที่มีก่อนเปิดระบบ stock มี stock = 0 (default)  ถ้านับ stock เลย = ขายไม่ได้ทั้งร้าน
+--track_inventory = FALSE ---> ไม่จอง / ไม่ตัด stock (ขายได้ไม่จำกัดเหมือนก่อนมี inventory)
+--product ที่มี ledger แล้ว (ตั้ง stock ตอนสร้าง / adjust) = นับ stock,  ที่เหลือเริ่มนับเมื่อ admin /inventory/adjust ครั้งแรก
+--product ใหม่นับ stock ตั้งแต่สร้าง (default TRUE)   variant ตั้ง stock ตอนสร้างเสมอ นับทุกตัว
+ALTER TABLE "products" ADD COLUMN "track_inventory" BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE "products" "p" SET "track_inventory" = TRUE
+WHERE EXISTS (
+  SELECT 1
+  FROM "inventory_movements" "m"
+  WHERE "m"."product_id" = "p"."id"
+    AND "m"."variant_id" IS NULL
+);
+ALTER TABLE "products" ALTER COLUMN "track_inventory" SET DEFAULT TRUE;
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE "products" DROP CONSTRAINT IF EXISTS "products_sale_price_check";
+
+COMMIT;
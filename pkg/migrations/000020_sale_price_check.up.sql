@@ -0,0 +1,14 @@
+BEGIN;
+
+--====================================================================================================================================================
+--Sale price check   price = ราคาปกติ (compare-at) ต้องสูงกว่า sale_price เสมอ  ไม่งั้น effective_price สูงกว่าราคาปกติ
+--row เดิมที่ชนกัน (schedule ลดราคาลงต่ำกว่า sale) ล้าง sale ทิ้ง ก่อนใส่ check
+UPDATE "products" SET
+  "sale_price" = NULL,
+  "sale_start_at" = NULL,
+  "sale_end_at" = NULL
+WHERE "sale_price" >= "price";
+
+ALTER TABLE "products" ADD CONSTRAINT "products_sale_price_check" CHECK ("sale_price" IS NULL OR "sale_price" < "price");
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS "products_price_id_idx" ON "products" ("price", "id");
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+--====================================================================================================================================================
+--เรียงตาม price ใช้ราคาที่ขายจริง (sale_price ในช่วงลดราคา = CASE ตาม now())  index ("price", "id") ไม่ถูกใช้
+DROP INDEX IF EXISTS "products_price_id_idx";
+
+COMMIT;
@@ -0,0 +1,189 @@
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ----------Flow
+//    Amount = จำนวนเต็มหน่วยย่อย 1/100 (สตางค์, cent)  ตรงกับ NUMERIC(14, 2) ใน database  บวก / คูณไม่มีเศษทศนิยมเพี้ยน
+//    json   : ตัวเลขทศนิยม 2 ตำแหน่ง (150.50)  รับได้ทั้งตัวเลขและ string  แปลงจากข้อความตรงๆ ไม่ผ่าน float64
+//    sql    : Value ---> "150.50" ,  Scan <--- NUMERIC (string / []byte)
+//    currency เก็บแยก column (ISO 4217)  Amount ไม่รู้ว่าเป็นสกุลไหน
+
+// Scale จำนวนตำแหน่งทศนิยมที่เก็บ  (NUMERIC(14, 2))
+const Scale = 2
+
+// Max ค่าสูงสุดที่ NUMERIC(14, 2) เก็บได้  (999,999,999,999.99)
+const Max Amount = 99999999999999
+
+const DefaultCurrency = "THB"
+
+// Currencies สกุลเงินที่รองรับ ---> จำนวนทศนิยมที่ใช้ได้จริง  (JPY ไม่มีเศษ)
+var Currencies = map[string]int{
+	"THB": 2,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"SGD": 2,
+	"JPY": 0,
+}
+
+var (
+	ErrInvalidAmount   = errors.New("amount must be a decimal number with at most 2 decimal places")
+	ErrAmountRange     = errors.New("amount is out of range")
+	ErrInvalidCurrency = errors.New("currency is not supported")
+)
+
+// Amount เงินเป็นหน่วยย่อย 1/100
+type Amount int64
+
+// Parse "150", "150.5", "150.50", "-3.25"  ---> Amount  (ทศนิยมเกิน 2 ตำแหน่ง, exponent = error)
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	if negative || strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || len(frac) > Scale || !digits(whole) || !digits(frac) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	// ทศนิยม 150.5 ---> 150.50
+	frac += strings.Repeat("0", Scale-len(frac))
+
+	whole = strings.TrimLeft(whole, "0")
+	if len(whole) > 12 {
+		return 0, fmt.Errorf("%w: %q", ErrAmountRange, s)
+	}
+	v, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if negative {
+		v = -v
+	}
+	return Amount(v), nil
+}
+
+// digits ตัวเลข 0-9 ล้วน  ("" = ผ่าน)
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String 150.50  (ทศนิยม 2 ตำแหน่งเสมอ)
+func (a Amount) String() string {
+	v := int64(a)
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+// Float64 ใช้แสดงผลเท่านั้น (เช่น number cell ใน xlsx)  ห้ามเอาไปคำนวณต่อ
+func (a Amount) Float64() float64 {
+	f, _ := strconv.ParseFloat(a.String(), 64)
+	return f
+}
+
+// Mul ราคา x จำนวน
+func (a Amount) Mul(qty int) Amount {
+	return a * Amount(qty)
+}
+
+// MarshalJSON ตัวเลข 150.50
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON รับ 150.5 หรือ "150.50"  (null = 0)
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		*a = 0
+		return nil
+	}
+	if s, err := strconv.Unquote(string(data)); err == nil {
+		data = []byte(s)
+	}
+	v, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// UnmarshalText query string  ?min_price=99.50
+func (a *Amount) UnmarshalText(text []byte) error {
+	v, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// Value เก็บลง NUMERIC เป็นข้อความ  (ไม่ผ่าน float)
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan อ่านจาก NUMERIC
+func (a *Amount) Scan(src any) error {
+	switch data := src.(type) {
+	case nil:
+		*a = 0
+		return nil
+	case []byte:
+		return a.UnmarshalText(data)
+	case string:
+		return a.UnmarshalText([]byte(data))
+	case int64:
+		*a = Amount(data * 100)
+		return nil
+	default:
+		return fmt.Errorf("scan amount failed: unsupported type %T", src)
+	}
+}
+
+// Validate currency ที่รองรับ  ค่าไม่ติดลบ ไม่เกิน Max  และไม่มีเศษที่สกุลนั้นไม่มี (JPY)
+func Validate(a Amount, currency string) error {
+	decimals, ok := Currencies[currency]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrInvalidCurrency, currency)
+	}
+	if a < 0 || a > Max {
+		return fmt.Errorf("%w: %s", ErrAmountRange, a)
+	}
+	if decimals < Scale {
+		unit := Amount(1)
+		for i := decimals; i < Scale; i++ {
+			unit *= 10
+		}
+		if a%unit != 0 {
+			return fmt.Errorf("%s amount must have at most %d decimal places", currency, decimals)
+		}
+	}
+	return nil
+}
+
+// NormalizeCurrency ตัวพิมพ์ใหญ่  ว่าง = DefaultCurrency
+func NormalizeCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultCurrency
+	}
+	return currency
+}
@@ -26,16 +26,44 @@ CREATE TABLE "products" (
   "id" varchar PRIMARY KEY,
   "title" varchar,
   "description" varchar,
-  "price" float,
+  "price" numeric(14,2),
+  "currency" varchar(3),
+  "sale_price" numeric(14,2),
+  "sale_start_at" timestamptz,
+  "sale_end_at" timestamptz,
+  "stock" int,
+  "reserved" int,
+  "track_inventory" boolean,
+  "title_tokens" text,
+  "description_tokens" text,
+  "search" tsvector,
+  "status" varchar,
+  "publish_at" timestamptz,
+  "unpublish_at" timestamptz,
   "created_at" timestamp,
-  "updated_at" timestamp
+  "updated_at" timestamp,
+  "deleted_at" timestamp
 );
 
 CREATE TABLE "images" (
   "id" varchar PRIMARY KEY,
   "filename" varchar,
   "url" varchar,
+  "variants" jsonb,
   "product_id" varchar,
+  "variant_id" varchar,
+  "created_at" timestamp,
+  "updated_at" timestamp
+);
+
+CREATE TABLE "product_variants" (
+  "id" varchar PRIMARY KEY,
+  "product_id" varchar,
+  "sku" varchar UNIQUE,
+  "options" jsonb,
+  "price" numeric(14,2),
+  "stock" int,
+  "reserved" int,
   "created_at" timestamp,
   "updated_at" timestamp
 );
@@ -48,7 +76,10 @@ CREATE TABLE "products_categories" (
 
 CREATE TABLE "categories" (
   "id" int PRIMARY KEY,
-  "title" varchar UNIQUE
+  "title" varchar,
+  "parent_id" int,
+  "position" int,
+  "deleted_at" timestamp
 );
 
 CREATE TABLE "orders" (
@@ -58,6 +89,7 @@ CREATE TABLE "orders" (
   "address" varchar,
   "tranfer_slip" json,
   "status" varchar,
+  "currency" varchar(3),
   "created_at" timestamp,
   "updated_at" timestamp
 );
@@ -66,7 +98,70 @@ CREATE TABLE "products_orders" (
   "id" varchar PRIMARY KEY,
   "qty" int,
   "order_id" varchar,
-  "product" jsonb
+  "product" jsonb,
+  "variant_id" varchar,
+  "variant" jsonb
+);
+
+CREATE TABLE "files" (
+  "id" varchar PRIMARY KEY,
+  "key" varchar UNIQUE,
+  "filename" varchar,
+  "size" bigint,
+  "mime" varchar,
+  "checksum" varchar,
+  "private" boolean,
+  "ref_count" int,
+  "variants" jsonb,
+  "user_id" varchar,
+  "created_at" timestamp,
+  "acquired_at" timestamp
+);
+
+CREATE TABLE "outbox" (
+  "id" varchar PRIMARY KEY,
+  "event_type" varchar,
+  "payload" jsonb,
+  "attempts" int,
+  "last_error" varchar,
+  "next_attempt_at" timestamp,
+  "created_at" timestamp
+);
+
+CREATE TABLE "inventory_movements" (
+  "id" varchar PRIMARY KEY,
+  "product_id" varchar,
+  "variant_id" varchar,
+  "sku" varchar,
+  "order_id" varchar,
+  "type" varchar,
+  "qty" int,
+  "stock" int,
+  "reserved" int,
+  "note" varchar,
+  "user_id" varchar,
+  "created_at" timestamp
+);
+
+CREATE TABLE "product_revisions" (
+  "id" bigserial PRIMARY KEY,
+  "product_id" varchar,
+  "user_id" varchar,
+  "action" varchar,
+  "rollback_of" bigint,
+  "before" jsonb,
+  "after" jsonb,
+  "created_at" timestamp
+);
+
+CREATE TABLE "product_price_schedules" (
+  "id" bigserial PRIMARY KEY,
+  "product_id" varchar,
+  "price" numeric(14,2),
+  "apply_at" timestamptz,
+  "applied_at" timestamptz,
+  "user_id" varchar,
+  "created_at" timestamp
 );
 
 ALTER TABLE "users" ADD FOREIGN KEY ("role_id") REFERENCES "roles" ("id");
@@ -75,6 +170,18 @@ ALTER TABLE "oauth" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
 
 ALTER TABLE "images" ADD FOREIGN KEY ("product_id") REFERENCES "products" ("id");
 
+ALTER TABLE "images" ADD FOREIGN KEY ("variant_id") REFERENCES "product_variants" ("id");
+
+ALTER TABLE "product_variants" ADD FOREIGN KEY ("product_id") REFERENCES "products" ("id");
+
+ALTER TABLE "categories" ADD FOREIGN KEY ("parent_id") REFERENCES "categories" ("id");
+
+ALTER TABLE "product_revisions" ADD FOREIGN KEY ("product_id") REFERENCES "products" ("id");
+
+ALTER TABLE "product_revisions" ADD FOREIGN KEY ("rollback_of") REFERENCES "product_revisions" ("id");
+
+ALTER TABLE "product_price_schedules" ADD FOREIGN KEY ("product_id") REFERENCES "products" ("id");
+
 ALTER TABLE "products_categories" ADD FOREIGN KEY ("product_id") REFERENCES "products" ("id");
 
 ALTER TABLE "products_categories" ADD FOREIGN KEY ("category_id") REFERENCES "categories" ("id");
@@ -82,3 +189,7 @@ ALTER TABLE "products_categories" ADD FOREIGN KEY ("category_id") REFERENCES "ca
 ALTER TABLE "orders" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
 
 ALTER TABLE "products_orders" ADD FOREIGN KEY ("order_id") REFERENCES "orders" ("id");
+
+ALTER TABLE "products_orders" ADD FOREIGN KEY ("variant_id") REFERENCES "product_variants" ("id");
+
+ALTER TABLE "files" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
@@ -0,0 +1,109 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ----------Flow
+//    index : title, description ---> ThaiTokens (คำไทยที่ตัดแล้ว + คำย่อย คั่นด้วย space) ---> เก็บใน products.*_tokens ---> trigger สร้าง tsvector
+//    query : คำค้น ---> terms (ไทยตัดคำ, อังกฤษแยกตาม space) ---> TsQuery (prefix match ทุกคำ  คำประสมตรงทั้งคำ หรือครบทุกคำย่อย)
+
+// terms แยกคำค้นเป็นคำ  ภาษาไทยตัดคำด้วย dictionary  ภาษาอื่นแยกตามช่องว่าง/เครื่องหมาย  (ตัวเล็ก, ไม่ซ้ำ)
+func terms(text string) []string {
+	result := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(term string) {
+		if term == "" || seen[term] {
+			return
+		}
+		seen[term] = true
+		result = append(result, term)
+	}
+
+	for _, word := range splitWords(strings.ToLower(text)) {
+		if !isThaiWord(word) {
+			add(word)
+			continue
+		}
+		for _, term := range Segment(word) {
+			add(term)
+		}
+	}
+	return result
+}
+
+// ThaiTokens คำไทยใน text ที่ตัดแล้ว + คำย่อยของคำประสม คั่นด้วย space  (ภาษาอื่น tsvector แยกเองได้ ไม่ต้องเก็บซ้ำ)
+func ThaiTokens(text string) string {
+	tokens := make([]string, 0)
+	for _, word := range splitWords(strings.ToLower(text)) {
+		if !isThaiWord(word) {
+			continue
+		}
+		for _, token := range Segment(word) {
+			tokens = append(tokens, token)
+			if parts := Split(token); len(parts) > 1 {
+				tokens = append(tokens, parts...)
+			}
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+// TsQuery query สำหรับ to_tsquery('simple', ...)  ทุกคำต้องเจอ (&) แบบ prefix (:*)  ไม่มีคำ = ""
+//
+//	รองเท้าวิ่ง ดำ ---> ( รองเท้าวิ่ง:* | รอง:* & เท้า:* & วิ่ง:* ) & ดำ:*
+func TsQuery(text string) string {
+	query := make([]string, 0)
+	for _, term := range terms(text) {
+		parts := Split(term)
+		if !isThaiWord(term) || len(parts) < 2 {
+			query = append(query, term+":*")
+			continue
+		}
+		for i := range parts {
+			parts[i] += ":*"
+		}
+		query = append(query, fmt.Sprintf("( %s:* | %s )", term, strings.Join(parts, " & ")))
+	}
+	return strings.Join(query, " & ")
+}
+
+// splitWords ตัดตามตัวที่ไม่ใช่ตัวอักษร/ตัวเลข  (สระบน-ล่าง, วรรณยุกต์ = ตัวอักษร)  ตัวอักษรไทยกับอังกฤษติดกัน = แยกคำ
+func splitWords(text string) []string {
+	words := make([]string, 0)
+	var b strings.Builder
+	var thai bool
+	flush := func() {
+		if b.Len() > 0 {
+			words = append(words, b.String())
+			b.Reset()
+		}
+	}
+
+	for _, r := range text {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r) {
+			flush()
+			continue
+		}
+		if b.Len() > 0 && isThai(r) != thai {
+			flush()
+		}
+		thai = isThai(r)
+		b.WriteRune(r)
+	}
+	flush()
+	return words
+}
+
+func isThai(r rune) bool {
+	return r >= 0x0E00 && r <= 0x0E7F
+}
+
+func isThaiWord(word string) bool {
+	for _, r := range word {
+		return isThai(r)
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package search
+
+import (
+	_ "embed"
+	"strings"
+)
+
+// ตัดคำไทยแบบ maximal matching  (เลือกแบบที่คำที่ไม่รู้จักน้อยที่สุด แล้วจำนวนคำน้อยที่สุด)
+// dictionary = thaiwords.txt  เพิ่มคำได้ด้วย AddWords  คำที่ไม่อยู่ใน dictionary จะรวมเป็นก้อนเดียว (ไม่ตัดกลางพยางค์)
+// คำประสม (รองเท้าวิ่ง) แตกต่อเป็นคำย่อยได้ด้วย Split (รอง เท้า วิ่ง)  ใช้ค้นแบบไม่ต้องตรงทั้งคำ
+
+//go:embed thaiwords.txt
+var thaiWords string
+
+var (
+	dictionary = make(map[string]bool)
+	maxWordLen int
+)
+
+func init() {
+	AddWords(strings.Split(thaiWords, "\n")...)
+}
+
+// AddWords เพิ่มคำใน dictionary  (เรียกตอน start server เท่านั้น ไม่ lock)
+func AddWords(words ...string) {
+	for _, w := range words {
+		w = strings.TrimSpace(w)
+		if w == "" || strings.HasPrefix(w, "#") {
+			continue
+		}
+		dictionary[w] = true
+		if n := len([]rune(w)); n > maxWordLen {
+			maxWordLen = n
+		}
+	}
+}
+
+type segmentCost struct {
+	unknown int // จำนวนตัวอักษรที่ไม่อยู่ใน dictionary
+	tokens  int
+	prev    int
+	known   bool
+}
+
+// less fine = ได้คำเยอะที่สุด (คำย่อย),  ไม่ fine = ได้คำน้อยที่สุด (คำยาวสุด)
+func (c segmentCost) less(o segmentCost, fine bool) bool {
+	if c.unknown != o.unknown {
+		return c.unknown < o.unknown
+	}
+	if fine {
+		return c.tokens > o.tokens
+	}
+	return c.tokens < o.tokens
+}
+
+// Segment ตัดคำไทย 1 ก้อน (ไม่มีช่องว่าง) เป็นคำที่ยาวที่สุดใน dictionary
+func Segment(text string) []string {
+	return segment(text, false)
+}
+
+// Split แตกคำไทยเป็นคำย่อยที่สุดใน dictionary  (แตกไม่ได้ = คำเดิม 1 คำ)
+func Split(word string) []string {
+	return segment(word, true)
+}
+
+func segment(text string, fine bool) []string {
+	runes := []rune(text)
+	n := len(runes)
+	if n == 0 {
+		return nil
+	}
+
+	costs := make([]*segmentCost, n+1)
+	costs[0] = &segmentCost{}
+	for i := 0; i < n; i++ {
+		if costs[i] == nil {
+			continue
+		}
+		relax := func(j int, known bool) {
+			next := segmentCost{
+				unknown: costs[i].unknown,
+				tokens:  costs[i].tokens + 1,
+				prev:    i,
+				known:   known,
+			}
+			if !known {
+				next.unknown += j - i
+			}
+			if costs[j] == nil || next.less(*costs[j], fine) {
+				costs[j] = &next
+			}
+		}
+
+		for j := i + 1; j <= n && j-i <= maxWordLen; j++ {
+			if isBoundary(runes, j) && dictionary[string(runes[i:j])] {
+				relax(j, true)
+			}
+		}
+		// ไม่รู้จัก = ข้ามไป 1 พยางค์ (ถึงตำแหน่งที่ตัดได้ถัดไป)
+		j := i + 1
+		for j < n && !isBoundary(runes, j) {
+			j++
+		}
+		relax(j, false)
+	}
+
+	// ย้อนกลับ (ท้าย ---> หน้า)
+	type segment struct {
+		start, end int
+		known      bool
+	}
+	segments := make([]segment, 0)
+	for j := n; j > 0; j = costs[j].prev {
+		segments = append(segments, segment{costs[j].prev, j, costs[j].known})
+	}
+
+	// คำที่ไม่รู้จักติดกันรวมเป็นคำเดียว
+	words := make([]string, 0, len(segments))
+	for k := len(segments) - 1; k >= 0; k-- {
+		seg := segments[k]
+		for !seg.known && k > 0 && !segments[k-1].known {
+			k--
+			seg.end = segments[k].end
+		}
+		words = append(words, string(runes[seg.start:seg.end]))
+	}
+	return words
+}
+
+// isBoundary ตัดคำก่อน runes[i] ได้ไหม  ห้ามตัดหน้าสระบน-ล่าง/วรรณยุกต์/สระตามหลัง และหลังสระนำ (เ แ โ ใ ไ)
+func isBoundary(runes []rune, i int) bool {
+	if i <= 0 || i >= len(runes) {
+		return true
+	}
+	switch r := runes[i]; {
+	case r == 0x0E30, r == 0x0E31, r >= 0x0E32 && r <= 0x0E3A, r == 0x0E45, r >= 0x0E47 && r <= 0x0E4E:
+		return false
+	}
+	if r := runes[i-1]; r >= 0x0E40 && r <= 0x0E44 {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,214 @@
+package sheets
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ----------Flow
+//    read  : ไฟล์ .csv / .xlsx ---> Read ---> แถว [][]string (sheet แรกของ xlsx,  ค่าดิบไม่ผ่าน number format)
+//    write : แถว [][]any ---> Write / NewWriter (ทีละแถว) ---> csv (มี BOM ให้ Excel อ่านภาษาไทยได้) / xlsx
+//    ช่องข้อความที่ขึ้นต้นเหมือนสูตร (= + - @) ใส่ ' นำหน้า กัน formula injection  Read ตัดออกให้
+
+const (
+	CSV  = "csv"
+	XLSX = "xlsx"
+)
+
+var ErrUnsupportedFormat = errors.New("file format must be csv or xlsx")
+
+// utf8Bom ไฟล์ csv ที่ save จาก Excel ขึ้นต้นด้วย BOM
+const utf8Bom = "\ufeff"
+
+// Format จากนามสกุลไฟล์  .csv, .xlsx
+func Format(filename string) (string, error) {
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), ".")) {
+	case CSV:
+		return CSV, nil
+	case XLSX:
+		return XLSX, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// ContentType ของไฟล์ที่ export
+func ContentType(format string) string {
+	if format == XLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Read ทุกแถวของไฟล์  แถวที่สั้นกว่าหัวตาราง = ช่องท้ายว่าง
+func Read(format string, r io.Reader) ([][]string, error) {
+	switch format {
+	case CSV:
+		reader := bufio.NewReader(r)
+		if bom, err := reader.Peek(len(utf8Bom)); err == nil && string(bom) == utf8Bom {
+			reader.Discard(len(utf8Bom))
+		}
+		csvReader := csv.NewReader(reader)
+		csvReader.FieldsPerRecord = -1
+		rows, err := csvReader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("read csv failed: %v", err)
+		}
+		return unescapeRows(rows), nil
+	case XLSX:
+		f, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("open xlsx failed: %v", err)
+		}
+		defer f.Close()
+
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return [][]string{}, nil
+		}
+		rows, err := f.GetRows(sheets[0], excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, fmt.Errorf("read xlsx failed: %v", err)
+		}
+		return unescapeRows(rows), nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// unescapeRows ตัด ' ที่ Write ใส่กันสูตรออก  ไฟล์ที่ export แล้ว import กลับได้ค่าเดิม
+func unescapeRows(rows [][]string) [][]string {
+	for _, row := range rows {
+		for i, cell := range row {
+			row[i] = unescapeText(cell)
+		}
+	}
+	return rows
+}
+
+// Write แถวทั้งหมดลง w  (แถวแรก = หัวตาราง)  ตัวเลขใน xlsx เป็น number cell
+func Write(w io.Writer, format string, rows [][]any) error {
+	writer, err := NewWriter(w, format)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// ======================================= Writer ============================================
+// IWriter เขียนทีละแถว  export ใหญ่ไม่ต้องเก็บทุกแถวไว้ใน memory   Close = เขียนส่วนท้ายไฟล์ (ต้องเรียกเสมอ)
+type IWriter interface {
+	WriteRow(row []any) error
+	Close() error
+}
+
+// NewWriter csv เขียนลง w ทันที,  xlsx ใช้ stream writer ของ excelize (แถวเกิน buffer ลง temp file) แล้วเขียนลง w ตอน Close
+func NewWriter(w io.Writer, format string) (IWriter, error) {
+	switch format {
+	case CSV:
+		if _, err := io.WriteString(w, utf8Bom); err != nil {
+			return nil, err
+		}
+		return &csvWriter{writer: csv.NewWriter(w)}, nil
+	case XLSX:
+		f := excelize.NewFile()
+		stream, err := f.NewStreamWriter(f.GetSheetName(0))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("write xlsx failed: %v", err)
+		}
+		return &xlsxWriter{w: w, file: f, stream: stream}, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (c *csvWriter) WriteRow(row []any) error {
+	record := make([]string, len(row))
+	for i, cell := range row {
+		switch v := cell.(type) {
+		case nil:
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64) // ไม่เอา 1e+06
+		case string:
+			record[i] = escapeText(v)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	if err := c.writer.Write(record); err != nil {
+		return fmt.Errorf("write csv failed: %v", err)
+	}
+	return nil
+}
+
+func (c *csvWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type xlsxWriter struct {
+	w      io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	rows   int
+}
+
+func (x *xlsxWriter) WriteRow(row []any) error {
+	x.rows++
+	cell, err := excelize.CoordinatesToCellName(1, x.rows)
+	if err != nil {
+		return err
+	}
+	values := make([]any, len(row))
+	for i, v := range row {
+		if text, ok := v.(string); ok {
+			v = escapeText(text)
+		}
+		values[i] = v
+	}
+	if err := x.stream.SetRow(cell, values); err != nil {
+		return fmt.Errorf("write xlsx failed: %v", err)
+	}
+	return nil
+}
+
+func (x *xlsxWriter) Close() error {
+	defer x.file.Close()
+	if err := x.stream.Flush(); err != nil {
+		return fmt.Errorf("write xlsx failed: %v", err)
+	}
+	return x.file.Write(x.w)
+}
+
+// ======================================= Formula injection =================================
+// ช่องข้อความที่ขึ้นต้นด้วย = + - @ (tab, CR) โปรแกรม spreadsheet อ่านเป็นสูตร  ใส่ ' นำหน้าตอนเขียน  Read ตัดออกให้
+const formulaChars = "=+-@\t\r"
+
+func escapeText(v string) string {
+	if v != "" && strings.ContainsRune(formulaChars, rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+func unescapeText(v string) string {
+	if len(v) > 1 && v[0] == '\'' && strings.ContainsRune(formulaChars, rune(v[1])) {
+		return v[1:]
+	}
+	return v
+}